@@ -1,11 +1,13 @@
 package ble
 
 import (
-	"io"
+	"net"
 )
 
+// ClientRFCOMM is a DLC to a server channel of a remote device. Its addresses are NetAddrs, and its deadlines make
+// the pending reads and writes fail with os.ErrDeadlineExceeded.
 type ClientRFCOMM interface {
 	Client
 
-	io.ReadWriter
+	net.Conn
 }
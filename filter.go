@@ -0,0 +1,118 @@
+package ble
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"strings"
+)
+
+// And returns a filter matching advertisements that match f and all of fs.
+// A nil filter matches every advertisement.
+func (f AdvFilter) And(fs ...AdvFilter) AdvFilter {
+	fs = append([]AdvFilter{f}, fs...)
+	return func(a Advertisement) bool {
+		for _, f := range fs {
+			if f != nil && !f(a) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a filter matching advertisements that match f or any of fs.
+// A nil filter matches every advertisement.
+func (f AdvFilter) Or(fs ...AdvFilter) AdvFilter {
+	fs = append([]AdvFilter{f}, fs...)
+	return func(a Advertisement) bool {
+		for _, f := range fs {
+			if f == nil || f(a) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a filter matching advertisements that f does not match.
+func (f AdvFilter) Not() AdvFilter {
+	return func(a Advertisement) bool {
+		return f != nil && !f(a)
+	}
+}
+
+// FilterService matches advertisements listing any of the service UUIDs,
+// either in the service lists or as service data.
+func FilterService(uuids ...UUID) AdvFilter {
+	return func(a Advertisement) bool {
+		for _, u := range uuids {
+			if Contains(a.Services(), u) {
+				return true
+			}
+			for _, sd := range a.ServiceData() {
+				if sd.UUID.Equal(u) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// FilterNamePrefix matches advertisements whose local name starts with prefix.
+func FilterNamePrefix(prefix string) AdvFilter {
+	return func(a Advertisement) bool {
+		return strings.HasPrefix(a.LocalName(), prefix)
+	}
+}
+
+// FilterNameRegexp matches advertisements whose local name matches re.
+func FilterNameRegexp(re *regexp.Regexp) AdvFilter {
+	return func(a Advertisement) bool {
+		return re.MatchString(a.LocalName())
+	}
+}
+
+// FilterManufacturer matches advertisements carrying manufacturer data for
+// the company id whose payload, following the company id, starts with prefix.
+func FilterManufacturer(id uint16, prefix []byte) AdvFilter {
+	return func(a Advertisement) bool {
+		md := a.ManufacturerData()
+		if len(md) < 2 || binary.LittleEndian.Uint16(md) != id {
+			return false
+		}
+		return bytes.HasPrefix(md[2:], prefix)
+	}
+}
+
+// FilterAddress matches advertisements sent from any of the addresses.
+func FilterAddress(addrs ...Addr) AdvFilter {
+	return func(a Advertisement) bool {
+		if a.Address() == nil {
+			return false
+		}
+		s := a.Address().String()
+		for _, addr := range addrs {
+			if strings.EqualFold(addr.String(), s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterMinRSSI matches advertisements received with a signal strength of at
+// least rssi dBm.
+func FilterMinRSSI(rssi int) AdvFilter {
+	return func(a Advertisement) bool {
+		return a.RSSI() >= rssi
+	}
+}
+
+// FilterConnectable matches advertisements from connectable peripherals.
+func FilterConnectable() AdvFilter {
+	return func(a Advertisement) bool {
+		return a.Connectable()
+	}
+}
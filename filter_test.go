@@ -0,0 +1,63 @@
+package ble
+
+import (
+	"regexp"
+	"testing"
+)
+
+type testAdv struct {
+	name        string
+	md          []byte
+	services    []UUID
+	rssi        int
+	addr        Addr
+	connectable bool
+}
+
+func (a testAdv) LocalName() string          { return a.name }
+func (a testAdv) ManufacturerData() []byte   { return a.md }
+func (a testAdv) ServiceData() []ServiceData { return nil }
+func (a testAdv) Services() []UUID           { return a.services }
+func (a testAdv) OverflowService() []UUID    { return nil }
+func (a testAdv) TxPowerLevel() int          { return 0 }
+func (a testAdv) Connectable() bool          { return a.connectable }
+func (a testAdv) SolicitedService() []UUID   { return nil }
+func (a testAdv) RSSI() int                  { return a.rssi }
+func (a testAdv) Address() Addr              { return a.addr }
+func (a testAdv) AddressType() AddressType   { return AddressTypePublic }
+
+func TestFilters(t *testing.T) {
+	a := testAdv{
+		name:        "Sensor-42",
+		md:          []byte{0x4C, 0x00, 0x02, 0x15, 0x01},
+		services:    []UUID{UUID16(0x180D)},
+		rssi:        -60,
+		addr:        NewAddr("AA:BB:CC:DD:EE:FF"),
+		connectable: true,
+	}
+	tests := []struct {
+		name     string
+		f        AdvFilter
+		expected bool
+	}{
+		{"service", FilterService(UUID16(0x180F), UUID16(0x180D)), true},
+		{"missing service", FilterService(UUID16(0x180F)), false},
+		{"name prefix", FilterNamePrefix("Sensor"), true},
+		{"name regexp", FilterNameRegexp(regexp.MustCompile(`-\d+$`)), true},
+		{"manufacturer", FilterManufacturer(0x004C, []byte{0x02, 0x15}), true},
+		{"manufacturer payload", FilterManufacturer(0x004C, []byte{0x03}), false},
+		{"other manufacturer", FilterManufacturer(0x0059, nil), false},
+		{"address", FilterAddress(NewAddr("11:22:33:44:55:66"), NewAddr("aa:bb:cc:dd:ee:ff")), true},
+		{"rssi", FilterMinRSSI(-70), true},
+		{"weak rssi", FilterMinRSSI(-50), false},
+		{"connectable", FilterConnectable(), true},
+		{"and", FilterNamePrefix("Sensor").And(FilterMinRSSI(-50)), false},
+		{"or", FilterNamePrefix("Beacon").Or(FilterMinRSSI(-70)), true},
+		{"not", FilterConnectable().Not(), false},
+	}
+	for _, test := range tests {
+		if received := test.f(a); received != test.expected {
+			t.Fatalf("%s: Expected: %t, Received: %t", test.name, test.expected, received)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package deadline implements the read and write deadlines of the connections of the library, as net.Conn specifies
+// them.
+package deadline
+
+import (
+	"sync"
+	"time"
+)
+
+// Deadline is a read or write deadline: the channel Done returns is closed once it passes, until it is set again.
+// The zero value has no deadline.
+type Deadline struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	ch    chan struct{}
+}
+
+// Set sets the deadline, or clears it if t is zero.
+func (d *Deadline) Set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		// The timer fired, the deadline passed: waits after this one use a new channel.
+		d.ch = nil
+	}
+	d.timer = nil
+	if d.ch != nil {
+		select {
+		case <-d.ch:
+			d.ch = nil
+		default:
+		}
+	}
+	if d.ch == nil {
+		d.ch = make(chan struct{})
+	}
+	if t.IsZero() {
+		return
+	}
+	ch := d.ch
+	if dur := time.Until(t); dur > 0 {
+		d.timer = time.AfterFunc(dur, func() { close(ch) })
+		return
+	}
+	close(ch)
+}
+
+// Done returns a channel closed once the deadline passes.
+func (d *Deadline) Done() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ch == nil {
+		d.ch = make(chan struct{})
+	}
+	return d.ch
+}
@@ -0,0 +1,42 @@
+package deadline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	var d Deadline
+	select {
+	case <-d.Done():
+		t.Fatalf("Expected: no deadline, Received: done")
+	default:
+	}
+
+	d.Set(time.Now().Add(20 * time.Millisecond))
+	select {
+	case <-d.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the deadline")
+	}
+
+	// A deadline set again, or cleared, after it passed no longer is.
+	d.Set(time.Now().Add(time.Hour))
+	select {
+	case <-d.Done():
+		t.Fatalf("Expected: deadline in an hour, Received: done")
+	default:
+	}
+	d.Set(time.Now().Add(-time.Second))
+	select {
+	case <-d.Done():
+	default:
+		t.Fatalf("Expected: deadline passed, Received: not done")
+	}
+	d.Set(time.Time{})
+	select {
+	case <-d.Done():
+		t.Fatalf("Expected: no deadline, Received: done")
+	default:
+	}
+}
@@ -0,0 +1,345 @@
+package adv
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/thomascriley/ble"
+)
+
+// maxFieldDataLength is the largest payload a single field can carry: a full
+// packet minus the length and type octets.
+const maxFieldDataLength = MaxEIRPacketLength - 2
+
+// FieldKind identifies the kind of field added to a Builder.
+type FieldKind int
+
+// Kinds of fields handled by the Builder.
+const (
+	FieldFlags FieldKind = iota
+	FieldService
+	FieldManufacturerData
+	FieldServiceData
+	FieldAppearance
+	FieldTxPower
+	FieldName
+)
+
+func (k FieldKind) String() string {
+	switch k {
+	case FieldFlags:
+		return "flags"
+	case FieldService:
+		return "service"
+	case FieldManufacturerData:
+		return "manufacturer data"
+	case FieldServiceData:
+		return "service data"
+	case FieldAppearance:
+		return "appearance"
+	case FieldTxPower:
+		return "tx power"
+	case FieldName:
+		return "local name"
+	}
+	return fmt.Sprintf("field kind %d", int(k))
+}
+
+// Dropped describes a field that fit in neither the advertising packet nor the
+// scan response.
+type Dropped struct {
+	Kind FieldKind
+	UUID ble.UUID // service uuid for FieldService and FieldServiceData
+	ID   uint16   // company identifier for FieldManufacturerData
+	Data []byte   // field payload, excluding any uuid or company identifier
+}
+
+func (d Dropped) String() string {
+	switch d.Kind {
+	case FieldService:
+		return fmt.Sprintf("%s %s", d.Kind, d.UUID)
+	case FieldServiceData:
+		return fmt.Sprintf("%s %s: %X", d.Kind, d.UUID, d.Data)
+	case FieldManufacturerData:
+		return fmt.Sprintf("%s 0x%04X: %X", d.Kind, d.ID, d.Data)
+	}
+	return fmt.Sprintf("%s: %X", d.Kind, d.Data)
+}
+
+// Payload is the result of a Builder: the advertising packet, the scan response
+// and an account of everything that had to be altered to make them fit.
+type Payload struct {
+	AD           *Packet
+	ScanResponse *Packet
+
+	// ShortenedName is set to the advertised name when the local name was
+	// shortened to fit.
+	ShortenedName string
+
+	// OverflowServices lists the service uuids that did not fit in the
+	// advertising packet and were carried in the scan response.
+	OverflowServices []ble.UUID
+
+	// Dropped lists the fields that were left out of both packets.
+	Dropped []Dropped
+}
+
+type manufacturer struct {
+	id   uint16
+	data []byte
+}
+
+// Builder assembles an advertising packet and scan response from a set of
+// fields. Fields are placed in the advertising packet while there is room and
+// spill over into the scan response otherwise. They are placed in the order
+// flags, service uuids, manufacturer data, service data, appearance, tx power
+// and local name, the name going last since it can be shortened to fill
+// whatever space remains.
+type Builder struct {
+	flags         byte
+	name          string
+	minNameLen    int
+	appearance    uint16
+	hasAppearance bool
+	txPower       int8
+	hasTxPower    bool
+	services      []ble.UUID
+	serviceData   []ble.ServiceData
+	manufacturers []manufacturer
+}
+
+// NewBuilder returns a Builder which advertises as general discoverable and
+// LE only.
+func NewBuilder() *Builder {
+	return &Builder{flags: FlagGeneralDiscoverable | FlagLEOnly, minNameLen: 1}
+}
+
+// SetFlags sets the advertising flags. Zero omits the flags field, as is
+// usual for non-connectable broadcasters.
+func (b *Builder) SetFlags(f byte) *Builder {
+	b.flags = f
+	return b
+}
+
+// SetName sets the local name.
+func (b *Builder) SetName(name string) *Builder {
+	b.name = name
+	return b
+}
+
+// SetMinNameLength sets the minimum number of bytes a shortened name may have.
+// A name which cannot be shortened to at least n bytes is dropped.
+func (b *Builder) SetMinNameLength(n int) *Builder {
+	b.minNameLen = n
+	return b
+}
+
+// SetAppearance sets the external appearance of the device.
+func (b *Builder) SetAppearance(a uint16) *Builder {
+	b.appearance, b.hasAppearance = a, true
+	return b
+}
+
+// SetTxPower sets the advertised tx power level in dBm.
+func (b *Builder) SetTxPower(pwr int8) *Builder {
+	b.txPower, b.hasTxPower = pwr, true
+	return b
+}
+
+// AddServices adds service uuids. Uuids are grouped by width into lists.
+func (b *Builder) AddServices(uuids ...ble.UUID) *Builder {
+	b.services = append(b.services, uuids...)
+	return b
+}
+
+// AddServiceData adds data associated with a service uuid.
+func (b *Builder) AddServiceData(u ble.UUID, data []byte) *Builder {
+	b.serviceData = append(b.serviceData, ble.ServiceData{UUID: u, Data: data})
+	return b
+}
+
+// AddManufacturerData adds manufacturer specific data for the company id.
+func (b *Builder) AddManufacturerData(id uint16, data []byte) *Builder {
+	b.manufacturers = append(b.manufacturers, manufacturer{id: id, data: data})
+	return b
+}
+
+// Validate reports fields which can never be advertised, whatever else is in
+// the packets. Build calls it before placing any field.
+func (b *Builder) Validate() error {
+	for _, u := range b.services {
+		if !validUUID(u) {
+			return fmt.Errorf("service uuid %s has %d bytes: %w", u, u.Len(), ErrInvalid)
+		}
+	}
+	for _, s := range b.serviceData {
+		if !validUUID(s.UUID) {
+			return fmt.Errorf("service data uuid %s has %d bytes: %w", s.UUID, s.UUID.Len(), ErrInvalid)
+		}
+		if l := s.UUID.Len() + len(s.Data); l > maxFieldDataLength {
+			return fmt.Errorf("service data for %s is %d bytes, at most %d fit: %w", s.UUID, l, maxFieldDataLength, ErrNotFit)
+		}
+	}
+	for _, m := range b.manufacturers {
+		if l := 2 + len(m.data); l > maxFieldDataLength {
+			return fmt.Errorf("manufacturer data for 0x%04X is %d bytes, at most %d fit: %w", m.id, l, maxFieldDataLength, ErrNotFit)
+		}
+	}
+	if b.minNameLen > maxFieldDataLength {
+		return fmt.Errorf("minimum name length %d exceeds %d: %w", b.minNameLen, maxFieldDataLength, ErrInvalid)
+	}
+	return nil
+}
+
+// Build validates the fields and splits them between the advertising packet
+// and the scan response.
+func (b *Builder) Build() (*Payload, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	ad, _ := NewPacket()
+	sr, _ := NewPacket()
+	p := &Payload{AD: ad, ScanResponse: sr}
+
+	if b.flags != 0 {
+		if err := ad.Append(Flags(b.flags)); err != nil {
+			return nil, err
+		}
+	}
+
+	var uuids16, uuids32, uuids128 []ble.UUID
+	for _, u := range b.services {
+		switch u.Len() {
+		case 2:
+			uuids16 = append(uuids16, u)
+		case 4:
+			uuids32 = append(uuids32, u)
+		default:
+			uuids128 = append(uuids128, u)
+		}
+	}
+	b.placeServices(p, uuids16, allUUID16, someUUID16)
+	b.placeServices(p, uuids32, allUUID32, someUUID32)
+	b.placeServices(p, uuids128, allUUID128, someUUID128)
+
+	for _, m := range b.manufacturers {
+		if !p.place(ManufacturerData(m.id, m.data)) {
+			p.Dropped = append(p.Dropped, Dropped{Kind: FieldManufacturerData, ID: m.id, Data: m.data})
+		}
+	}
+	for _, s := range b.serviceData {
+		if !p.place(ServiceData(s.UUID, s.Data)) {
+			p.Dropped = append(p.Dropped, Dropped{Kind: FieldServiceData, UUID: s.UUID, Data: s.Data})
+		}
+	}
+	if b.hasAppearance && !p.place(Appearance(b.appearance)) {
+		p.Dropped = append(p.Dropped, Dropped{Kind: FieldAppearance, Data: []byte{uint8(b.appearance), uint8(b.appearance >> 8)}})
+	}
+	if b.hasTxPower && !p.place(TxPower(b.txPower)) {
+		p.Dropped = append(p.Dropped, Dropped{Kind: FieldTxPower, Data: []byte{uint8(b.txPower)}})
+	}
+	if b.name != "" {
+		b.placeName(p)
+	}
+	return p, nil
+}
+
+// place appends the field to the advertising packet, or to the scan response
+// if it does not fit. It reports false if it fits in neither.
+func (p *Payload) place(f Field) bool {
+	return p.AD.Append(f) == nil || p.ScanResponse.Append(f) == nil
+}
+
+// placeServices places a list of uuids of the same width. A list that fits
+// in the advertising packet is advertised as complete. Otherwise as many uuids
+// as fit are advertised as an incomplete list, the remainder overflowing into
+// the scan response.
+func (b *Builder) placeServices(p *Payload, uuids []ble.UUID, all, some byte) {
+	if len(uuids) == 0 {
+		return
+	}
+	if p.AD.append(all, joinUUIDs(uuids)) == nil {
+		return
+	}
+	w := uuids[0].Len()
+	n := fieldCapacity(p.AD, w)
+	if n > 0 {
+		_ = p.AD.append(some, joinUUIDs(uuids[:n]))
+		uuids = uuids[n:]
+	}
+
+	m := fieldCapacity(p.ScanResponse, w)
+	if m > len(uuids) {
+		m = len(uuids)
+	}
+	if m > 0 {
+		typ := some
+		if n == 0 && m == len(uuids) {
+			// Nothing made it into the advertising packet, so the list
+			// in the scan response is the complete one.
+			typ = all
+		}
+		_ = p.ScanResponse.append(typ, joinUUIDs(uuids[:m]))
+		p.OverflowServices = append(p.OverflowServices, uuids[:m]...)
+	}
+	for _, u := range uuids[m:] {
+		p.Dropped = append(p.Dropped, Dropped{Kind: FieldService, UUID: u})
+	}
+}
+
+// placeName places the complete name in whichever packet has room for it, or
+// else shortens it to fill the scan response or the advertising packet.
+func (b *Builder) placeName(p *Payload) {
+	if p.place(CompleteName(b.name)) {
+		return
+	}
+	for _, pkt := range []*Packet{p.ScanResponse, p.AD} {
+		n := shorten(b.name, MaxEIRPacketLength-pkt.Len()-2)
+		if len(n) >= b.minNameLen && len(n) > 0 && pkt.Append(ShortName(n)) == nil {
+			p.ShortenedName = n
+			return
+		}
+	}
+	p.Dropped = append(p.Dropped, Dropped{Kind: FieldName, Data: []byte(b.name)})
+}
+
+// fieldCapacity returns the number of uuids of width w a new field in the
+// packet can hold.
+func fieldCapacity(p *Packet, w int) int {
+	free := MaxEIRPacketLength - p.Len() - 2
+	if free < 0 {
+		return 0
+	}
+	return free / w
+}
+
+// shorten truncates the name to at most n bytes without splitting a rune.
+func shorten(name string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(name) <= n {
+		return name
+	}
+	name = name[:n]
+	for len(name) > 0 && !utf8.ValidString(name) {
+		name = name[:len(name)-1]
+	}
+	return name
+}
+
+func joinUUIDs(uuids []ble.UUID) []byte {
+	var b []byte
+	for _, u := range uuids {
+		b = append(b, u...)
+	}
+	return b
+}
+
+func validUUID(u ble.UUID) bool {
+	switch u.Len() {
+	case 2, 4, 16:
+		return true
+	}
+	return false
+}
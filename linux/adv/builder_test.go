@@ -0,0 +1,111 @@
+package adv
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/thomascriley/ble"
+)
+
+func TestBuilderFitsAdvertisingPacket(t *testing.T) {
+	p, err := NewBuilder().
+		SetName("dev").
+		AddServices(ble.UUID16(0x180D), ble.UUID16(0x180F)).
+		SetTxPower(-4).
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []byte{
+		0x02, flags, FlagGeneralDiscoverable | FlagLEOnly,
+		0x05, allUUID16, 0x0D, 0x18, 0x0F, 0x18,
+		0x02, txPower, 0xFC,
+		0x04, completeName, 'd', 'e', 'v',
+	}
+	if !bytes.Equal(p.AD.Bytes(), expected) {
+		t.Fatalf("Expected: %X, Received: %X", expected, p.AD.Bytes())
+	}
+	if p.ScanResponse.Len() != 0 {
+		t.Fatalf("Expected empty scan response, Received: %X", p.ScanResponse.Bytes())
+	}
+	if pwr, ok := p.AD.TxPower(); !ok || pwr != -4 {
+		t.Fatalf("Expected: %d, Received: %d", -4, pwr)
+	}
+}
+
+func TestBuilderOverflowsServices(t *testing.T) {
+	u1 := ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7")
+	u2 := ble.MustParse("6E400001-B5A3-F393-E0A9-E50E24DCCA9E")
+	p, err := NewBuilder().AddServices(u1, u2).Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if b := p.AD.Field(someUUID128); !bytes.Equal(b, u1) {
+		t.Fatalf("Expected: %X, Received: %X", []byte(u1), b)
+	}
+	if b := p.ScanResponse.Field(someUUID128); !bytes.Equal(b, u2) {
+		t.Fatalf("Expected: %X, Received: %X", []byte(u2), b)
+	}
+	if len(p.OverflowServices) != 1 || !p.OverflowServices[0].Equal(u2) {
+		t.Fatalf("Expected overflow: [%s], Received: %v", u2, p.OverflowServices)
+	}
+	if len(p.Dropped) != 0 {
+		t.Fatalf("Expected nothing dropped, Received: %v", p.Dropped)
+	}
+}
+
+func TestBuilderShortensName(t *testing.T) {
+	md := bytes.Repeat([]byte{0xAA}, 24)
+	p, err := NewBuilder().
+		SetName("a rather long device name which does not fit").
+		AddManufacturerData(0x004C, md).
+		AddServiceData(ble.UUID16(0xFEAA), bytes.Repeat([]byte{0xBB}, 10)).
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if p.AD.ManufacturerData() == nil {
+		t.Fatalf("Expected manufacturer data in the advertising packet: %X", p.AD.Bytes())
+	}
+	if p.ScanResponse.ServiceData() == nil {
+		t.Fatalf("Expected service data in the scan response: %X", p.ScanResponse.Bytes())
+	}
+	if p.ShortenedName == "" || p.ScanResponse.LocalName() != p.ShortenedName {
+		t.Fatalf("Expected shortened name %q in scan response, Received: %q", p.ShortenedName, p.ScanResponse.LocalName())
+	}
+	if p.ScanResponse.Len() != MaxEIRPacketLength {
+		t.Fatalf("Expected: %d, Received: %d", MaxEIRPacketLength, p.ScanResponse.Len())
+	}
+}
+
+func TestBuilderReportsDropped(t *testing.T) {
+	md := bytes.Repeat([]byte{0xAA}, 24)
+	p, err := NewBuilder().
+		AddManufacturerData(0x0001, md).
+		AddManufacturerData(0x0002, md).
+		AddManufacturerData(0x0003, md).
+		SetAppearance(0x0340).
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(p.Dropped) != 2 {
+		t.Fatalf("Expected 2 dropped fields, Received: %v", p.Dropped)
+	}
+	if d := p.Dropped[0]; d.Kind != FieldManufacturerData || d.ID != 0x0003 {
+		t.Fatalf("Expected manufacturer data 0x0003 dropped, Received: %s", d)
+	}
+	if d := p.Dropped[1]; d.Kind != FieldAppearance {
+		t.Fatalf("Expected appearance dropped, Received: %s", d)
+	}
+}
+
+func TestBuilderValidate(t *testing.T) {
+	if _, err := NewBuilder().AddManufacturerData(0x004C, make([]byte, 28)).Build(); !errors.Is(err, ErrNotFit) {
+		t.Fatalf("Expected: %s, Received: %v", ErrNotFit, err)
+	}
+	if _, err := NewBuilder().AddServices(ble.UUID{0x01, 0x02, 0x03}).Build(); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected: %s, Received: %v", ErrInvalid, err)
+	}
+}
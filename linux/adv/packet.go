@@ -166,6 +166,36 @@ func ServiceData16(id uint16, b []byte) Field {
 	}
 }
 
+// ServiceData is service data for a 16, 32 or 128 bit service uuid. Unlike
+// ServiceData16, it does not add the uuid to the service list.
+func ServiceData(u ble.UUID, b []byte) Field {
+	return func(p *Packet) error {
+		switch u.Len() {
+		case 2:
+			return p.append(serviceData16, append(append([]byte{}, u...), b...))
+		case 4:
+			return p.append(serviceData32, append(append([]byte{}, u...), b...))
+		case 16:
+			return p.append(serviceData128, append(append([]byte{}, u...), b...))
+		}
+		return ErrInvalid
+	}
+}
+
+// Appearance is the external appearance of the device.
+func Appearance(a uint16) Field {
+	return func(p *Packet) error {
+		return p.append(appearance, []byte{uint8(a), uint8(a >> 8)})
+	}
+}
+
+// TxPower is the transmitted power level of the packet in dBm.
+func TxPower(pwr int8) Field {
+	return func(p *Packet) error {
+		return p.append(txPower, []byte{uint8(pwr)})
+	}
+}
+
 // Field returns the field data (excluding the initial length and typ byte).
 // It returns nil, if the specified field is not found.
 func (p *Packet) Field(typ byte) []byte {
@@ -235,12 +265,12 @@ func (p *Packet) fieldPos(typ byte, offset int) ([]byte, int) {
 }
 
 // Flags returns the flags of the packet.
-func (p *Packet) Flags() (flags byte, present bool) {
+func (p *Packet) Flags() (f byte, present bool) {
 	b := p.Field(flags)
-	if len(b) < 2 {
+	if len(b) < 1 {
 		return 0, false
 	}
-	return b[2], true
+	return b[0], true
 }
 
 // LocalName returns the ShortName or CompleteName if it presents.
@@ -254,13 +284,10 @@ func (p *Packet) LocalName() string {
 // TxPower returns the TxPower, if it presents.
 func (p *Packet) TxPower() (power int, present bool) {
 	b := p.Field(txPower)
-	if b == nil {
-		return 0, false
-	}
-	if len(b) < 3 {
+	if len(b) < 1 {
 		return 0, false
 	}
-	return int(int8(b[2])), true
+	return int(int8(b[0])), true
 }
 
 // UUIDs returns a list of service UUIDs.
@@ -305,6 +332,15 @@ func (p *Packet) ServiceData() []ble.ServiceData {
 	return s
 }
 
+// Appearance returns the appearance, if it presents.
+func (p *Packet) Appearance() (a uint16, present bool) {
+	b := p.Field(appearance)
+	if len(b) < 2 {
+		return 0, false
+	}
+	return uint16(b[0]) | uint16(b[1])<<8, true
+}
+
 // ManufacturerData returns the ManufacturerData field if it presents.
 func (p *Packet) ManufacturerData() []byte {
 	return p.Field(manufacturerData)
@@ -334,6 +370,6 @@ func serviceDataList(sd []ble.ServiceData, d []byte, w int) []ble.ServiceData {
 		UUID: ble.UUID(d[:w]),
 		Data: make([]byte, len(d)-w),
 	}
-	copy(serviceData.Data, d[2:])
+	copy(serviceData.Data, d[w:])
 	return append(sd, serviceData)
 }
@@ -0,0 +1,193 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+	"github.com/thomascriley/ble/log"
+)
+
+// AdvOption configures a single call to Device.AdvertiseWithOptions.
+type AdvOption func(*advConfig)
+
+// AdvMode selects the advertising PDU type [Vol 6, Part B, 2.3.1].
+type AdvMode uint8
+
+// Advertising modes.
+const (
+	// AdvConnectable advertises connectable and scannable undirected PDUs (ADV_IND).
+	AdvConnectable AdvMode = iota + 1
+
+	// AdvDirectedHighDuty advertises connectable PDUs directed to the peer (ADV_DIRECT_IND) every 3.75 ms or less.
+	// The controller stops after 1.28 s, and the advertising call then fails with hci.ErrDirAdvTimeout, if the peer
+	// did not connect.
+	AdvDirectedHighDuty
+
+	// AdvDirectedLowDuty advertises connectable PDUs directed to the peer (ADV_DIRECT_IND) at the advertising
+	// interval, until the peer connects.
+	AdvDirectedLowDuty
+
+	// AdvScannable advertises scannable undirected PDUs (ADV_SCAN_IND), for scan responses without connections.
+	AdvScannable
+
+	// AdvNonConnectable advertises non-connectable undirected PDUs (ADV_NONCONN_IND), such as beacons.
+	AdvNonConnectable
+)
+
+// advertising interval limits [Vol 2, Part E, 7.8.5]
+const (
+	advTimeUnit    = 625 * time.Microsecond
+	minAdvInterval = 0x0020 * advTimeUnit
+	maxAdvInterval = 0x4000 * advTimeUnit
+)
+
+// advertisingType returns the advertising type of the LE Set Advertising Parameters command.
+func (m AdvMode) advertisingType() uint8 {
+	switch m {
+	case AdvDirectedHighDuty:
+		return 0x01
+	case AdvScannable:
+		return 0x02
+	case AdvNonConnectable:
+		return 0x03
+	case AdvDirectedLowDuty:
+		return 0x04
+	default:
+		return 0x00
+	}
+}
+
+func (m AdvMode) directed() bool {
+	return m == AdvDirectedHighDuty || m == AdvDirectedLowDuty
+}
+
+type advConfig struct {
+	params cmd.LESetAdvertisingParameters
+	mode   AdvMode
+	peer   bool
+	err    error
+}
+
+// WithAdvMode selects the advertising mode. The directed modes require the peer to be set with WithPeer.
+func WithAdvMode(m AdvMode) AdvOption {
+	return func(c *advConfig) {
+		if m < AdvConnectable || m > AdvNonConnectable {
+			c.err = fmt.Errorf("invalid advertising mode %d", m)
+			return
+		}
+		c.mode = m
+		c.params.AdvertisingType = m.advertisingType()
+	}
+}
+
+// WithPeer sets the central the directed advertising modes advertise to, usually a bonded one.
+func WithPeer(a ble.Addr, addressType ble.AddressType) AdvOption {
+	return func(c *advConfig) {
+		addr, err := hci.BDAddr(a)
+		if err != nil {
+			c.err = fmt.Errorf("invalid peer address %s: %w", a, err)
+			return
+		}
+		c.params.DirectAddress = addr
+		c.params.DirectAddressType = uint8(addressType)
+		c.peer = true
+	}
+}
+
+// WithAdvInterval sets the range of the interval between advertising events, from 20 ms to 10.24 s. It does not
+// apply to high duty cycle directed advertising.
+func WithAdvInterval(min, max time.Duration) AdvOption {
+	return func(c *advConfig) {
+		switch {
+		case min < minAdvInterval || min > maxAdvInterval:
+			c.err = fmt.Errorf("advertising interval %s out of range [%s, %s]", min, minAdvInterval, maxAdvInterval)
+		case max < min || max > maxAdvInterval:
+			c.err = fmt.Errorf("advertising interval %s out of range [%s, %s]", max, min, maxAdvInterval)
+		default:
+			c.params.AdvertisingIntervalMin = uint16(min / advTimeUnit)
+			c.params.AdvertisingIntervalMax = uint16(max / advTimeUnit)
+		}
+	}
+}
+
+// AdvertiseWithOptions advertises the advertising data and scan response until the context is done. Options not
+// given keep the defaults set with HCI.SetAdvParams. Directed advertising carries no data; it returns once the peer
+// connected, or with hci.ErrDirAdvTimeout once high duty cycle directed advertising ended without a connection.
+// Undirected connectable advertising resumes after each connection.
+func (d *Device) AdvertiseWithOptions(ctx context.Context, ad, sr []byte, opts ...AdvOption) error {
+	cfg := &advConfig{params: d.HCI.AdvParams()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.err != nil {
+		return cfg.err
+	}
+	if cfg.mode.directed() && !cfg.peer {
+		return errors.New("directed advertising requires a peer address")
+	}
+
+	restart := func(ctx context.Context) error {
+		return d.HCI.AdvertiseWithParams(ctx, cfg.params)
+	}
+	start := func(ctx context.Context) error {
+		if err := d.HCI.SetAdvertisement(ctx, ad, sr); err != nil {
+			return fmt.Errorf("unable to set advertisement: %w", err)
+		}
+		return restart(ctx)
+	}
+	if cfg.mode.directed() {
+		restart = nil
+	}
+	return d.advertise(ctx, start, restart)
+}
+
+// advertiseOnce starts advertising and waits for the context to be done like advertise, but leaves advertising
+// stopped after a connection: the HCI enables it again once the central disconnected, as the Advertise methods
+// predating the advertising options always did.
+func (d *Device) advertiseOnce(ctx context.Context, start func(context.Context) error) error {
+	return d.advertise(ctx, start, func(context.Context) error { return nil })
+}
+
+// advertise starts advertising and waits for the context to be done, stopping advertising then. When the controller
+// stops advertising because a central connected, restart resumes it; without restart advertise returns, leaving it
+// stopped. It returns the error if the controller stopped advertising for another reason.
+func (d *Device) advertise(ctx context.Context, start, restart func(context.Context) error) error {
+	// discard reasons left over from earlier advertising
+	select {
+	case <-d.HCI.AdvertisingStopped():
+	default:
+	}
+	if err := start(ctx); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// the context is done, give the controller some time to stop
+			stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			return d.HCI.StopAdvertising(stopCtx)
+		case <-d.HCI.Closed():
+			return errors.New("hci device is down")
+		case err := <-d.HCI.AdvertisingStopped():
+			if err != nil {
+				return fmt.Errorf("advertising stopped: %w", err)
+			}
+			if restart == nil {
+				// The directed advertising is done, it must not be enabled again once the central disconnected.
+				stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				return d.HCI.StopAdvertising(stopCtx)
+			}
+			// The controller refuses once it reached its maximum number of connections.
+			if err = restart(ctx); err != nil {
+				d.log.Debug("unable to resume advertising", log.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package linux
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble"
+)
+
+func TestAdvOptions(t *testing.T) {
+	cfg := &advConfig{}
+	for _, opt := range []AdvOption{
+		WithAdvMode(AdvDirectedLowDuty),
+		WithPeer(ble.NewAddr("aa:bb:cc:dd:ee:ff"), ble.AddressTypeRandom),
+		WithAdvInterval(100*time.Millisecond, 200*time.Millisecond),
+	} {
+		opt(cfg)
+	}
+	if cfg.err != nil {
+		t.Fatalf("Expected: no error, Received: %s", cfg.err)
+	}
+	if cfg.params.AdvertisingType != 0x04 {
+		t.Fatalf("Expected: %X, Received: %X", 0x04, cfg.params.AdvertisingType)
+	}
+	if expected := [6]byte{0xFF, 0xEE, 0xDD, 0xCC, 0xBB, 0xAA}; cfg.params.DirectAddress != expected || cfg.params.DirectAddressType != 0x01 {
+		t.Fatalf("Expected: %X, Received: %X", expected, cfg.params.DirectAddress)
+	}
+	if cfg.params.AdvertisingIntervalMin != 160 || cfg.params.AdvertisingIntervalMax != 320 {
+		t.Fatalf("Expected: 160-320, Received: %d-%d", cfg.params.AdvertisingIntervalMin, cfg.params.AdvertisingIntervalMax)
+	}
+
+	for _, opt := range []AdvOption{
+		WithAdvMode(0),
+		WithAdvInterval(10*time.Millisecond, 20*time.Millisecond),
+		WithAdvInterval(100*time.Millisecond, 50*time.Millisecond),
+	} {
+		cfg = &advConfig{}
+		if opt(cfg); cfg.err == nil {
+			t.Fatalf("Expected: error, Received: none")
+		}
+	}
+}
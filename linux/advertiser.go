@@ -0,0 +1,239 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/adv"
+	"github.com/thomascriley/ble/linux/hci"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+	"github.com/thomascriley/ble/linux/hci/evt"
+	"github.com/thomascriley/ble/log"
+)
+
+// DefaultAdvDwell is how long a payload stays on air each time its turn comes, if its dwell time is not set.
+const DefaultAdvDwell = time.Second
+
+// AdvPayload is one of the advertisements sent by Device.AdvertiseSchedule.
+type AdvPayload struct {
+	// AD and ScanResponse are the advertising data and scan response, at most 31 bytes each.
+	AD           []byte
+	ScanResponse []byte
+
+	// Connectable advertises with connectable PDUs (ADV_IND). Otherwise the payload is scannable (ADV_SCAN_IND) if it
+	// has a scan response and non-connectable (ADV_NONCONN_IND) if not.
+	Connectable bool
+
+	// Mode selects the advertising mode, overriding Connectable. The directed modes are not supported.
+	Mode AdvMode
+
+	// Dwell is how long the payload stays on air each time its turn comes, on controllers advertising a single
+	// payload at a time. It defaults to DefaultAdvDwell.
+	Dwell time.Duration
+
+	// Weight is the number of turns the payload gets in each rotation. It defaults to 1.
+	Weight int
+}
+
+// NewAdvPayload returns the payload advertising the packets assembled by an adv.Builder.
+func NewAdvPayload(p *adv.Payload, connectable bool) AdvPayload {
+	return AdvPayload{AD: p.AD.Bytes(), ScanResponse: p.ScanResponse.Bytes(), Connectable: connectable}
+}
+
+func (p AdvPayload) validate() error {
+	switch {
+	case len(p.AD) > adv.MaxEIRPacketLength || len(p.ScanResponse) > adv.MaxEIRPacketLength:
+		return ble.ErrEIRPacketTooLong
+	case p.Dwell < 0:
+		return fmt.Errorf("negative dwell time %s", p.Dwell)
+	case p.Mode.directed():
+		return errors.New("directed advertising can not be scheduled")
+	case p.Weight < 0:
+		return fmt.Errorf("negative weight %d", p.Weight)
+	}
+	return nil
+}
+
+func (p AdvPayload) dwell() time.Duration {
+	if p.Dwell == 0 {
+		return DefaultAdvDwell
+	}
+	return p.Dwell
+}
+
+func (p AdvPayload) weight() int {
+	if p.Weight == 0 {
+		return 1
+	}
+	return p.Weight
+}
+
+// params returns the advertising parameters of the payload, based on the default ones.
+func (p AdvPayload) params(base cmd.LESetAdvertisingParameters) cmd.LESetAdvertisingParameters {
+	switch {
+	case p.Mode != 0:
+		base.AdvertisingType = p.Mode.advertisingType()
+	case p.Connectable:
+		base.AdvertisingType = 0x00 // ADV_IND
+	case len(p.ScanResponse) > 0:
+		base.AdvertisingType = 0x02 // ADV_SCAN_IND
+	default:
+		base.AdvertisingType = 0x03 // ADV_NONCONN_IND
+	}
+	return base
+}
+
+// AdvertiseSchedule advertises all the payloads until the context is done. Controllers supporting LE Extended
+// Advertising with enough advertising sets advertise every payload at the same time, each with its own set. Other
+// controllers advertise a single payload at a time, so the payloads take turns: each stays on air for its dwell time
+// and, within a rotation, a payload gets as many turns as its weight, spread among those of the other payloads.
+func (d *Device) AdvertiseSchedule(ctx context.Context, payloads ...AdvPayload) error {
+	if len(payloads) == 0 {
+		return errors.New("no payload to advertise")
+	}
+	for i, p := range payloads {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("invalid payload %d: %w", i, err)
+		}
+	}
+	if d.HCI.LEFeatures().Has(hci.LEFeatureExtendedAdvertising) {
+		n, err := d.HCI.NumAdvertisingSets(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to read number of advertising sets: %w", err)
+		}
+		// One set is kept to stand in for the legacy advertising commands.
+		if n > len(payloads) {
+			return d.advertiseSets(ctx, payloads)
+		}
+		d.log.Debug("not enough advertising sets, rotating payloads", slog.Int("sets", n))
+	}
+	return d.rotateAdvertising(ctx, payloads)
+}
+
+// advertiseSets advertises each payload with its own extended advertising set.
+func (d *Device) advertiseSets(ctx context.Context, payloads []AdvPayload) (err error) {
+	base := d.HCI.AdvParams()
+	handles := make([]uint8, 0, len(payloads))
+	defer func() {
+		// The context is most likely done already.
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if len(handles) > 0 {
+			err = errors.Join(err, d.HCI.EnableAdvertisingSets(stopCtx, false, handles...))
+		}
+		for _, handle := range handles {
+			err = errors.Join(err, d.HCI.RemoveAdvertisingSet(stopCtx, handle))
+		}
+	}()
+
+	for i, p := range payloads {
+		handle := uint8(i + 1)
+		if err := d.HCI.SetAdvertisingSet(ctx, handle, p.params(base), p.AD, p.ScanResponse); err != nil {
+			return fmt.Errorf("unable to set advertising set %d: %w", handle, err)
+		}
+		handles = append(handles, handle)
+	}
+
+	// Connectable sets stop once a central connects, they are enabled again for the next one.
+	terminated := make(chan uint8, len(handles))
+	if err := d.HCI.SetAdvertisingSetTerminatedHandler(func(e evt.LEAdvertisingSetTerminated) {
+		select {
+		case terminated <- e.AdvertisingHandle():
+		default:
+		}
+	}); err != nil {
+		return err
+	}
+	defer func() { _ = d.HCI.SetAdvertisingSetTerminatedHandler(nil) }()
+
+	if err := d.HCI.EnableAdvertisingSets(ctx, true, handles...); err != nil {
+		return fmt.Errorf("unable to enable advertising sets: %w", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.HCI.Closed():
+			return errors.New("hci device is down")
+		case handle := <-terminated:
+			if handle == 0 || int(handle) > len(handles) {
+				continue
+			}
+			// The controller may refuse while it has reached its maximum number of connections.
+			if err := d.HCI.EnableAdvertisingSets(ctx, true, handle); err != nil {
+				d.log.Debug("unable to re-enable advertising set", log.Uint8("handle", handle), log.Error(err))
+			}
+		}
+	}
+}
+
+// rotateAdvertising advertises the payloads in turn through the single legacy advertising instance.
+func (d *Device) rotateAdvertising(ctx context.Context, payloads []AdvPayload) (err error) {
+	base := d.HCI.AdvParams()
+	order := schedule(payloads)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		err = errors.Join(err, d.HCI.StopAdvertising(stopCtx))
+	}()
+
+	prev := -1
+	for i := 0; ; i = (i + 1) % len(order) {
+		p := payloads[order[i]]
+		if order[i] != prev {
+			if err := d.advertiseTurn(ctx, p.params(base), p); err != nil {
+				return err
+			}
+			prev = order[i]
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.HCI.Closed():
+			return errors.New("hci device is down")
+		case <-time.After(p.dwell()):
+		}
+	}
+}
+
+// advertiseTurn replaces the advertised payload.
+func (d *Device) advertiseTurn(ctx context.Context, params cmd.LESetAdvertisingParameters, p AdvPayload) error {
+	// Controllers prior to 5.0 refuse to disable advertising while it is not enabled.
+	if err := d.HCI.StopAdvertising(ctx); err != nil && !errors.Is(err, hci.ErrDisallowed) {
+		return fmt.Errorf("unable to stop advertising: %w", err)
+	}
+	if err := d.HCI.SetAdvertisement(ctx, p.AD, p.ScanResponse); err != nil {
+		return fmt.Errorf("unable to set advertisement: %w", err)
+	}
+	if err := d.HCI.AdvertiseWithParams(ctx, params); err != nil {
+		return fmt.Errorf("unable to advertise: %w", err)
+	}
+	return nil
+}
+
+// schedule returns the order in which the payloads take turns in one rotation. Each payload gets as many turns as its
+// weight, interleaved with the others using a smooth weighted round robin.
+func schedule(payloads []AdvPayload) []int {
+	total := 0
+	for _, p := range payloads {
+		total += p.weight()
+	}
+	current := make([]int, len(payloads))
+	order := make([]int, 0, total)
+	for len(order) < total {
+		next := 0
+		for i, p := range payloads {
+			current[i] += p.weight()
+			if current[i] > current[next] {
+				next = i
+			}
+		}
+		current[next] -= total
+		order = append(order, next)
+	}
+	return order
+}
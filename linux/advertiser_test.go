@@ -0,0 +1,46 @@
+package linux
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thomascriley/ble/linux/hci/cmd"
+)
+
+func TestSchedule(t *testing.T) {
+	tests := []struct {
+		weights  []int
+		expected []int
+	}{
+		{[]int{0}, []int{0}},
+		{[]int{1, 1, 1}, []int{0, 1, 2}},
+		{[]int{2, 1}, []int{0, 1, 0}},
+		{[]int{3, 1, 1}, []int{0, 1, 0, 2, 0}},
+	}
+	for _, test := range tests {
+		payloads := make([]AdvPayload, len(test.weights))
+		for i, w := range test.weights {
+			payloads[i].Weight = w
+		}
+		if received := schedule(payloads); !reflect.DeepEqual(received, test.expected) {
+			t.Fatalf("Expected: %v, Received: %v", test.expected, received)
+		}
+	}
+}
+
+func TestAdvPayloadParams(t *testing.T) {
+	tests := []struct {
+		p        AdvPayload
+		expected uint8
+	}{
+		{AdvPayload{Connectable: true}, 0x00},
+		{AdvPayload{ScanResponse: []byte{0x02, 0x0A, 0x00}}, 0x02},
+		{AdvPayload{AD: []byte{0x02, 0x0A, 0x00}}, 0x03},
+		{AdvPayload{Connectable: true, Mode: AdvNonConnectable}, 0x03},
+	}
+	for _, test := range tests {
+		if received := test.p.params(cmd.LESetAdvertisingParameters{AdvertisingType: 0x04}).AdvertisingType; received != test.expected {
+			t.Fatalf("Expected: %X, Received: %X", test.expected, received)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci"
+	"github.com/thomascriley/ble/linux/rfcomm"
+	"github.com/thomascriley/ble/linux/sdp"
+)
+
+// DialL2CAPChannel opens a BR/EDR channel to the protocol or service listening on the PSM of the remote device,
+// configured with the parameters p. The channels opened to the same device share its ACL link.
+func (d *Device) DialL2CAPChannel(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8,
+	psm uint16, p hci.ChannelParams) (*hci.BREDRChannel, error) {
+	select {
+	case <-d.HCI.Closed():
+		return nil, errors.New("hci device is down")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if err := d.tempStop(); err != nil {
+		return nil, fmt.Errorf("unable to temporary stop scan: %w", err)
+	}
+	defer d.tempStart()
+	return d.HCI.DialL2CAPChannel(ctx, a, clockOffset, pageScanRepetitionMode, psm, p)
+}
+
+// ListenL2CAPChannel listens for the BR/EDR channels opened by remote devices on the PSM, which are configured with
+// the parameters p. The remote devices connect once accepted by the handler set with SetBREDRAcceptHandler.
+func (d *Device) ListenL2CAPChannel(psm uint16, p hci.ChannelParams) (*hci.BREDRListener, error) {
+	return d.HCI.ListenL2CAPChannel(psm, p)
+}
+
+// SetBREDRAcceptHandler sets the policy accepting the BR/EDR connection requests of the remote devices, which are
+// rejected unless it returns true.
+func (d *Device) SetBREDRAcceptHandler(f func(hci.BREDRConnRequest) bool) error {
+	return d.HCI.SetBREDRAcceptHandler(f)
+}
+
+// SetConnectable makes the device connectable by the BR/EDR devices, or stops it.
+func (d *Device) SetConnectable(ctx context.Context, connectable bool) error {
+	return d.HCI.SetConnectable(ctx, connectable)
+}
+
+// ServeSDP publishes the records of the SDP server to the remote devices, until the listener returned is closed.
+func (d *Device) ServeSDP(srv *sdp.Server) (*hci.BREDRListener, error) {
+	return d.HCI.ServeSDP(srv)
+}
+
+// ListenRFCOMM listens for the RFCOMM connections to the server channel, or to a server channel it allocates if
+// channel is 0, until the listener returned is closed.
+func (d *Device) ListenRFCOMM(channel uint8) (*rfcomm.Listener, error) {
+	return d.HCI.ListenRFCOMM(channel)
+}
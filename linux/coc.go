@@ -0,0 +1,9 @@
+package linux
+
+import "github.com/thomascriley/ble/linux/hci"
+
+// ListenL2CAP listens for the LE credit based channels opened by remote devices on the LE_PSM, which receive with
+// the parameters p. Channels are opened on an LE connection with hci.Conn.DialL2CAP.
+func (d *Device) ListenL2CAP(psm uint16, p hci.CoCParams) (*hci.L2CAPListener, error) {
+	return d.HCI.ListenL2CAP(psm, p)
+}
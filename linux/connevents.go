@@ -0,0 +1,169 @@
+package linux
+
+import (
+	"context"
+	"sync"
+
+	"github.com/thomascriley/ble/linux/hci"
+)
+
+// connEvents delivers the connection lifecycle events of the HCI to the handler and subscribers of the Device. The
+// events are queued as they arrive, as the HCI reports most of them from its event loop, and delivered in order from
+// a goroutine of their own, so the handler and subscribers are free to send commands.
+type connEvents struct {
+	mu      sync.Mutex
+	queue   []hci.ConnEvent
+	handler func(hci.ConnEvent)
+	subs    []*connEventSub
+	chQueue chan struct{}
+	stopped chan struct{}
+}
+
+// connEventSub is a subscriber of Device.ConnEvents. Its mutex is held while sending on its channel, so the
+// channel is never closed during a send.
+type connEventSub struct {
+	mu     sync.Mutex
+	ch     chan hci.ConnEvent
+	done   <-chan struct{}
+	closed bool
+}
+
+// send passes the event to the subscriber. It returns false if the subscriber is gone.
+func (s *connEventSub) send(e hci.ConnEvent, done <-chan struct{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.ch <- e:
+		return true
+	case <-s.done:
+		return false
+	case <-done:
+		return true
+	}
+}
+
+func (s *connEventSub) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+func newConnEvents() *connEvents {
+	return &connEvents{chQueue: make(chan struct{}, 1), stopped: make(chan struct{})}
+}
+
+// push queues the event. It never blocks.
+func (q *connEvents) push(e hci.ConnEvent) {
+	q.mu.Lock()
+	q.queue = append(q.queue, e)
+	q.mu.Unlock()
+	select {
+	case q.chQueue <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the queued events until done is closed, then closes the channels of the subscribers left.
+func (q *connEvents) run(done <-chan struct{}) {
+	defer func() {
+		q.mu.Lock()
+		subs := q.subs
+		q.subs = nil
+		close(q.stopped)
+		q.mu.Unlock()
+		for _, sub := range subs {
+			sub.close()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case <-q.chQueue:
+		}
+
+		q.mu.Lock()
+		queue := q.queue
+		q.queue = nil
+		q.mu.Unlock()
+
+		for _, e := range queue {
+			q.deliver(e, done)
+		}
+	}
+}
+
+func (q *connEvents) deliver(e hci.ConnEvent, done <-chan struct{}) {
+	q.mu.Lock()
+	handler, subs := q.handler, q.subs
+	q.mu.Unlock()
+
+	if handler != nil {
+		handler(e)
+	}
+	for _, sub := range subs {
+		if !sub.send(e, done) {
+			q.unsubscribe(sub)
+		}
+	}
+}
+
+func (q *connEvents) setHandler(f func(hci.ConnEvent)) {
+	q.mu.Lock()
+	q.handler = f
+	q.mu.Unlock()
+}
+
+func (q *connEvents) subscribe(ctx context.Context) *connEventSub {
+	sub := &connEventSub{ch: make(chan hci.ConnEvent, 16), done: ctx.Done()}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-q.stopped:
+		sub.close()
+	default:
+		q.subs = append(q.subs[:len(q.subs):len(q.subs)], sub)
+	}
+	return sub
+}
+
+// unsubscribe removes the subscriber and closes its channel.
+func (q *connEvents) unsubscribe(sub *connEventSub) {
+	q.mu.Lock()
+	for i, s := range q.subs {
+		if s == sub {
+			q.subs = append(q.subs[:i:i], q.subs[i+1:]...)
+			break
+		}
+	}
+	q.mu.Unlock()
+	sub.close()
+}
+
+// SetConnEventHandler sets handler to be called, in order, on every change in the lifecycle of the connections:
+// established, parameters updated, encryption changed, MTU changed and disconnected.
+func (d *Device) SetConnEventHandler(f func(hci.ConnEvent)) error {
+	d.connEvents.setHandler(f)
+	return nil
+}
+
+// ConnEvents returns a channel receiving, in order, every change in the lifecycle of the connections until the
+// context is done or the device closes, when the channel is closed. The channel must be drained, the events are not
+// delivered to the other subscribers while it is full.
+func (d *Device) ConnEvents(ctx context.Context) <-chan hci.ConnEvent {
+	sub := d.connEvents.subscribe(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.connEvents.unsubscribe(sub)
+		case <-d.connEvents.stopped:
+		}
+	}()
+	return sub.ch
+}
@@ -0,0 +1,56 @@
+package linux
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thomascriley/ble/linux/hci"
+)
+
+func TestConnEvents(t *testing.T) {
+	q := newConnEvents()
+	done := make(chan struct{})
+	go q.run(done)
+
+	var handled []hci.ConnEventType
+	chHandled := make(chan struct{}, 3)
+	q.setHandler(func(e hci.ConnEvent) {
+		handled = append(handled, e.Type)
+		chHandled <- struct{}{}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := q.subscribe(ctx)
+
+	expected := []hci.ConnEvent{
+		{Type: hci.ConnEventConnected},
+		{Type: hci.ConnEventMTUChanged, MTU: 247},
+		{Type: hci.ConnEventDisconnected, Err: hci.ErrRemoteUser},
+	}
+	for _, e := range expected {
+		q.push(e)
+	}
+	for i, e := range expected {
+		received := <-sub.ch
+		if received.Type != e.Type {
+			t.Fatalf("event %d: Expected: %s, Received: %s", i, e.Type, received.Type)
+		}
+		<-chHandled
+	}
+	for i, typ := range handled {
+		if typ != expected[i].Type {
+			t.Fatalf("handled event %d: Expected: %s, Received: %s", i, expected[i].Type, typ)
+		}
+	}
+
+	cancel()
+	q.unsubscribe(sub)
+	if _, ok := <-sub.ch; ok {
+		t.Fatalf("Expected the channel to be closed")
+	}
+
+	close(done)
+	<-q.stopped
+	if _, ok := <-q.subscribe(context.Background()).ch; ok {
+		t.Fatalf("Expected the channel of a late subscriber to be closed")
+	}
+}
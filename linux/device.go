@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/adv"
 	"github.com/thomascriley/ble/linux/att"
 	"github.com/thomascriley/ble/linux/gatt"
 	"github.com/thomascriley/ble/linux/hci"
@@ -22,14 +23,10 @@ type Device struct {
 	HCI          *hci.HCI
 	Server       *gatt.Server
 	numResponses int
-	allowDup     bool
 	interval     time.Duration
 
-	scanMutex       sync.Mutex
-	scanErr         chan error
-	scanning        bool
-	scanTempStopped chan bool
-	scanRequested   bool
+	scanner    *scanner
+	connEvents *connEvents
 
 	inquireMutex       sync.Mutex
 	inquireErr         chan error
@@ -45,13 +42,13 @@ func NewDevice(log *slog.Logger) *Device {
 	log = log.With("package", "github.com/thomascriley/ble")
 	d := &Device{
 		HCI:                hci.NewHCI(log),
-		scanErr:            make(chan error, 1),
 		inquireErr:         make(chan error, 1),
-		scanTempStopped:    make(chan bool),
 		inquireTempStopped: make(chan bool),
 		log:                log,
 	}
-	close(d.scanTempStopped)
+	d.scanner = newScanner(d.HCI, log)
+	d.connEvents = newConnEvents()
+	_ = d.HCI.SetConnEventHandler(d.connEvents.push)
 	close(d.inquireTempStopped)
 	return d
 }
@@ -62,6 +59,11 @@ func (d *Device) Initialize(ctx context.Context) error {
 	case errors.Is(err, ble.ErrAlreadyInitialized):
 		return err
 	case err == nil:
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.connEvents.run(d.HCI.Closed())
+		}()
 		return nil
 	default:
 		_ = d.HCI.Close()
@@ -167,83 +169,59 @@ func (d *Device) SetServices(svcs []*ble.Service) error {
 }
 
 func (d *Device) Advertise(ctx context.Context, adv ble.Advertisement) error {
-	if err := d.HCI.AdvertiseAdv(ctx, adv); err != nil {
-		return err
-	}
-	select {
-	case <-ctx.Done():
-	case <-d.HCI.Closed():
-		return errors.New("hci device is down")
-	}
-	return d.HCI.StopAdvertising(ctx)
-
+	return d.advertiseOnce(ctx, func(ctx context.Context) error {
+		return d.HCI.AdvertiseAdv(ctx, adv)
+	})
 }
 
 // AdvertiseNameAndServices advertises device name, and specified service UUIDs.
 // It tres to fit the UUIDs in the advertising packet as much as possible.
 // If name doesn't fit in the advertising packet, it will be put in scan response.
 func (d *Device) AdvertiseNameAndServices(ctx context.Context, name string, uuids ...ble.UUID) error {
-	if err := d.HCI.AdvertiseNameAndServices(ctx, name, uuids...); err != nil {
-		return err
+	return d.advertiseOnce(ctx, func(ctx context.Context) error {
+		return d.HCI.AdvertiseNameAndServices(ctx, name, uuids...)
+	})
+}
+
+// AdvertiseBuilder advertises the fields of the builder, splitting them between the advertising packet and the scan
+// response. Fields which fit in neither are logged and left out; call b.Build beforehand to inspect them.
+func (d *Device) AdvertiseBuilder(ctx context.Context, b *adv.Builder, opts ...AdvOption) error {
+	p, err := b.Build()
+	if err != nil {
+		return fmt.Errorf("unable to build advertisement: %w", err)
 	}
-	select {
-	case <-ctx.Done():
-	case <-d.HCI.Closed():
-		return errors.New("hci device is down")
+	for _, f := range p.Dropped {
+		d.log.Debug("advertising field dropped", log.Stringer("field", f))
 	}
-	return d.HCI.StopAdvertising(ctx)
+	return d.AdvertiseWithOptions(ctx, p.AD.Bytes(), p.ScanResponse.Bytes(), opts...)
 }
 
 // AdvertiseMfgData avertises the given manufacturer data.
 func (d *Device) AdvertiseMfgData(ctx context.Context, id uint16, b []byte) error {
-	if err := d.HCI.AdvertiseMfgData(ctx, id, b); err != nil {
-		return err
-	}
-	select {
-	case <-ctx.Done():
-	case <-d.HCI.Closed():
-		return errors.New("hci device is down")
-	}
-	return d.HCI.StopAdvertising(ctx)
+	return d.advertiseOnce(ctx, func(ctx context.Context) error {
+		return d.HCI.AdvertiseMfgData(ctx, id, b)
+	})
 }
 
 // AdvertiseServiceData16 advertises data associated with a 16bit service uuid
 func (d *Device) AdvertiseServiceData16(ctx context.Context, id uint16, b []byte) error {
-	if err := d.HCI.AdvertiseServiceData16(ctx, id, b); err != nil {
-		return err
-	}
-	select {
-	case <-ctx.Done():
-	case <-d.HCI.Closed():
-		return errors.New("hci device is down")
-	}
-	return d.HCI.StopAdvertising(ctx)
+	return d.advertiseOnce(ctx, func(ctx context.Context) error {
+		return d.HCI.AdvertiseServiceData16(ctx, id, b)
+	})
 }
 
 // AdvertiseIBeaconData advertise iBeacon with given manufacturer data.
 func (d *Device) AdvertiseIBeaconData(ctx context.Context, b []byte) error {
-	if err := d.HCI.AdvertiseIBeaconData(ctx, b); err != nil {
-		return err
-	}
-	select {
-	case <-ctx.Done():
-	case <-d.HCI.Closed():
-		return errors.New("hci device is down")
-	}
-	return d.HCI.StopAdvertising(ctx)
+	return d.advertiseOnce(ctx, func(ctx context.Context) error {
+		return d.HCI.AdvertiseIBeaconData(ctx, b)
+	})
 }
 
 // AdvertiseIBeacon advertises iBeacon with specified parameters.
 func (d *Device) AdvertiseIBeacon(ctx context.Context, u ble.UUID, major, minor uint16, pwr int8) error {
-	if err := d.HCI.AdvertiseIBeacon(ctx, u, major, minor, pwr); err != nil {
-		return err
-	}
-	select {
-	case <-ctx.Done():
-	case <-d.HCI.Closed():
-		return errors.New("hci device is down")
-	}
-	return d.HCI.StopAdvertising(ctx)
+	return d.advertiseOnce(ctx, func(ctx context.Context) error {
+		return d.HCI.AdvertiseIBeacon(ctx, u, major, minor, pwr)
+	})
 }
 
 // RequestRemoteName ...
@@ -253,33 +231,7 @@ func (d *Device) RequestRemoteName(ctx context.Context, a ble.Addr) (string, err
 
 // Scan starts scanning. Duplicated advertisements will be filtered out if allowDup is set to false.
 func (d *Device) Scan(ctx context.Context, allowDup bool, h ble.AdvHandler) error {
-	select {
-	case <-d.scanTempStopped:
-	case <-ctx.Done():
-		return ctx.Err()
-	}
-
-	d.scanRequested = true
-	defer func() { d.scanRequested = false }()
-
-	if err := d.HCI.SetAdvHandler(h); err != nil {
-		return fmt.Errorf("unable to set advertisement handler: %s", err)
-	}
-	if err := d.startScan(ctx, allowDup); err != nil {
-		return err
-	}
-
-	// scan until the context or socket close
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	select {
-	case err := <-d.scanErr:
-		return err
-	case <-ctx.Done():
-		return d.stopScan()
-	case <-d.HCI.Closed():
-		return errors.New("hci device closed")
-	}
+	return d.ScanWithOptions(ctx, h, WithAllowDuplicates(allowDup))
 }
 
 // Inquire starts inquiring for bluetooth devices broadcasting using br/edr
@@ -337,8 +289,8 @@ func (d *Device) DialBLE(ctx context.Context, address ble.Addr, addressType ble.
 	return cli, err
 }
 
-// DialRFCOMM ...
-// TODO: implement SDP to determine RFCOMM channel number
+// DialRFCOMM opens an RFCOMM channel to the server channel of the remote device. The channels opened to the same
+// device share its RFCOMM session. Use DialRFCOMMService to look the server channel up from the class of the service.
 func (d *Device) DialRFCOMM(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8, channel uint8) (cli ble.ClientRFCOMM, err error) {
 	// d.HCI.DialRFCOMM is a blocking call, although most of time it should return immediately.
 	// But in case passing wrong device address or the device went non-connectable, it blocks.
@@ -357,6 +309,24 @@ func (d *Device) DialRFCOMM(ctx context.Context, a ble.Addr, clockOffset uint16,
 	return cli, err
 }
 
+// DialRFCOMMService opens an RFCOMM channel to the service of the class, such as the serial port 0x1101, looking its
+// server channel up with SDP.
+func (d *Device) DialRFCOMMService(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8,
+	class ble.UUID) (ble.ClientRFCOMM, error) {
+	select {
+	case <-d.HCI.Closed():
+		return nil, errors.New("hci device is down")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if err := d.tempStop(); err != nil {
+		return nil, fmt.Errorf("unable to temporary stop scan: %w", err)
+	}
+	defer d.tempStart()
+	return d.HCI.DialRFCOMMService(ctx, a, clockOffset, pageScanRepetitionMode, class)
+}
+
 func (d *Device) inquire(ctx context.Context, interval time.Duration) error {
 	ctx, cancel := context.WithTimeout(ctx, interval)
 	defer cancel()
@@ -378,11 +348,6 @@ func (d *Device) inquire(ctx context.Context, interval time.Duration) error {
 
 // tempStop temporarily stops scanning or inquiring (this is done when connecting)
 func (d *Device) tempStop() (err error) {
-	select {
-	case <-d.scanTempStopped:
-		d.scanTempStopped = make(chan bool)
-	default:
-	}
 	select {
 	case <-d.inquireTempStopped:
 		d.inquireTempStopped = make(chan bool)
@@ -399,11 +364,6 @@ func (d *Device) tempStop() (err error) {
 }
 
 func (d *Device) tempStart() {
-	select {
-	case <-d.scanTempStopped:
-	default:
-		close(d.scanTempStopped)
-	}
 	select {
 	case <-d.inquireTempStopped:
 	default:
@@ -413,12 +373,8 @@ func (d *Device) tempStart() {
 }
 
 func (d *Device) tempStopScan() error {
-	if !d.scanRequested {
-		d.log.Debug("BLE: tempStopScan: scan no longer requested")
-		return nil
-	}
 	d.log.Debug("BLE: temporarily stopping scan")
-	if err := d.stopScan(); err != nil {
+	if err := d.scanner.pause(); err != nil {
 		return err
 	}
 	d.log.Debug("BLE: temporarily stopped scan")
@@ -426,20 +382,8 @@ func (d *Device) tempStopScan() error {
 }
 
 func (d *Device) tempStartScan(ctx context.Context) {
-	if !d.scanRequested {
-		d.log.Debug("BLE: tempStartScan: scan no longer requested")
-		return
-	}
 	d.log.Debug("BLE: temporarily starting scan")
-	if err := d.startScan(ctx, d.allowDup); err != nil {
-		select {
-		case d.scanErr <- err:
-		default:
-		}
-		d.log.Debug("BLE: failed to temporarily start inquiry", slog.String("Error", err.Error()))
-		return
-	}
-	d.log.Debug("BLE: temporarily started scan")
+	d.scanner.resume(ctx)
 }
 
 func (d *Device) tempStartInquiry(ctx context.Context) {
@@ -449,7 +393,7 @@ func (d *Device) tempStartInquiry(ctx context.Context) {
 	d.log.Debug("BLE: temporarily starting inquiry")
 	if err := d.startInquiry(ctx, d.interval); err != nil {
 		select {
-		case d.scanErr <- err:
+		case d.inquireErr <- err:
 		default:
 		}
 		d.log.Debug("BLE: failed to temporarily start inquiry", slog.String("Error", err.Error()))
@@ -494,46 +438,6 @@ func (d *Device) trigger(fns ...func(ctx context.Context)) {
 	}
 }
 
-func (d *Device) startScan(ctx context.Context, allowDup bool) error {
-	d.scanMutex.Lock()
-	defer d.scanMutex.Unlock()
-
-	d.log.Debug("BLE: startScan")
-	if d.scanning {
-		d.log.Debug("BLE: startScan: already scanning")
-		return nil
-	}
-	d.log.Debug("BLE: startScan: starting device scan")
-	if err := d.HCI.Scan(ctx, allowDup); err != nil {
-		return fmt.Errorf("ble failed to start scan: %w", err)
-	}
-	d.log.Debug("BLE: startScan: started device scan")
-	d.allowDup = allowDup
-	d.scanning = true
-	return nil
-}
-
-func (d *Device) stopScan() error {
-	d.scanMutex.Lock()
-	defer d.scanMutex.Unlock()
-
-	d.log.Debug("BLE: stopScan")
-	if !d.scanning {
-		d.log.Debug("BLE: stopScan: already not scanning")
-		return nil
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	d.log.Debug("BLE: stopScan: stopping device scan")
-	if err := d.HCI.StopScanning(ctx); err != nil {
-		return fmt.Errorf("ble failed to stop scanning: %w", err)
-	}
-	d.log.Debug("BLE: stopScan: stopped device scan")
-	d.scanning = false
-	return nil
-}
-
 func (d *Device) startInquiry(ctx context.Context, interval time.Duration) error {
 	d.inquireMutex.Lock()
 	defer d.inquireMutex.Unlock()
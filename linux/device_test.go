@@ -11,4 +11,5 @@ var testDevice ble.Device = &Device{}
 var testConn ble.Conn = &hci.Conn{}
 var testClient ble.ClientBLE = &gatt.Client{}
 var testRFCOMMClient ble.ClientRFCOMM = &rfcomm.Client{}
+var testRFCOMMConn ble.ClientRFCOMM = &rfcomm.Conn{}
 var testAdv ble.Advertisement = &hci.Advertisement{}
\ No newline at end of file
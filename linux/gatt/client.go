@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"github.com/thomascriley/ble"
 	"github.com/thomascriley/ble/linux/att"
+	"github.com/thomascriley/ble/log"
 	"log/slog"
 	"sync"
+	"time"
 )
 
 const (
@@ -16,6 +18,9 @@ const (
 	cccIndicate = 0x0002
 )
 
+// rssiTimeout bounds the time to read the RSSI from the controller.
+const rssiTimeout = 2 * time.Second
+
 // NewClient returns a GATT Client.
 func NewClient(log *slog.Logger, conn ble.Conn) (*Client, error) {
 	p := &Client{
@@ -347,13 +352,27 @@ func (p *Client) WriteDescriptor(d *ble.Descriptor, v []byte) error {
 	return nil
 }
 
+// rssiReader is implemented by connections able to read the signal strength of the link, such as *hci.Conn.
+type rssiReader interface {
+	ReadRSSI(ctx context.Context) (int, error)
+}
+
 // ReadRSSI retrieves the current RSSI value of remote peripheral. [Vol 2, Part E, 7.5.4]
+// It returns 0 if the RSSI can not be read.
 func (p *Client) ReadRSSI() int {
 	p.log.Debug("read RSSI")
-	p.Lock()
-	defer p.Unlock()
-	// TODO:
-	return 0
+	r, ok := p.conn.(rssiReader)
+	if !ok {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rssiTimeout)
+	defer cancel()
+	rssi, err := r.ReadRSSI(ctx)
+	if err != nil {
+		p.log.Debug("unable to read RSSI", log.Error(err))
+		return 0
+	}
+	return rssi
 }
 
 // ExchangeMTU informs the server of the client’s maximum receive MTU size and
@@ -0,0 +1,32 @@
+package hci
+
+import (
+	"context"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+)
+
+// AcceptListSize returns the number of entries the controller accept list (white list) can hold.
+func (h *HCI) AcceptListSize(ctx context.Context) (int, error) {
+	var rp cmd.LEReadWhiteListSizeRP
+	if err := h.Send(ctx, &cmd.LEReadWhiteListSize{}, &rp); err != nil {
+		return 0, err
+	}
+	return int(rp.WhiteListSize), nil
+}
+
+// ClearAcceptList removes all entries from the controller accept list. The list can not be modified while it is in
+// use by scanning, advertising or a pending connection.
+func (h *HCI) ClearAcceptList(ctx context.Context) error {
+	return h.Send(ctx, &cmd.LEClearWhiteList{}, nil)
+}
+
+// AddToAcceptList adds the address to the controller accept list.
+func (h *HCI) AddToAcceptList(ctx context.Context, a ble.Addr, addressType ble.AddressType) error {
+	addr, err := BDAddr(a)
+	if err != nil {
+		return err
+	}
+	return h.Send(ctx, &cmd.LEAddDeviceToWhiteList{AddressType: uint8(addressType), Address: addr}, nil)
+}
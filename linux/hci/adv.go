@@ -16,15 +16,74 @@ const (
 	evtTypScanRsp       = 0x04 // Scan Response (SCAN_RSP).
 )
 
+// [Vol 2, Part E, 7.7.65.13] Event type bits of extended advertising reports.
+const (
+	extEvtTypConnectable  = 1 << 0
+	extEvtTypScannable    = 1 << 1
+	extEvtTypDirected     = 1 << 2
+	extEvtTypScanRsp      = 1 << 3
+	extEvtTypLegacy       = 1 << 4
+	extEvtTypDataStatus   = 3 << 5
+	extDataStatusComplete = 0 << 5
+	extDataStatusMore     = 1 << 5
+)
+
+// extTxPowerNotAvailable is reported when an extended advertisement carries no tx power.
+const extTxPowerNotAvailable = 0x7F
+
 func newAdvertisement(e evt.LEAdvertisingReport, i int) *Advertisement {
-	return &Advertisement{e: e, i: i}
+	return &Advertisement{
+		eventType:   e.EventType(i),
+		addressType: e.AddressType(i),
+		address:     e.Address(i),
+		data:        append([]byte(nil), e.Data(i)...),
+		rssi:        e.RSSI(i),
+		txPower:     extTxPowerNotAvailable,
+		primaryPHY:  0x01, // LE 1M
+	}
+}
+
+func newExtendedAdvertisement(e evt.LEExtendedAdvertisingReport, i int, data []byte) *Advertisement {
+	return &Advertisement{
+		eventType:    legacyEventType(e.EventType(i)),
+		addressType:  e.AddressType(i),
+		address:      e.Address(i),
+		data:         data,
+		rssi:         e.RSSI(i),
+		txPower:      e.TXPower(i),
+		primaryPHY:   e.PrimaryPHY(i),
+		secondaryPHY: e.SecondaryPHY(i),
+	}
+}
+
+// legacyEventType maps the event type bits of an extended advertising report to the closest legacy event type.
+func legacyEventType(t uint16) uint8 {
+	switch {
+	case t&extEvtTypScanRsp != 0:
+		return evtTypScanRsp
+	case t&extEvtTypConnectable != 0 && t&extEvtTypDirected != 0:
+		return evtTypAdvDirectInd
+	case t&extEvtTypConnectable != 0:
+		return evtTypAdvInd
+	case t&extEvtTypScannable != 0:
+		return evtTypAdvScanInd
+	default:
+		return evtTypAdvNonconnInd
+	}
 }
 
 // Advertisement implements ble.Advertisement and other functions that are only
 // available on Linux.
 type Advertisement struct {
-	e  evt.LEAdvertisingReport
-	i  int
+	eventType    uint8
+	addressType  uint8
+	address      [6]byte
+	data         []byte
+	rssi         int8
+	txPower      int8
+	primaryPHY   uint8
+	secondaryPHY uint8
+
 	sr *Advertisement
 
 	// cached packets.
@@ -90,7 +149,10 @@ func (a *Advertisement) OverflowService() []ble.UUID {
 func (a *Advertisement) TxPowerLevel() int {
 	// fmt.Println("pwr")
 	// defer fmt.Println("pwr - done")
-	pwr, _ := a.packets().TxPower()
+	pwr, ok := a.packets().TxPower()
+	if !ok && a.txPower != extTxPowerNotAvailable {
+		return int(a.txPower)
+	}
 	return pwr
 }
 
@@ -110,10 +172,7 @@ func (a *Advertisement) Connectable() bool {
 func (a *Advertisement) RSSI() int {
 	// fmt.Println("rssi")
 	// defer fmt.Println("rssi - done")
-	if a.e == nil {
-		return 0
-	}
-	return int(a.e.RSSI(a.i))
+	return int(a.rssi)
 }
 
 // Addr returns the address of the remote peripheral.
@@ -121,10 +180,7 @@ func (a *Advertisement) Address() ble.Addr {
 	// fmt.Println("addr")
 	// defer fmt.Println("addr - done")
 	if a.addr == nil {
-		if a.e == nil {
-			return nil
-		}
-		b := a.e.Address(a.i)
+		b := a.address
 		a.addr = net.HardwareAddr([]byte{b[5], b[4], b[3], b[2], b[1], b[0]})
 	}
 	return a.addr
@@ -147,10 +203,7 @@ func (a *Advertisement) AddressString() string {
 func (a *Advertisement) EventType() uint8 {
 	// fmt.Println("evt type")
 	// defer fmt.Println("evt type - done")
-	if a.e == nil {
-		return 0
-	}
-	return a.e.EventType(a.i)
+	return a.eventType
 }
 
 // AddressType returns the address type of the Advertisement.
@@ -158,10 +211,7 @@ func (a *Advertisement) EventType() uint8 {
 func (a *Advertisement) AddressType() ble.AddressType {
 	// fmt.Println("addr type")
 	// defer fmt.Println("addr type - done")
-	if a.e == nil {
-		return ble.AddressTypeRandom
-	}
-	return ble.AddressType(a.e.AddressType(a.i))
+	return ble.AddressType(a.addressType)
 }
 
 // Data returns the advertising data of the packet.
@@ -169,10 +219,7 @@ func (a *Advertisement) AddressType() ble.AddressType {
 func (a *Advertisement) Data() []byte {
 	// fmt.Println("data")
 	// defer fmt.Println("data - done")
-	if a.e == nil {
-		return nil
-	}
-	return a.e.Data(a.i)
+	return a.data
 }
 
 // ScanResponse returns the scan response of the packet, if it presents.
@@ -185,3 +232,23 @@ func (a *Advertisement) ScanResponse() []byte {
 	}
 	return a.sr.Data()
 }
+
+// PrimaryPHY returns the PHY the advertisement was received on.
+// This is linux sepcific.
+func (a *Advertisement) PrimaryPHY() PHYs {
+	return phyFromCode(a.primaryPHY)
+}
+
+// SecondaryPHY returns the PHY the extended advertising data was received on, or zero for legacy advertisements.
+// This is linux sepcific.
+func (a *Advertisement) SecondaryPHY() PHYs {
+	return phyFromCode(a.secondaryPHY)
+}
+
+// phyFromCode converts a PHY number, as used in events (1: LE 1M, 2: LE 2M, 3: LE Coded), to its bit.
+func phyFromCode(c uint8) PHYs {
+	if c == 0 || c > 3 {
+		return 0
+	}
+	return 1 << (c - 1)
+}
@@ -0,0 +1,183 @@
+package hci
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+	"github.com/thomascriley/ble/linux/hci/evt"
+)
+
+// extAdvReportHeaderLen is the length of the header of an extended advertising report, preceding its data.
+const extAdvReportHeaderLen = 24
+
+// extAdvReport returns an LE Extended Advertising Report event of a single report.
+func extAdvReport(addr byte, sid uint8, more bool, data []byte) []byte {
+	b := make([]byte, 2+extAdvReportHeaderLen, 2+extAdvReportHeaderLen+len(data))
+	b[0], b[1] = 0x0D, 1
+	r := b[2:]
+	if more {
+		r[0] = extDataStatusMore
+	}
+	r[3] = addr
+	r[11] = sid
+	r[12] = extTxPowerNotAvailable
+	r[23] = uint8(len(data))
+	return append(b, data...)
+}
+
+func TestExtendedAdvertisingReassembly(t *testing.T) {
+	var received [][]byte
+	h := &HCI{
+		log:         slog.Default(),
+		adHist:      expirable.NewLRU[string, *Advertisement](10, nil, time.Minute),
+		extAdvFrags: expirable.NewLRU[string, []byte](extAdvFragsSize, nil, extAdvFragsTTL),
+		advHandler:  func(a ble.Advertisement) { received = append(received, a.(*Advertisement).data) },
+	}
+
+	for _, e := range [][]byte{
+		extAdvReport(0x01, 0, true, []byte{0x01, 0x02}),
+		extAdvReport(0x02, 0, false, []byte{0x0A}),
+		extAdvReport(0x01, 0, false, []byte{0x03}),
+	} {
+		if err := h.handleLEExtendedAdvertisingReport(e); err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+	}
+	if len(received) != 2 || !bytes.Equal(received[0], []byte{0x0A}) || !bytes.Equal(received[1], []byte{0x01, 0x02,
+		0x03}) {
+		t.Fatalf("Expected: [0A 010203], Received: %X", received)
+	}
+	if n := h.extAdvFrags.Len(); n != 0 {
+		t.Fatalf("Expected: 0 pending fragments, Received: %d", n)
+	}
+
+	// The fragments of the advertisers never completing their data are evicted.
+	for i := 0; i < 2*extAdvFragsSize; i++ {
+		if err := h.handleLEExtendedAdvertisingReport(extAdvReport(byte(i), 1, true, []byte{0x01})); err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+	}
+	if n := h.extAdvFrags.Len(); n != extAdvFragsSize {
+		t.Fatalf("Expected: %d pending fragments, Received: %d", extAdvFragsSize, n)
+	}
+
+	// The data exceeding the longest advertising data is dropped.
+	received = nil
+	chunk := make([]byte, 250)
+	for i := 0; i < 7; i++ {
+		if err := h.handleLEExtendedAdvertisingReport(extAdvReport(0xFF, 2, true, chunk)); err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+	}
+	if err := h.handleLEExtendedAdvertisingReport(extAdvReport(0xFF, 2, false, chunk)); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(received) != 0 || h.extAdvFrags.Contains(fmt.Sprintf("%X/0/2", [6]byte{0xFF})) {
+		t.Fatalf("Expected: data dropped, Received: %d advertisements", len(received))
+	}
+}
+
+// fakeSocket is a controller answering every command with a successful Command Complete event, and sending the events
+// of the test.
+type fakeSocket struct {
+	rx     chan []byte
+	cmds   chan []byte
+	closed chan struct{}
+}
+
+func newFakeSocket() *fakeSocket {
+	return &fakeSocket{rx: make(chan []byte, 16), cmds: make(chan []byte, 64), closed: make(chan struct{})}
+}
+
+func (s *fakeSocket) Read(b []byte) (int, error) {
+	select {
+	case p := <-s.rx:
+		return copy(b, p), nil
+	case <-s.closed:
+		return 0, io.EOF
+	}
+}
+
+func (s *fakeSocket) Write(b []byte) (int, error) {
+	s.cmds <- append([]byte(nil), b...)
+	s.rx <- []byte{pktTypeEvent, evt.CommandCompleteCode, 0x04, 0x01, b[1], b[2], 0x00}
+	return len(b), nil
+}
+
+func (s *fakeSocket) Close() error          { close(s.closed); return nil }
+func (s *fakeSocket) Closed() chan struct{} { return s.closed }
+
+// expectAdvertiseEnable waits for the LE Set Advertising Enable command enabling advertising.
+func (s *fakeSocket) expectAdvertiseEnable(t *testing.T) {
+	t.Helper()
+	enable := cmd.LESetAdvertiseEnable{AdvertisingEnable: 1}
+	for {
+		select {
+		case b := <-s.cmds:
+			if int(binary.LittleEndian.Uint16(b[1:3])) == enable.OpCode() && b[4] == 0x01 {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected: advertising enabled")
+		}
+	}
+}
+
+func TestAdvertisingEnabledAfterDisconnection(t *testing.T) {
+	skt := newFakeSocket()
+	h := NewHCI(slog.Default())
+	h.skt = skt
+	h.pool = NewPool(1+4+27, 4)
+	h.evth[0x3E] = h.handleLEMeta
+	h.evth[evt.CommandCompleteCode] = h.handleCommandComplete
+	h.evth[evt.DisconnectionCompleteCode] = h.handleDisconnectionComplete
+	h.subh[evt.LEConnectionCompleteSubCode] = h.handleLEConnectionComplete
+	if err := h.setAllowedCommands(1); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	go h.sktLoop()
+	defer func() {
+		h.Wait()
+		_ = skt.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.Advertise(ctx); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	skt.expectAdvertiseEnable(t)
+
+	// A central connects, which stops advertising, and disconnects.
+	skt.rx <- []byte{pktTypeEvent, 0x3E, 19, evt.LEConnectionCompleteSubCode, 0x00, 0x40, 0x00, roleSlave, 0x00,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x18, 0x00, 0x00, 0x00, 0x48, 0x00, 0x00}
+	if _, err := h.Accept(); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if err := <-h.AdvertisingStopped(); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	skt.rx <- []byte{pktTypeEvent, evt.DisconnectionCompleteCode, 0x04, 0x00, 0x40, 0x00, 0x13}
+	skt.expectAdvertiseEnable(t)
+	h.Wait()
+
+	// Advertising stopped by the caller is not enabled again.
+	if err := h.StopAdvertising(ctx); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	h.params.RLock()
+	wanted := h.params.advWanted
+	h.params.RUnlock()
+	if wanted {
+		t.Fatalf("Expected: advertising no longer wanted")
+	}
+}
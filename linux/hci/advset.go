@@ -0,0 +1,140 @@
+package hci
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/adv"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+)
+
+// legacyAdvHandle is the advertising set standing in for the legacy advertising commands once the extended ones are
+// in use.
+const legacyAdvHandle = 0x00
+
+// Advertising event properties of the extended advertising sets using legacy PDUs [Vol 2, Part E, 7.8.53].
+const (
+	advPropConnectable     = 1 << 0
+	advPropScannable       = 1 << 1
+	advPropDirected        = 1 << 2
+	advPropHighDutyCycle   = 1 << 3
+	advPropLegacy          = 1 << 4
+	advPropsInd            = advPropLegacy | advPropConnectable | advPropScannable
+	advPropsDirectLowDuty  = advPropLegacy | advPropConnectable | advPropDirected
+	advPropsDirectHighDuty = advPropsDirectLowDuty | advPropHighDutyCycle
+	advPropsScanInd        = advPropLegacy | advPropScannable
+	advPropsNonConnInd     = advPropLegacy
+)
+
+// ExtendedAdvertising reports whether the extended advertising commands are in use. Once they are, the controller
+// may reject the legacy advertising, scanning and connection commands, so the HCI uses their extended equivalents
+// from then on, even once the advertising sets are removed.
+func (h *HCI) ExtendedAdvertising() bool {
+	return h.extendedAdvertising.Load()
+}
+
+// NumAdvertisingSets returns the number of advertising sets the controller can advertise at the same time. It
+// requires a controller supporting LE Extended Advertising.
+func (h *HCI) NumAdvertisingSets(ctx context.Context) (int, error) {
+	if !h.leFeatures.Has(LEFeatureExtendedAdvertising) {
+		return 0, fmt.Errorf("advertising sets: %w", ErrUnsupportedFeature)
+	}
+	var rp cmd.LEReadNumberofSupportedAdvertisingSetsRP
+	if err := h.Send(ctx, &cmd.LEReadNumberofSupportedAdvertisingSets{}, &rp); err != nil {
+		return 0, err
+	}
+	return int(rp.NumSupportedAdvertisingSets), nil
+}
+
+// SetAdvertisingSet creates or updates the advertising set with the handle. The set advertises legacy PDUs, so that
+// scanners not supporting extended advertising see it, described by the legacy advertising parameters. The data and
+// scan response can each be at most 31 bytes long. The parameters can only be changed while the set is disabled. The
+// HCI then uses the extended commands for good, see ExtendedAdvertising.
+func (h *HCI) SetAdvertisingSet(ctx context.Context, handle uint8, p cmd.LESetAdvertisingParameters, ad, sr []byte) error {
+	if !h.leFeatures.Has(LEFeatureExtendedAdvertising) {
+		return fmt.Errorf("advertising sets: %w", ErrUnsupportedFeature)
+	}
+	if len(ad) > adv.MaxEIRPacketLength || len(sr) > adv.MaxEIRPacketLength {
+		return ble.ErrEIRPacketTooLong
+	}
+	h.extendedAdvertising.Store(true)
+
+	x := extendedAdvParams(handle, p)
+	if err := h.Send(ctx, &x, nil); err != nil {
+		return fmt.Errorf("unable to set extended advertising parameters: %w", err)
+	}
+	return h.setAdvertisingSetData(ctx, handle, x.AdvertisingEventProperties, ad, sr)
+}
+
+// setAdvertisingSetData replaces the data of the advertising set. It can be changed while the set is enabled.
+func (h *HCI) setAdvertisingSetData(ctx context.Context, handle uint8, props uint16, ad, sr []byte) error {
+	// Directed legacy PDUs carry no data.
+	if props&advPropDirected != 0 {
+		return nil
+	}
+	// operation 0x03: complete data, fragment preference 0x01: the controller should not fragment
+	if err := h.Send(ctx, &cmd.LESetExtendedAdvertisingData{AdvertisingHandle: handle, Operation: 0x03,
+		FragmentPreference: 0x01, AdvertisingData: ad}, nil); err != nil {
+		return fmt.Errorf("unable to set extended advertising data: %w", err)
+	}
+	// Only scannable sets accept a scan response.
+	if props&advPropScannable == 0 {
+		return nil
+	}
+	if err := h.Send(ctx, &cmd.LESetExtendedScanResponseData{AdvertisingHandle: handle, Operation: 0x03,
+		FragmentPreference: 0x01, ScanResponseData: sr}, nil); err != nil {
+		return fmt.Errorf("unable to set extended scan response data: %w", err)
+	}
+	return nil
+}
+
+// EnableAdvertisingSets starts or stops advertising the sets. Disabling without handles stops all the sets.
+func (h *HCI) EnableAdvertisingSets(ctx context.Context, enable bool, handles ...uint8) error {
+	c := cmd.LESetExtendedAdvertisingEnable{
+		AdvertisingHandle:            handles,
+		Duration:                     make([]uint16, len(handles)),
+		MaxExtendedAdvertisingEvents: make([]uint8, len(handles)),
+	}
+	if enable {
+		c.Enable = 1
+	}
+	return h.Send(ctx, &c, nil)
+}
+
+// RemoveAdvertisingSet removes the disabled advertising set from the controller.
+func (h *HCI) RemoveAdvertisingSet(ctx context.Context, handle uint8) error {
+	return h.Send(ctx, &cmd.LERemoveAdvertisingSet{AdvertisingHandle: handle}, nil)
+}
+
+// extendedAdvParams returns the extended advertising parameters using legacy PDUs equivalent to the legacy ones.
+func extendedAdvParams(handle uint8, p cmd.LESetAdvertisingParameters) cmd.LESetExtendedAdvertisingParameters {
+	var props uint16
+	switch p.AdvertisingType {
+	case 0x01:
+		props = advPropsDirectHighDuty
+	case 0x02:
+		props = advPropsScanInd
+	case 0x03:
+		props = advPropsNonConnInd
+	case 0x04:
+		props = advPropsDirectLowDuty
+	default:
+		props = advPropsInd
+	}
+	return cmd.LESetExtendedAdvertisingParameters{
+		AdvertisingHandle:             handle,
+		AdvertisingEventProperties:    props,
+		PrimaryAdvertisingIntervalMin: [3]byte{byte(p.AdvertisingIntervalMin), byte(p.AdvertisingIntervalMin >> 8)},
+		PrimaryAdvertisingIntervalMax: [3]byte{byte(p.AdvertisingIntervalMax), byte(p.AdvertisingIntervalMax >> 8)},
+		PrimaryAdvertisingChannelMap:  p.AdvertisingChannelMap,
+		OwnAddressType:                p.OwnAddressType,
+		PeerAddressType:               p.DirectAddressType,
+		PeerAddress:                   p.DirectAddress,
+		AdvertisingFilterPolicy:       p.AdvertisingFilterPolicy,
+		AdvertisingTXPower:            0x7F, // no preference
+		PrimaryAdvertisingPHY:         uint8(PHY1M),
+		SecondaryAdvertisingPHY:       uint8(PHY1M),
+		AdvertisingSID:                handle,
+	}
+}
@@ -1,6 +1,7 @@
 package hci
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"github.com/thomascriley/ble/linux/hci/cmd"
 	"github.com/thomascriley/ble/linux/l2cap"
 	"github.com/thomascriley/ble/linux/rfcomm"
+	"github.com/thomascriley/ble/linux/sdp"
 )
 
 type nameEvent struct {
@@ -105,11 +107,16 @@ func (h *HCI) sendBREDRParams(ctx context.Context, addr [6]byte, clockOffset uin
 	}
 }
 
-func (h *HCI) DialRFCOMM(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode, channel uint8) (cli ble.ClientRFCOMM, err error) {
+// DialBREDR returns the BR/EDR connection to the remote device, creating the ACL link unless one exists already. The
+// channels opened on the connection share its link.
+func (h *HCI) DialBREDR(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8) (*Conn, error) {
 	b, err := net.ParseMAC(a.String())
 	if err != nil {
 		return nil, ErrInvalidAddr
 	}
+	if c := h.bredrConn(b); c != nil {
+		return c, nil
+	}
 	addr := [6]byte{b[5], b[4], b[3], b[2], b[1], b[0]}
 
 	if err := h.sendBREDRParams(ctx, addr, clockOffset, pageScanRepetitionMode); err != nil {
@@ -122,71 +129,312 @@ func (h *HCI) DialRFCOMM(ctx context.Context, a ble.Addr, clockOffset uint16, pa
 	case <-ctx.Done():
 		return nil, h.cancelConnectionBREDR(ctx, addr, fmt.Errorf("connection timed out"))
 	case c := <-h.chMasterBREDRConn:
-
-		// increment to the next available dynamicCID channel id
-		c.SourceID = h.dynamicCID
-		if h.dynamicCID == 0xFFFF {
-			h.dynamicCID = cidDynamicStart
-		} else {
-			// this doesn't work for some reason, maybe they need to be reused after
-			// connection closes
-			//h.dynamicCID++
-		}
-
 		timeout := 15 * time.Second
 
 		if err = c.InformationRequest(ctx, l2cap.InfoTypeConnectionlessMTU, timeout); err != nil {
 			h.log.Warn("failed to make information request for connectionless mtu", log.Error(err))
-			//c.Close()
-			//return nil, err
 		}
 
 		if err = c.InformationRequest(ctx, l2cap.InfoTypeExtendedFeatures, timeout); err != nil {
 			h.log.Warn("failed to make information request for extended features", log.Error(err))
-			//c.Close()
-			//return nil, err
 		}
 
 		// 1.2 - 2.1 + EDR will return not supported
 		if err = c.InformationRequest(ctx, l2cap.InfoTypeFixedChannels, timeout); err != nil {
 			h.log.Warn("failed to make information request for fixed channels", log.Error(err))
 		}
+		return c, nil
+	}
+}
 
-		if err = c.ConnectionRequest(ctx, psmRFCOMM, timeout); err != nil {
-			_ = c.Close(ctx)
-			return nil, fmt.Errorf("unable to make connection request: %w", err)
+// bredrConn returns the BR/EDR connection to the address, nil if there is none.
+func (h *HCI) bredrConn(addr net.HardwareAddr) *Conn {
+	h.muConns.Lock()
+	defer h.muConns.Unlock()
+	for _, c := range h.conns {
+		if c.isLE() {
+			continue
+		}
+		if ra, ok := c.RemoteAddr().(net.HardwareAddr); ok && bytes.Equal(ra, addr) {
+			select {
+			case <-c.Disconnected():
+				continue
+			default:
+				return c
+			}
 		}
+	}
+	return nil
+}
 
-		// Even if all default values are acceptable, a Configuration Request
-		// packet with no options shall be sent. [Vol 3, Part A, 4.4]
-		// TODO: make this non-static
+// DialL2CAPChannel opens a channel to the protocol or service listening on the PSM of the remote device, configured
+// with the parameters p, over the BR/EDR connection to the device.
+func (h *HCI) DialL2CAPChannel(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8,
+	psm uint16, p ChannelParams) (*BREDRChannel, error) {
+	c, err := h.DialBREDR(ctx, a, clockOffset, pageScanRepetitionMode)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := c.DialChannel(ctx, psm, p)
+	if err != nil {
+		c.closeIfIdle(ctx)
+		return nil, err
+	}
+	return ch, nil
+}
 
-		mtuOption := &l2cap.MTUOption{MTU: 0x03f5}
-		//mtuOption.SetHint(0x01)
-		if err = c.ConfigurationRequest(ctx, []l2cap.Option{mtuOption}, timeout); err != nil {
-			_ = c.Close(ctx)
-			return nil, fmt.Errorf("unable to make configuration request: %w", err)
+// DialRFCOMM opens an RFCOMM channel, a DLC, to the server channel of the remote device. The DLCs to the same device
+// share an RFCOMM session, over a single L2CAP channel, which closes with its last DLC.
+func (h *HCI) DialRFCOMM(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode, channel uint8) (cli ble.ClientRFCOMM, err error) {
+	// A session found closing is dialed again once.
+	for retry := true; ; retry = false {
+		s, err := h.rfcommSession(ctx, a, clockOffset, pageScanRepetitionMode)
+		if err != nil {
+			return nil, err
+		}
+		c, err := s.Dial(ctx, channel)
+		if errors.Is(err, rfcomm.ErrSessionClosed) && retry {
+			h.removeRFCOMMSession(s)
+			continue
 		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to dial client: %w", err)
+		}
+		return c, nil
+	}
+}
 
-		select {
-		case <-h.Closed():
-			_ = c.Close(ctx)
-			return nil, fmt.Errorf("hci device closed: %w", h.err)
-		case <-ctx.Done():
-			_ = c.Close(ctx)
-			return nil, errors.New("timed out waiting for cfgRequest")
-		case <-c.cfgRequest:
+// rfcommSession returns the RFCOMM session to the remote device, opening one if there is none. The concurrent calls
+// for the same device wait for the session a single one of them opens.
+func (h *HCI) rfcommSession(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8) (*rfcomm.Session, error) {
+	key, err := rfcommKey(a)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		h.muRFCOMM.Lock()
+		if s, ok := h.rfcommSessions[key]; ok {
+			h.muRFCOMM.Unlock()
+			return s, nil
+		}
+		if d, ok := h.rfcommDials[key]; ok {
+			h.muRFCOMM.Unlock()
+			select {
+			case <-d.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			// The session is opened again if the caller opening it gave up.
+			if errors.Is(d.err, context.Canceled) || errors.Is(d.err, context.DeadlineExceeded) {
+				continue
+			}
+			return d.s, d.err
 		}
+		d := &rfcommDial{done: make(chan struct{})}
+		if h.rfcommDials == nil {
+			h.rfcommDials = make(map[string]*rfcommDial)
+		}
+		h.rfcommDials[key] = d
+		srv := h.rfcommServerLocked()
+		h.muRFCOMM.Unlock()
 
-		cli := rfcomm.NewClient(h.log, c, channel)
-		if err := cli.DialContext(ctx); err != nil {
-			_ = c.Close(ctx)
-			return nil, fmt.Errorf("unable to dial client: %w", err)
+		d.s, d.err = h.openRFCOMMSession(ctx, a, clockOffset, pageScanRepetitionMode, srv)
+
+		h.muRFCOMM.Lock()
+		delete(h.rfcommDials, key)
+		if d.err == nil {
+			h.addRFCOMMSessionLocked(key, d.s)
 		}
+		h.muRFCOMM.Unlock()
+		close(d.done)
+		return d.s, d.err
+	}
+}
+
+// rfcommDial is an RFCOMM session being opened, whose result is set once done is closed.
+type rfcommDial struct {
+	done chan struct{}
+	s    *rfcomm.Session
+	err  error
+}
+
+// openRFCOMMSession opens an RFCOMM session over a new L2CAP channel to the remote device.
+func (h *HCI) openRFCOMMSession(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8,
+	srv *rfcomm.Server) (*rfcomm.Session, error) {
+	ch, err := h.DialL2CAPChannel(ctx, a, clockOffset, pageScanRepetitionMode, psmRFCOMM,
+		ChannelParams{ModeParams: h.modeParams})
+	if err != nil {
+		return nil, err
+	}
+	return rfcomm.OpenSession(ctx, rfcommConn{ch}, srv, h.log)
+}
+
+// addRFCOMMSessionLocked registers the session to the remote device until it closes. A session opened by each device
+// at the same time is not registered, but still runs.
+func (h *HCI) addRFCOMMSessionLocked(key string, s *rfcomm.Session) {
+	if _, ok := h.rfcommSessions[key]; ok {
+		return
+	}
+	if h.rfcommSessions == nil {
+		h.rfcommSessions = make(map[string]*rfcomm.Session)
+	}
+	h.rfcommSessions[key] = s
+	go func() {
+		<-s.Closed()
+		h.removeRFCOMMSession(s)
+	}()
+}
+
+// removeRFCOMMSession unregisters the session, if it is still registered.
+func (h *HCI) removeRFCOMMSession(s *rfcomm.Session) {
+	key, err := rfcommKey(s.RemoteAddr())
+	if err != nil {
+		return
+	}
+	h.muRFCOMM.Lock()
+	defer h.muRFCOMM.Unlock()
+	if h.rfcommSessions[key] == s {
+		delete(h.rfcommSessions, key)
+	}
+}
+
+// rfcommServerLocked returns the RFCOMM server, creating it if needed.
+func (h *HCI) rfcommServerLocked() *rfcomm.Server {
+	if h.rfcommServer == nil {
+		h.rfcommServer = rfcomm.NewServer(h.log)
+	}
+	return h.rfcommServer
+}
+
+// rfcommKey returns the key of the RFCOMM sessions to the device, regardless of the format of its address.
+func rfcommKey(a ble.Addr) (string, error) {
+	b, err := net.ParseMAC(a.String())
+	if err != nil {
+		return "", ErrInvalidAddr
+	}
+	return b.String(), nil
+}
+
+// DialRFCOMMService opens an RFCOMM channel to the service of the class, whose server channel is looked up with SDP
+// [Vol 3, Part B]. The first service record of the class listing an RFCOMM channel is used.
+func (h *HCI) DialRFCOMMService(ctx context.Context, a ble.Addr, clockOffset uint16, pageScanRepetitionMode uint8,
+	class ble.UUID) (ble.ClientRFCOMM, error) {
+	ch, err := h.DialL2CAPChannel(ctx, a, clockOffset, pageScanRepetitionMode, psmSDP, ChannelParams{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sdp channel: %w", err)
+	}
+	recs, err := sdp.NewClient(ch, ch.RxMTU(), ch.TxMTU()).ServiceSearchAttribute(ctx, []ble.UUID{class},
+		sdp.Attribute(sdp.AttrServiceRecordHandle), sdp.Attribute(sdp.AttrProtocolDescriptorList))
+	if err != nil {
+		_ = ch.release(ctx)
+		return nil, fmt.Errorf("unable to search service %s: %w", class, err)
+	}
+	for _, r := range recs {
+		channel, ok := r.RFCOMMChannel()
+		if !ok {
+			continue
+		}
+		// The sdp channel is closed once the RFCOMM one is open, so that the ACL link stays up meanwhile.
+		cli, err := h.DialRFCOMM(ctx, a, clockOffset, pageScanRepetitionMode, channel)
+		_ = ch.release(ctx)
 		return cli, err
 	}
+	_ = ch.release(ctx)
+	return nil, fmt.Errorf("no rfcomm channel found for service %s", class)
 }
 
+// closeIfIdle disconnects the BR/EDR connection once its last channel is closed.
+func (c *Conn) closeIfIdle(ctx context.Context) {
+	if len(c.bredrChannels()) == 0 {
+		_ = c.Close(ctx)
+	}
+}
+
+// ServeSDP answers the SDP requests of the remote devices from the records of the server, until the listener returned
+// is closed. The remote devices connect once accepted by the handler set with SetBREDRAcceptHandler.
+func (h *HCI) ServeSDP(srv *sdp.Server) (*BREDRListener, error) {
+	l, err := h.ListenL2CAPChannel(psmSDP, ChannelParams{})
+	if err != nil {
+		return nil, err
+	}
+	h.Add(1)
+	go func() {
+		defer h.Done()
+		for {
+			ch, err := l.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				if err := srv.Serve(ch, ch.RxMTU(), ch.TxMTU()); err != nil {
+					h.log.Debug("sdp server stopped", log.Error(err))
+				}
+				_ = ch.Close()
+			}()
+		}
+	}()
+	return l, nil
+}
+
+// ListenRFCOMM listens for the RFCOMM connections to the server channel, or to a server channel it allocates if
+// channel is 0. The RFCOMM sessions are accepted on the RFCOMM PSM from the first call on. Remote devices connect once
+// accepted by the handler set with SetBREDRAcceptHandler.
+func (h *HCI) ListenRFCOMM(channel uint8) (*rfcomm.Listener, error) {
+	h.muRFCOMM.Lock()
+	defer h.muRFCOMM.Unlock()
+	if h.rfcommListener == nil {
+		l, err := h.ListenL2CAPChannel(psmRFCOMM, ChannelParams{ModeParams: h.modeParams})
+		if err != nil {
+			return nil, fmt.Errorf("unable to listen on rfcomm psm: %w", err)
+		}
+		srv := h.rfcommServerLocked()
+		h.Add(1)
+		go func() {
+			defer h.Done()
+			for {
+				ch, err := l.Accept(context.Background())
+				if err != nil {
+					return
+				}
+				s := srv.Serve(rfcommConn{ch})
+				if key, err := rfcommKey(s.RemoteAddr()); err == nil {
+					h.muRFCOMM.Lock()
+					h.addRFCOMMSessionLocked(key, s)
+					h.muRFCOMM.Unlock()
+				}
+			}
+		}()
+		h.rfcommListener = l
+	}
+	return h.rfcommServer.Listen(channel)
+}
+
+// release closes the channel, and the ACL link unless other channels use it.
+func (ch *BREDRChannel) release(ctx context.Context) error {
+	err := ch.Close()
+	ch.conn.closeIfIdle(ctx)
+	return err
+}
+
+// rfcommConn adapts a BR/EDR channel to the ble.Conn RFCOMM runs on. Closing it closes the channel, and the ACL link
+// unless other channels use it.
+type rfcommConn struct {
+	*BREDRChannel
+}
+
+func (r rfcommConn) Close(ctx context.Context) error {
+	return r.release(ctx)
+}
+
+func (r rfcommConn) LocalAddr() ble.Addr  { return r.conn.LocalAddr() }
+func (r rfcommConn) RemoteAddr() ble.Addr { return r.conn.RemoteAddr() }
+
+// The MTUs are negotiated by the configuration of the channel.
+func (r rfcommConn) SetRxMTU(int) {}
+func (r rfcommConn) SetTxMTU(int) {}
+
+func (r rfcommConn) Disconnected() <-chan struct{} { return r.Closed() }
+
 func (h *HCI) cancelConnectionBREDR(ctx context.Context, addr [6]byte, connErr error) error {
 	h.params.Lock()
 	h.params.connCancelBREDR.BDADDR = addr
@@ -0,0 +1,241 @@
+package hci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+	"github.com/thomascriley/ble/linux/hci/evt"
+	"github.com/thomascriley/ble/linux/l2cap"
+	"github.com/thomascriley/ble/log"
+)
+
+// linkTypeACL is the link type of the ACL connection requests, as opposed to the SCO and eSCO ones
+// [Vol 2, Part E, 7.7.4].
+const linkTypeACL = 0x01
+
+// acceptTimeout bounds the commands accepting or rejecting a connection request, which the controller times out on
+// its own.
+const acceptTimeout = 10 * time.Second
+
+// BREDRConnRequest is a BR/EDR connection request of a remote device [Vol 2, Part E, 7.7.4].
+type BREDRConnRequest struct {
+	Addr          ble.Addr
+	ClassOfDevice uint32
+	LinkType      uint8
+}
+
+// acceptedConnectionComplete is the completion of a connection accepted by the local device, which stays slave of the
+// link.
+type acceptedConnectionComplete struct {
+	evt.ConnectionComplete
+}
+
+func (e acceptedConnectionComplete) Role() uint8 { return roleSlave }
+
+// SetConnectable makes the controller scan for the pages of the remote devices connecting to it, or stop doing so
+// [Vol 2, Part E, 7.3.18].
+func (h *HCI) SetConnectable(ctx context.Context, connectable bool) error {
+	c := &cmd.WriteScanEnable{}
+	if connectable {
+		c.ScanEnable = 0x02 // Page scan enabled, inquiry scan disabled.
+	}
+	if err := h.Send(ctx, c, nil); err != nil {
+		return fmt.Errorf("unable to write scan enable: %w", err)
+	}
+	return nil
+}
+
+// handleConnectionRequest accepts or rejects the connection request. The request is answered from its own goroutine,
+// as the policy may block and the commands can not be sent from the event loop.
+func (h *HCI) handleConnectionRequest(b []byte) error {
+	e := evt.ConnectionRequest(append([]byte(nil), b...))
+	h.Add(1)
+	go func() {
+		defer h.Done()
+		h.answerConnectionRequest(e)
+	}()
+	return nil
+}
+
+func (h *HCI) answerConnectionRequest(e evt.ConnectionRequest) {
+	a, cod := e.BDADDR(), e.ClassOfDevice()
+	req := BREDRConnRequest{
+		Addr:          net.HardwareAddr([]byte{a[5], a[4], a[3], a[2], a[1], a[0]}),
+		ClassOfDevice: uint32(cod[0]) | uint32(cod[1])<<8 | uint32(cod[2])<<16,
+		LinkType:      e.LinkType(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), acceptTimeout)
+	defer cancel()
+
+	// Only ACL links are accepted, as long as the policy allows them.
+	if req.LinkType != linkTypeACL || h.bredrAcceptHandler == nil || !h.bredrAcceptHandler(req) {
+		if err := h.Send(ctx, &cmd.RejectConnectionRequest{BDADDR: a, Reason: uint8(ErrBDADDR)}, nil); err != nil {
+			h.log.Debug("unable to reject connection request", log.Error(err))
+		}
+		return
+	}
+
+	h.muConns.Lock()
+	h.acceptedBREDR[a] = struct{}{}
+	h.muConns.Unlock()
+	if err := h.Send(ctx, &cmd.AcceptConnectionRequest{BDADDR: a, Role: roleSlave}, nil); err != nil {
+		h.log.Debug("unable to accept connection request", log.Error(err))
+		h.muConns.Lock()
+		delete(h.acceptedBREDR, a)
+		h.muConns.Unlock()
+	}
+}
+
+// BREDRListener accepts the BR/EDR channels opened by remote devices on a PSM.
+type BREDRListener struct {
+	h        *HCI
+	psm      uint16
+	params   ChannelParams
+	chAccept chan *BREDRChannel
+
+	mu       sync.Mutex
+	closed   bool
+	chClosed chan struct{}
+}
+
+// ListenL2CAPChannel listens for the BR/EDR channels opened on the PSM, which are configured with the parameters p.
+// Remote devices can only connect once accepted by the handler set with SetBREDRAcceptHandler.
+func (h *HCI) ListenL2CAPChannel(psm uint16, p ChannelParams) (*BREDRListener, error) {
+	// PSMs are odd, and the least significant bit of their most significant octet is 0 [Vol 3, Part A, 4.2].
+	if psm&0x0101 != 0x0001 {
+		return nil, fmt.Errorf("invalid PSM 0x%04X", psm)
+	}
+	mp, err := p.ModeParams.withDefaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel parameters: %w", err)
+	}
+	p.ModeParams = mp
+
+	h.muBREDR.Lock()
+	defer h.muBREDR.Unlock()
+	if _, ok := h.bredrListeners[psm]; ok {
+		return nil, fmt.Errorf("already listening on PSM 0x%04X", psm)
+	}
+	if h.bredrListeners == nil {
+		h.bredrListeners = make(map[uint16]*BREDRListener)
+	}
+	l := &BREDRListener{
+		h:        h,
+		psm:      psm,
+		params:   p,
+		chAccept: make(chan *BREDRChannel, listenBacklog),
+		chClosed: make(chan struct{}),
+	}
+	h.bredrListeners[psm] = l
+	return l, nil
+}
+
+func (h *HCI) bredrListener(psm uint16) *BREDRListener {
+	h.muBREDR.Lock()
+	defer h.muBREDR.Unlock()
+	return h.bredrListeners[psm]
+}
+
+// PSM returns the PSM the listener accepts channels on.
+func (l *BREDRListener) PSM() uint16 { return l.psm }
+
+// Accept waits for the next channel opened, and configured, by a remote device.
+func (l *BREDRListener) Accept(ctx context.Context) (*BREDRChannel, error) {
+	select {
+	case ch := <-l.chAccept:
+		return ch, nil
+	case <-l.chClosed:
+		return nil, io.ErrClosedPipe
+	case <-l.h.Closed():
+		return nil, io.ErrClosedPipe
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops listening. The channels already accepted stay open, those waiting to be accepted are closed.
+func (l *BREDRListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.chClosed)
+	l.mu.Unlock()
+
+	l.h.muBREDR.Lock()
+	if l.h.bredrListeners[l.psm] == l {
+		delete(l.h.bredrListeners, l.psm)
+	}
+	l.h.muBREDR.Unlock()
+
+	for {
+		select {
+		case ch := <-l.chAccept:
+			_ = ch.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// deliver queues the channel to be accepted. It reports false if the listener is closed or its backlog full.
+func (l *BREDRListener) deliver(ch *BREDRChannel) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	select {
+	case l.chAccept <- ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// acceptBREDRChannel opens the channel requested by the remote device if a listener is registered for its PSM. It
+// returns the result of the connection response, and the channel and its listener once opened.
+func (c *Conn) acceptBREDRChannel(req l2cap.ConnectionRequest) (*BREDRChannel, *BREDRListener, uint16) {
+	l := c.hci.bredrListener(req.PSM)
+	switch {
+	case l == nil || c.isLE():
+		return nil, nil, l2cap.ConnectionResultPSMNotSupported
+	case req.SourceCID < cidDynamicStart:
+		return nil, nil, l2cap.ConnectionResultInvalidSourceCID
+	case c.bredrChannelByRemoteCID(req.SourceCID) != nil:
+		return nil, nil, l2cap.ConnectionResultSourceCIDAlreadyAllocated
+	}
+	ch := newBREDRChannel(c, req.PSM, l.params.ModeParams)
+	ch.remoteCID = req.SourceCID
+	if err := c.addBREDRChannel(ch); err != nil {
+		return nil, nil, l2cap.ConnectionResultNoResources
+	}
+	return ch, l, l2cap.ConnectionResultSuccessful
+}
+
+// configureAccepted configures the channel accepted with the parameters of the listener, then delivers it. It runs
+// on its own goroutine, as the recombine loop of the connection reads the responses.
+func (ch *BREDRChannel) configureAccepted(l *BREDRListener) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*bredrSignalTimeout)
+	defer cancel()
+	if err := ch.conn.checkMode(ctx, l.params.Mode); err != nil {
+		ch.abort(err)
+		return
+	}
+	if err := ch.setup(ctx, l.params); err != nil {
+		ch.abort(err)
+		return
+	}
+	if !l.deliver(ch) {
+		ch.abort(errors.New("listener closed or backlog full"))
+	}
+}
@@ -0,0 +1,483 @@
+package hci
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/internal/deadline"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+const (
+	// cidDynamicEnd is the last CID dynamically allocated on ACL-U logical links [Vol 3, Part A, 2.1].
+	cidDynamicEnd uint16 = 0xFFFF
+
+	// bredrSignalTimeout bounds the signaling requests opening, configuring and closing the channels.
+	bredrSignalTimeout = 15 * time.Second
+
+	// maxFlushTimeoutSlots is the largest automatic flush timeout of the controller, in 0.625 ms slots
+	// [Vol 2, Part E, 7.3.30].
+	maxFlushTimeoutSlots = 0x07FF
+)
+
+// FlushTimeoutInfinite is the flush timeout of the channels whose packets are retransmitted until they are
+// acknowledged, the default [Vol 3, Part A, 5.2].
+const FlushTimeoutInfinite = 0xFFFF
+
+// ChannelError is the result of a refused connection request [Vol 3, Part A, 4.3].
+type ChannelError uint16
+
+func (e ChannelError) Error() string {
+	switch uint16(e) {
+	case l2cap.ConnectionResultPSMNotSupported:
+		return "PSM not supported"
+	case l2cap.ConnectionResultSecurityBlock:
+		return "security block"
+	case l2cap.ConnectionResultNoResources:
+		return "no resources available"
+	case l2cap.ConnectionResultInvalidSourceCID:
+		return "invalid source CID"
+	case l2cap.ConnectionResultSourceCIDAlreadyAllocated:
+		return "source CID already allocated"
+	default:
+		return fmt.Sprintf("connection refused (0x%04X)", uint16(e))
+	}
+}
+
+// ChannelParams are the parameters of a BR/EDR channel, proposed to the remote device by the configuration request
+// [Vol 3, Part A, 5].
+type ChannelParams struct {
+	ModeParams
+
+	// FlushTimeout is the time in milliseconds the local device attempts to transmit a packet before it flushes it, 1
+	// for no retransmission. Zero leaves the default, FlushTimeoutInfinite. As the controller flushes the packets of
+	// the whole ACL link, it applies to the other channels of the link too.
+	FlushTimeout uint16
+
+	// QoS is the quality of service of the traffic the local device sends, best effort if nil.
+	QoS *l2cap.QoSOption
+}
+
+// options returns the options of the configuration request proposing the parameters.
+func (p ChannelParams) options() []l2cap.Option {
+	opts := p.ModeParams.options()
+	if p.FlushTimeout != 0 {
+		opts = append(opts, &l2cap.FlushTimeoutOption{FlushTimeout: p.FlushTimeout})
+	}
+	if p.QoS != nil {
+		qos := *p.QoS
+		opts = append(opts, &qos)
+	}
+	return opts
+}
+
+// BREDRChannel is a connection oriented channel of a BR/EDR connection [Vol 3, Part A, 3.1]. Unlike the LE credit
+// based channels, it keeps the boundaries of the SDUs: Write sends one SDU and Read returns one SDU. It is a net.Conn.
+type BREDRChannel struct {
+	conn *Conn
+	psm  uint16
+
+	localCID uint16
+
+	// remoteCID is set by the recombine loop of the connection, before the connection response is delivered.
+	remoteCID uint16
+
+	// muMode guards the configuration of the channel and, once both devices configured the Enhanced Retransmission
+	// or Streaming mode, the engine of the mode.
+	muMode sync.Mutex
+	mode   modeConfig
+	ertm   *ertm
+
+	// chConfigured is closed once both devices configured the channel.
+	chConfigured chan struct{}
+
+	// chSDU receives the SDUs of the Basic mode.
+	chSDU chan []byte
+
+	readDeadline  deadline.Deadline
+	writeDeadline deadline.Deadline
+
+	closeOnce sync.Once
+	chClosed  chan struct{}
+}
+
+func newBREDRChannel(c *Conn, psm uint16, p ModeParams) *BREDRChannel {
+	return &BREDRChannel{
+		conn:         c,
+		psm:          psm,
+		mode:         modeConfig{local: p},
+		chConfigured: make(chan struct{}),
+		chSDU:        make(chan []byte, 16),
+		chClosed:     make(chan struct{}),
+	}
+}
+
+// PSM returns the protocol/service multiplexer of the channel.
+func (ch *BREDRChannel) PSM() uint16 { return ch.psm }
+
+// Conn returns the BR/EDR connection the channel is opened on.
+func (ch *BREDRChannel) Conn() *Conn { return ch.conn }
+
+// Mode returns the mode of the channel, l2cap.ModeBasic, l2cap.ModeEnhancedRetransmission or l2cap.ModeStreaming.
+func (ch *BREDRChannel) Mode() uint8 { return ch.mode.local.Mode }
+
+// RxMTU returns the size of the largest SDU the channel accepts.
+func (ch *BREDRChannel) RxMTU() int { return int(ch.mode.local.MTU) }
+
+// TxMTU returns the size of the largest SDU the remote device accepts.
+func (ch *BREDRChannel) TxMTU() int {
+	ch.muMode.Lock()
+	defer ch.muMode.Unlock()
+	if ch.mode.txMTU == 0 {
+		return defaultACLMTU
+	}
+	return ch.mode.txMTU
+}
+
+// Closed returns a channel closed once the channel is closed.
+func (ch *BREDRChannel) Closed() <-chan struct{} { return ch.chClosed }
+
+// LocalAddr returns the address of the local device, and the PSM of the channel.
+func (ch *BREDRChannel) LocalAddr() net.Addr {
+	return ble.NetAddr{Addr: ch.conn.LocalAddr(), Net: "l2cap", Port: int(ch.psm)}
+}
+
+// RemoteAddr returns the address of the remote device, and the PSM of the channel.
+func (ch *BREDRChannel) RemoteAddr() net.Addr {
+	return ble.NetAddr{Addr: ch.conn.RemoteAddr(), Net: "l2cap", Port: int(ch.psm)}
+}
+
+// SetDeadline sets the read and write deadlines of the channel.
+func (ch *BREDRChannel) SetDeadline(t time.Time) error {
+	ch.readDeadline.Set(t)
+	ch.writeDeadline.Set(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline of the reads, past which they return os.ErrDeadlineExceeded. A zero value clears
+// it.
+func (ch *BREDRChannel) SetReadDeadline(t time.Time) error {
+	ch.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the writes, past which they return os.ErrDeadlineExceeded. A zero value
+// clears it. In the Enhanced Retransmission and Streaming modes, the SDU the write expired on is still sent.
+func (ch *BREDRChannel) SetWriteDeadline(t time.Time) error {
+	ch.writeDeadline.Set(t)
+	return nil
+}
+
+// Read reads the next SDU received, returning io.EOF once the channel is closed. If b is shorter than the SDU, the
+// SDU is dropped and io.ErrShortBuffer returned.
+func (ch *BREDRChannel) Read(b []byte) (int, error) {
+	sdu, err := ch.nextSDU()
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < len(sdu) {
+		return 0, fmt.Errorf("sdu of %d bytes exceeds buffer: %w", len(sdu), io.ErrShortBuffer)
+	}
+	return copy(b, sdu), nil
+}
+
+// nextSDU returns the next SDU received, those received before the channel closed included.
+func (ch *BREDRChannel) nextSDU() ([]byte, error) {
+	expired := ch.readDeadline.Done()
+	if e := ch.modeEngine(); e != nil {
+		return e.read(expired)
+	}
+	select {
+	case sdu := <-ch.chSDU:
+		return sdu, nil
+	default:
+	}
+	select {
+	case sdu := <-ch.chSDU:
+		return sdu, nil
+	case <-expired:
+		return nil, os.ErrDeadlineExceeded
+	case <-ch.chClosed:
+		return nil, io.EOF
+	}
+}
+
+// Write sends b as one SDU, of at most TxMTU bytes.
+func (ch *BREDRChannel) Write(b []byte) (int, error) {
+	expired := ch.writeDeadline.Done()
+	select {
+	case <-ch.chClosed:
+		return 0, io.ErrClosedPipe
+	case <-expired:
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+	if len(b) > ch.TxMTU() {
+		return 0, fmt.Errorf("payload exceeds mtu: %w", io.ErrShortWrite)
+	}
+	if e := ch.modeEngine(); e != nil {
+		if err := e.write(b, expired); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	p := make([]byte, 4+len(b))
+	binary.LittleEndian.PutUint16(p[0:2], uint16(len(b)))
+	binary.LittleEndian.PutUint16(p[2:4], ch.remoteCID)
+	copy(p[4:], b)
+	if _, err := ch.conn.writePDU(p); err != nil {
+		return 0, fmt.Errorf("unable to write b-frame: %w", err)
+	}
+	return len(b), nil
+}
+
+// receive handles a PDU received on the channel. It runs on the recombine loop of the connection.
+func (ch *BREDRChannel) receive(p pdu) {
+	if e := ch.modeEngine(); e != nil {
+		e.receive(p)
+		return
+	}
+	if len(p.payload()) > ch.RxMTU() {
+		ch.conn.log.Debug(fmt.Sprintf("dropping b-frame of %d bytes larger than mtu %d", len(p.payload()), ch.RxMTU()))
+		return
+	}
+	sdu := make([]byte, len(p.payload()))
+	copy(sdu, p.payload())
+	// Basic mode has no flow control, the SDUs the reader falls behind on are dropped rather than blocking the other
+	// channels of the connection.
+	select {
+	case ch.chSDU <- sdu:
+	case <-ch.chClosed:
+	case <-ch.conn.Disconnected():
+	default:
+		ch.conn.log.Debug(fmt.Sprintf("dropping b-frame of %d bytes on channel %04X not read", len(sdu), ch.localCID))
+	}
+}
+
+// Close disconnects the channel.
+func (ch *BREDRChannel) Close() error {
+	select {
+	case <-ch.chClosed:
+		return nil
+	case <-ch.conn.Disconnected():
+		ch.shutdown()
+		return nil
+	default:
+	}
+	defer ch.shutdown()
+
+	if err := ch.conn.Signal(context.Background(),
+		&l2cap.DisconnectRequest{DestinationCID: ch.remoteCID, SourceCID: ch.localCID},
+		&l2cap.DisconnectResponse{}, bredrSignalTimeout); err != nil {
+		return fmt.Errorf("unable to disconnect l2cap channel: %w", err)
+	}
+	return nil
+}
+
+// abort closes the channel after its mode failed. The engine of the mode may call it from its timers, so the
+// goroutine is tracked by the HCI rather than the connection.
+func (ch *BREDRChannel) abort(err error) {
+	ch.conn.log.Debug("closing l2cap channel: " + err.Error())
+	ch.conn.hci.Add(1)
+	go func() {
+		defer ch.conn.hci.Done()
+		_ = ch.Close()
+	}()
+}
+
+// shutdown releases the channel, once disconnected.
+func (ch *BREDRChannel) shutdown() {
+	ch.closeOnce.Do(func() {
+		ch.conn.removeBREDRChannel(ch)
+		if e := ch.modeEngine(); e != nil {
+			e.close()
+		}
+		close(ch.chClosed)
+	})
+}
+
+// configure applies the configuration request of the remote device. It returns the options and result of the
+// response.
+func (ch *BREDRChannel) configure(req l2cap.ConfigurationRequest) ([]l2cap.Option, uint16) {
+	ch.muMode.Lock()
+	defer ch.muMode.Unlock()
+	opts, result := ch.mode.request(req.ConfigurationOptions)
+
+	// Options may continue in further requests [Vol 3, Part A, 4.4].
+	if result == l2cap.ConfigurationResultSuccessful && req.Flags&0x0001 == 0 {
+		ch.mode.remoteDone = true
+		ch.startMode()
+	}
+	return opts, result
+}
+
+// configured applies the successful response to the last configuration request of the local device.
+func (ch *BREDRChannel) configured(opts []l2cap.Option) {
+	ch.muMode.Lock()
+	defer ch.muMode.Unlock()
+	ch.mode.response(opts)
+	ch.mode.localDone = true
+	ch.startMode()
+}
+
+// open closes chConfigured once both devices configured the channel. It is called once the response to the request of
+// the remote device is sent, so the channel is not used before the remote device knows its configuration is accepted.
+func (ch *BREDRChannel) open() {
+	ch.muMode.Lock()
+	defer ch.muMode.Unlock()
+	if !ch.mode.localDone || !ch.mode.remoteDone {
+		return
+	}
+	select {
+	case <-ch.chConfigured:
+	default:
+		close(ch.chConfigured)
+	}
+}
+
+// waitConfigured waits for both devices to configure the channel.
+func (ch *BREDRChannel) waitConfigured(ctx context.Context) error {
+	select {
+	case <-ch.chConfigured:
+		return nil
+	case <-ch.chClosed:
+		return errors.New("l2cap channel closed")
+	case <-ch.conn.Disconnected():
+		return errors.New("disconnected")
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(bredrSignalTimeout):
+		return errors.New("timed out waiting for the configuration of the remote device")
+	}
+}
+
+// DialChannel opens a channel to the protocol or service listening on the PSM of the remote device over the BR/EDR
+// connection [Vol 3, Part A, 4.2], configured with the parameters p.
+func (c *Conn) DialChannel(ctx context.Context, psm uint16, p ChannelParams) (*BREDRChannel, error) {
+	if c.isLE() {
+		return nil, errors.New("l2cap channels to a PSM are only available on BR/EDR connections")
+	}
+	mp, err := p.ModeParams.withDefaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel parameters: %w", err)
+	}
+	p.ModeParams = mp
+	if err = c.checkMode(ctx, p.Mode); err != nil {
+		return nil, err
+	}
+	ch := newBREDRChannel(c, psm, p.ModeParams)
+	if err = c.addBREDRChannel(ch); err != nil {
+		return nil, err
+	}
+
+	rsp := &l2cap.ConnectionResponse{}
+	if err = c.Signal(ctx, &l2cap.ConnectionRequest{PSM: psm, SourceCID: ch.localCID}, rsp,
+		bredrSignalTimeout); err != nil {
+		ch.shutdown()
+		return nil, fmt.Errorf("unable to request l2cap channel: %w", err)
+	}
+	if rsp.Result != l2cap.ConnectionResultSuccessful {
+		ch.shutdown()
+		return nil, fmt.Errorf("l2cap channel refused: %w", ChannelError(rsp.Result))
+	}
+
+	if err = ch.setup(ctx, p); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// setup configures the channel with the parameters p, and waits for the remote device to configure it too.
+func (ch *BREDRChannel) setup(ctx context.Context, p ChannelParams) error {
+	// Even if all default values are acceptable, a Configuration Request packet with no options shall be sent
+	// [Vol 3, Part A, 4.4].
+	if err := ch.conn.configurationRequest(ctx, ch.remoteCID, p.options(), bredrSignalTimeout); err != nil {
+		return fmt.Errorf("unable to configure l2cap channel: %w", err)
+	}
+	if err := ch.waitConfigured(ctx); err != nil {
+		return err
+	}
+	if p.FlushTimeout != 0 && p.FlushTimeout != FlushTimeoutInfinite {
+		return ch.conn.setFlushTimeout(ctx, p.FlushTimeout)
+	}
+	return nil
+}
+
+// setFlushTimeout sets the automatic flush timeout of the ACL link, given in milliseconds.
+func (c *Conn) setFlushTimeout(ctx context.Context, ms uint16) error {
+	slots := int(ms) * 8 / 5
+	if slots > maxFlushTimeoutSlots {
+		slots = maxFlushTimeoutSlots
+	}
+	if err := c.hci.Send(ctx, &cmd.WriteAutomaticFlushTimeout{
+		ConnectionHandle: c.param.ConnectionHandle(),
+		FlushTimeout:     uint16(slots),
+	}, nil); err != nil {
+		return fmt.Errorf("unable to set flush timeout: %w", err)
+	}
+	return nil
+}
+
+// addBREDRChannel allocates the local CID of the channel.
+func (c *Conn) addBREDRChannel(ch *BREDRChannel) error {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	cid, err := c.allocCID(cidDynamicEnd)
+	if err != nil {
+		return err
+	}
+	if c.bredrChans == nil {
+		c.bredrChans = make(map[uint16]*BREDRChannel)
+	}
+	ch.localCID = cid
+	c.bredrChans[cid] = ch
+	return nil
+}
+
+func (c *Conn) removeBREDRChannel(ch *BREDRChannel) {
+	c.muChans.Lock()
+	if c.bredrChans[ch.localCID] == ch {
+		delete(c.bredrChans, ch.localCID)
+	}
+	c.muChans.Unlock()
+}
+
+// bredrChannel returns the BR/EDR channel with the local CID.
+func (c *Conn) bredrChannel(cid uint16) *BREDRChannel {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	return c.bredrChans[cid]
+}
+
+func (c *Conn) bredrChannelByRemoteCID(cid uint16) *BREDRChannel {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	for _, ch := range c.bredrChans {
+		if ch.remoteCID == cid {
+			return ch
+		}
+	}
+	return nil
+}
+
+// bredrChannels returns the BR/EDR channels of the connection.
+func (c *Conn) bredrChannels() []*BREDRChannel {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	chans := make([]*BREDRChannel, 0, len(c.bredrChans))
+	for _, ch := range c.bredrChans {
+		chans = append(chans, ch)
+	}
+	return chans
+}
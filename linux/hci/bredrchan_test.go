@@ -0,0 +1,189 @@
+package hci
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+var (
+	_ net.Conn = &BREDRChannel{}
+	_ net.Conn = &L2CAPChannel{}
+)
+
+func TestAllocCID(t *testing.T) {
+	c := &Conn{}
+	for i := 0; i < int(cidLEDynamicEnd-cidDynamicStart)+1; i++ {
+		if err := c.addChannel(&L2CAPChannel{}); err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+	}
+	if err := c.addChannel(&L2CAPChannel{}); err == nil {
+		t.Fatalf("Expected an error once the le cids are allocated")
+	}
+
+	// BR/EDR channels take the CIDs above the LE ones, which are allocated in turn.
+	ch := newBREDRChannel(c, psmRFCOMM, ModeParams{})
+	if err := c.addBREDRChannel(ch); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if ch.localCID != cidLEDynamicEnd+1 {
+		t.Fatalf("Expected: %04X, Received: %04X", cidLEDynamicEnd+1, ch.localCID)
+	}
+	c.removeBREDRChannel(ch)
+	next := newBREDRChannel(c, psmRFCOMM, ModeParams{})
+	if err := c.addBREDRChannel(next); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if next.localCID != cidLEDynamicEnd+2 {
+		t.Fatalf("Expected: %04X, Received: %04X", cidLEDynamicEnd+2, next.localCID)
+	}
+	if c.bredrChannel(ch.localCID) != nil || c.bredrChannel(next.localCID) != next {
+		t.Fatalf("Expected only channel %04X to be registered", next.localCID)
+	}
+}
+
+func TestChannelParamsOptions(t *testing.T) {
+	local, err := ModeParams{}.withDefaults()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	p := ChannelParams{ModeParams: local, FlushTimeout: 100, QoS: &l2cap.QoSOption{ServiceType: 0x02}}
+	opts := p.options()
+	if len(opts) != 3 {
+		t.Fatalf("Expected: 3 options, Received: %d", len(opts))
+	}
+
+	// The flush timeout and quality of service of the remote device are accepted as is.
+	m := modeConfig{local: local}
+	rsp, result := m.request(opts)
+	if result != l2cap.ConfigurationResultSuccessful {
+		t.Fatalf("Expected: %d, Received: %d", l2cap.ConfigurationResultSuccessful, result)
+	}
+	if len(rsp) != 3 || m.txMTU != int(local.MTU) {
+		t.Fatalf("Received: %+v, mtu %d", rsp, m.txMTU)
+	}
+}
+
+func TestAcceptBREDRChannel(t *testing.T) {
+	h := &HCI{}
+	if _, err := h.ListenL2CAPChannel(0x0002, ChannelParams{}); err == nil {
+		t.Fatalf("Expected an error for an even psm")
+	}
+	l, err := h.ListenL2CAPChannel(0x1001, ChannelParams{})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if _, err = h.ListenL2CAPChannel(0x1001, ChannelParams{}); err == nil {
+		t.Fatalf("Expected an error for a psm already listened on")
+	}
+
+	c := &Conn{hci: h}
+	tests := []struct {
+		req    l2cap.ConnectionRequest
+		result uint16
+	}{
+		{l2cap.ConnectionRequest{PSM: 0x1003, SourceCID: 0x0040}, l2cap.ConnectionResultPSMNotSupported},
+		{l2cap.ConnectionRequest{PSM: 0x1001, SourceCID: 0x0001}, l2cap.ConnectionResultInvalidSourceCID},
+		{l2cap.ConnectionRequest{PSM: 0x1001, SourceCID: 0x0040}, l2cap.ConnectionResultSuccessful},
+		{l2cap.ConnectionRequest{PSM: 0x1001, SourceCID: 0x0040}, l2cap.ConnectionResultSourceCIDAlreadyAllocated},
+	}
+	for _, tt := range tests {
+		ch, _, result := c.acceptBREDRChannel(tt.req)
+		if result != tt.result {
+			t.Fatalf("Expected: %d, Received: %d", tt.result, result)
+		}
+		if (ch != nil) != (result == l2cap.ConnectionResultSuccessful) {
+			t.Fatalf("Expected a channel only for the successful result")
+		}
+		if ch != nil && (ch.remoteCID != tt.req.SourceCID || c.bredrChannel(ch.localCID) != ch) {
+			t.Fatalf("Received: channel %04X to %04X", ch.localCID, ch.remoteCID)
+		}
+	}
+
+	if err = l.Close(); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if _, _, result := c.acceptBREDRChannel(tests[2].req); result != l2cap.ConnectionResultPSMNotSupported {
+		t.Fatalf("Expected: %d, Received: %d", l2cap.ConnectionResultPSMNotSupported, result)
+	}
+}
+
+func TestBREDRChannelDeadline(t *testing.T) {
+	ch := newBREDRChannel(&Conn{}, psmRFCOMM, ModeParams{})
+	b := make([]byte, 4)
+
+	if err := ch.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if _, err := ch.Read(b); err != os.ErrDeadlineExceeded {
+		t.Fatalf("Expected: %s, Received: %v", os.ErrDeadlineExceeded, err)
+	}
+
+	// The SDUs are read again once the deadline is cleared.
+	ch.chSDU <- []byte("ping")
+	if err := ch.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if n, err := ch.Read(b); err != nil || !bytes.Equal(b[:n], []byte("ping")) {
+		t.Fatalf("Expected: %s, Received: %s (%v)", "ping", b[:n], err)
+	}
+
+	if err := ch.SetWriteDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if _, err := ch.Write([]byte("pong")); err != os.ErrDeadlineExceeded {
+		t.Fatalf("Expected: %s, Received: %v", os.ErrDeadlineExceeded, err)
+	}
+}
+
+func TestBREDRChannelReceiveNotRead(t *testing.T) {
+	c := &Conn{hci: &HCI{skt: newFakeSocket()}, log: slog.Default(), chInPkt: make(chan packet, 1),
+		chDone: make(chan struct{})}
+	unread := newBREDRChannel(c, psmRFCOMM, ModeParams{MTU: 672})
+	ch := newBREDRChannel(c, psmRFCOMM, ModeParams{MTU: 672})
+	unread.localCID, ch.localCID = 0x0040, 0x0041
+	c.bredrChans = map[uint16]*BREDRChannel{unread.localCID: unread, ch.localCID: ch}
+
+	// The b-frames of a channel whose reader falls behind are dropped, the other channels still receive theirs.
+	cids := make([]uint16, cap(unread.chSDU)+1)
+	for i := range cids {
+		cids[i] = unread.localCID
+	}
+	cids = append(cids, ch.localCID)
+	done := make(chan error, 1)
+	go func() {
+		for _, cid := range cids {
+			c.chInPkt <- packet{0x01, 0x20, 0x05, 0x00, 0x01, 0x00, byte(cid), byte(cid >> 8), 0xAA}
+			if err := c.recombine(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected: b-frames received")
+	}
+	select {
+	case sdu := <-ch.chSDU:
+		if !bytes.Equal(sdu, []byte{0xAA}) {
+			t.Fatalf("Expected: %X, Received: %X", []byte{0xAA}, sdu)
+		}
+	default:
+		t.Fatalf("Expected: b-frame received on channel %04X", ch.localCID)
+	}
+	if n := len(unread.chSDU); n != cap(unread.chSDU) {
+		t.Fatalf("Expected: %d b-frames, Received: %d", cap(unread.chSDU), n)
+	}
+}
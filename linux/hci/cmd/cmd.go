@@ -29,3 +29,233 @@ func unmarshal(c commandRP, b []byte) error {
 	buf := bytes.NewBuffer(b)
 	return binary.Read(buf, binary.LittleEndian, c)
 }
+
+// LESetExtendedScanParameters implements LE Set Extended Scan Parameters (0x08|0x0041) [Vol 2, Part E, 7.8.64]
+// The scan type, interval and window are given once for each PHY set in ScanningPHYs, in order of increasing bit.
+type LESetExtendedScanParameters struct {
+	OwnAddressType       uint8
+	ScanningFilterPolicy uint8
+	ScanningPHYs         uint8
+	ScanType             []uint8
+	ScanInterval         []uint16
+	ScanWindow           []uint16
+}
+
+func (c *LESetExtendedScanParameters) String() string {
+	return "LE Set Extended Scan Parameters (0x08|0x0041)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LESetExtendedScanParameters) OpCode() int { return 0x08<<10 | 0x0041 }
+
+// Len returns the length of the command.
+func (c *LESetExtendedScanParameters) Len() int { return 3 + 5*len(c.ScanType) }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LESetExtendedScanParameters) Marshal(b []byte) error {
+	if len(c.ScanInterval) != len(c.ScanType) || len(c.ScanWindow) != len(c.ScanType) {
+		return io.ErrUnexpectedEOF
+	}
+	if len(b) < c.Len() {
+		return io.ErrShortBuffer
+	}
+	b[0], b[1], b[2] = c.OwnAddressType, c.ScanningFilterPolicy, c.ScanningPHYs
+	for i, typ := range c.ScanType {
+		p := b[3+5*i:]
+		p[0] = typ
+		binary.LittleEndian.PutUint16(p[1:], c.ScanInterval[i])
+		binary.LittleEndian.PutUint16(p[3:], c.ScanWindow[i])
+	}
+	return nil
+}
+
+// LESetExtendedScanParametersRP returns the return parameter of LE Set Extended Scan Parameters
+type LESetExtendedScanParametersRP struct {
+	Status uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LESetExtendedScanParametersRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LESetExtendedAdvertisingData implements LE Set Extended Advertising Data (0x08|0x0037) [Vol 2, Part E, 7.8.54]
+type LESetExtendedAdvertisingData struct {
+	AdvertisingHandle  uint8
+	Operation          uint8
+	FragmentPreference uint8
+	AdvertisingData    []byte
+}
+
+func (c *LESetExtendedAdvertisingData) String() string {
+	return "LE Set Extended Advertising Data (0x08|0x0037)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LESetExtendedAdvertisingData) OpCode() int { return 0x08<<10 | 0x0037 }
+
+// Len returns the length of the command.
+func (c *LESetExtendedAdvertisingData) Len() int { return 4 + len(c.AdvertisingData) }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LESetExtendedAdvertisingData) Marshal(b []byte) error {
+	if len(c.AdvertisingData) > 251 {
+		return io.ErrShortWrite
+	}
+	if len(b) < c.Len() {
+		return io.ErrShortBuffer
+	}
+	b[0], b[1], b[2], b[3] = c.AdvertisingHandle, c.Operation, c.FragmentPreference, uint8(len(c.AdvertisingData))
+	copy(b[4:], c.AdvertisingData)
+	return nil
+}
+
+// LESetExtendedAdvertisingDataRP returns the return parameter of LE Set Extended Advertising Data
+type LESetExtendedAdvertisingDataRP struct {
+	Status uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LESetExtendedAdvertisingDataRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LESetExtendedScanResponseData implements LE Set Extended Scan Response Data (0x08|0x0038) [Vol 2, Part E, 7.8.55]
+type LESetExtendedScanResponseData struct {
+	AdvertisingHandle  uint8
+	Operation          uint8
+	FragmentPreference uint8
+	ScanResponseData   []byte
+}
+
+func (c *LESetExtendedScanResponseData) String() string {
+	return "LE Set Extended Scan Response Data (0x08|0x0038)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LESetExtendedScanResponseData) OpCode() int { return 0x08<<10 | 0x0038 }
+
+// Len returns the length of the command.
+func (c *LESetExtendedScanResponseData) Len() int { return 4 + len(c.ScanResponseData) }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LESetExtendedScanResponseData) Marshal(b []byte) error {
+	if len(c.ScanResponseData) > 251 {
+		return io.ErrShortWrite
+	}
+	if len(b) < c.Len() {
+		return io.ErrShortBuffer
+	}
+	b[0], b[1], b[2], b[3] = c.AdvertisingHandle, c.Operation, c.FragmentPreference, uint8(len(c.ScanResponseData))
+	copy(b[4:], c.ScanResponseData)
+	return nil
+}
+
+// LESetExtendedScanResponseDataRP returns the return parameter of LE Set Extended Scan Response Data
+type LESetExtendedScanResponseDataRP struct {
+	Status uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LESetExtendedScanResponseDataRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LESetExtendedAdvertisingEnable implements LE Set Extended Advertising Enable (0x08|0x0039) [Vol 2, Part E, 7.8.56]
+// The handle, duration and maximum number of events are given once for each advertising set. Disabling with no sets
+// disables all of them.
+type LESetExtendedAdvertisingEnable struct {
+	Enable                       uint8
+	AdvertisingHandle            []uint8
+	Duration                     []uint16
+	MaxExtendedAdvertisingEvents []uint8
+}
+
+func (c *LESetExtendedAdvertisingEnable) String() string {
+	return "LE Set Extended Advertising Enable (0x08|0x0039)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LESetExtendedAdvertisingEnable) OpCode() int { return 0x08<<10 | 0x0039 }
+
+// Len returns the length of the command.
+func (c *LESetExtendedAdvertisingEnable) Len() int { return 2 + 4*len(c.AdvertisingHandle) }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LESetExtendedAdvertisingEnable) Marshal(b []byte) error {
+	if len(c.Duration) != len(c.AdvertisingHandle) || len(c.MaxExtendedAdvertisingEvents) != len(c.AdvertisingHandle) {
+		return io.ErrUnexpectedEOF
+	}
+	if len(b) < c.Len() {
+		return io.ErrShortBuffer
+	}
+	b[0], b[1] = c.Enable, uint8(len(c.AdvertisingHandle))
+	for i, handle := range c.AdvertisingHandle {
+		p := b[2+4*i:]
+		p[0] = handle
+		binary.LittleEndian.PutUint16(p[1:], c.Duration[i])
+		p[3] = c.MaxExtendedAdvertisingEvents[i]
+	}
+	return nil
+}
+
+// LESetExtendedAdvertisingEnableRP returns the return parameter of LE Set Extended Advertising Enable
+type LESetExtendedAdvertisingEnableRP struct {
+	Status uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LESetExtendedAdvertisingEnableRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LEExtendedCreateConnection implements LE Extended Create Connection (0x08|0x0043) [Vol 2, Part E, 7.8.66]
+// The scan and connection parameters are given once for each PHY set in InitiatingPHYs, in order of increasing bit.
+type LEExtendedCreateConnection struct {
+	InitiatorFilterPolicy uint8
+	OwnAddressType        uint8
+	PeerAddressType       uint8
+	PeerAddress           [6]byte
+	InitiatingPHYs        uint8
+	ScanInterval          []uint16
+	ScanWindow            []uint16
+	ConnIntervalMin       []uint16
+	ConnIntervalMax       []uint16
+	ConnLatency           []uint16
+	SupervisionTimeout    []uint16
+	MinimumCELength       []uint16
+	MaximumCELength       []uint16
+}
+
+func (c *LEExtendedCreateConnection) String() string {
+	return "LE Extended Create Connection (0x08|0x0043)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LEExtendedCreateConnection) OpCode() int { return 0x08<<10 | 0x0043 }
+
+// Len returns the length of the command.
+func (c *LEExtendedCreateConnection) Len() int { return 10 + 16*len(c.ScanInterval) }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LEExtendedCreateConnection) Marshal(b []byte) error {
+	params := [][]uint16{c.ScanInterval, c.ScanWindow, c.ConnIntervalMin, c.ConnIntervalMax, c.ConnLatency,
+		c.SupervisionTimeout, c.MinimumCELength, c.MaximumCELength}
+	for _, p := range params {
+		if len(p) != len(c.ScanInterval) {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	if len(b) < c.Len() {
+		return io.ErrShortBuffer
+	}
+	b[0], b[1], b[2] = c.InitiatorFilterPolicy, c.OwnAddressType, c.PeerAddressType
+	copy(b[3:9], c.PeerAddress[:])
+	b[9] = c.InitiatingPHYs
+	for i := range c.ScanInterval {
+		for j, p := range params {
+			binary.LittleEndian.PutUint16(b[10+16*i+2*j:], p[i])
+		}
+	}
+	return nil
+}
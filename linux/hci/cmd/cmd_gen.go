@@ -1961,7 +1961,7 @@ func (c *ReadTransmitPowerLevel) Marshal(b []byte) error {
 type ReadTransmitPowerLevelRP struct {
 	Status             uint8
 	ConnectionHandle   uint16
-	TransmitPowerLevel uint8
+	TransmitPowerLevel int8
 }
 
 // Unmarshal de-serializes the binary data and stores the result in the receiver.
@@ -3392,3 +3392,200 @@ type LERemoteConnectionParameterRequestNegativeReplyRP struct {
 func (c *LERemoteConnectionParameterRequestNegativeReplyRP) Unmarshal(b []byte) error {
 	return unmarshal(c, b)
 }
+
+// LESetExtendedScanEnable implements LE Set Extended Scan Enable (0x08|0x0042) [Vol 2, Part E, 7.8.65]
+type LESetExtendedScanEnable struct {
+	Enable           uint8
+	FilterDuplicates uint8
+	Duration         uint16
+	Period           uint16
+}
+
+func (c *LESetExtendedScanEnable) String() string {
+	return "LE Set Extended Scan Enable (0x08|0x0042)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LESetExtendedScanEnable) OpCode() int { return 0x08<<10 | 0x0042 }
+
+// Len returns the length of the command.
+func (c *LESetExtendedScanEnable) Len() int { return 6 }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LESetExtendedScanEnable) Marshal(b []byte) error {
+	return marshal(c, b)
+}
+
+// LESetExtendedScanEnableRP returns the return parameter of LE Set Extended Scan Enable
+type LESetExtendedScanEnableRP struct {
+	Status uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LESetExtendedScanEnableRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LESetExtendedAdvertisingParameters implements LE Set Extended Advertising Parameters (0x08|0x0036) [Vol 2, Part E, 7.8.53]
+type LESetExtendedAdvertisingParameters struct {
+	AdvertisingHandle             uint8
+	AdvertisingEventProperties    uint16
+	PrimaryAdvertisingIntervalMin [3]byte
+	PrimaryAdvertisingIntervalMax [3]byte
+	PrimaryAdvertisingChannelMap  uint8
+	OwnAddressType                uint8
+	PeerAddressType               uint8
+	PeerAddress                   [6]byte
+	AdvertisingFilterPolicy       uint8
+	AdvertisingTXPower            int8
+	PrimaryAdvertisingPHY         uint8
+	SecondaryAdvertisingMaxSkip   uint8
+	SecondaryAdvertisingPHY       uint8
+	AdvertisingSID                uint8
+	ScanRequestNotificationEnable uint8
+}
+
+func (c *LESetExtendedAdvertisingParameters) String() string {
+	return "LE Set Extended Advertising Parameters (0x08|0x0036)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LESetExtendedAdvertisingParameters) OpCode() int { return 0x08<<10 | 0x0036 }
+
+// Len returns the length of the command.
+func (c *LESetExtendedAdvertisingParameters) Len() int { return 25 }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LESetExtendedAdvertisingParameters) Marshal(b []byte) error {
+	return marshal(c, b)
+}
+
+// LESetExtendedAdvertisingParametersRP returns the return parameter of LE Set Extended Advertising Parameters
+type LESetExtendedAdvertisingParametersRP struct {
+	Status          uint8
+	SelectedTXPower int8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LESetExtendedAdvertisingParametersRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LEReadMaximumAdvertisingDataLength implements LE Read Maximum Advertising Data Length (0x08|0x003A) [Vol 2, Part E, 7.8.57]
+type LEReadMaximumAdvertisingDataLength struct {
+}
+
+func (c *LEReadMaximumAdvertisingDataLength) String() string {
+	return "LE Read Maximum Advertising Data Length (0x08|0x003A)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LEReadMaximumAdvertisingDataLength) OpCode() int { return 0x08<<10 | 0x003A }
+
+// Len returns the length of the command.
+func (c *LEReadMaximumAdvertisingDataLength) Len() int { return 0 }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LEReadMaximumAdvertisingDataLength) Marshal(b []byte) error {
+	return marshal(c, b)
+}
+
+// LEReadMaximumAdvertisingDataLengthRP returns the return parameter of LE Read Maximum Advertising Data Length
+type LEReadMaximumAdvertisingDataLengthRP struct {
+	Status                   uint8
+	MaxAdvertisingDataLength uint16
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LEReadMaximumAdvertisingDataLengthRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LEReadNumberofSupportedAdvertisingSets implements LE Read Number of Supported Advertising Sets (0x08|0x003B) [Vol 2, Part E, 7.8.58]
+type LEReadNumberofSupportedAdvertisingSets struct {
+}
+
+func (c *LEReadNumberofSupportedAdvertisingSets) String() string {
+	return "LE Read Number of Supported Advertising Sets (0x08|0x003B)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LEReadNumberofSupportedAdvertisingSets) OpCode() int { return 0x08<<10 | 0x003B }
+
+// Len returns the length of the command.
+func (c *LEReadNumberofSupportedAdvertisingSets) Len() int { return 0 }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LEReadNumberofSupportedAdvertisingSets) Marshal(b []byte) error {
+	return marshal(c, b)
+}
+
+// LEReadNumberofSupportedAdvertisingSetsRP returns the return parameter of LE Read Number of Supported Advertising Sets
+type LEReadNumberofSupportedAdvertisingSetsRP struct {
+	Status                      uint8
+	NumSupportedAdvertisingSets uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LEReadNumberofSupportedAdvertisingSetsRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LERemoveAdvertisingSet implements LE Remove Advertising Set (0x08|0x003C) [Vol 2, Part E, 7.8.59]
+type LERemoveAdvertisingSet struct {
+	AdvertisingHandle uint8
+}
+
+func (c *LERemoveAdvertisingSet) String() string {
+	return "LE Remove Advertising Set (0x08|0x003C)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LERemoveAdvertisingSet) OpCode() int { return 0x08<<10 | 0x003C }
+
+// Len returns the length of the command.
+func (c *LERemoveAdvertisingSet) Len() int { return 1 }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LERemoveAdvertisingSet) Marshal(b []byte) error {
+	return marshal(c, b)
+}
+
+// LERemoveAdvertisingSetRP returns the return parameter of LE Remove Advertising Set
+type LERemoveAdvertisingSetRP struct {
+	Status uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LERemoveAdvertisingSetRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
+
+// LEClearAdvertisingSets implements LE Clear Advertising Sets (0x08|0x003D) [Vol 2, Part E, 7.8.60]
+type LEClearAdvertisingSets struct {
+}
+
+func (c *LEClearAdvertisingSets) String() string {
+	return "LE Clear Advertising Sets (0x08|0x003D)"
+}
+
+// OpCode returns the opcode of the command.
+func (c *LEClearAdvertisingSets) OpCode() int { return 0x08<<10 | 0x003D }
+
+// Len returns the length of the command.
+func (c *LEClearAdvertisingSets) Len() int { return 0 }
+
+// Marshal serializes the command parameters into binary form.
+func (c *LEClearAdvertisingSets) Marshal(b []byte) error {
+	return marshal(c, b)
+}
+
+// LEClearAdvertisingSetsRP returns the return parameter of LE Clear Advertising Sets
+type LEClearAdvertisingSetsRP struct {
+	Status uint8
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (c *LEClearAdvertisingSetsRP) Unmarshal(b []byte) error {
+	return unmarshal(c, b)
+}
@@ -0,0 +1,740 @@
+package hci
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/internal/deadline"
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+// Limits of the LE credit based channels [Vol 3, Part A, 4.22].
+const (
+	cocMinMTU     = 23
+	cocMinMPS     = 23
+	cocMaxMPS     = 65533
+	cocMaxCredits = 65535
+
+	// cidLEDynamicEnd is the last CID dynamically allocated on LE-U logical links [Vol 3, Part A, 2.1].
+	cidLEDynamicEnd uint16 = 0x7F
+
+	// cocSignalTimeout bounds the signaling requests opening and closing the channels.
+	cocSignalTimeout = 30 * time.Second
+)
+
+// Default parameters of the receiving side of LE credit based channels.
+const (
+	DefaultCoCMTU     = 2048
+	DefaultCoCMPS     = 247
+	DefaultCoCCredits = 32
+)
+
+// CoCParams are the parameters of the receiving side of an LE credit based channel. Zero values are replaced by the
+// defaults.
+type CoCParams struct {
+	// MTU is the size of the largest SDU accepted, at least 23 bytes.
+	MTU uint16
+
+	// MPS is the size of the largest K-frame payload accepted, from 23 to 65533 bytes.
+	MPS uint16
+
+	// Credits is the number of K-frames the remote device can send before it waits for more credits. Credits are
+	// returned as the SDUs are read.
+	Credits uint16
+}
+
+func (p CoCParams) withDefaults() (CoCParams, error) {
+	if p.MTU == 0 {
+		p.MTU = DefaultCoCMTU
+	}
+	if p.MPS == 0 {
+		p.MPS = DefaultCoCMPS
+	}
+	if p.Credits == 0 {
+		p.Credits = DefaultCoCCredits
+	}
+	switch {
+	case p.MTU < cocMinMTU:
+		return p, fmt.Errorf("mtu %d is less than %d", p.MTU, cocMinMTU)
+	case p.MPS < cocMinMPS || p.MPS > cocMaxMPS:
+		return p, fmt.Errorf("mps %d is out of range [%d, %d]", p.MPS, cocMinMPS, cocMaxMPS)
+	}
+	return p, nil
+}
+
+// CoCError is the result of a refused LE credit based connection request [Vol 3, Part A, 4.23].
+type CoCError uint16
+
+func (e CoCError) Error() string {
+	switch uint16(e) {
+	case l2cap.LECreditResultPSMNotSupported:
+		return "LE_PSM not supported"
+	case l2cap.LECreditResultNoResources:
+		return "no resources available"
+	case l2cap.LECreditResultInsufficientAuthentication:
+		return "insufficient authentication"
+	case l2cap.LECreditResultInsufficientAuthorization:
+		return "insufficient authorization"
+	case l2cap.LECreditResultInsufficientEncryptionKeySize:
+		return "insufficient encryption key size"
+	case l2cap.LECreditResultInsufficientEncryption:
+		return "insufficient encryption"
+	case l2cap.LECreditResultInvalidSourceCID:
+		return "invalid source CID"
+	case l2cap.LECreditResultSourceCIDAlreadyAllocated:
+		return "source CID already allocated"
+	case l2cap.LECreditResultUnacceptableParameters:
+		return "unacceptable parameters"
+	default:
+		return fmt.Sprintf("connection refused (0x%04X)", uint16(e))
+	}
+}
+
+// rxSDU is an SDU received on an L2CAPChannel, along with the number of K-frames, and so of credits, it took.
+type rxSDU struct {
+	data   []byte
+	frames int
+}
+
+// L2CAPChannel is an LE credit based connection oriented channel [Vol 3, Part A, 10.2]. It is a stream: Write splits
+// the data into SDUs of at most the MTU of the remote device, and Read returns the data of the SDUs received in order.
+// It is a net.Conn.
+type L2CAPChannel struct {
+	conn *Conn
+	psm  uint16
+
+	localCID  uint16
+	remoteCID uint16
+
+	// enhanced is set on the channels opened with the enhanced credit based flow control mode.
+	enhanced bool
+
+	// muCredits guards the credits and the parameters, which the enhanced mode can reconfigure. txCredits are the
+	// K-frames the channel can send, rxCredits those the remote device can send.
+	muCredits sync.Mutex
+	rx        CoCParams
+	txMTU     int
+	txMPS     int
+	txCredits int
+	rxCredits int
+	chCredits chan struct{}
+
+	muWrite sync.Mutex
+
+	// asm is only used by the recombine loop of the connection.
+	asm   sduAssembler
+	chSDU chan rxSDU
+
+	muRead sync.Mutex
+	rxBuf  []byte
+	sigID  uint8
+
+	readDeadline  deadline.Deadline
+	writeDeadline deadline.Deadline
+
+	closeOnce sync.Once
+	chClosed  chan struct{}
+}
+
+func newL2CAPChannel(c *Conn, psm uint16, rx CoCParams) *L2CAPChannel {
+	return &L2CAPChannel{
+		conn:      c,
+		psm:       psm,
+		rx:        rx,
+		rxCredits: int(rx.Credits),
+		chCredits: make(chan struct{}, 1),
+		chSDU:     make(chan rxSDU, rx.Credits),
+		chClosed:  make(chan struct{}),
+	}
+}
+
+// open sets the parameters of the remote device, as exchanged by the connection request and response.
+func (ch *L2CAPChannel) open(remoteCID, mtu, mps, credits uint16) error {
+	minMTU, minMPS := uint16(cocMinMTU), uint16(cocMinMPS)
+	if ch.enhanced {
+		minMTU, minMPS = ecfcMinMTU, ecfcMinMPS
+	}
+	switch {
+	case remoteCID < cidDynamicStart || remoteCID > cidLEDynamicEnd:
+		return CoCError(l2cap.LECreditResultInvalidSourceCID)
+	case mtu < minMTU || mps < minMPS || mps > cocMaxMPS:
+		return CoCError(l2cap.LECreditResultUnacceptableParameters)
+	}
+	ch.remoteCID, ch.txMTU, ch.txMPS, ch.txCredits = remoteCID, int(mtu), int(mps), int(credits)
+	return nil
+}
+
+// PSM returns the LE protocol/service multiplexer of the channel.
+func (ch *L2CAPChannel) PSM() uint16 { return ch.psm }
+
+// Conn returns the LE connection the channel is opened on.
+func (ch *L2CAPChannel) Conn() *Conn { return ch.conn }
+
+// RxMTU returns the size of the largest SDU the channel accepts.
+func (ch *L2CAPChannel) RxMTU() int {
+	ch.muCredits.Lock()
+	defer ch.muCredits.Unlock()
+	return int(ch.rx.MTU)
+}
+
+// TxMTU returns the size of the largest SDU the remote device accepts.
+func (ch *L2CAPChannel) TxMTU() int {
+	ch.muCredits.Lock()
+	defer ch.muCredits.Unlock()
+	return ch.txMTU
+}
+
+// Closed returns a channel closed once the channel is closed.
+func (ch *L2CAPChannel) Closed() <-chan struct{} { return ch.chClosed }
+
+// LocalAddr returns the address of the local device, and the PSM of the channel.
+func (ch *L2CAPChannel) LocalAddr() net.Addr {
+	return ble.NetAddr{Addr: ch.conn.LocalAddr(), Net: "l2cap", Port: int(ch.psm)}
+}
+
+// RemoteAddr returns the address of the remote device, and the PSM of the channel.
+func (ch *L2CAPChannel) RemoteAddr() net.Addr {
+	return ble.NetAddr{Addr: ch.conn.RemoteAddr(), Net: "l2cap", Port: int(ch.psm)}
+}
+
+// SetDeadline sets the read and write deadlines of the channel.
+func (ch *L2CAPChannel) SetDeadline(t time.Time) error {
+	ch.readDeadline.Set(t)
+	ch.writeDeadline.Set(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline of the reads, past which they return os.ErrDeadlineExceeded. A zero value clears
+// it.
+func (ch *L2CAPChannel) SetReadDeadline(t time.Time) error {
+	ch.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the writes, past which they return os.ErrDeadlineExceeded rather than wait
+// for credits. A zero value clears it. An SDU is never cut short: once its first K-frame is sent, the write waits for
+// the credits of the others.
+func (ch *L2CAPChannel) SetWriteDeadline(t time.Time) error {
+	ch.writeDeadline.Set(t)
+	return nil
+}
+
+// Read reads the data of the SDUs received, returning io.EOF once the channel is closed.
+func (ch *L2CAPChannel) Read(b []byte) (int, error) {
+	ch.muRead.Lock()
+	defer ch.muRead.Unlock()
+
+	for len(ch.rxBuf) == 0 {
+		sdu, err := ch.nextSDU()
+		if err != nil {
+			return 0, err
+		}
+		ch.rxBuf = sdu.data
+		if err = ch.returnCredits(sdu.frames); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, ch.rxBuf)
+	ch.rxBuf = ch.rxBuf[n:]
+	return n, nil
+}
+
+// nextSDU returns the next SDU received, those received before the channel closed included.
+func (ch *L2CAPChannel) nextSDU() (rxSDU, error) {
+	select {
+	case sdu := <-ch.chSDU:
+		return sdu, nil
+	default:
+	}
+	select {
+	case sdu := <-ch.chSDU:
+		return sdu, nil
+	case <-ch.readDeadline.Done():
+		return rxSDU{}, os.ErrDeadlineExceeded
+	case <-ch.chClosed:
+		return rxSDU{}, io.EOF
+	case <-ch.conn.Disconnected():
+		return rxSDU{}, io.EOF
+	}
+}
+
+// returnCredits lets the remote device send as many K-frames as the SDU read took.
+func (ch *L2CAPChannel) returnCredits(n int) error {
+	ch.muCredits.Lock()
+	ch.rxCredits += n
+	ch.muCredits.Unlock()
+
+	// The credit packet is not a request, but its identifier still has to be non-zero [Vol 3, Part A, 4].
+	if ch.sigID++; ch.sigID == 0 {
+		ch.sigID = 1
+	}
+	if _, err := ch.conn.sendResponse(l2cap.SignalLEFlowControlCredit, ch.sigID,
+		&l2cap.LEFlowControlCredit{CID: ch.localCID, Credits: uint16(n)}); err != nil {
+		return fmt.Errorf("unable to send credits: %w", err)
+	}
+	return nil
+}
+
+// Write sends the data as SDUs of at most the MTU of the remote device, waiting for credits as needed.
+func (ch *L2CAPChannel) Write(b []byte) (int, error) {
+	ch.muWrite.Lock()
+	defer ch.muWrite.Unlock()
+
+	sent := 0
+	for len(b) > 0 {
+		n := len(b)
+		if mtu := ch.TxMTU(); n > mtu {
+			n = mtu
+		}
+		if err := ch.writeSDU(b[:n]); err != nil {
+			return sent, err
+		}
+		sent += n
+		b = b[n:]
+	}
+	return sent, nil
+}
+
+func (ch *L2CAPChannel) writeSDU(sdu []byte) error {
+	ch.muCredits.Lock()
+	mps := ch.txMPS
+	ch.muCredits.Unlock()
+	expired := ch.writeDeadline.Done()
+	for i, frame := range segmentSDU(sdu, mps) {
+		if i > 0 {
+			expired = nil
+		}
+		if err := ch.takeCredit(expired); err != nil {
+			return err
+		}
+		p := make([]byte, 4+len(frame))
+		binary.LittleEndian.PutUint16(p[0:2], uint16(len(frame)))
+		binary.LittleEndian.PutUint16(p[2:4], ch.remoteCID)
+		copy(p[4:], frame)
+		if _, err := ch.conn.writePDU(p); err != nil {
+			return fmt.Errorf("unable to write k-frame: %w", err)
+		}
+	}
+	return nil
+}
+
+// takeCredit waits for a credit to send a K-frame, until expired is closed.
+func (ch *L2CAPChannel) takeCredit(expired <-chan struct{}) error {
+	for {
+		ch.muCredits.Lock()
+		if ch.txCredits > 0 {
+			ch.txCredits--
+			ch.muCredits.Unlock()
+			return nil
+		}
+		ch.muCredits.Unlock()
+
+		select {
+		case <-ch.chCredits:
+		case <-expired:
+			return os.ErrDeadlineExceeded
+		case <-ch.chClosed:
+			return io.ErrClosedPipe
+		case <-ch.conn.Disconnected():
+			return io.ErrClosedPipe
+		}
+	}
+}
+
+// addCredits adds the credits granted by the remote device. It runs on the recombine loop of the connection.
+func (ch *L2CAPChannel) addCredits(n int) error {
+	ch.muCredits.Lock()
+	if ch.txCredits+n > cocMaxCredits {
+		ch.muCredits.Unlock()
+		return fmt.Errorf("credits of channel %04X exceed %d", ch.localCID, cocMaxCredits)
+	}
+	ch.txCredits += n
+	ch.muCredits.Unlock()
+
+	select {
+	case ch.chCredits <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// receive handles a K-frame received by the connection. It runs on the recombine loop of the connection, so it never
+// blocks: the channel holds as many SDUs as the remote device has credits for.
+func (ch *L2CAPChannel) receive(p pdu) error {
+	ch.muCredits.Lock()
+	if ch.rxCredits == 0 {
+		ch.muCredits.Unlock()
+		return errors.New("k-frame received without credits")
+	}
+	ch.rxCredits--
+	rx := ch.rx
+	ch.muCredits.Unlock()
+
+	if len(p.payload()) > int(rx.MPS) {
+		return fmt.Errorf("k-frame size %d larger than mps %d", len(p.payload()), rx.MPS)
+	}
+	sdu, frames, err := ch.asm.add(p.payload(), int(rx.MTU))
+	if err != nil || frames == 0 {
+		return err
+	}
+	select {
+	case ch.chSDU <- rxSDU{data: sdu, frames: frames}:
+		return nil
+	default:
+		return errors.New("sdu buffer full")
+	}
+}
+
+// Close disconnects the channel.
+func (ch *L2CAPChannel) Close() error {
+	select {
+	case <-ch.chClosed:
+		return nil
+	case <-ch.conn.Disconnected():
+		ch.shutdown()
+		return nil
+	default:
+	}
+	defer ch.shutdown()
+
+	if err := ch.conn.Signal(context.Background(),
+		&l2cap.DisconnectRequest{DestinationCID: ch.remoteCID, SourceCID: ch.localCID},
+		&l2cap.DisconnectResponse{}, cocSignalTimeout); err != nil {
+		return fmt.Errorf("unable to disconnect l2cap channel: %w", err)
+	}
+	return nil
+}
+
+// abort closes the channel after the remote device violated the protocol. It runs on the recombine loop of the
+// connection, which reads the response of the disconnect request.
+func (ch *L2CAPChannel) abort(err error) {
+	ch.conn.log.Debug("closing l2cap channel: " + err.Error())
+	ch.conn.Add(1)
+	go func() {
+		defer ch.conn.Done()
+		_ = ch.Close()
+	}()
+}
+
+// shutdown releases the channel, once disconnected.
+func (ch *L2CAPChannel) shutdown() {
+	ch.closeOnce.Do(func() {
+		ch.conn.removeChannel(ch)
+		close(ch.chClosed)
+	})
+}
+
+// DialL2CAP opens an LE credit based channel to the protocol or service listening on the LE_PSM of the remote
+// device. The channel receives with the parameters p.
+func (c *Conn) DialL2CAP(ctx context.Context, psm uint16, p CoCParams) (*L2CAPChannel, error) {
+	if !c.isLE() {
+		return nil, errors.New("credit based channels are only available on LE connections")
+	}
+	p, err := p.withDefaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel parameters: %w", err)
+	}
+	ch := newL2CAPChannel(c, psm, p)
+	if err = c.addChannel(ch); err != nil {
+		return nil, err
+	}
+
+	req := &l2cap.LECreditBasedConnectionRequest{
+		LEPSM:          psm,
+		SourceCID:      ch.localCID,
+		MTU:            p.MTU,
+		MPS:            p.MPS,
+		InitialCredits: p.Credits,
+	}
+	rsp := &l2cap.LECreditBasedConnectionResponse{}
+	if err = c.Signal(ctx, req, rsp, cocSignalTimeout); err != nil {
+		ch.shutdown()
+		return nil, fmt.Errorf("unable to request l2cap channel: %w", err)
+	}
+	if rsp.Result != l2cap.LECreditResultSuccessful {
+		ch.shutdown()
+		return nil, fmt.Errorf("l2cap channel refused: %w", CoCError(rsp.Result))
+	}
+	if err = ch.open(rsp.DestinationCID, rsp.MTU, rsp.MPS, rsp.InitialCredits); err != nil {
+		_ = ch.Close()
+		return nil, fmt.Errorf("invalid l2cap channel response: %w", err)
+	}
+	return ch, nil
+}
+
+// handleLECreditBasedConnectionRequest accepts the channel if a listener is registered for its LE_PSM.
+func (c *Conn) handleLECreditBasedConnectionRequest(s sigCmd) error {
+	var req l2cap.LECreditBasedConnectionRequest
+	if err := req.Unmarshal(s.data()); err != nil {
+		return fmt.Errorf("unable to unmarshal le credit based connection request: %w", err)
+	}
+
+	ch, l, result := c.acceptChannel(req)
+	rsp := &l2cap.LECreditBasedConnectionResponse{Result: result}
+	if ch != nil {
+		rsp.DestinationCID, rsp.MTU, rsp.MPS, rsp.InitialCredits = ch.localCID, ch.rx.MTU, ch.rx.MPS, ch.rx.Credits
+	}
+	if _, err := c.sendResponse(l2cap.SignalLECreditBasedConnectionResponse, s.id(), rsp); err != nil {
+		if ch != nil {
+			ch.shutdown()
+		}
+		return fmt.Errorf("unable to send le credit based connection response: %w", err)
+	}
+	if ch != nil && !l.deliver(ch) {
+		ch.abort(errors.New("listener closed or backlog full"))
+	}
+	return nil
+}
+
+func (c *Conn) acceptChannel(req l2cap.LECreditBasedConnectionRequest) (*L2CAPChannel, *L2CAPListener, uint16) {
+	l := c.hci.cocListener(req.LEPSM)
+	if l == nil {
+		return nil, nil, l2cap.LECreditResultPSMNotSupported
+	}
+	if c.channelByRemoteCID(req.SourceCID) != nil {
+		return nil, nil, l2cap.LECreditResultSourceCIDAlreadyAllocated
+	}
+	ch := newL2CAPChannel(c, req.LEPSM, l.params)
+	if err := ch.open(req.SourceCID, req.MTU, req.MPS, req.InitialCredits); err != nil {
+		return nil, nil, uint16(err.(CoCError))
+	}
+	if err := c.addChannel(ch); err != nil {
+		return nil, nil, l2cap.LECreditResultNoResources
+	}
+	return ch, l, l2cap.LECreditResultSuccessful
+}
+
+// handleLEFlowControlCredit adds the credits granted by the remote device to its channel.
+func (c *Conn) handleLEFlowControlCredit(s sigCmd) error {
+	var cred l2cap.LEFlowControlCredit
+	if err := cred.Unmarshal(s.data()); err != nil {
+		return fmt.Errorf("unable to unmarshal le flow control credit: %w", err)
+	}
+	// The CID is the one of the remote device.
+	ch := c.channelByRemoteCID(cred.CID)
+	if ch == nil {
+		return nil
+	}
+	if err := ch.addCredits(int(cred.Credits)); err != nil {
+		ch.abort(err)
+	}
+	return nil
+}
+
+// addChannel allocates a local CID to the channel and registers it with the connection.
+func (c *Conn) addChannel(ch *L2CAPChannel) error {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	cid, err := c.allocCID(cidLEDynamicEnd)
+	if err != nil {
+		return err
+	}
+	if c.chans == nil {
+		c.chans = make(map[uint16]*L2CAPChannel)
+	}
+	ch.localCID = cid
+	c.chans[cid] = ch
+	return nil
+}
+
+func (c *Conn) removeChannel(ch *L2CAPChannel) {
+	c.muChans.Lock()
+	if c.chans[ch.localCID] == ch {
+		delete(c.chans, ch.localCID)
+	}
+	c.muChans.Unlock()
+}
+
+// channel returns the channel with the local CID.
+func (c *Conn) channel(cid uint16) *L2CAPChannel {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	return c.chans[cid]
+}
+
+func (c *Conn) channelByRemoteCID(cid uint16) *L2CAPChannel {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	for _, ch := range c.chans {
+		if ch.remoteCID == cid {
+			return ch
+		}
+	}
+	return nil
+}
+
+// L2CAPListener accepts the LE credit based channels opened by remote devices on an LE_PSM.
+type L2CAPListener struct {
+	h        *HCI
+	psm      uint16
+	params   CoCParams
+	chAccept chan *L2CAPChannel
+
+	mu       sync.Mutex
+	closed   bool
+	chClosed chan struct{}
+}
+
+// listenBacklog is the number of channels waiting to be accepted by a listener.
+const listenBacklog = 16
+
+// ListenL2CAP listens for the LE credit based channels opened on the LE_PSM, which receive with the parameters p.
+func (h *HCI) ListenL2CAP(psm uint16, p CoCParams) (*L2CAPListener, error) {
+	// LE_PSMs are defined by the SIG from 0x0001 to 0x007F and dynamically allocated from 0x0080 to 0x00FF.
+	if psm == 0 || psm > 0x00FF {
+		return nil, fmt.Errorf("invalid LE_PSM 0x%04X", psm)
+	}
+	p, err := p.withDefaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel parameters: %w", err)
+	}
+
+	h.muCoC.Lock()
+	defer h.muCoC.Unlock()
+	if _, ok := h.cocListeners[psm]; ok {
+		return nil, fmt.Errorf("already listening on LE_PSM 0x%04X", psm)
+	}
+	if h.cocListeners == nil {
+		h.cocListeners = make(map[uint16]*L2CAPListener)
+	}
+	l := &L2CAPListener{
+		h:        h,
+		psm:      psm,
+		params:   p,
+		chAccept: make(chan *L2CAPChannel, listenBacklog),
+		chClosed: make(chan struct{}),
+	}
+	h.cocListeners[psm] = l
+	return l, nil
+}
+
+func (h *HCI) cocListener(psm uint16) *L2CAPListener {
+	h.muCoC.Lock()
+	defer h.muCoC.Unlock()
+	return h.cocListeners[psm]
+}
+
+// PSM returns the LE_PSM the listener accepts channels on.
+func (l *L2CAPListener) PSM() uint16 { return l.psm }
+
+// Accept waits for the next channel opened by a remote device.
+func (l *L2CAPListener) Accept(ctx context.Context) (*L2CAPChannel, error) {
+	select {
+	case ch := <-l.chAccept:
+		return ch, nil
+	case <-l.chClosed:
+		return nil, io.ErrClosedPipe
+	case <-l.h.Closed():
+		return nil, io.ErrClosedPipe
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops listening. The channels already accepted stay open, those waiting to be accepted are closed.
+func (l *L2CAPListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.chClosed)
+	l.mu.Unlock()
+
+	l.h.muCoC.Lock()
+	if l.h.cocListeners[l.psm] == l {
+		delete(l.h.cocListeners, l.psm)
+	}
+	l.h.muCoC.Unlock()
+
+	for {
+		select {
+		case ch := <-l.chAccept:
+			_ = ch.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// deliver queues the channel to be accepted. It reports false if the listener is closed or its backlog full.
+func (l *L2CAPListener) deliver(ch *L2CAPChannel) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	select {
+	case l.chAccept <- ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// sduAssembler reassembles SDUs from the payloads of K-frames, the first of which starts with the SDU length
+// [Vol 3, Part A, 3.4.3].
+type sduAssembler struct {
+	sdu    []byte
+	length int
+	frames int
+}
+
+// add appends the payload of a K-frame to an SDU of at most mtu bytes. Once the SDU is complete, it returns it along
+// with the number of K-frames it took, or 0 frames while more are expected.
+func (a *sduAssembler) add(payload []byte, mtu int) ([]byte, int, error) {
+	if a.frames == 0 {
+		if len(payload) < 2 {
+			return nil, 0, errors.New("k-frame too short for sdu length")
+		}
+		a.length = int(binary.LittleEndian.Uint16(payload))
+		if a.length > mtu {
+			return nil, 0, fmt.Errorf("sdu length %d larger than mtu %d", a.length, mtu)
+		}
+		a.sdu = make([]byte, 0, a.length)
+		payload = payload[2:]
+	}
+	a.frames++
+	if len(a.sdu)+len(payload) > a.length {
+		a.frames = 0
+		return nil, 0, fmt.Errorf("k-frames exceed sdu length %d", a.length)
+	}
+	a.sdu = append(a.sdu, payload...)
+	if len(a.sdu) < a.length {
+		return nil, 0, nil
+	}
+	sdu, frames := a.sdu, a.frames
+	a.sdu, a.frames = nil, 0
+	return sdu, frames, nil
+}
+
+// segmentSDU splits the SDU into the payloads of K-frames of at most mps bytes, the first of which starts with the SDU
+// length [Vol 3, Part A, 3.4.3].
+func segmentSDU(sdu []byte, mps int) [][]byte {
+	n := mps - 2
+	if n > len(sdu) {
+		n = len(sdu)
+	}
+	first := make([]byte, 2+n)
+	binary.LittleEndian.PutUint16(first, uint16(len(sdu)))
+	copy(first[2:], sdu[:n])
+	frames := [][]byte{first}
+	for sdu = sdu[n:]; len(sdu) > 0; {
+		n = mps
+		if n > len(sdu) {
+			n = len(sdu)
+		}
+		frames = append(frames, sdu[:n])
+		sdu = sdu[n:]
+	}
+	return frames
+}
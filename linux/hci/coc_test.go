@@ -0,0 +1,77 @@
+package hci
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSegmentSDU(t *testing.T) {
+	sdu := make([]byte, 100)
+	for i := range sdu {
+		sdu[i] = byte(i)
+	}
+	frames := segmentSDU(sdu, 23)
+	// 21 bytes in the first frame after the SDU length, then 23 bytes per frame.
+	if len(frames) != 5 {
+		t.Fatalf("Expected: %d, Received: %d", 5, len(frames))
+	}
+	if !bytes.Equal(frames[0][:2], []byte{100, 0}) {
+		t.Fatalf("Expected: %X, Received: %X", []byte{100, 0}, frames[0][:2])
+	}
+
+	a := sduAssembler{}
+	for i, frame := range frames {
+		received, n, err := a.add(frame, 100)
+		if err != nil {
+			t.Fatalf("frame %d: %s", i, err)
+		}
+		if i < len(frames)-1 {
+			if n != 0 {
+				t.Fatalf("frame %d: Expected: %d, Received: %d", i, 0, n)
+			}
+			continue
+		}
+		if n != len(frames) {
+			t.Fatalf("Expected: %d, Received: %d", len(frames), n)
+		}
+		if !bytes.Equal(received, sdu) {
+			t.Fatalf("Expected: %X, Received: %X", sdu, received)
+		}
+	}
+
+	frames = segmentSDU(nil, 23)
+	if len(frames) != 1 || !bytes.Equal(frames[0], []byte{0, 0}) {
+		t.Fatalf("Expected: %X, Received: %X", [][]byte{{0, 0}}, frames)
+	}
+	if received, n, err := a.add(frames[0], 100); err != nil || n != 1 || len(received) != 0 {
+		t.Fatalf("Expected an empty sdu, Received: %X, %d, %v", received, n, err)
+	}
+}
+
+func TestSDUAssemblerErrors(t *testing.T) {
+	a := sduAssembler{}
+	if _, _, err := a.add([]byte{24, 0}, 23); err == nil {
+		t.Fatalf("Expected an error for an sdu larger than the mtu")
+	}
+	if _, _, err := a.add([]byte{2, 0, 1, 2, 3}, 23); err == nil {
+		t.Fatalf("Expected an error for k-frames exceeding the sdu length")
+	}
+	if _, _, err := a.add([]byte{1}, 23); err == nil {
+		t.Fatalf("Expected an error for a k-frame without sdu length")
+	}
+}
+
+func TestCoCParams(t *testing.T) {
+	p, err := CoCParams{}.withDefaults()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if p != (CoCParams{MTU: DefaultCoCMTU, MPS: DefaultCoCMPS, Credits: DefaultCoCCredits}) {
+		t.Fatalf("Expected the defaults, Received: %+v", p)
+	}
+	for _, p := range []CoCParams{{MTU: 22}, {MPS: 22}, {MPS: 65534}} {
+		if _, err = p.withDefaults(); err == nil {
+			t.Fatalf("Expected an error for %+v", p)
+		}
+	}
+}
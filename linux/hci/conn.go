@@ -10,9 +10,12 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/internal/deadline"
 	"github.com/thomascriley/ble/linux/hci/cmd"
 	"github.com/thomascriley/ble/linux/hci/evt"
 	"github.com/thomascriley/ble/linux/smp"
@@ -32,9 +35,14 @@ type Conn struct {
 
 	param ConnectionCompleteEvent
 
-	// LMP Supported Features as reported by the Read Remote Supported Features
-	// Command [Vol 2, Part C, 3.3]
-	lmpFeatures uint64
+	// remoteInfo holds the features and version information of the remote
+	// device, set by fetchRemoteInfo before it closes chRemoteInfo.
+	remoteInfo    RemoteInfo
+	remoteInfoErr error
+	chRemoteInfo  chan struct{}
+
+	// chRemoteEvt receives the events completing the remote information requests.
+	chRemoteEvt chan remoteEvent
 
 	// The channel identifiers. This may be a fixed ID for some protocols (LE)
 	// but dynamic for others (BR/EDR) [Vol 3, Part A, 2.1]
@@ -78,12 +86,18 @@ type Conn struct {
 	// over LE-U logical links shall use CID 0x0005 [Vol 3, Part A, 4]
 	sigCID uint16
 
-	sigSent chan []byte
+	sigSent   chan []byte
+	muSigSent sync.Mutex
+	sigMu     sync.Mutex
 	// smpSent chan []byte
 
-	// cfgRequest closes when the RFCOMM connection responds to a configuration
-	// request
-	cfgRequest chan struct{}
+	// chans are the LE credit based channels, and bredrChans the BR/EDR
+	// channels, by local CID. nextCID is the offset from cidDynamicStart of
+	// the next CID to allocate.
+	muChans    sync.Mutex
+	chans      map[uint16]*L2CAPChannel
+	bredrChans map[uint16]*BREDRChannel
+	nextCID    int
 
 	// chDisconnect called with disconnect complete event from hci
 	chDisconnect chan []byte
@@ -119,6 +133,9 @@ type Conn struct {
 
 	chDone chan struct{}
 
+	readDeadline  deadline.Deadline
+	writeDeadline deadline.Deadline
+
 	// leFrame is set to be true when the LE Credit based flow control is used.
 	leFrame bool
 
@@ -154,7 +171,6 @@ func newConn(h *HCI, param ConnectionCompleteEvent, disconnectHandler func(*Conn
 		sigRxMTU: defaultMTU,
 		sigTxMTU: defaultMTU,
 
-		cfgRequest:   make(chan struct{}),
 		chDisconnect: make(chan []byte),
 
 		chInPkt: make(chan packet, 16),
@@ -162,6 +178,9 @@ func newConn(h *HCI, param ConnectionCompleteEvent, disconnectHandler func(*Conn
 
 		txBuffer: NewClient(h.pool),
 
+		chRemoteInfo: make(chan struct{}),
+		chRemoteEvt:  make(chan remoteEvent, 1),
+
 		chDone:            make(chan struct{}),
 		chRecombine:       make(chan error),
 		log:               log,
@@ -183,9 +202,41 @@ func newConn(h *HCI, param ConnectionCompleteEvent, disconnectHandler func(*Conn
 			}
 		}
 	}()
+
+	c.Add(1)
+	go func() {
+		defer c.Done()
+		c.fetchRemoteInfo()
+	}()
 	return c
 }
 
+// isLE reports whether the connection is an LE one, as opposed to a BR/EDR one.
+func (c *Conn) isLE() bool {
+	_, ok := c.param.(evt.LEConnectionComplete)
+	return ok
+}
+
+// allocCID returns an unused CID, from cidDynamicStart to last. The CIDs are
+// allocated in turn, so the ones of the channels just closed are not reused
+// right away. It is called with muChans held.
+func (c *Conn) allocCID(last uint16) (uint16, error) {
+	n := int(last-cidDynamicStart) + 1
+	for i := 0; i < n; i++ {
+		offset := (c.nextCID + i) % n
+		cid := cidDynamicStart + uint16(offset)
+		if _, ok := c.chans[cid]; ok {
+			continue
+		}
+		if _, ok := c.bredrChans[cid]; ok {
+			continue
+		}
+		c.nextCID = (offset + 1) % n
+		return cid, nil
+	}
+	return 0, errors.New("no channel identifier available")
+}
+
 // Read copies re-assembled L2CAP PDUs into sdu.
 func (c *Conn) Read(sdu []byte) (n int, err error) {
 	var p pdu
@@ -199,6 +250,8 @@ func (c *Conn) Read(sdu []byte) (n int, err error) {
 		if len(p) == 0 {
 			return 0, fmt.Errorf("received empty packet: %w", io.ErrUnexpectedEOF)
 		}
+	case <-c.readDeadline.Done():
+		return 0, os.ErrDeadlineExceeded
 	case <-c.Disconnected():
 		return 0, io.ErrClosedPipe
 	case <-c.hci.Closed():
@@ -241,7 +294,11 @@ func (c *Conn) Write(sdu []byte) (int, error) {
 	if len(sdu) > c.txMTU {
 		return 0, fmt.Errorf("payload exceeds mtu: %w", io.ErrShortWrite)
 	}
-
+	select {
+	case <-c.writeDeadline.Done():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
 	pLen := len(sdu)
 	if pLen > c.txMTU {
 		pLen = c.txMTU
@@ -412,6 +469,16 @@ func (c *Conn) recombine() error {
 	case cid == cidSMP:
 		return c.handleSMP(p)
 	case cid >= cidDynamicStart:
+		if ch := c.bredrChannel(cid); ch != nil {
+			ch.receive(p)
+			return nil
+		}
+		if ch := c.channel(cid); ch != nil {
+			if err := ch.receive(p); err != nil {
+				ch.abort(err)
+			}
+			return nil
+		}
 		return c.receivePDU(p)
 	default:
 		c.hci.log.Debug("recombine: unrecognized CID", slog.String("CID", fmt.Sprintf("%04X", cid)), log.Bytes("pdu", p))
@@ -479,8 +546,10 @@ func (c *Conn) close(ctx context.Context) error {
 
 	c.log.Debug("Releasing for connection resources")
 
+	for _, ch := range c.bredrChannels() {
+		ch.shutdown()
+	}
 	close(c.chInPkt)
-	close(c.cfgRequest)
 	close(c.chInPDU)
 
 	// When a connection disconnects, all the sent packets and weren't acked yet
@@ -496,22 +565,21 @@ func (c *Conn) close(ctx context.Context) error {
 	c.log.Debug("Calling disconnect handler")
 	c.disconnectHandler(c)
 
-	if c.param.Role() == roleSlave {
-		// Re-enable advertising, if it was advertising. Refer to the
-		// handleLEConnectionComplete() for details.
-		// This may fail with ErrCommandDisallowed, if the controller
-		// was actually in advertising state. It does no harm though.
+	if c.param.Role() == roleSlave && c.isLE() {
+		// Re-enable advertising, if it was wanted when the central connected, and has not been resumed since. Refer
+		// to the handleLEConnectionComplete() for details.
 		c.hci.params.RLock()
-		if c.hci.params.advEnable.AdvertisingEnable == 1 {
+		resume := c.hci.params.advWanted && c.hci.params.advEnable.AdvertisingEnable == 0
+		c.hci.params.RUnlock()
+		if resume {
 			c.hci.Add(1)
 			go func() {
 				defer c.hci.Done()
-				if err := c.hci.Send(context.Background(), &c.hci.params.advEnable, nil); err != nil {
-					c.hci.err = fmt.Errorf("unable to reenable advertising: %w", err)
+				if err := c.hci.Advertise(context.Background()); err != nil {
+					c.log.Debug("unable to reenable advertising", log.Error(err))
 				}
 			}()
 		}
-		c.hci.params.RUnlock()
 	}
 	return nil
 }
@@ -525,6 +593,27 @@ func (c *Conn) RemoteAddr() ble.Addr {
 	return net.HardwareAddr([]byte{a[5], a[4], a[3], a[2], a[1], a[0]})
 }
 
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	c.writeDeadline.Set(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline of the reads, past which they return os.ErrDeadlineExceeded. A zero value clears
+// it. The fragments of a PDU whose first one is received are still read in full.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the writes, past which they return os.ErrDeadlineExceeded. A zero value
+// clears it. A PDU is never cut short: the writes started wait for the buffers of the controller.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+	return nil
+}
+
 // RxMTU returns the MTU which the upper layer is capable of accepting.
 func (c *Conn) RxMTU() int { return c.rxMTU }
 
@@ -535,7 +624,13 @@ func (c *Conn) SetRxMTU(mtu int) { c.rxMTU, c.rxMPS = mtu, mtu }
 func (c *Conn) TxMTU() int { return c.txMTU }
 
 // SetTxMTU sets the MTU which the remote device is capable of accepting.
-func (c *Conn) SetTxMTU(mtu int) { c.txMTU = mtu }
+func (c *Conn) SetTxMTU(mtu int) {
+	if mtu == c.txMTU {
+		return
+	}
+	c.txMTU = mtu
+	c.hci.emitConnEvent(newConnEvent(ConnEventMTUChanged, c))
+}
 
 // pkt implements HCI ACL Data Packet [Vol 2, Part E, 5.4.2]
 // Packet boundary flags , bit[5:6] of handle field's MSB
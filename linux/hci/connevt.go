@@ -0,0 +1,145 @@
+package hci
+
+import (
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci/evt"
+)
+
+// ConnEventType is the kind of change reported by a ConnEvent.
+type ConnEventType uint8
+
+// Connection lifecycle events.
+const (
+	ConnEventConnected         ConnEventType = iota + 1 // a connection was established
+	ConnEventParamsUpdated                              // the LE connection parameters were updated
+	ConnEventEncryptionChanged                          // encryption was enabled, disabled or its key refreshed
+	ConnEventMTUChanged                                 // the MTU accepted by the remote device changed
+	ConnEventDisconnected                               // the connection was terminated
+)
+
+func (t ConnEventType) String() string {
+	switch t {
+	case ConnEventConnected:
+		return "connected"
+	case ConnEventParamsUpdated:
+		return "params updated"
+	case ConnEventEncryptionChanged:
+		return "encryption changed"
+	case ConnEventMTUChanged:
+		return "mtu changed"
+	case ConnEventDisconnected:
+		return "disconnected"
+	default:
+		return "unknown"
+	}
+}
+
+// Role is the role of the local device in a connection.
+type Role uint8
+
+// Connection roles [Vol 2, Part E, 7.7.65.1].
+const (
+	RoleMaster Role = roleMaster // the local device initiated the connection
+	RoleSlave  Role = roleSlave  // the local device accepted the connection
+)
+
+func (r Role) String() string {
+	if r == RoleSlave {
+		return "slave"
+	}
+	return "master"
+}
+
+// ConnEvent is a change in the lifecycle of a connection.
+type ConnEvent struct {
+	Type ConnEventType
+	Conn *Conn
+
+	Handle   uint16
+	Role     Role
+	Addr     ble.Addr
+	AddrType ble.AddressType
+
+	// Interval, Latency and SupervisionTimeout are the parameters of LE connections, set by ConnEventConnected and
+	// ConnEventParamsUpdated.
+	Interval           time.Duration
+	Latency            int
+	SupervisionTimeout time.Duration
+
+	// Encrypted reports whether the link is encrypted, set by ConnEventEncryptionChanged.
+	Encrypted bool
+
+	// MTU is the MTU accepted by the remote device, set by ConnEventMTUChanged.
+	MTU int
+
+	// Err is the reason of ConnEventDisconnected, or the failure of a parameters update or encryption change. It is
+	// an ErrCommand, so it can be tested with errors.Is, e.g. errors.Is(e.Err, ErrRemoteUser).
+	Err error
+}
+
+// newConnEvent returns the event of the type describing the connection.
+func newConnEvent(typ ConnEventType, c *Conn) ConnEvent {
+	e := ConnEvent{
+		Type:     typ,
+		Conn:     c,
+		Handle:   c.param.ConnectionHandle(),
+		Role:     Role(c.param.Role()),
+		Addr:     c.RemoteAddr(),
+		AddrType: ble.AddressTypePublic,
+		MTU:      c.txMTU,
+	}
+	if le, ok := c.param.(evt.LEConnectionComplete); ok {
+		// Public and random identity addresses resolved by the controller share the types of their kind.
+		e.AddrType = ble.AddressType(le.PeerAddressType() & 0x01)
+		if typ == ConnEventConnected {
+			e.setParams(le.ConnInterval(), le.ConnLatency(), le.SupervisionTimeout())
+		}
+	}
+	return e
+}
+
+func (e *ConnEvent) setParams(interval, latency, timeout uint16) {
+	e.Interval = time.Duration(interval) * 1250 * time.Microsecond
+	e.Latency = int(latency)
+	e.SupervisionTimeout = time.Duration(timeout) * 10 * time.Millisecond
+}
+
+// emitConnEvent passes the event to the connection event handler.
+func (h *HCI) emitConnEvent(e ConnEvent) {
+	if f := h.connEventHandler; f != nil {
+		f(e)
+	}
+}
+
+// statusErr returns the error reported by an event status, nil on success.
+func statusErr(status uint8) error {
+	if status == 0x00 {
+		return nil
+	}
+	return ErrCommand(status)
+}
+
+func (h *HCI) handleEncryptionChange(b []byte) error {
+	e := evt.EncryptionChange(b)
+	return h.encryptionChanged(e.ConnectionHandle(), e.Status(), e.EncryptionEnabled() != 0x00)
+}
+
+func (h *HCI) handleEncryptionKeyRefreshComplete(b []byte) error {
+	e := evt.EncryptionKeyRefreshComplete(b)
+	return h.encryptionChanged(e.ConnectionHandle(), e.Status(), true)
+}
+
+func (h *HCI) encryptionChanged(handle uint16, status uint8, encrypted bool) error {
+	h.muConns.Lock()
+	c, ok := h.conns[handle]
+	h.muConns.Unlock()
+	if !ok {
+		return nil
+	}
+	e := newConnEvent(ConnEventEncryptionChanged, c)
+	e.Encrypted, e.Err = encrypted && status == 0x00, statusErr(status)
+	h.emitConnEvent(e)
+	return nil
+}
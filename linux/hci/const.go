@@ -9,6 +9,10 @@ const (
 	pktTypeVendor  uint8 = 0xFF
 )
 
+// cmdBufSize fits the largest HCI command packet: the packet type, opcode, parameter length and up to 255 bytes of
+// parameters [Vol 2, Part E, 5.4.1].
+const cmdBufSize = 1 + 2 + 1 + 255
+
 // Packet boundary flags of HCI ACL Data Packet [Vol 2, Part E, 5.4.2].
 const (
 	pbfHostToControllerStart = 0x00 // Start of a non-automatically-flushable from host to controller.
@@ -0,0 +1,275 @@
+package hci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+// Minimum parameters of the channels opened with the enhanced credit based flow control mode [Vol 3, Part A, 4.25].
+const (
+	ecfcMinMTU = 64
+	ecfcMinMPS = 64
+)
+
+// ReconfigureError is the result of a refused credit based reconfigure request [Vol 3, Part A, 4.28].
+type ReconfigureError uint16
+
+func (e ReconfigureError) Error() string {
+	switch uint16(e) {
+	case l2cap.ReconfigureResultMTUReductionNotAllowed:
+		return "reduction in size of MTU not allowed"
+	case l2cap.ReconfigureResultMPSReductionNotAllowed:
+		return "reduction in size of MPS not allowed for more than one channel at a time"
+	case l2cap.ReconfigureResultInvalidDestinationCID:
+		return "one or more destination CIDs invalid"
+	case l2cap.ReconfigureResultUnacceptableParameters:
+		return "unacceptable parameters"
+	default:
+		return fmt.Sprintf("reconfiguration refused (0x%04X)", uint16(e))
+	}
+}
+
+// DialL2CAPChannels opens n, up to 5, channels to the protocol or service listening on the SPSM of the remote device
+// with a single request of the enhanced credit based flow control mode [Vol 3, Part A, 10.2]. The channels receive
+// with the parameters p, whose MTU and MPS must be at least 64 bytes. If the remote device refuses some of the
+// channels, the ones it opened are returned along with the error.
+func (c *Conn) DialL2CAPChannels(ctx context.Context, psm uint16, n int, p CoCParams) ([]*L2CAPChannel, error) {
+	if !c.isLE() {
+		return nil, errors.New("credit based channels are only available on LE connections")
+	}
+	if n < 1 || n > l2cap.MaxCreditBasedChannels {
+		return nil, fmt.Errorf("invalid number of channels %d", n)
+	}
+	p, err := p.withDefaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel parameters: %w", err)
+	}
+	if p.MTU < ecfcMinMTU || p.MPS < ecfcMinMPS {
+		return nil, fmt.Errorf("mtu %d and mps %d must be at least %d", p.MTU, p.MPS, ecfcMinMTU)
+	}
+
+	chans := make([]*L2CAPChannel, n)
+	req := &l2cap.CreditBasedConnectionRequest{SPSM: psm, MTU: p.MTU, MPS: p.MPS, InitialCredits: p.Credits}
+	for i := range chans {
+		chans[i] = newL2CAPChannel(c, psm, p)
+		chans[i].enhanced = true
+		if err = c.addChannel(chans[i]); err != nil {
+			shutdownChannels(chans[:i])
+			return nil, err
+		}
+		req.SourceCID = append(req.SourceCID, chans[i].localCID)
+	}
+
+	rsp := &l2cap.CreditBasedConnectionResponse{}
+	if err = c.Signal(ctx, req, rsp, cocSignalTimeout); err != nil {
+		shutdownChannels(chans)
+		return nil, fmt.Errorf("unable to request l2cap channels: %w", err)
+	}
+
+	// Refused channels have a null destination CID.
+	var opened []*L2CAPChannel
+	var errs []error
+	for i, ch := range chans {
+		var dcid uint16
+		if i < len(rsp.DestinationCID) {
+			dcid = rsp.DestinationCID[i]
+		}
+		if dcid == 0 {
+			ch.shutdown()
+			continue
+		}
+		if err = ch.open(dcid, rsp.MTU, rsp.MPS, rsp.InitialCredits); err != nil {
+			errs = append(errs, fmt.Errorf("invalid l2cap channel response: %w", err))
+			_ = ch.Close()
+			continue
+		}
+		opened = append(opened, ch)
+	}
+	if rsp.Result != l2cap.CreditBasedResultSuccessful {
+		errs = append(errs, fmt.Errorf("l2cap channels refused: %w", CoCError(rsp.Result)))
+	}
+	return opened, errors.Join(errs...)
+}
+
+func shutdownChannels(chans []*L2CAPChannel) {
+	for _, ch := range chans {
+		ch.shutdown()
+	}
+}
+
+// ReconfigureL2CAPChannels changes the MTU and MPS the channels, opened with the enhanced credit based flow control
+// mode on the connection, receive with. The MTU can not be reduced, nor can the MPS of more than one channel at a
+// time [Vol 3, Part A, 4.27].
+func (c *Conn) ReconfigureL2CAPChannels(ctx context.Context, mtu, mps uint16, chans ...*L2CAPChannel) error {
+	if len(chans) < 1 || len(chans) > l2cap.MaxCreditBasedChannels {
+		return fmt.Errorf("invalid number of channels %d", len(chans))
+	}
+	if mtu < ecfcMinMTU || mps < ecfcMinMPS || mps > cocMaxMPS {
+		return ReconfigureError(l2cap.ReconfigureResultUnacceptableParameters)
+	}
+	req := &l2cap.CreditBasedReconfigureRequest{MTU: mtu, MPS: mps}
+	for _, ch := range chans {
+		if ch.conn != c || !ch.enhanced {
+			return fmt.Errorf("channel %04X is not an enhanced credit based channel of the connection", ch.localCID)
+		}
+		ch.muCredits.Lock()
+		rx := ch.rx
+		ch.muCredits.Unlock()
+		switch {
+		case mtu < rx.MTU:
+			return ReconfigureError(l2cap.ReconfigureResultMTUReductionNotAllowed)
+		case mps < rx.MPS && len(chans) > 1:
+			return ReconfigureError(l2cap.ReconfigureResultMPSReductionNotAllowed)
+		}
+		req.DestinationCID = append(req.DestinationCID, ch.localCID)
+	}
+
+	// The remote device may use the new parameters as soon as it accepts them, so the larger ones are applied first.
+	prev := make([]CoCParams, len(chans))
+	for i, ch := range chans {
+		ch.muCredits.Lock()
+		prev[i] = ch.rx
+		ch.rx.MTU = mtu
+		if mps > ch.rx.MPS {
+			ch.rx.MPS = mps
+		}
+		ch.muCredits.Unlock()
+	}
+	restore := func() {
+		for i, ch := range chans {
+			ch.muCredits.Lock()
+			ch.rx.MTU, ch.rx.MPS = prev[i].MTU, prev[i].MPS
+			ch.muCredits.Unlock()
+		}
+	}
+
+	rsp := &l2cap.CreditBasedReconfigureResponse{}
+	if err := c.Signal(ctx, req, rsp, cocSignalTimeout); err != nil {
+		restore()
+		return fmt.Errorf("unable to reconfigure l2cap channels: %w", err)
+	}
+	if rsp.Result != l2cap.ReconfigureResultSuccessful {
+		restore()
+		return ReconfigureError(rsp.Result)
+	}
+	for _, ch := range chans {
+		ch.muCredits.Lock()
+		ch.rx.MPS = mps
+		ch.muCredits.Unlock()
+	}
+	return nil
+}
+
+// handleCreditBasedConnectionRequest accepts the channels if a listener is registered for their SPSM.
+func (c *Conn) handleCreditBasedConnectionRequest(s sigCmd) error {
+	var req l2cap.CreditBasedConnectionRequest
+	if err := req.Unmarshal(s.data()); err != nil {
+		// Malformed requests and requests for more than 5 channels are refused as a whole.
+		_, err = c.sendResponse(l2cap.SignalCreditBasedConnectionResponse, s.id(),
+			&l2cap.CreditBasedConnectionResponse{Result: l2cap.CreditBasedResultInvalidParameters})
+		return err
+	}
+
+	chans, l, result := c.acceptChannels(req)
+	rsp := &l2cap.CreditBasedConnectionResponse{Result: result, DestinationCID: make([]uint16, len(req.SourceCID))}
+	if l != nil {
+		rsp.MTU, rsp.MPS, rsp.InitialCredits = l.params.MTU, l.params.MPS, l.params.Credits
+	}
+	for i, ch := range chans {
+		if ch != nil {
+			rsp.DestinationCID[i] = ch.localCID
+		}
+	}
+	if _, err := c.sendResponse(l2cap.SignalCreditBasedConnectionResponse, s.id(), rsp); err != nil {
+		for _, ch := range chans {
+			if ch != nil {
+				ch.shutdown()
+			}
+		}
+		return fmt.Errorf("unable to send credit based connection response: %w", err)
+	}
+	for _, ch := range chans {
+		if ch != nil && !l.deliver(ch) {
+			ch.abort(errors.New("listener closed or backlog full"))
+		}
+	}
+	return nil
+}
+
+// acceptChannels returns the channels accepted, nil for the ones refused, along with the result of the request.
+func (c *Conn) acceptChannels(req l2cap.CreditBasedConnectionRequest) ([]*L2CAPChannel, *L2CAPListener, uint16) {
+	l := c.hci.cocListener(req.SPSM)
+	switch {
+	case len(req.SourceCID) == 0:
+		return nil, nil, l2cap.CreditBasedResultInvalidParameters
+	case l == nil:
+		return nil, nil, l2cap.CreditBasedResultSPSMNotSupported
+	case req.MTU < ecfcMinMTU || req.MPS < ecfcMinMPS || req.MPS > cocMaxMPS,
+		l.params.MTU < ecfcMinMTU || l.params.MPS < ecfcMinMPS:
+		return nil, l, l2cap.CreditBasedResultUnacceptableParameters
+	}
+
+	chans := make([]*L2CAPChannel, len(req.SourceCID))
+	result := l2cap.CreditBasedResultSuccessful
+	for i, scid := range req.SourceCID {
+		if c.channelByRemoteCID(scid) != nil {
+			result = l2cap.CreditBasedResultSourceCIDAlreadyAllocated
+			continue
+		}
+		ch := newL2CAPChannel(c, req.SPSM, l.params)
+		ch.enhanced = true
+		if err := ch.open(scid, req.MTU, req.MPS, req.InitialCredits); err != nil {
+			result = l2cap.CreditBasedResultInvalidSourceCID
+			continue
+		}
+		if err := c.addChannel(ch); err != nil {
+			result = l2cap.CreditBasedResultNoResources
+			continue
+		}
+		chans[i] = ch
+	}
+	return chans, l, result
+}
+
+// handleCreditBasedReconfigureRequest applies the MTU and MPS the remote device receives with to its channels.
+func (c *Conn) handleCreditBasedReconfigureRequest(s sigCmd) error {
+	var req l2cap.CreditBasedReconfigureRequest
+	result := c.reconfigureChannels(req.Unmarshal(s.data()), req)
+	_, err := c.sendResponse(l2cap.SignalCreditBasedReconfigureResponse, s.id(),
+		&l2cap.CreditBasedReconfigureResponse{Result: result})
+	return err
+}
+
+func (c *Conn) reconfigureChannels(err error, req l2cap.CreditBasedReconfigureRequest) uint16 {
+	if err != nil || len(req.DestinationCID) == 0 || req.MTU < ecfcMinMTU || req.MPS < ecfcMinMPS ||
+		req.MPS > cocMaxMPS {
+		return l2cap.ReconfigureResultUnacceptableParameters
+	}
+	// The CIDs are the ones of the remote device.
+	chans := make([]*L2CAPChannel, len(req.DestinationCID))
+	for i, cid := range req.DestinationCID {
+		if chans[i] = c.channelByRemoteCID(cid); chans[i] == nil || !chans[i].enhanced {
+			return l2cap.ReconfigureResultInvalidDestinationCID
+		}
+	}
+	for _, ch := range chans {
+		ch.muCredits.Lock()
+		mtu, mps := ch.txMTU, ch.txMPS
+		ch.muCredits.Unlock()
+		switch {
+		case int(req.MTU) < mtu:
+			return l2cap.ReconfigureResultMTUReductionNotAllowed
+		case int(req.MPS) < mps && len(chans) > 1:
+			return l2cap.ReconfigureResultMPSReductionNotAllowed
+		}
+	}
+	for _, ch := range chans {
+		ch.muCredits.Lock()
+		ch.txMTU, ch.txMPS = int(req.MTU), int(req.MPS)
+		ch.muCredits.Unlock()
+	}
+	return l2cap.ReconfigureResultSuccessful
+}
@@ -13,6 +13,7 @@ var (
 	ErrUnsupportedScoPacket = errors.New("unsupported sco packet")
 	ErrUnsupportedCommand = errors.New("unsupported command")
 	ErrInvalidPacket = errors.New("invalid packet")
+	ErrUnsupportedFeature = errors.New("feature not supported by controller")
 )
 
 // HCI Command Errors  [Vol2, Part D, 1.3 ]
@@ -0,0 +1,719 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+// Fields of the standard control field of the I-frames and S-frames [Vol 3, Part A, 3.3.2].
+const (
+	ctrlSFrame = 0x0001
+	ctrlPoll   = 0x0010
+	ctrlFinal  = 0x0080
+
+	// Segmentation and Reassembly of the I-frames.
+	sarUnsegmented  = 0x00
+	sarStart        = 0x01
+	sarEnd          = 0x02
+	sarContinuation = 0x03
+
+	// Supervisory functions of the S-frames.
+	sRR   = 0x00 // Receiver Ready
+	sREJ  = 0x01 // Reject
+	sRNR  = 0x02 // Receiver Not Ready
+	sSREJ = 0x03 // Selective Reject
+
+	// seqMask is the modulus of the sequence numbers.
+	seqMask = 0x3F
+
+	// streamingBacklog is the number of SDUs received in Streaming mode held until they are read. Newer SDUs are
+	// dropped once it is reached, as the mode has no flow control.
+	streamingBacklog = 64
+)
+
+type control uint16
+
+func iControl(txSeq, reqSeq, sar uint8, final bool) control {
+	c := control(txSeq&seqMask)<<1 | control(reqSeq&seqMask)<<8 | control(sar)<<14
+	if final {
+		c |= ctrlFinal
+	}
+	return c
+}
+
+func sControl(function, reqSeq uint8, poll, final bool) control {
+	c := ctrlSFrame | control(function)<<2 | control(reqSeq&seqMask)<<8
+	if poll {
+		c |= ctrlPoll
+	}
+	if final {
+		c |= ctrlFinal
+	}
+	return c
+}
+
+func (c control) isS() bool       { return c&ctrlSFrame != 0 }
+func (c control) txSeq() uint8    { return uint8(c>>1) & seqMask }
+func (c control) reqSeq() uint8   { return uint8(c>>8) & seqMask }
+func (c control) sar() uint8      { return uint8(c >> 14) }
+func (c control) function() uint8 { return uint8(c>>2) & 0x03 }
+func (c control) poll() bool      { return c&ctrlPoll != 0 }
+func (c control) final() bool     { return c&ctrlFinal != 0 }
+
+// seqOffset returns how far the sequence number is ahead of base.
+func seqOffset(seq, base uint8) int { return int((seq - base) & seqMask) }
+
+// ertmConfig is the configuration of an ertm, as negotiated by the configuration of the channel.
+type ertmConfig struct {
+	mode uint8
+	fcs  bool
+
+	rxMTU    int
+	rxMPS    int
+	rxWindow int
+
+	txMTU       int
+	txMPS       int
+	txWindow    int
+	maxTransmit int
+
+	retransmissionTimeout time.Duration
+	monitorTimeout        time.Duration
+}
+
+// txFrame is an I-frame sent, or waiting to be, along with the number of times it was.
+type txFrame struct {
+	txSeq       uint8
+	sar         uint8
+	payload     []byte
+	transmitted int
+}
+
+// ertm implements the Enhanced Retransmission and Streaming modes of a BR/EDR channel [Vol 3, Part A, 8]. It
+// segments the SDUs written into I-frames, which are numbered, acknowledged and retransmitted in Enhanced
+// Retransmission mode, and reassembles the SDUs of the I-frames received.
+type ertm struct {
+	cfg ertmConfig
+	cid uint16
+
+	// send writes a frame on the link. failed disconnects the channel after an error, or after the remote device
+	// violated the protocol. Both are called with mu held.
+	send   func([]byte) error
+	failed func(error)
+
+	mu sync.Mutex
+
+	// Transmitting side. nextTxSeq is the TxSeq of the next new I-frame, expectedAckSeq the one of the oldest I-frame
+	// not yet acknowledged.
+	muWrite        sync.Mutex
+	pending        []*txFrame
+	unacked        map[uint8]*txFrame
+	nextTxSeq      uint8
+	expectedAckSeq uint8
+	remoteBusy     bool
+	waitF          bool
+	retryCount     int
+	retransTimer   *time.Timer
+	monitorTimer   *time.Timer
+	chTx           chan struct{}
+
+	// Receiving side. expectedTxSeq is the TxSeq of the next I-frame to reassemble and bufferSeq the one following
+	// the latest received, which are held in srej until the I-frames missing before them are retransmitted.
+	expectedTxSeq uint8
+	bufferSeq     uint8
+	srej          map[uint8]rxFrame
+	rejSent       bool
+	asm           sarAssembler
+	sdus          [][]byte
+	localBusy     bool
+	chSDU         chan struct{}
+
+	err      error
+	chClosed chan struct{}
+}
+
+// rxFrame is an I-frame received out of sequence.
+type rxFrame struct {
+	sar     uint8
+	payload []byte
+}
+
+func newERTM(cfg ertmConfig, cid uint16, send func([]byte) error, failed func(error)) *ertm {
+	return &ertm{
+		cfg:      cfg,
+		cid:      cid,
+		send:     send,
+		failed:   failed,
+		unacked:  make(map[uint8]*txFrame),
+		srej:     make(map[uint8]rxFrame),
+		chTx:     make(chan struct{}, 1),
+		chSDU:    make(chan struct{}, 1),
+		chClosed: make(chan struct{}),
+	}
+}
+
+// write segments the SDU into I-frames and waits until they are all sent, or expired is closed: the I-frames pending
+// are still sent then.
+func (e *ertm) write(sdu []byte, expired <-chan struct{}) error {
+	if len(sdu) > e.cfg.txMTU {
+		return fmt.Errorf("sdu size %d larger than mtu %d: %w", len(sdu), e.cfg.txMTU, io.ErrShortWrite)
+	}
+	e.muWrite.Lock()
+	defer e.muWrite.Unlock()
+
+	e.mu.Lock()
+	e.pending = append(e.pending, segmentIFrames(sdu, e.cfg.txMPS)...)
+	e.mu.Unlock()
+
+	for {
+		e.mu.Lock()
+		err := e.transmit()
+		done := len(e.pending) == 0
+		e.mu.Unlock()
+		switch {
+		case err != nil:
+			return err
+		case done:
+			return nil
+		}
+		select {
+		case <-e.chTx:
+		case <-expired:
+			return os.ErrDeadlineExceeded
+		case <-e.chClosed:
+			return e.closedErr()
+		}
+	}
+}
+
+// segmentIFrames splits the SDU into I-frame payloads of at most mps bytes, the length of the SDU included.
+func segmentIFrames(sdu []byte, mps int) []*txFrame {
+	if len(sdu) <= mps {
+		return []*txFrame{{sar: sarUnsegmented, payload: append([]byte(nil), sdu...)}}
+	}
+	n := mps - 2
+	start := make([]byte, 2, mps)
+	binary.LittleEndian.PutUint16(start, uint16(len(sdu)))
+	frames := []*txFrame{{sar: sarStart, payload: append(start, sdu[:n]...)}}
+	for sdu = sdu[n:]; len(sdu) > 0; sdu = sdu[n:] {
+		n = mps
+		sar := uint8(sarContinuation)
+		if len(sdu) <= n {
+			n, sar = len(sdu), sarEnd
+		}
+		frames = append(frames, &txFrame{sar: sar, payload: append([]byte(nil), sdu[:n]...)})
+	}
+	return frames
+}
+
+// transmit sends the pending I-frames the window of the remote device allows. It is called with mu held.
+func (e *ertm) transmit() error {
+	if e.err != nil {
+		return e.closedErr()
+	}
+	for len(e.pending) > 0 {
+		if e.cfg.mode == l2cap.ModeEnhancedRetransmission &&
+			(e.remoteBusy || e.waitF || len(e.unacked) >= e.cfg.txWindow) {
+			return nil
+		}
+		f := e.pending[0]
+		e.pending = e.pending[1:]
+		f.txSeq = e.nextTxSeq
+		e.nextTxSeq = (e.nextTxSeq + 1) & seqMask
+		if e.cfg.mode == l2cap.ModeEnhancedRetransmission {
+			e.unacked[f.txSeq] = f
+		}
+		if err := e.sendIFrame(f, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendIFrame sends, or resends, the I-frame acknowledging the I-frames received.
+func (e *ertm) sendIFrame(f *txFrame, final bool) error {
+	reqSeq := e.expectedTxSeq
+	if e.cfg.mode == l2cap.ModeStreaming {
+		reqSeq = 0
+	}
+	f.transmitted++
+	if err := e.send(e.frame(iControl(f.txSeq, reqSeq, f.sar, final), f.payload)); err != nil {
+		return fmt.Errorf("unable to send i-frame: %w", err)
+	}
+	if e.cfg.mode == l2cap.ModeEnhancedRetransmission && !e.waitF {
+		e.startRetransTimer()
+	}
+	return nil
+}
+
+// sendSFrame sends the S-frame acknowledging the I-frames received.
+func (e *ertm) sendSFrame(function uint8, poll, final bool) error {
+	if function == sRR && e.localBusy {
+		function = sRNR
+	}
+	if err := e.send(e.frame(sControl(function, e.expectedTxSeq, poll, final), nil)); err != nil {
+		return fmt.Errorf("unable to send s-frame: %w", err)
+	}
+	return nil
+}
+
+// sendSREJ requests the retransmission of the I-frame.
+func (e *ertm) sendSREJ(txSeq uint8) error {
+	if err := e.send(e.frame(sControl(sSREJ, txSeq, false, false), nil)); err != nil {
+		return fmt.Errorf("unable to send s-frame: %w", err)
+	}
+	return nil
+}
+
+// frame returns the PDU of the control field and payload, followed by its Frame Check Sequence if used.
+func (e *ertm) frame(ctrl control, payload []byte) []byte {
+	n := 2 + len(payload)
+	if e.cfg.fcs {
+		n += 2
+	}
+	b := make([]byte, 6, 4+n)
+	binary.LittleEndian.PutUint16(b[0:2], uint16(n))
+	binary.LittleEndian.PutUint16(b[2:4], e.cid)
+	binary.LittleEndian.PutUint16(b[4:6], uint16(ctrl))
+	b = append(b, payload...)
+	if e.cfg.fcs {
+		fcs := fcs16(b)
+		b = append(b, byte(fcs), byte(fcs>>8))
+	}
+	return b
+}
+
+// startRetransTimer starts the retransmission timer, unless it is running, while I-frames wait to be acknowledged.
+func (e *ertm) startRetransTimer() {
+	if e.retransTimer != nil || len(e.unacked) == 0 {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(e.cfg.retransmissionTimeout, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.retransTimer != t {
+			return
+		}
+		e.retransTimer = nil
+		if len(e.unacked) == 0 || e.err != nil {
+			return
+		}
+		// Poll the remote device for the I-frames it received [Vol 3, Part A, 8.6.5.6].
+		e.waitF, e.retryCount = true, 1
+		if err := e.sendSFrame(sRR, true, false); err != nil {
+			e.fail(err)
+			return
+		}
+		e.startMonitorTimer()
+	})
+	e.retransTimer = t
+}
+
+func (e *ertm) stopRetransTimer() {
+	if e.retransTimer != nil {
+		e.retransTimer.Stop()
+		e.retransTimer = nil
+	}
+}
+
+// startMonitorTimer starts the monitor timer, which polls the remote device again until it answers, or MaxTransmit
+// polls were sent.
+func (e *ertm) startMonitorTimer() {
+	var t *time.Timer
+	t = time.AfterFunc(e.cfg.monitorTimeout, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.monitorTimer != t {
+			return
+		}
+		e.monitorTimer = nil
+		if !e.waitF || e.err != nil {
+			return
+		}
+		if e.cfg.maxTransmit != 0 && e.retryCount >= e.cfg.maxTransmit {
+			e.fail(errors.New("remote device did not answer the polls"))
+			return
+		}
+		e.retryCount++
+		if err := e.sendSFrame(sRR, true, false); err != nil {
+			e.fail(err)
+			return
+		}
+		e.startMonitorTimer()
+	})
+	e.monitorTimer = t
+}
+
+func (e *ertm) stopMonitorTimer() {
+	if e.monitorTimer != nil {
+		e.monitorTimer.Stop()
+		e.monitorTimer = nil
+	}
+}
+
+// acknowledge releases the I-frames acknowledged by ReqSeq, which acknowledges those before it.
+func (e *ertm) acknowledge(reqSeq uint8) error {
+	if seqOffset(reqSeq, e.expectedAckSeq) > seqOffset(e.nextTxSeq, e.expectedAckSeq) {
+		return fmt.Errorf("invalid reqseq %d", reqSeq)
+	}
+	for e.expectedAckSeq != reqSeq {
+		delete(e.unacked, e.expectedAckSeq)
+		e.expectedAckSeq = (e.expectedAckSeq + 1) & seqMask
+	}
+	e.stopRetransTimer()
+	if !e.waitF && !e.remoteBusy {
+		e.startRetransTimer()
+	}
+	select {
+	case e.chTx <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// retransmit resends the I-frame, unless it was sent MaxTransmit times.
+func (e *ertm) retransmit(txSeq uint8, final bool) error {
+	f, ok := e.unacked[txSeq]
+	if !ok {
+		return nil
+	}
+	if e.cfg.maxTransmit != 0 && f.transmitted >= e.cfg.maxTransmit {
+		return fmt.Errorf("i-frame %d sent %d times", txSeq, f.transmitted)
+	}
+	return e.sendIFrame(f, final)
+}
+
+// retransmitAll resends the I-frames not acknowledged, in order.
+func (e *ertm) retransmitAll() error {
+	for seq := e.expectedAckSeq; seq != e.nextTxSeq; seq = (seq + 1) & seqMask {
+		if err := e.retransmit(seq, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receive handles an I-frame or S-frame received on the channel. It runs on the recombine loop of the connection.
+func (e *ertm) receive(p pdu) {
+	b := p.payload()
+	if e.cfg.fcs {
+		// Corrupted frames are dropped and recovered as lost ones [Vol 3, Part A, 8.6.5.4].
+		n := len(p) - 2
+		if len(b) < 4 || fcs16(p[:n]) != binary.LittleEndian.Uint16(p[n:]) {
+			return
+		}
+		b = b[:len(b)-2]
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return
+	}
+	if len(b) < 2 {
+		e.fail(errors.New("frame without control field"))
+		return
+	}
+	ctrl := control(binary.LittleEndian.Uint16(b))
+	b = b[2:]
+
+	var err error
+	switch {
+	case e.cfg.mode == l2cap.ModeStreaming:
+		if !ctrl.isS() {
+			e.receiveStreaming(ctrl, b)
+		}
+	case ctrl.isS():
+		err = e.receiveSFrame(ctrl)
+	default:
+		err = e.receiveIFrame(ctrl, b)
+	}
+	if err != nil {
+		e.fail(err)
+	}
+}
+
+func (e *ertm) receiveSFrame(ctrl control) error {
+	// A selective reject only acknowledges the I-frames when it polls [Vol 3, Part A, 8.6.5.9].
+	if ctrl.function() != sSREJ || ctrl.poll() {
+		if err := e.acknowledge(ctrl.reqSeq()); err != nil {
+			return err
+		}
+	} else if _, ok := e.unacked[ctrl.reqSeq()]; !ok {
+		return fmt.Errorf("invalid reqseq %d", ctrl.reqSeq())
+	}
+
+	resend := e.receiveFinal(ctrl)
+	switch ctrl.function() {
+	case sRR:
+		e.remoteBusy = false
+	case sRNR:
+		e.remoteBusy = true
+		e.stopRetransTimer()
+		resend = false
+	case sREJ:
+		e.remoteBusy, resend = false, true
+	case sSREJ:
+		e.remoteBusy = false
+		if err := e.retransmit(ctrl.reqSeq(), ctrl.poll()); err != nil {
+			return err
+		}
+		return e.transmit()
+	}
+	if resend {
+		if err := e.retransmitAll(); err != nil {
+			return err
+		}
+	}
+	if ctrl.poll() {
+		if err := e.sendSFrame(sRR, false, true); err != nil {
+			return err
+		}
+	}
+	return e.transmit()
+}
+
+// receiveFinal ends the wait for the answer of the remote device to a poll. It reports whether the I-frames not
+// acknowledged by the answer have to be resent.
+func (e *ertm) receiveFinal(ctrl control) bool {
+	if !ctrl.final() || !e.waitF {
+		return false
+	}
+	e.waitF, e.retryCount = false, 0
+	e.stopMonitorTimer()
+	e.startRetransTimer()
+	return len(e.unacked) > 0
+}
+
+func (e *ertm) receiveIFrame(ctrl control, payload []byte) error {
+	if err := e.acknowledge(ctrl.reqSeq()); err != nil {
+		return err
+	}
+	if e.receiveFinal(ctrl) {
+		if err := e.retransmitAll(); err != nil {
+			return err
+		}
+	}
+	if len(payload) > e.cfg.rxMPS+2 {
+		return fmt.Errorf("i-frame size %d larger than mps %d", len(payload), e.cfg.rxMPS)
+	}
+
+	txSeq := ctrl.txSeq()
+	ahead := seqOffset(txSeq, e.expectedTxSeq)
+	switch {
+	case ahead >= e.cfg.rxWindow && seqOffset(e.expectedTxSeq, txSeq) <= e.cfg.rxWindow:
+		// Duplicates of I-frames already received are dropped, but still acknowledged.
+		return e.sendAck()
+	case ahead >= e.cfg.rxWindow:
+		return fmt.Errorf("invalid txseq %d", txSeq)
+	}
+	if _, ok := e.srej[txSeq]; ok {
+		return nil
+	}
+	e.srej[txSeq] = rxFrame{sar: ctrl.sar(), payload: append([]byte(nil), payload...)}
+
+	// I-frames missing before the one received are requested again: a single one selectively, more with a reject.
+	if next := seqOffset(e.bufferSeq, e.expectedTxSeq); ahead >= next {
+		switch missing := ahead - next; {
+		case missing == 1:
+			if err := e.sendSREJ(e.bufferSeq); err != nil {
+				return err
+			}
+		case missing > 1 && !e.rejSent:
+			e.rejSent = true
+			if err := e.sendSFrame(sREJ, false, false); err != nil {
+				return err
+			}
+		}
+		e.bufferSeq = (txSeq + 1) & seqMask
+	}
+
+	for {
+		f, ok := e.srej[e.expectedTxSeq]
+		if !ok {
+			break
+		}
+		delete(e.srej, e.expectedTxSeq)
+		e.expectedTxSeq = (e.expectedTxSeq + 1) & seqMask
+		e.rejSent = false
+		sdu, err := e.asm.add(f.sar, f.payload, e.cfg.rxMTU)
+		if err != nil {
+			return err
+		}
+		if sdu != nil {
+			e.queue(sdu)
+		}
+	}
+	return e.sendAck()
+}
+
+// sendAck acknowledges the I-frames received, along with the I-frames pending if the window allows.
+func (e *ertm) sendAck() error {
+	if len(e.pending) > 0 && !e.remoteBusy && !e.waitF && len(e.unacked) < e.cfg.txWindow {
+		return e.transmit()
+	}
+	return e.sendSFrame(sRR, false, false)
+}
+
+// receiveStreaming reassembles the I-frames received in Streaming mode, in which the SDUs of the I-frames lost are
+// dropped [Vol 3, Part A, 8.6.6].
+func (e *ertm) receiveStreaming(ctrl control, payload []byte) {
+	if ctrl.txSeq() != e.expectedTxSeq {
+		e.asm.reset()
+	}
+	e.expectedTxSeq = (ctrl.txSeq() + 1) & seqMask
+	if len(payload) > e.cfg.rxMPS+2 {
+		e.asm.reset()
+		return
+	}
+	sdu, err := e.asm.add(ctrl.sar(), payload, e.cfg.rxMTU)
+	switch {
+	case err != nil:
+		e.asm.reset()
+	case sdu != nil && len(e.sdus) < streamingBacklog:
+		e.queue(sdu)
+	}
+}
+
+// queue holds the SDU until it is read. In Enhanced Retransmission mode the remote device is told to stop sending
+// once a window of SDUs is waiting.
+func (e *ertm) queue(sdu []byte) {
+	e.sdus = append(e.sdus, sdu)
+	if e.cfg.mode == l2cap.ModeEnhancedRetransmission && len(e.sdus) >= e.cfg.rxWindow {
+		e.localBusy = true
+	}
+	select {
+	case e.chSDU <- struct{}{}:
+	default:
+	}
+}
+
+// read returns the next SDU received, io.EOF once the channel is closed, or os.ErrDeadlineExceeded once expired is
+// closed.
+func (e *ertm) read(expired <-chan struct{}) ([]byte, error) {
+	for {
+		e.mu.Lock()
+		if len(e.sdus) > 0 {
+			sdu := e.sdus[0]
+			e.sdus[0] = nil
+			e.sdus = e.sdus[1:]
+			var err error
+			if e.localBusy && len(e.sdus) == 0 {
+				// The remote device can send again [Vol 3, Part A, 8.6.5.5].
+				e.localBusy = false
+				err = e.sendSFrame(sRR, false, false)
+			}
+			e.mu.Unlock()
+			return sdu, err
+		}
+		e.mu.Unlock()
+
+		select {
+		case <-e.chSDU:
+		case <-expired:
+			return nil, os.ErrDeadlineExceeded
+		case <-e.chClosed:
+			e.mu.Lock()
+			n := len(e.sdus)
+			e.mu.Unlock()
+			if n == 0 {
+				return nil, io.EOF
+			}
+		}
+	}
+}
+
+// fail stops the mode after an error. It is called with mu held.
+func (e *ertm) fail(err error) {
+	if e.err != nil {
+		return
+	}
+	e.err = err
+	e.stopRetransTimer()
+	e.stopMonitorTimer()
+	close(e.chClosed)
+	if !errors.Is(err, io.ErrClosedPipe) && e.failed != nil {
+		e.failed(err)
+	}
+}
+
+// close stops the mode once the channel is closed.
+func (e *ertm) close() {
+	e.mu.Lock()
+	e.fail(io.ErrClosedPipe)
+	e.mu.Unlock()
+}
+
+func (e *ertm) closedErr() error {
+	if errors.Is(e.err, io.ErrClosedPipe) {
+		return io.ErrClosedPipe
+	}
+	return fmt.Errorf("channel failed: %w", e.err)
+}
+
+// sarAssembler reassembles the SDUs segmented into I-frames.
+type sarAssembler struct {
+	sdu  []byte
+	size int
+	busy bool
+}
+
+// add appends the payload of the I-frame, returning the SDU once complete.
+func (a *sarAssembler) add(sar uint8, payload []byte, mtu int) ([]byte, error) {
+	switch sar {
+	case sarUnsegmented:
+		if a.busy {
+			return nil, errors.New("unsegmented i-frame within a segmented sdu")
+		}
+		if len(payload) > mtu {
+			return nil, fmt.Errorf("sdu size %d larger than mtu %d", len(payload), mtu)
+		}
+		return payload, nil
+	case sarStart:
+		if a.busy {
+			return nil, errors.New("sdu started within a segmented sdu")
+		}
+		if len(payload) < 2 {
+			return nil, errors.New("start i-frame without sdu length")
+		}
+		a.size = int(binary.LittleEndian.Uint16(payload))
+		if a.size > mtu {
+			return nil, fmt.Errorf("sdu size %d larger than mtu %d", a.size, mtu)
+		}
+		a.sdu, a.busy = append(make([]byte, 0, a.size), payload[2:]...), true
+		if len(a.sdu) >= a.size {
+			return nil, errors.New("start i-frame holds the whole sdu")
+		}
+		return nil, nil
+	default:
+		if !a.busy {
+			return nil, errors.New("i-frame continues no sdu")
+		}
+		a.sdu = append(a.sdu, payload...)
+		switch {
+		case len(a.sdu) > a.size:
+			return nil, fmt.Errorf("sdu larger than its size %d", a.size)
+		case sar == sarContinuation && len(a.sdu) == a.size:
+			return nil, errors.New("continuation i-frame ends the sdu")
+		case sar == sarEnd && len(a.sdu) != a.size:
+			return nil, fmt.Errorf("sdu of %d bytes ended before its size %d", len(a.sdu), a.size)
+		case sar == sarEnd:
+			sdu := a.sdu
+			a.reset()
+			return sdu, nil
+		}
+		return nil, nil
+	}
+}
+
+func (a *sarAssembler) reset() {
+	a.sdu, a.size, a.busy = nil, 0, false
+}
@@ -0,0 +1,292 @@
+package hci
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+func TestFCS16(t *testing.T) {
+	if fcs := fcs16([]byte("123456789")); fcs != 0xBB3D {
+		t.Fatalf("Expected: %04X, Received: %04X", 0xBB3D, fcs)
+	}
+}
+
+func TestSegmentIFrames(t *testing.T) {
+	sdu := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	frames := segmentIFrames(sdu, 4)
+	expected := []uint8{sarStart, sarContinuation, sarEnd}
+	if len(frames) != len(expected) {
+		t.Fatalf("Expected: %d frames, Received: %d", len(expected), len(frames))
+	}
+	var asm sarAssembler
+	for i, f := range frames {
+		if f.sar != expected[i] {
+			t.Fatalf("Expected: %d, Received: %d", expected[i], f.sar)
+		}
+		if len(f.payload) > 4 {
+			t.Fatalf("Expected: at most 4 bytes, Received: %X", f.payload)
+		}
+		b, err := asm.add(f.sar, f.payload, len(sdu))
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if i == len(frames)-1 && !bytes.Equal(sdu, b) {
+			t.Fatalf("Expected: %X, Received: %X", sdu, b)
+		}
+	}
+
+	if _, err := asm.add(sarStart, frames[0].payload, len(sdu)-1); err == nil {
+		t.Fatalf("Expected an error for an sdu larger than the mtu")
+	}
+	asm.reset()
+	if _, err := asm.add(sarEnd, frames[2].payload, len(sdu)); err == nil {
+		t.Fatalf("Expected an error for an end frame without start frame")
+	}
+}
+
+// ertmLink connects two engines, passing the frames one sends to the other unless drop drops them.
+type ertmLink struct {
+	a, b *ertm
+	wg   sync.WaitGroup
+	errs chan error
+	done chan struct{}
+}
+
+func newERTMLink(cfg ertmConfig, drop func(from *ertm, ctrl control) bool) *ertmLink {
+	l := &ertmLink{errs: make(chan error, 2), done: make(chan struct{})}
+	toA, toB := make(chan []byte, 256), make(chan []byte, 256)
+	failed := func(err error) { l.errs <- err }
+	l.a = newERTM(cfg, 0x0040, func(b []byte) error { toB <- b; return nil }, failed)
+	l.b = newERTM(cfg, 0x0041, func(b []byte) error { toA <- b; return nil }, failed)
+	pump := func(from, to *ertm, ch chan []byte) {
+		defer l.wg.Done()
+		for {
+			select {
+			case b := <-ch:
+				if !drop(from, control(binary.LittleEndian.Uint16(b[4:6]))) {
+					to.receive(b)
+				}
+			case <-l.done:
+				return
+			}
+		}
+	}
+	l.wg.Add(2)
+	go pump(l.a, l.b, toB)
+	go pump(l.b, l.a, toA)
+	return l
+}
+
+func (l *ertmLink) close() {
+	close(l.done)
+	l.wg.Wait()
+	l.a.close()
+	l.b.close()
+}
+
+// testTransfer writes the SDUs on one side of the link and checks they are read in order on the other.
+func testTransfer(t *testing.T, l *ertmLink, sdus [][]byte) {
+	chErr := make(chan error, 1)
+	go func() {
+		for _, sdu := range sdus {
+			if err := l.a.write(sdu, nil); err != nil {
+				chErr <- err
+				return
+			}
+		}
+		chErr <- nil
+	}()
+	for _, sdu := range sdus {
+		b, err := l.b.read(nil)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if !bytes.Equal(sdu, b) {
+			t.Fatalf("Expected: %X, Received: %X", sdu, b)
+		}
+	}
+	if err := <-chErr; err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	select {
+	case err := <-l.errs:
+		t.Fatalf("Error: %s", err)
+	default:
+	}
+}
+
+func testSDUs(n, size int) [][]byte {
+	sdus := make([][]byte, n)
+	for i := range sdus {
+		sdus[i] = make([]byte, size)
+		for j := range sdus[i] {
+			sdus[i][j] = byte(i + j)
+		}
+	}
+	return sdus
+}
+
+var testERTMConfig = ertmConfig{
+	mode:                  l2cap.ModeEnhancedRetransmission,
+	fcs:                   true,
+	rxMTU:                 512,
+	rxMPS:                 16,
+	rxWindow:              4,
+	txMTU:                 512,
+	txMPS:                 16,
+	txWindow:              4,
+	maxTransmit:           5,
+	retransmissionTimeout: 20 * time.Millisecond,
+	monitorTimeout:        50 * time.Millisecond,
+}
+
+func TestERTMRecovery(t *testing.T) {
+	// The first transmissions of I-frame 2, lost alone, and of I-frames 6 and 7, lost together, are dropped, as is
+	// the first acknowledgement of I-frame 12, recovered by polling.
+	var mu sync.Mutex
+	dropped := map[string]bool{}
+	drop := func(from *ertm, ctrl control) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		var key string
+		switch {
+		case !ctrl.isS() && (ctrl.txSeq() == 2 || ctrl.txSeq() == 6 || ctrl.txSeq() == 7):
+			key = string(rune('a' + ctrl.txSeq()))
+		case ctrl.isS() && ctrl.function() == sRR && ctrl.reqSeq() == 13 && !ctrl.final():
+			key = "ack"
+		default:
+			return false
+		}
+		if dropped[key] {
+			return false
+		}
+		dropped[key] = true
+		return true
+	}
+	l := newERTMLink(testERTMConfig, drop)
+	defer l.close()
+	testTransfer(t, l, testSDUs(6, 40))
+}
+
+func TestERTMMaxTransmit(t *testing.T) {
+	l := newERTMLink(testERTMConfig, func(from *ertm, ctrl control) bool { return true })
+	defer l.close()
+	go func() { _ = l.a.write([]byte{0x01}, nil) }()
+	select {
+	case <-l.errs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the channel to fail")
+	}
+}
+
+func TestStreamingLoss(t *testing.T) {
+	cfg := testERTMConfig
+	cfg.mode = l2cap.ModeStreaming
+	l := newERTMLink(cfg, func(from *ertm, ctrl control) bool { return ctrl.txSeq() == 1 })
+	defer l.close()
+
+	// The SDU of the lost I-frame is dropped.
+	sdus := testSDUs(3, 20)
+	for _, sdu := range sdus {
+		if err := l.a.write(sdu, nil); err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+	}
+	for _, sdu := range sdus[1:] {
+		b, err := l.b.read(nil)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if !bytes.Equal(sdu, b) {
+			t.Fatalf("Expected: %X, Received: %X", sdu, b)
+		}
+	}
+}
+
+func TestModeConfigRequest(t *testing.T) {
+	local, err := ModeParams{Mode: l2cap.ModeEnhancedRetransmission}.withDefaults()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	m := modeConfig{local: local}
+
+	// Basic mode is refused, suggesting the mode of the local device.
+	opts, result := m.request([]l2cap.Option{&l2cap.MTUOption{MTU: 672}})
+	if result != l2cap.ConfigurationResultFailureUnacceptable {
+		t.Fatalf("Expected: %d, Received: %d", l2cap.ConfigurationResultFailureUnacceptable, result)
+	}
+	if rfc, ok := opts[0].(*l2cap.RetransmissionAndFlowControlOption); !ok || rfc.Mode != local.Mode {
+		t.Fatalf("Expected: mode %d, Received: %+v", local.Mode, opts[0])
+	}
+
+	opts, result = m.request([]l2cap.Option{
+		&l2cap.MTUOption{MTU: 672},
+		&l2cap.RetransmissionAndFlowControlOption{Mode: l2cap.ModeEnhancedRetransmission, TxWindowSize: 10,
+			MaxTransmit: 4, MaximumPDUSize: 200},
+		&l2cap.FrameCheckSequenceOption{FCSType: l2cap.FCSTypeNone},
+	})
+	if result != l2cap.ConfigurationResultSuccessful {
+		t.Fatalf("Expected: %d, Received: %d", l2cap.ConfigurationResultSuccessful, result)
+	}
+	var rfc *l2cap.RetransmissionAndFlowControlOption
+	for _, opt := range opts {
+		if o, ok := opt.(*l2cap.RetransmissionAndFlowControlOption); ok {
+			rfc = o
+		}
+	}
+	if rfc == nil || rfc.RetransmissionTimeout != 2000 || rfc.MonitorTimeout != 12000 {
+		t.Fatalf("Expected: timeouts 2000 and 12000, Received: %+v", rfc)
+	}
+
+	m.response(nil)
+	cfg := m.ertmConfig()
+	if cfg.txMTU != 672 || cfg.txMPS != 200 || cfg.txWindow != 10 || cfg.maxTransmit != 4 || !cfg.fcs {
+		t.Fatalf("Received: %+v", cfg)
+	}
+}
+
+func TestModeConfigSmallMPS(t *testing.T) {
+	local, err := ModeParams{Mode: l2cap.ModeEnhancedRetransmission, MTU: 512}.withDefaults()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if _, err = (ModeParams{Mode: l2cap.ModeStreaming, MPS: 2}).withDefaults(); err == nil {
+		t.Fatalf("Expected an error for an mps of 2")
+	}
+	m := modeConfig{local: local}
+
+	// An MPS too small to segment the SDUs is refused, suggesting the smallest one accepted.
+	rfc := &l2cap.RetransmissionAndFlowControlOption{Mode: l2cap.ModeEnhancedRetransmission, TxWindowSize: 4,
+		MaxTransmit: 5}
+	for _, mps := range []uint16{0, 1, 2, minModeMPS - 1} {
+		rfc.MaximumPDUSize = mps
+		opts, result := m.request([]l2cap.Option{&l2cap.MTUOption{MTU: 512}, rfc})
+		if result != l2cap.ConfigurationResultFailureUnacceptable {
+			t.Fatalf("Expected: %d, Received: %d", l2cap.ConfigurationResultFailureUnacceptable, result)
+		}
+		if o, ok := opts[0].(*l2cap.RetransmissionAndFlowControlOption); !ok || o.MaximumPDUSize != minModeMPS {
+			t.Fatalf("Expected: mps %d, Received: %+v", minModeMPS, opts[0])
+		}
+	}
+
+	// The SDUs are segmented into I-frames of the smallest MPS accepted.
+	rfc.MaximumPDUSize = minModeMPS
+	if _, result := m.request([]l2cap.Option{&l2cap.MTUOption{MTU: 512}, rfc}); result !=
+		l2cap.ConfigurationResultSuccessful {
+		t.Fatalf("Expected: %d, Received: %d", l2cap.ConfigurationResultSuccessful, result)
+	}
+	m.response(nil)
+	cfg := m.ertmConfig()
+	if cfg.txMPS != minModeMPS {
+		t.Fatalf("Expected: %d, Received: %d", minModeMPS, cfg.txMPS)
+	}
+	cfg.rxMPS, cfg.rxWindow = cfg.txMPS, cfg.txWindow
+	l := newERTMLink(cfg, func(*ertm, control) bool { return false })
+	defer l.close()
+	testTransfer(t, l, testSDUs(3, 500))
+}
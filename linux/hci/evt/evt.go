@@ -54,6 +54,65 @@ func (e LEAdvertisingReport) RSSI(i int) int8 {
 	return int8(e[2+int(e.NumReports())*9+l+i])
 }
 
+// LE Extended Advertising Reports are laid out one after the other, each a 24 byte header followed by its data,
+// rather than field by field as in LE Advertising Reports.
+const extAdvReportHeaderLen = 24
+
+func (e LEExtendedAdvertisingReport) SubeventCode() uint8 { return e[0] }
+func (e LEExtendedAdvertisingReport) NumReports() uint8   { return e[1] }
+
+// Valid reports whether the event is long enough to hold all its reports.
+func (e LEExtendedAdvertisingReport) Valid() bool {
+	if len(e) < 2 {
+		return false
+	}
+	b := e[2:]
+	for i := 0; i < int(e.NumReports()); i++ {
+		if len(b) < extAdvReportHeaderLen || len(b) < extAdvReportHeaderLen+int(b[23]) {
+			return false
+		}
+		b = b[extAdvReportHeaderLen+int(b[23]):]
+	}
+	return true
+}
+
+func (e LEExtendedAdvertisingReport) report(i int) []byte {
+	b := e[2:]
+	for j := 0; j < i; j++ {
+		b = b[extAdvReportHeaderLen+int(b[23]):]
+	}
+	return b
+}
+
+func (e LEExtendedAdvertisingReport) EventType(i int) uint16 {
+	return binary.LittleEndian.Uint16(e.report(i))
+}
+func (e LEExtendedAdvertisingReport) AddressType(i int) uint8 { return e.report(i)[2] }
+func (e LEExtendedAdvertisingReport) Address(i int) [6]byte {
+	b := [6]byte{}
+	copy(b[:], e.report(i)[3:])
+	return b
+}
+func (e LEExtendedAdvertisingReport) PrimaryPHY(i int) uint8     { return e.report(i)[9] }
+func (e LEExtendedAdvertisingReport) SecondaryPHY(i int) uint8   { return e.report(i)[10] }
+func (e LEExtendedAdvertisingReport) AdvertisingSID(i int) uint8 { return e.report(i)[11] }
+func (e LEExtendedAdvertisingReport) TXPower(i int) int8         { return int8(e.report(i)[12]) }
+func (e LEExtendedAdvertisingReport) RSSI(i int) int8            { return int8(e.report(i)[13]) }
+func (e LEExtendedAdvertisingReport) PeriodicAdvertisingInterval(i int) uint16 {
+	return binary.LittleEndian.Uint16(e.report(i)[14:])
+}
+func (e LEExtendedAdvertisingReport) DirectAddressType(i int) uint8 { return e.report(i)[16] }
+func (e LEExtendedAdvertisingReport) DirectAddress(i int) [6]byte {
+	b := [6]byte{}
+	copy(b[:], e.report(i)[17:])
+	return b
+}
+func (e LEExtendedAdvertisingReport) DataLength(i int) uint8 { return e.report(i)[23] }
+func (e LEExtendedAdvertisingReport) Data(i int) []byte {
+	b := e.report(i)
+	return b[extAdvReportHeaderLen : extAdvReportHeaderLen+int(b[23])]
+}
+
 func (e InquiryResult) NumResponses() uint8 { return e[0] }
 func (e InquiryResult) BDADDR(i int) [6]byte {
 	b := [6]byte{}
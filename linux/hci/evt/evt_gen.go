@@ -898,3 +898,29 @@ type AuthenticatedPayloadTimeoutExpired []byte
 func (r AuthenticatedPayloadTimeoutExpired) ConnectionHandle() uint16 {
 	return binary.LittleEndian.Uint16(r[0:])
 }
+
+const LEExtendedAdvertisingReportCode = 0x3E
+
+const LEExtendedAdvertisingReportSubCode = 0x0D
+
+// LEExtendedAdvertisingReport implements LE Extended Advertising Report (0x3E:0x0D) [Vol 2, Part E, 7.7.65.13].
+type LEExtendedAdvertisingReport []byte
+
+const LEAdvertisingSetTerminatedCode = 0x3E
+
+const LEAdvertisingSetTerminatedSubCode = 0x12
+
+// LEAdvertisingSetTerminated implements LE Advertising Set Terminated (0x3E:0x12) [Vol 2, Part E, 7.7.65.18].
+type LEAdvertisingSetTerminated []byte
+
+func (r LEAdvertisingSetTerminated) SubeventCode() uint8 { return r[0] }
+
+func (r LEAdvertisingSetTerminated) Status() uint8 { return r[1] }
+
+func (r LEAdvertisingSetTerminated) AdvertisingHandle() uint8 { return r[2] }
+
+func (r LEAdvertisingSetTerminated) ConnectionHandle() uint16 {
+	return binary.LittleEndian.Uint16(r[3:])
+}
+
+func (r LEAdvertisingSetTerminated) NumCompletedExtendedAdvertisingEvents() uint8 { return r[5] }
@@ -0,0 +1,28 @@
+package hci
+
+// fcsTable is the table of the CRC-16 generator polynomial x^16 + x^15 + x^2 + 1 of the Frame Check Sequence, bit
+// reversed as the bits are sent least significant first [Vol 3, Part A, 3.3.5].
+var fcsTable = func() (t [256]uint16) {
+	for i := range t {
+		crc := uint16(i)
+		for j := 0; j < 8; j++ {
+			if crc&0x0001 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// fcs16 returns the Frame Check Sequence of the I-frames and S-frames of the Enhanced Retransmission and Streaming
+// modes, computed over the basic L2CAP header, the control field and the payload.
+func fcs16(b []byte) uint16 {
+	var crc uint16
+	for _, v := range b {
+		crc = crc>>8 ^ fcsTable[byte(crc)^v]
+	}
+	return crc
+}
@@ -0,0 +1,77 @@
+package hci
+
+// LEFeatures is a bit mask of the link layer features supported by a controller [Vol 6, Part B, 4.6].
+type LEFeatures uint64
+
+// LE link layer features.
+const (
+	LEFeatureEncryption                    LEFeatures = 1 << 0  // LE Encryption
+	LEFeatureConnParamsRequest             LEFeatures = 1 << 1  // Connection Parameters Request Procedure
+	LEFeatureExtendedReject                LEFeatures = 1 << 2  // Extended Reject Indication
+	LEFeatureSlaveFeatureExchange          LEFeatures = 1 << 3  // Slave-initiated Features Exchange
+	LEFeaturePing                          LEFeatures = 1 << 4  // LE Ping
+	LEFeatureDataPacketLengthExtension     LEFeatures = 1 << 5  // LE Data Packet Length Extension
+	LEFeaturePrivacy                       LEFeatures = 1 << 6  // LL Privacy
+	LEFeatureExtendedScannerFilterPolicies LEFeatures = 1 << 7  // Extended Scanner Filter Policies
+	LEFeature2MPHY                         LEFeatures = 1 << 8  // LE 2M PHY
+	LEFeatureStableModulationIndexTx       LEFeatures = 1 << 9  // Stable Modulation Index - Transmitter
+	LEFeatureStableModulationIndexRx       LEFeatures = 1 << 10 // Stable Modulation Index - Receiver
+	LEFeatureCodedPHY                      LEFeatures = 1 << 11 // LE Coded PHY
+	LEFeatureExtendedAdvertising           LEFeatures = 1 << 12 // LE Extended Advertising
+	LEFeaturePeriodicAdvertising           LEFeatures = 1 << 13 // LE Periodic Advertising
+	LEFeatureChannelSelectionAlgorithm2    LEFeatures = 1 << 14 // Channel Selection Algorithm #2
+	LEFeaturePowerClass1                   LEFeatures = 1 << 15 // LE Power Class 1
+	LEFeatureMinimumUsedChannels           LEFeatures = 1 << 16 // Minimum Number of Used Channels Procedure
+)
+
+// Has reports whether all the features of f are set.
+func (f LEFeatures) Has(features LEFeatures) bool {
+	return f&features == features
+}
+
+// PHYs is a bit mask of LE physical layers, as used by the scanning and PHY update commands.
+type PHYs uint8
+
+// LE physical layers.
+const (
+	PHY1M    PHYs = 1 << 0 // LE 1M
+	PHY2M    PHYs = 1 << 1 // LE 2M
+	PHYCoded PHYs = 1 << 2 // LE Coded
+)
+
+// LEFeatures returns the link layer features supported by the controller.
+func (h *HCI) LEFeatures() LEFeatures {
+	return h.leFeatures
+}
+
+// LMPFeature is a link manager feature of a BR/EDR device, the page of the features mask in the high byte and the bit
+// in the low byte [Vol 2, Part C, 3.3].
+type LMPFeature uint16
+
+// BR/EDR link manager features.
+const (
+	LMPFeature3SlotPackets        LMPFeature = 0<<8 | 0  // 3 slot packets
+	LMPFeature5SlotPackets        LMPFeature = 0<<8 | 1  // 5 slot packets
+	LMPFeatureEncryption          LMPFeature = 0<<8 | 2  // Encryption
+	LMPFeatureRoleSwitch          LMPFeature = 0<<8 | 5  // Role switch
+	LMPFeatureSniffMode           LMPFeature = 0<<8 | 7  // Sniff mode
+	LMPFeatureEDRACL2M            LMPFeature = 0<<8 | 25 // Enhanced Data Rate ACL 2 Mb/s mode
+	LMPFeatureEDRACL3M            LMPFeature = 0<<8 | 26 // Enhanced Data Rate ACL 3 Mb/s mode
+	LMPFeatureLE                  LMPFeature = 0<<8 | 38 // LE Supported (Controller)
+	LMPFeatureSecureSimplePairing LMPFeature = 0<<8 | 51 // Secure Simple Pairing (Controller Support)
+	LMPFeatureExtendedFeatures    LMPFeature = 0<<8 | 63 // Extended features
+	LMPFeatureSSPHost             LMPFeature = 1<<8 | 0  // Secure Simple Pairing (Host Support)
+	LMPFeatureLEHost              LMPFeature = 1<<8 | 1  // LE Supported (Host)
+	LMPFeatureSecureConnHost      LMPFeature = 1<<8 | 3  // Secure Connections (Host Support)
+	LMPFeatureSecureConn          LMPFeature = 2<<8 | 8  // Secure Connections (Controller Support)
+	LMPFeaturePing                LMPFeature = 2<<8 | 9  // Ping
+)
+
+// LMPFeatures holds the pages of the link manager features mask of a BR/EDR device.
+type LMPFeatures []uint64
+
+// Has reports whether the feature is set.
+func (f LMPFeatures) Has(feature LMPFeature) bool {
+	page, bit := int(feature>>8), feature&0xFF
+	return page < len(f) && f[page]&(1<<bit) != 0
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/thomascriley/ble"
 	"github.com/thomascriley/ble/linux/adv"
 	"github.com/thomascriley/ble/linux/gatt"
+	"github.com/thomascriley/ble/linux/hci/cmd"
 )
 
 // Addr ...
@@ -27,19 +28,87 @@ func (h *HCI) Scan(ctx context.Context, allowDup bool) error {
 	if allowDup {
 		h.params.scanEnable.FilterDuplicates = 0
 	}
+	if h.extendedAdvertising.Load() {
+		return h.ScanExtended(ctx, ExtendedScanParameters(h.ScanParams(), PHY1M), allowDup)
+	}
 	h.params.scanEnable.LEScanEnable = 1
 	h.stoppedScanning = false
+	h.extendedScanning = false
 	return h.Send(ctx, &h.params.scanEnable, nil)
 }
 
+// ScanParams returns the default scanning parameters.
+func (h *HCI) ScanParams() cmd.LESetScanParameters {
+	h.params.RLock()
+	defer h.params.RUnlock()
+	return h.params.scanParams
+}
+
+// ScanWithParams sets the scanning parameters and starts scanning. The parameters can only be changed while the
+// controller is not scanning.
+func (h *HCI) ScanWithParams(ctx context.Context, p cmd.LESetScanParameters, allowDup bool) error {
+	if h.extendedAdvertising.Load() {
+		return h.ScanExtended(ctx, ExtendedScanParameters(p, PHY1M), allowDup)
+	}
+	if err := h.Send(ctx, &p, nil); err != nil {
+		return fmt.Errorf("unable to set scan parameters: %w", err)
+	}
+	return h.Scan(ctx, allowDup)
+}
+
+// ScanExtended sets the extended scanning parameters and starts scanning on the PHYs they select. It requires a
+// controller supporting LE Extended Advertising.
+func (h *HCI) ScanExtended(ctx context.Context, p cmd.LESetExtendedScanParameters, allowDup bool) error {
+	if !h.leFeatures.Has(LEFeatureExtendedAdvertising) {
+		return fmt.Errorf("extended scanning: %w", ErrUnsupportedFeature)
+	}
+	if PHYs(p.ScanningPHYs)&PHYCoded != 0 && !h.leFeatures.Has(LEFeatureCodedPHY) {
+		return fmt.Errorf("scanning on LE Coded PHY: %w", ErrUnsupportedFeature)
+	}
+	if err := h.Send(ctx, &p, nil); err != nil {
+		return fmt.Errorf("unable to set extended scan parameters: %w", err)
+	}
+	enable := cmd.LESetExtendedScanEnable{Enable: 1, FilterDuplicates: 1}
+	if allowDup {
+		enable.FilterDuplicates = 0
+	}
+	h.stoppedScanning = false
+	h.extendedScanning = true
+	return h.Send(ctx, &enable, nil)
+}
+
+// ExtendedScanParameters returns the extended scanning parameters equivalent to the legacy ones, for each selected
+// PHY.
+func ExtendedScanParameters(p cmd.LESetScanParameters, phys PHYs) cmd.LESetExtendedScanParameters {
+	x := cmd.LESetExtendedScanParameters{
+		OwnAddressType:       p.OwnAddressType,
+		ScanningFilterPolicy: p.ScanningFilterPolicy,
+		ScanningPHYs:         uint8(phys),
+	}
+	for _, phy := range []PHYs{PHY1M, PHYCoded} {
+		if phys&phy != 0 {
+			x.ScanType = append(x.ScanType, p.LEScanType)
+			x.ScanInterval = append(x.ScanInterval, p.LEScanInterval)
+			x.ScanWindow = append(x.ScanWindow, p.LEScanWindow)
+		}
+	}
+	return x
+}
+
 // StopScanning stops scanning.
 func (h *HCI) StopScanning(ctx context.Context) (err error) {
-	h.params.scanEnable.LEScanEnable = 0
-	if err = h.Send(ctx, &h.params.scanEnable, nil); err != nil {
+	if h.extendedScanning {
+		err = h.Send(ctx, &cmd.LESetExtendedScanEnable{Enable: 0}, nil)
+	} else {
+		h.params.scanEnable.LEScanEnable = 0
+		err = h.Send(ctx, &h.params.scanEnable, nil)
+	}
+	if err != nil {
 		return err
 	}
 	h.stoppedScanning = true
 	h.adHist.Purge()
+	h.extAdvFrags.Purge()
 	return nil
 }
 
@@ -127,6 +196,14 @@ func (h *HCI) AdvertiseNameAndServices(ctx context.Context, name string, uuids .
 	return h.Advertise(ctx)
 }
 
+// AdvertisePayload advertises the packets assembled by an adv.Builder.
+func (h *HCI) AdvertisePayload(ctx context.Context, p *adv.Payload) error {
+	if err := h.SetAdvertisement(ctx, p.AD.Bytes(), p.ScanResponse.Bytes()); err != nil {
+		return fmt.Errorf("unable to set advertisement: %w", err)
+	}
+	return h.Advertise(ctx)
+}
+
 // AdvertiseMfgData avertises the given manufacturer data.
 func (h *HCI) AdvertiseMfgData(ctx context.Context, id uint16, md []byte) error {
 	ad, err := adv.NewPacket(adv.ManufacturerData(id, md))
@@ -177,7 +254,17 @@ func (h *HCI) AdvertiseIBeacon(ctx context.Context, u ble.UUID, major, minor uin
 
 // StopAdvertising stops advertising.
 func (h *HCI) StopAdvertising(ctx context.Context) error {
+	h.params.Lock()
 	h.params.advEnable.AdvertisingEnable = 0
+	h.params.advWanted = false
+	h.params.Unlock()
+	if h.extendedAdvertising.Load() {
+		if h.legacyAdvProps == 0 {
+			// the advertising set standing in for the legacy commands has not been created yet
+			return nil
+		}
+		return h.EnableAdvertisingSets(ctx, false, legacyAdvHandle)
+	}
 	return h.Send(ctx, &h.params.advEnable, nil)
 }
 
@@ -205,7 +292,11 @@ func (h *HCI) Dial(ctx context.Context, a ble.Addr, addressType ble.AddressType)
 	} else {
 		h.params.connParams.PeerAddressType = 0
 	}
-	err = h.Send(ctx, &h.params.connParams, nil)
+	if h.extendedAdvertising.Load() {
+		err = h.Send(ctx, extendedConnParams(h.params.connParams), nil)
+	} else {
+		err = h.Send(ctx, &h.params.connParams, nil)
+	}
 	h.params.Unlock()
 
 	if err != nil {
@@ -237,6 +328,26 @@ func (h *HCI) Dial(ctx context.Context, a ble.Addr, addressType ble.AddressType)
 	}
 }
 
+// extendedConnParams returns the extended connection parameters equivalent to the legacy ones, initiating on the LE 1M
+// PHY.
+func extendedConnParams(p cmd.LECreateConnection) *cmd.LEExtendedCreateConnection {
+	return &cmd.LEExtendedCreateConnection{
+		InitiatorFilterPolicy: p.InitiatorFilterPolicy,
+		OwnAddressType:        p.OwnAddressType,
+		PeerAddressType:       p.PeerAddressType,
+		PeerAddress:           p.PeerAddress,
+		InitiatingPHYs:        uint8(PHY1M),
+		ScanInterval:          []uint16{p.LEScanInterval},
+		ScanWindow:            []uint16{p.LEScanWindow},
+		ConnIntervalMin:       []uint16{p.ConnIntervalMin},
+		ConnIntervalMax:       []uint16{p.ConnIntervalMax},
+		ConnLatency:           []uint16{p.ConnLatency},
+		SupervisionTimeout:    []uint16{p.SupervisionTimeout},
+		MinimumCELength:       []uint16{p.MinimumCELength},
+		MaximumCELength:       []uint16{p.MaximumCELength},
+	}
+}
+
 // cancelDial cancels the Dialing
 func (h *HCI) cancelDial(ctx context.Context) (ble.ClientBLE, error) {
 	err := h.Send(ctx, &h.params.connCancel, nil)
@@ -265,8 +376,75 @@ func (h *HCI) cancelDial(ctx context.Context) (ble.ClientBLE, error) {
 
 // Advertise starts advertising.
 func (h *HCI) Advertise(ctx context.Context) error {
+	if h.extendedAdvertising.Load() {
+		return h.advertiseSet(ctx, h.AdvParams())
+	}
+	h.params.Lock()
 	h.params.advEnable.AdvertisingEnable = 1
-	return h.Send(ctx, &h.params.advEnable, nil)
+	h.params.advWanted = true
+	h.params.Unlock()
+	if err := h.Send(ctx, &h.params.advEnable, nil); err != nil {
+		// The controller refuses while it has no room for another connection, it is enabled again on disconnection.
+		h.params.Lock()
+		h.params.advEnable.AdvertisingEnable = 0
+		h.params.Unlock()
+		return err
+	}
+	return nil
+}
+
+// AdvertisingStopped returns a channel receiving the reason each time the controller stops advertising on its own:
+// nil once a central connected, or ErrDirAdvTimeout once high duty cycle directed advertising ended without a
+// connection. Further reasons are dropped while one is waiting to be received.
+func (h *HCI) AdvertisingStopped() <-chan error {
+	return h.chAdvStopped
+}
+
+// AdvParams returns the default advertising parameters.
+func (h *HCI) AdvParams() cmd.LESetAdvertisingParameters {
+	h.params.RLock()
+	defer h.params.RUnlock()
+	return h.params.advParams
+}
+
+// AdvertiseWithParams sets the advertising parameters and starts advertising. The parameters can only be changed
+// while the controller is not advertising.
+func (h *HCI) AdvertiseWithParams(ctx context.Context, p cmd.LESetAdvertisingParameters) error {
+	if h.extendedAdvertising.Load() {
+		return h.advertiseSet(ctx, p)
+	}
+	if err := h.Send(ctx, &p, nil); err != nil {
+		return fmt.Errorf("unable to set advertising parameters: %w", err)
+	}
+	return h.Advertise(ctx)
+}
+
+// advertiseSet advertises the data set with SetAdvertisement using the advertising set standing in for the legacy
+// advertising commands.
+func (h *HCI) advertiseSet(ctx context.Context, p cmd.LESetAdvertisingParameters) error {
+	if h.params.advEnable.AdvertisingEnable == 1 {
+		// The parameters of an enabled set can not be changed.
+		if err := h.EnableAdvertisingSets(ctx, false, legacyAdvHandle); err != nil {
+			return err
+		}
+		h.params.advEnable.AdvertisingEnable = 0
+	}
+	ad := h.params.advData.AdvertisingData[:h.params.advData.AdvertisingDataLength]
+	sr := h.params.scanResp.ScanResponseData[:h.params.scanResp.ScanResponseDataLength]
+	if err := h.SetAdvertisingSet(ctx, legacyAdvHandle, p, ad, sr); err != nil {
+		return err
+	}
+	h.legacyAdvProps = extendedAdvParams(legacyAdvHandle, p).AdvertisingEventProperties
+	h.params.Lock()
+	h.params.advWanted = true
+	h.params.Unlock()
+	if err := h.EnableAdvertisingSets(ctx, true, legacyAdvHandle); err != nil {
+		return err
+	}
+	h.params.Lock()
+	h.params.advEnable.AdvertisingEnable = 1
+	h.params.Unlock()
+	return nil
 }
 
 // SetAdvertisement sets advertising data and scanResp.
@@ -277,12 +455,22 @@ func (h *HCI) SetAdvertisement(ctx context.Context, ad []byte, sr []byte) error
 
 	h.params.advData.AdvertisingDataLength = uint8(len(ad))
 	copy(h.params.advData.AdvertisingData[:], ad)
+	h.params.scanResp.ScanResponseDataLength = uint8(len(sr))
+	copy(h.params.scanResp.ScanResponseData[:], sr)
+
+	if h.extendedAdvertising.Load() {
+		// The data is sent along with the parameters when advertising starts, or replaced right away if it already
+		// has.
+		if h.params.advEnable.AdvertisingEnable == 0 {
+			return nil
+		}
+		return h.setAdvertisingSetData(ctx, legacyAdvHandle, h.legacyAdvProps, ad, sr)
+	}
+
 	if err := h.Send(ctx, &h.params.advData, nil); err != nil {
 		return err
 	}
 
-	h.params.scanResp.ScanResponseDataLength = uint8(len(sr))
-	copy(h.params.scanResp.ScanResponseData[:], sr)
 	if err := h.Send(ctx, &h.params.scanResp, nil); err != nil {
 		return err
 	}
@@ -312,3 +500,12 @@ func (h *HCI) cancelConnection(ctx context.Context, connErr error) (ble.Client,
 	}
 	return nil, fmt.Errorf("cancel connection failed: %w", err)
 }
+
+// BDAddr converts the address to the little-endian byte order used by HCI commands.
+func BDAddr(a ble.Addr) ([6]byte, error) {
+	b, err := net.ParseMAC(a.String())
+	if err != nil || len(b) != 6 {
+		return [6]byte{}, ErrInvalidAddr
+	}
+	return [6]byte{b[5], b[4], b[3], b[2], b[1], b[0]}, nil
+}
@@ -8,12 +8,14 @@ import (
 	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/thomascriley/ble"
 	"github.com/thomascriley/ble/linux/hci/cmd"
 	"github.com/thomascriley/ble/linux/hci/evt"
 	"github.com/thomascriley/ble/linux/hci/socket"
+	"github.com/thomascriley/ble/linux/rfcomm"
 	"github.com/thomascriley/ble/linux/smp"
 	"github.com/thomascriley/ble/log"
 
@@ -59,15 +61,23 @@ func NewHCI(log *slog.Logger) *HCI {
 		subh:     map[int]handlerFn{},
 		subMutex: &sync.RWMutex{},
 
-		adHist: expirable.NewLRU[string, *Advertisement](1000, nil, 5*time.Minute),
+		adHist:      expirable.NewLRU[string, *Advertisement](1000, nil, 5*time.Minute),
+		extAdvFrags: expirable.NewLRU[string, []byte](extAdvFragsSize, nil, extAdvFragsTTL),
 
-		dynamicCID: cidDynamicStart,
+		modeParams: ModeParams{
+			MTU:         DefaultModeMTU,
+			MPS:         DefaultModeMTU,
+			TxWindow:    DefaultModeTxWindow,
+			MaxTransmit: DefaultModeMaxTransmit,
+		},
 
 		muConns:           &sync.Mutex{},
 		conns:             make(map[uint16]*Conn),
+		acceptedBREDR:     make(map[[6]byte]struct{}),
 		chMasterConn:      make(chan *Conn),
 		chMasterBREDRConn: make(chan *Conn),
 		chSlaveConn:       make(chan *Conn),
+		chAdvStopped:      make(chan error, 1),
 
 		log: log.With("device", "hci"),
 
@@ -105,8 +115,9 @@ type HCI struct {
 	bufCnt  int
 
 	// Device information or status.
-	addr    net.HardwareAddr
-	txPwrLv int
+	addr       net.HardwareAddr
+	txPwrLv    int
+	leFeatures LEFeatures
 
 	// adHist tracks the history of past advertising packets.
 	// Controller delivers AD(Advertising Data) and SR(Scan Response) separately
@@ -118,14 +129,29 @@ type HCI struct {
 	advHandler ble.AdvHandler
 	adHist     *expirable.LRU[string, *Advertisement]
 
+	// extAdvFrags holds the data of extended advertisements whose remaining fragments are still to be received. The
+	// fragments never completed expire, or are evicted by those of other advertisers.
+	extAdvFrags *expirable.LRU[string, []byte]
+
+	// extendedScanning is set while scanning with the extended scanning commands.
+	extendedScanning bool
+
+	// extendedAdvertising is set once the extended advertising commands have been used, and stays set: the controller
+	// keeps rejecting the legacy commands until it is reset, even once the advertising sets are removed.
+	extendedAdvertising atomic.Bool
+
+	// legacyAdvProps holds the event properties of the advertising set standing in for the legacy advertising
+	// commands.
+	legacyAdvProps uint16
+
 	// Inquiry scan handler
 	inqHandler ble.InqHandler
 
 	// Outstanding Remote Name Requests
 	nameHandlers *nameHandlers
 
-	// dynamicCID pointer to next available channel for LMP connections for BR/EDR
-	dynamicCID uint16
+	// modeParams are the parameters the BR/EDR channels are configured with.
+	modeParams ModeParams
 
 	// Host to Controller Data Flow Control Packet-based Data flow control for LE-U [Vol 2, Part E, 4.1.1]
 	// Minimum 27 bytes. 4 bytes of L2CAP Header, and 23 bytes Payload from upper layer (ATT)
@@ -137,9 +163,33 @@ type HCI struct {
 	chMasterConn      chan *Conn // Dial returns master BLE connections.
 	chMasterBREDRConn chan *Conn // DialBREDR returns master BREDR connections.
 	chSlaveConn       chan *Conn // Peripheral accept slave connections.
-
-	connectedHandler    func(evt.LEConnectionComplete)
-	disconnectedHandler func(ble.Conn)
+	chAdvStopped      chan error // Reasons the controller stopped advertising on its own.
+
+	connectedHandler        func(evt.LEConnectionComplete)
+	disconnectedHandler     func(ble.Conn)
+	advSetTerminatedHandler func(evt.LEAdvertisingSetTerminated)
+	connEventHandler        func(ConnEvent)
+	bredrAcceptHandler      func(BREDRConnRequest) bool
+
+	// acceptedBREDR are the addresses of the remote devices whose BR/EDR connection requests were accepted, until
+	// the connections complete.
+	acceptedBREDR map[[6]byte]struct{}
+
+	// LE credit based channel listeners by LE_PSM
+	muCoC        sync.Mutex
+	cocListeners map[uint16]*L2CAPListener
+
+	// BR/EDR channel listeners by PSM
+	muBREDR        sync.Mutex
+	bredrListeners map[uint16]*BREDRListener
+
+	// RFCOMM server, and the sessions to the remote devices by address, which the DLCs to a device share, and those
+	// being opened
+	muRFCOMM       sync.Mutex
+	rfcommServer   *rfcomm.Server
+	rfcommListener *BREDRListener
+	rfcommSessions map[string]*rfcomm.Session
+	rfcommDials    map[string]*rfcommDial
 
 	// SMP capabilities
 	smpCapabilites smp.Capabilities
@@ -168,14 +218,13 @@ func (h *HCI) Init(ctx context.Context) (err error) {
 	h.evth[evt.CommandStatusCode] = h.handleCommandStatus
 	h.evth[evt.DisconnectionCompleteCode] = h.handleDisconnectionComplete
 	h.evth[evt.NumberOfCompletedPacketsCode] = h.handleNumberOfCompletedPackets
+	h.evth[evt.ReadRemoteVersionInformationCompleteCode] = h.handleReadRemoteVersionInformationComplete
+	h.evth[evt.EncryptionChangeCode] = h.handleEncryptionChange
+	h.evth[evt.EncryptionKeyRefreshCompleteCode] = h.handleEncryptionKeyRefreshComplete
 
-	// evt.EncryptionChangeCode:                     todo),
-	// evt.ReadRemoteVersionInformationCompleteCode: todo),
 	// evt.HardwareErrorCode:                        todo),
 	// evt.DataBufferOverflowCode:                   todo),
-	// evt.EncryptionKeyRefreshCompleteCode:         todo),
 	// evt.AuthenticatedPayloadTimeoutExpiredCode:   todo),
-	// evt.LEReadRemoteUsedFeaturesCompleteSubCode:   todo),
 	// evt.LERemoteConnectionParameterRequestSubCode: todo),
 
 	// BD/EDR
@@ -183,9 +232,11 @@ func (h *HCI) Init(ctx context.Context) (err error) {
 	h.evth[evt.InquiryResultCode] = h.handleInquiryResult
 	h.evth[evt.InquiryResultwithRSSICode] = h.handleInquiryWithRSSI
 	h.evth[evt.ExtendedInquiryCode] = h.handleExtendedInquiry
+	h.evth[evt.ConnectionRequestCode] = h.handleConnectionRequest
 	h.evth[evt.ConnectionCompleteCode] = h.handleConnectionComplete
 	h.evth[evt.PageScanRepetitionModeChangeCode] = h.handlePageScanRepetitionModeChange
 	h.evth[evt.ReadRemoteSupportedFeaturesCompleteCode] = h.handleReadRemoteSupportedFeaturesComplete
+	h.evth[evt.ReadRemoteExtendedFeaturesCompleteCode] = h.handleReadRemoteExtendedFeaturesComplete
 	h.evth[evt.MaxSlotsChangeCode] = h.handleMaxSlotsChange
 
 	h.evtMutex.Unlock()
@@ -193,8 +244,11 @@ func (h *HCI) Init(ctx context.Context) (err error) {
 	h.subMutex.Lock()
 
 	h.subh[evt.LEAdvertisingReportSubCode] = h.handleLEAdvertisingReport
+	h.subh[evt.LEExtendedAdvertisingReportSubCode] = h.handleLEExtendedAdvertisingReport
 	h.subh[evt.LEConnectionCompleteSubCode] = h.handleLEConnectionComplete
+	h.subh[evt.LEReadRemoteUsedFeaturesCompleteSubCode] = h.handleLEReadRemoteUsedFeaturesComplete
 	h.subh[evt.LEConnectionUpdateCompleteSubCode] = h.handleLEConnectionUpdateComplete
+	h.subh[evt.LEAdvertisingSetTerminatedSubCode] = h.handleLEAdvertisingSetTerminated
 	h.subh[evt.LELongTermKeyRequestSubCode] = h.handleLELongTermKeyRequest
 
 	h.subMutex.Unlock()
@@ -327,9 +381,21 @@ func (h *HCI) init(ctx context.Context) error {
 
 	h.txPwrLv = int(LEReadAdvertisingChannelTxPowerRP.TransmitPowerLevel)
 
+	h.log.Debug("le read local supported features")
+	LEReadLocalSupportedFeaturesRP := cmd.LEReadLocalSupportedFeaturesRP{}
+	if err := h.Send(ctx, &cmd.LEReadLocalSupportedFeatures{}, &LEReadLocalSupportedFeaturesRP); err != nil {
+		return fmt.Errorf("unable to read le local supported features: %w", err)
+	}
+	h.leFeatures = LEFeatures(LEReadLocalSupportedFeaturesRP.LEFeatures)
+
 	h.log.Debug("le set event mask")
+	leEventMask := uint64(0x000000000000001F)
+	if h.leFeatures.Has(LEFeatureExtendedAdvertising) {
+		leEventMask |= 1 << (evt.LEExtendedAdvertisingReportSubCode - 1)
+		leEventMask |= 1 << (evt.LEAdvertisingSetTerminatedSubCode - 1)
+	}
 	LESetEventMaskRP := cmd.LESetEventMaskRP{}
-	if err := h.Send(ctx, &cmd.LESetEventMask{LEEventMask: 0x000000000000001F}, &LESetEventMaskRP); err != nil {
+	if err := h.Send(ctx, &cmd.LESetEventMask{LEEventMask: leEventMask}, &LESetEventMaskRP); err != nil {
 		return fmt.Errorf("unable to set le event mask: %w", err)
 	}
 
@@ -570,33 +636,86 @@ func (h *HCI) handleLEAdvertisingReport(b []byte) error {
 		return nil
 	}
 
-	var a *Advertisement
-
 	e := evt.LEAdvertisingReport(b)
 	for i := 0; i < int(e.NumReports()); i++ {
-		switch e.EventType(i) {
-		case evtTypAdvScanInd, evtTypAdvInd:
-			a = newAdvertisement(e, i)
-			h.adHist.Add(a.AddressString(), a)
-		case evtTypScanRsp:
-			var ok bool
-			sr := newAdvertisement(e, i)
-			addr := sr.AddressString()
-			// Got a SR without having received an associated AD before?
-			if a, ok = h.adHist.Get(addr); !ok {
-				return fmt.Errorf("received scan response %s with no associated Advertising Data packet. Advertising packet was most likely removed due to noise or delay", addr)
-			}
-			a.setScanResponse(sr)
-			h.adHist.Add(addr, a)
-		default:
-			a = newAdvertisement(e, i)
+		if err := h.dispatchAdvertisement(newAdvertisement(e, i)); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		//fmt.Printf("LE ADV: " + a.AddressString() + " : " + a.LocalName() + "\n")
+const (
+	// maxExtAdvDataLength is the longest advertising data an extended advertising train carries [Vol 6, Part B,
+	// 2.3.4.9]. The longer reassembled data is dropped.
+	maxExtAdvDataLength = 1650
 
-		h.advHandler(a)
+	// extAdvFragsSize and extAdvFragsTTL bound the extended advertising data awaiting its remaining fragments.
+	extAdvFragsSize = 64
+	extAdvFragsTTL  = 10 * time.Second
+)
+
+func (h *HCI) handleLEExtendedAdvertisingReport(b []byte) error {
+	if h.advHandler == nil || h.stoppedScanning {
+		return nil
 	}
 
+	e := evt.LEExtendedAdvertisingReport(b)
+	if !e.Valid() {
+		return fmt.Errorf("malformed extended advertising report: %w", ErrInvalidPacket)
+	}
+	for i := 0; i < int(e.NumReports()); i++ {
+		// Extended advertising data may be split over several reports, reassemble it before dispatching.
+		addr := e.Address(i)
+		key := fmt.Sprintf("%X/%d/%d", addr, e.AddressType(i), e.AdvertisingSID(i))
+		more := e.EventType(i)&extEvtTypDataStatus == extDataStatusMore
+		prev, ok := h.extAdvFrags.Get(key)
+		data := append(append(make([]byte, 0, len(prev)+len(e.Data(i))), prev...), e.Data(i)...)
+		if ok && prev == nil || len(data) > maxExtAdvDataLength {
+			// The data is too long, its remaining fragments are dropped as well, tracked with no data.
+			if !ok || prev != nil {
+				h.log.Debug("extended advertising data too long", slog.String("address", key))
+			}
+			if more {
+				h.extAdvFrags.Add(key, nil)
+			} else {
+				h.extAdvFrags.Remove(key)
+			}
+			continue
+		}
+		if more {
+			h.extAdvFrags.Add(key, data)
+			continue
+		}
+		h.extAdvFrags.Remove(key)
+		if e.EventType(i)&extEvtTypDataStatus != extDataStatusComplete {
+			h.log.Debug("extended advertising data truncated", slog.String("address", key))
+		}
+		if err := h.dispatchAdvertisement(newExtendedAdvertisement(e, i, data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchAdvertisement passes the advertisement to the handler, combining scan responses with the advertising data
+// they belong to.
+func (h *HCI) dispatchAdvertisement(a *Advertisement) error {
+	switch a.EventType() {
+	case evtTypAdvScanInd, evtTypAdvInd:
+		h.adHist.Add(a.AddressString(), a)
+	case evtTypScanRsp:
+		sr := a
+		addr := sr.AddressString()
+		// Got a SR without having received an associated AD before?
+		var ok bool
+		if a, ok = h.adHist.Get(addr); !ok {
+			return fmt.Errorf("received scan response %s with no associated Advertising Data packet. Advertising packet was most likely removed due to noise or delay", addr)
+		}
+		a.setScanResponse(sr)
+		h.adHist.Add(addr, a)
+	}
+	h.advHandler(a)
 	return nil
 }
 
@@ -642,7 +761,7 @@ func (h *HCI) handleCommandStatus(b []byte) error {
 }
 
 func (h *HCI) handleDisconnect(c *Conn) {
-	h.log.Debug("Removing connection: %d", c.param.ConnectionHandle())
+	h.log.Debug("Removing connection", log.Uint16("handle", c.param.ConnectionHandle()))
 	h.muConns.Lock()
 	delete(h.conns, c.param.ConnectionHandle())
 	h.muConns.Unlock()
@@ -655,54 +774,41 @@ func (h *HCI) handleLEConnectionComplete(b []byte) error {
 	e := evt.LEConnectionComplete(b)
 	handle := e.ConnectionHandle()
 
+	if e.Status() != 0x00 {
+		// The connection was canceled successfully (ErrConnID), or directed advertising ended without a connection.
+		if ErrCommand(e.Status()) == ErrDirAdvTimeout && !h.extendedAdvertising.Load() {
+			h.advertisingStopped(ErrDirAdvTimeout)
+		}
+		return nil
+	}
+
 	c := newConn(h, e, h.handleDisconnect, h.log.With(slog.Uint64("handle", uint64(handle)), slog.String("addr", fmt.Sprintf("%04X", e.PeerAddress()))))
 
 	h.log.Debug("Adding connection", slog.Uint64("handle", uint64(handle)))
 	h.muConns.Lock()
 	h.conns[e.ConnectionHandle()] = c
 	h.muConns.Unlock()
+	h.emitConnEvent(newConnEvent(ConnEventConnected, c))
 	if e.Role() == roleMaster {
-		if e.Status() == 0x00 {
-			select {
-			case h.chMasterConn <- c:
-				// sent connection back to dialer
-				return nil
-			case <-h.Closed():
-				// socket closed before connection made
-				return fmt.Errorf("hci device closed: %w", h.err)
-			}
-		}
-		if e.Status() == uint8(ErrConnID) {
-			// The connection was canceled successfully.
-			return nil
-		}
-		return nil
-	}
-	if e.Status() == 0x00 {
 		select {
-		case h.chSlaveConn <- c:
+		case h.chMasterConn <- c:
+			// sent connection back to dialer
+			return nil
 		case <-h.Closed():
+			// socket closed before connection made
 			return fmt.Errorf("hci device closed: %w", h.err)
 		}
-		// When a controller accepts a connection, it moves from advertising
-		// state to idle/ready state. Host needs to explicitly ask the
-		// controller to re-enable advertising. Note that the host was most
-		// likely in advertising state. Otherwise it couldn't accept the
-		// connection in the first place. The only exception is that user
-		// asked the host to stop advertising during this tiny window.
-		// The re-enabling might failed or ignored by the controller, if
-		// it had reached the maximum number of concurrent connections.
-		// So we also re-enable the advertising when a connection disconnected
-		h.params.RLock()
-		enabled := h.params.advEnable.AdvertisingEnable
-		h.params.RUnlock()
-
-		if enabled == 1 {
-			if err := h.Send(context.Background(), &cmd.LESetAdvertiseEnable{AdvertisingEnable: 0}, nil); err != nil {
-				_ = h.Close()
-				return fmt.Errorf("unable to renable advertising: %w", err)
-			}
-		}
+	}
+	select {
+	case h.chSlaveConn <- c:
+	case <-h.Closed():
+		return fmt.Errorf("hci device closed: %w", h.err)
+	}
+	// When a controller accepts a connection, it moves from advertising state to idle/ready state. The advertiser is
+	// told so it can re-enable advertising; commands can not be sent from the event loop, whose responses it reads.
+	// Advertising sets report their termination separately.
+	if !h.extendedAdvertising.Load() {
+		h.advertisingStopped(nil)
 	}
 	if h.connectedHandler != nil {
 		h.connectedHandler(e)
@@ -710,6 +816,37 @@ func (h *HCI) handleLEConnectionComplete(b []byte) error {
 	return nil
 }
 
+func (h *HCI) handleLEAdvertisingSetTerminated(b []byte) error {
+	e := evt.LEAdvertisingSetTerminated(b)
+	if e.AdvertisingHandle() == legacyAdvHandle {
+		var err error
+		if e.Status() != 0x00 {
+			err = ErrCommand(e.Status())
+		}
+		h.advertisingStopped(err)
+	}
+	if h.advSetTerminatedHandler != nil {
+		h.advSetTerminatedHandler(e)
+	}
+	return nil
+}
+
+// advertisingStopped records that the controller stopped advertising on its own, because a central connected (nil)
+// or directed advertising timed out (ErrDirAdvTimeout), and reports it to AdvertisingStopped. Advertising is still
+// wanted after a connection, to be enabled again once the central disconnected.
+func (h *HCI) advertisingStopped(err error) {
+	h.params.Lock()
+	h.params.advEnable.AdvertisingEnable = 0
+	if err != nil {
+		h.params.advWanted = false
+	}
+	h.params.Unlock()
+	select {
+	case h.chAdvStopped <- err:
+	default:
+	}
+}
+
 func (h *HCI) handleLEConnectionUpdateComplete(b []byte) error {
 	e := evt.LEConnectionUpdateComplete(b)
 	h.log.Debug("LE connection update complete", slog.Uint64("handle", uint64(e.ConnectionHandle())))
@@ -719,6 +856,11 @@ func (h *HCI) handleLEConnectionUpdateComplete(b []byte) error {
 	if !ok {
 		return fmt.Errorf("le connection update complete has invalid connection handle %04X", e.ConnectionHandle())
 	}
+	ce := newConnEvent(ConnEventParamsUpdated, c)
+	if ce.Err = statusErr(e.Status()); ce.Err == nil {
+		ce.setParams(e.ConnInterval(), e.ConnLatency(), e.SupervisionTimeout())
+	}
+	h.emitConnEvent(ce)
 	return c.handleLEConnectionUpdateComplete(e)
 }
 
@@ -757,6 +899,12 @@ func (h *HCI) handleDisconnectionComplete(b []byte) error {
 	h.log.Debug("waiting for routines", log.Uint16("handle", handle))
 	wg.Wait()
 
+	ce := newConnEvent(ConnEventDisconnected, c)
+	if ce.Err = statusErr(e.Status()); ce.Err == nil {
+		ce.Err = ErrCommand(e.Reason())
+	}
+	h.emitConnEvent(ce)
+
 	return nil
 }
 
@@ -844,50 +992,39 @@ func (h *HCI) handleInquiryWithRSSI(b []byte) error {
 func (h *HCI) handleConnectionComplete(b []byte) error {
 
 	e := evt.ConnectionComplete(b)
-	c := newConn(h, e, h.handleDisconnect, h.log.With(slog.String("handle", fmt.Sprintf("%04X", e.PeerAddress()))))
+
+	// Connections accepted by the local device are not waited for by DialBREDR.
+	h.muConns.Lock()
+	_, accepted := h.acceptedBREDR[e.PeerAddress()]
+	delete(h.acceptedBREDR, e.PeerAddress())
+	h.muConns.Unlock()
+
+	if e.Status() != 0x00 {
+		// The connection was canceled successfully (ErrConnID), or could not be made.
+		return nil
+	}
+	var param ConnectionCompleteEvent = e
+	if accepted {
+		param = acceptedConnectionComplete{e}
+	}
+	c := newConn(h, param, h.handleDisconnect, h.log.With(slog.String("handle", fmt.Sprintf("%04X", e.PeerAddress()))))
 
 	handle := e.ConnectionHandle()
 
-	c.log.Debug("Connected: %d", handle)
+	c.log.Debug("Connected", log.Uint16("handle", handle))
 	h.muConns.Lock()
 	if _, ok := h.conns[handle]; ok {
-		h.log.Debug("Handle already exists: %d", handle)
+		h.log.Debug("Handle already exists", log.Uint16("handle", handle))
 	}
 	h.conns[handle] = c
 	h.muConns.Unlock()
-
-	if e.Status() == 0x00 {
-		select {
-		case h.chMasterBREDRConn <- c:
-			return nil
-		case <-h.Closed():
-			return fmt.Errorf("hci device closed: %w", h.err)
-		}
-	}
-	if e.Status() == uint8(ErrConnID) {
-		// The connection was canceled successfully.
+	h.emitConnEvent(newConnEvent(ConnEventConnected, c))
+	if accepted {
 		return nil
 	}
-	return nil
-}
 
-func (h *HCI) handleReadRemoteSupportedFeaturesComplete(b []byte) error {
-	e := evt.ReadRemoteSupportedFeaturesComplete(b)
-	if e.Status() == 0x00 {
-		h.muConns.Lock()
-		c, ok := h.conns[e.ConnectionHandle()]
-		if ok {
-			c.lmpFeatures = e.LMPFeatures()
-		}
-		h.muConns.Unlock()
-	}
-
-	p, found := h.sentPkt(evt.ReadRemoteSupportedFeaturesCompleteCode)
-	if !found {
-		return fmt.Errorf("can't find the cmd for CommandReadRemoteSupportedFeatureEP: % X", e)
-	}
 	select {
-	case p.done <- []byte{e.Status()}:
+	case h.chMasterBREDRConn <- c:
 		return nil
 	case <-h.Closed():
 		return fmt.Errorf("hci device closed: %w", h.err)
@@ -951,7 +1088,7 @@ func (h *HCI) setAllowedCommands(n int) error {
 
 	for len(h.chCmdBufs) < n {
 		select {
-		case h.chCmdBufs <- make([]byte, 64): // TODO make buffer size a constant
+		case h.chCmdBufs <- make([]byte, cmdBufSize):
 		case <-h.Closed():
 			return fmt.Errorf("hci device closed: %w", h.err)
 		}
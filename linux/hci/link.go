@@ -0,0 +1,169 @@
+package hci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"time"
+
+	"github.com/thomascriley/ble/linux/hci/cmd"
+)
+
+// ChannelMap is the bit mask of the LE data channels in use by a connection, channel 0 in the least significant bit
+// of the first byte [Vol 2, Part E, 7.8.20].
+type ChannelMap [5]byte
+
+// numDataChannels is the number of LE data channels [Vol 6, Part B, 1.4.1].
+const numDataChannels = 37
+
+// Used reports whether the data channel is in use.
+func (m ChannelMap) Used(ch int) bool {
+	if ch < 0 || ch >= numDataChannels {
+		return false
+	}
+	return m[ch/8]&(1<<(ch%8)) != 0
+}
+
+// Count returns the number of data channels in use.
+func (m ChannelMap) Count() int {
+	n := 0
+	for i, b := range m {
+		if i == len(m)-1 {
+			b &= 0x1F // channels 37 to 39 are advertising channels
+		}
+		n += bits.OnesCount8(b)
+	}
+	return n
+}
+
+// ReadRSSI reads the received signal strength of the connection in dBm. [Vol 2, Part E, 7.5.4]
+func (c *Conn) ReadRSSI(ctx context.Context) (int, error) {
+	var rp cmd.ReadRSSIRP
+	if err := c.hci.Send(ctx, &cmd.ReadRSSI{Handle: c.param.ConnectionHandle()}, &rp); err != nil {
+		return 0, fmt.Errorf("unable to read rssi: %w", err)
+	}
+	return int(rp.RSSI), nil
+}
+
+// ReadTxPower reads the current transmit power level of the connection in dBm. [Vol 2, Part E, 7.3.35]
+func (c *Conn) ReadTxPower(ctx context.Context) (int, error) {
+	return c.readTxPower(ctx, 0x00)
+}
+
+// ReadMaxTxPower reads the maximum transmit power level of the connection in dBm. [Vol 2, Part E, 7.3.35]
+func (c *Conn) ReadMaxTxPower(ctx context.Context) (int, error) {
+	return c.readTxPower(ctx, 0x01)
+}
+
+func (c *Conn) readTxPower(ctx context.Context, typ uint8) (int, error) {
+	var rp cmd.ReadTransmitPowerLevelRP
+	if err := c.hci.Send(ctx, &cmd.ReadTransmitPowerLevel{ConnectionHandle: c.param.ConnectionHandle(), Type: typ}, &rp); err != nil {
+		return 0, fmt.Errorf("unable to read transmit power level: %w", err)
+	}
+	return int(rp.TransmitPowerLevel), nil
+}
+
+// ReadChannelMap reads the data channels in use by the LE connection. [Vol 2, Part E, 7.8.20]
+func (c *Conn) ReadChannelMap(ctx context.Context) (ChannelMap, error) {
+	if !c.isLE() {
+		return ChannelMap{}, errors.New("channel map is only available on LE connections")
+	}
+	var rp cmd.LEReadChannelMapRP
+	if err := c.hci.Send(ctx, &cmd.LEReadChannelMap{ConnectionHandle: c.param.ConnectionHandle()}, &rp); err != nil {
+		return ChannelMap{}, fmt.Errorf("unable to read channel map: %w", err)
+	}
+	return rp.ChannelMap, nil
+}
+
+// LinkQuality is a sample of the link quality of a connection taken by Conn.MonitorLink.
+type LinkQuality struct {
+	Time time.Time
+
+	// RSSI is the received signal strength in dBm, AvgRSSI its moving average.
+	RSSI    int
+	AvgRSSI float64
+
+	// TxPower is the current transmit power level in dBm, AvgTxPower its moving average.
+	TxPower    int
+	AvgTxPower float64
+
+	// ChannelMap holds the data channels in use, on LE connections.
+	ChannelMap ChannelMap
+}
+
+// MonitorLink samples the link quality of the connection every interval and passes it to h, along with the moving
+// averages over the last window samples, until the context is done or the connection closes. It returns the first
+// error reading the link quality.
+func (c *Conn) MonitorLink(ctx context.Context, interval time.Duration, window int, h func(LinkQuality)) error {
+	if interval <= 0 || window <= 0 {
+		return fmt.Errorf("invalid link monitor interval %s or window %d", interval, window)
+	}
+	rssi, txPower := newMovingAverage(window), newMovingAverage(window)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		q, err := c.sampleLink(ctx)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-c.Disconnected():
+				return nil
+			default:
+				return err
+			}
+		}
+		q.AvgRSSI, q.AvgTxPower = rssi.add(float64(q.RSSI)), txPower.add(float64(q.TxPower))
+		h(q)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.Disconnected():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Conn) sampleLink(ctx context.Context) (q LinkQuality, err error) {
+	q.Time = time.Now()
+	if q.RSSI, err = c.ReadRSSI(ctx); err != nil {
+		return q, err
+	}
+	if q.TxPower, err = c.ReadTxPower(ctx); err != nil {
+		return q, err
+	}
+	if c.isLE() {
+		if q.ChannelMap, err = c.ReadChannelMap(ctx); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// movingAverage is the simple moving average of the last samples added.
+type movingAverage struct {
+	samples []float64
+	next    int
+	sum     float64
+}
+
+func newMovingAverage(window int) *movingAverage {
+	return &movingAverage{samples: make([]float64, 0, window)}
+}
+
+// add adds the sample and returns the average of the samples in the window.
+func (m *movingAverage) add(v float64) float64 {
+	if len(m.samples) < cap(m.samples) {
+		m.samples = append(m.samples, v)
+	} else {
+		m.sum -= m.samples[m.next]
+		m.samples[m.next] = v
+		m.next = (m.next + 1) % len(m.samples)
+	}
+	m.sum += v
+	return m.sum / float64(len(m.samples))
+}
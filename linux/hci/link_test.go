@@ -0,0 +1,32 @@
+package hci
+
+import "testing"
+
+func TestChannelMap(t *testing.T) {
+	m := ChannelMap{0x01, 0x00, 0x00, 0x80, 0xF0}
+	for ch, expected := range map[int]bool{0: true, 1: false, 31: true, 36: true, 37: false, -1: false} {
+		if received := m.Used(ch); received != expected {
+			t.Fatalf("channel %d: Expected: %t, Received: %t", ch, expected, received)
+		}
+	}
+	if received := m.Count(); received != 3 {
+		t.Fatalf("Expected: %d, Received: %d", 3, received)
+	}
+}
+
+func TestMovingAverage(t *testing.T) {
+	m := newMovingAverage(3)
+	for i, test := range []struct {
+		sample, expected float64
+	}{
+		{-60, -60},
+		{-70, -65},
+		{-80, -70},
+		{-90, -80},
+		{-40, -70},
+	} {
+		if received := m.add(test.sample); received != test.expected {
+			t.Fatalf("sample %d: Expected: %f, Received: %f", i, test.expected, received)
+		}
+	}
+}
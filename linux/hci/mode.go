@@ -0,0 +1,287 @@
+package hci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+// Default parameters of the BR/EDR channels.
+const (
+	DefaultModeMTU         = 0x03F5
+	DefaultModeTxWindow    = 32
+	DefaultModeMaxTransmit = 3
+
+	// minACLMTU is the smallest MTU supported over ACL-U logical links, and defaultACLMTU the one used unless the
+	// remote device configures another [Vol 3, Part A, 5.1].
+	minACLMTU     = 48
+	defaultACLMTU = 672
+
+	// minModeMPS is the smallest MPS accepted in the Enhanced Retransmission and Streaming modes, as small as the
+	// smallest MTU, so that the I-frames starting a segmented SDU carry data beside its length.
+	minModeMPS = minACLMTU
+
+	// maxTxWindow is the largest window of the standard control field [Vol 3, Part A, 5.4].
+	maxTxWindow = 63
+)
+
+// localExtendedFeatures are the features of the local L2CAP implementation, as reported to the remote devices
+// [Vol 3, Part A, 4.12].
+const localExtendedFeatures = l2cap.ExtendedFeatureEnhancedRetransmissionModeSupported |
+	l2cap.ExtendedFeatureStreamingMode | l2cap.ExtendedFeatureFCSOption
+
+// Timeouts of the Enhanced Retransmission mode, which the remote device is told to use in the configuration
+// responses, and used when it leaves them unset [Vol 3, Part A, 8.6.2].
+const (
+	ertmRetransmissionTimeout = 2 * time.Second
+	ertmMonitorTimeout        = 12 * time.Second
+)
+
+// ModeParams are the parameters of the receiving side of a BR/EDR channel, proposed to the remote device by the
+// configuration request [Vol 3, Part A, 5]. Zero values are replaced by the defaults.
+type ModeParams struct {
+	// Mode is l2cap.ModeBasic, l2cap.ModeEnhancedRetransmission or l2cap.ModeStreaming. Both devices have to
+	// configure the same mode.
+	Mode uint8
+
+	// MTU is the size of the largest SDU accepted, at least 48 bytes.
+	MTU uint16
+
+	// MPS is the size of the largest I-frame payload accepted, the MTU by default, at least 48 bytes. It is unused in
+	// Basic mode.
+	MPS uint16
+
+	// TxWindow is the number of I-frames the remote device can send before they are acknowledged, from 1 to 63, in
+	// Enhanced Retransmission mode.
+	TxWindow uint8
+
+	// MaxTransmit is the number of transmissions of an I-frame, or poll, the remote device attempts before it gives up
+	// and disconnects the channel in Enhanced Retransmission mode.
+	MaxTransmit uint8
+
+	// NoFCS asks to omit the Frame Check Sequence of the I-frames and S-frames, which is only omitted if both devices
+	// ask to.
+	NoFCS bool
+}
+
+func (p ModeParams) withDefaults() (ModeParams, error) {
+	if p.MTU == 0 {
+		p.MTU = DefaultModeMTU
+	}
+	if p.MPS == 0 {
+		p.MPS = p.MTU
+	}
+	if p.TxWindow == 0 {
+		p.TxWindow = DefaultModeTxWindow
+	}
+	if p.MaxTransmit == 0 {
+		p.MaxTransmit = DefaultModeMaxTransmit
+	}
+	switch {
+	case p.Mode != l2cap.ModeBasic && p.Mode != l2cap.ModeEnhancedRetransmission && p.Mode != l2cap.ModeStreaming:
+		return p, fmt.Errorf("unsupported mode 0x%02X", p.Mode)
+	case p.MTU < minACLMTU:
+		return p, fmt.Errorf("mtu %d is less than %d", p.MTU, minACLMTU)
+	case p.Mode != l2cap.ModeBasic && p.MPS < minModeMPS:
+		return p, fmt.Errorf("mps %d is less than %d", p.MPS, minModeMPS)
+	case p.TxWindow > maxTxWindow:
+		return p, fmt.Errorf("tx window %d is larger than %d", p.TxWindow, maxTxWindow)
+	}
+	return p, nil
+}
+
+// options returns the options of the configuration request proposing the parameters.
+func (p ModeParams) options() []l2cap.Option {
+	opts := []l2cap.Option{&l2cap.MTUOption{MTU: p.MTU}}
+	if p.Mode == l2cap.ModeBasic {
+		return opts
+	}
+
+	// The timeouts are set by the response [Vol 3, Part A, 5.4].
+	rfc := &l2cap.RetransmissionAndFlowControlOption{Mode: p.Mode, MaximumPDUSize: p.MPS}
+	if p.Mode == l2cap.ModeEnhancedRetransmission {
+		rfc.TxWindowSize, rfc.MaxTransmit = p.TxWindow, p.MaxTransmit
+	}
+	opts = append(opts, rfc)
+	if p.NoFCS {
+		opts = append(opts, &l2cap.FrameCheckSequenceOption{FCSType: l2cap.FCSTypeNone})
+	}
+	return opts
+}
+
+// modeConfig is the configuration of a BR/EDR channel, negotiated by the configuration requests of both devices.
+type modeConfig struct {
+	local ModeParams
+
+	// Set by the configuration request of the remote device.
+	txMTU       int
+	txMPS       int
+	txWindow    int
+	maxTransmit int
+	remoteNoFCS bool
+
+	// Set by the configuration response of the remote device.
+	retransmissionTimeout time.Duration
+	monitorTimeout        time.Duration
+
+	// localDone and remoteDone are set once the configuration requests of the local and remote devices succeeded.
+	localDone  bool
+	remoteDone bool
+}
+
+// request applies the options of a configuration request of the remote device. It returns the options and result of
+// the response: the unacceptable options with acceptable values if any, the accepted ones otherwise.
+func (m *modeConfig) request(opts []l2cap.Option) ([]l2cap.Option, uint16) {
+	var accepted, unacceptable, unknown []l2cap.Option
+	rfc := &l2cap.RetransmissionAndFlowControlOption{Mode: l2cap.ModeBasic}
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *l2cap.MTUOption:
+			if o.MTU < minACLMTU {
+				unacceptable = append(unacceptable, &l2cap.MTUOption{MTU: minACLMTU})
+				continue
+			}
+			m.txMTU = int(o.MTU)
+			accepted = append(accepted, o)
+		case *l2cap.RetransmissionAndFlowControlOption:
+			rfc = o
+		case *l2cap.FrameCheckSequenceOption:
+			m.remoteNoFCS = o.FCSType == l2cap.FCSTypeNone
+			accepted = append(accepted, o)
+		case *l2cap.FlushTimeoutOption, *l2cap.QoSOption:
+			// The flush timeout and quality of service of the remote device only inform the local one.
+			accepted = append(accepted, o)
+		default:
+			if opt.Hint() == 0x00 {
+				unknown = append(unknown, opt)
+				continue
+			}
+			accepted = append(accepted, opt)
+		}
+	}
+	if len(unknown) > 0 {
+		return unknown, l2cap.ConfigurationResultFailureUnknown
+	}
+
+	// Both directions of the channel use the same mode, the one proposed by the local device.
+	switch {
+	case rfc.Mode != m.local.Mode:
+		suggested := &l2cap.RetransmissionAndFlowControlOption{Mode: m.local.Mode, MaximumPDUSize: m.local.MPS}
+		if m.local.Mode == l2cap.ModeEnhancedRetransmission {
+			suggested.TxWindowSize, suggested.MaxTransmit = m.local.TxWindow, m.local.MaxTransmit
+		}
+		unacceptable = append(unacceptable, suggested)
+	case rfc.Mode == l2cap.ModeEnhancedRetransmission && (rfc.TxWindowSize == 0 || rfc.TxWindowSize > maxTxWindow):
+		suggested := *rfc
+		suggested.TxWindowSize = DefaultModeTxWindow
+		unacceptable = append(unacceptable, &suggested)
+	case rfc.Mode != l2cap.ModeBasic && rfc.MaximumPDUSize < minModeMPS:
+		suggested := *rfc
+		suggested.MaximumPDUSize = minModeMPS
+		unacceptable = append(unacceptable, &suggested)
+	case rfc.Mode != l2cap.ModeBasic:
+		m.txMPS, m.txWindow, m.maxTransmit = int(rfc.MaximumPDUSize), int(rfc.TxWindowSize), int(rfc.MaxTransmit)
+		accepted = append(accepted, &l2cap.RetransmissionAndFlowControlOption{
+			Mode:                  rfc.Mode,
+			TxWindowSize:          rfc.TxWindowSize,
+			MaxTransmit:           rfc.MaxTransmit,
+			RetransmissionTimeout: timeoutOption(rfc.Mode, ertmRetransmissionTimeout),
+			MonitorTimeout:        timeoutOption(rfc.Mode, ertmMonitorTimeout),
+			MaximumPDUSize:        rfc.MaximumPDUSize,
+		})
+	}
+	if len(unacceptable) > 0 {
+		return unacceptable, l2cap.ConfigurationResultFailureUnacceptable
+	}
+	return accepted, l2cap.ConfigurationResultSuccessful
+}
+
+// timeoutOption returns the timeout in milliseconds, as set in the responses of the Enhanced Retransmission mode.
+func timeoutOption(mode uint8, d time.Duration) uint16 {
+	if mode != l2cap.ModeEnhancedRetransmission {
+		return 0
+	}
+	return uint16(d / time.Millisecond)
+}
+
+// response applies the options of the successful response to the configuration request of the local device.
+func (m *modeConfig) response(opts []l2cap.Option) {
+	m.retransmissionTimeout, m.monitorTimeout = ertmRetransmissionTimeout, ertmMonitorTimeout
+	for _, opt := range opts {
+		if rfc, ok := opt.(*l2cap.RetransmissionAndFlowControlOption); ok {
+			if rfc.RetransmissionTimeout != 0 {
+				m.retransmissionTimeout = time.Duration(rfc.RetransmissionTimeout) * time.Millisecond
+			}
+			if rfc.MonitorTimeout != 0 {
+				m.monitorTimeout = time.Duration(rfc.MonitorTimeout) * time.Millisecond
+			}
+		}
+	}
+}
+
+// ertmConfig returns the configuration of the Enhanced Retransmission or Streaming mode, once both devices are
+// configured.
+func (m *modeConfig) ertmConfig() ertmConfig {
+	cfg := ertmConfig{
+		mode:                  m.local.Mode,
+		fcs:                   !m.local.NoFCS || !m.remoteNoFCS,
+		rxMTU:                 int(m.local.MTU),
+		rxMPS:                 int(m.local.MPS),
+		rxWindow:              int(m.local.TxWindow),
+		txMTU:                 m.txMTU,
+		txMPS:                 m.txMPS,
+		txWindow:              m.txWindow,
+		maxTransmit:           m.maxTransmit,
+		retransmissionTimeout: m.retransmissionTimeout,
+		monitorTimeout:        m.monitorTimeout,
+	}
+	if cfg.txMTU == 0 {
+		cfg.txMTU = defaultACLMTU
+	}
+	if cfg.txMPS == 0 || cfg.txMPS > cfg.txMTU {
+		cfg.txMPS = cfg.txMTU
+	}
+	return cfg
+}
+
+// modeEngine returns the engine of the Enhanced Retransmission or Streaming mode of the channel, nil in Basic mode.
+func (ch *BREDRChannel) modeEngine() *ertm {
+	ch.muMode.Lock()
+	defer ch.muMode.Unlock()
+	return ch.ertm
+}
+
+// startMode starts the engine of the mode once both devices configured the channel. It is called with muMode held, on
+// the recombine loop, so the engine is set before the first I-frame is received.
+func (ch *BREDRChannel) startMode() {
+	if !ch.mode.localDone || !ch.mode.remoteDone || ch.ertm != nil || ch.mode.local.Mode == l2cap.ModeBasic {
+		return
+	}
+	ch.ertm = newERTM(ch.mode.ertmConfig(), ch.remoteCID, func(b []byte) error {
+		_, err := ch.conn.writePDU(b)
+		return err
+	}, ch.abort)
+}
+
+// checkMode returns an error if the remote device does not support the mode, as reported by its extended features.
+func (c *Conn) checkMode(ctx context.Context, mode uint8) error {
+	if mode == l2cap.ModeBasic {
+		return nil
+	}
+	if c.extendedFeatures == 0 {
+		if err := c.InformationRequest(ctx, l2cap.InfoTypeExtendedFeatures, bredrSignalTimeout); err != nil {
+			return fmt.Errorf("unable to request extended features: %w", err)
+		}
+	}
+	switch {
+	case mode == l2cap.ModeEnhancedRetransmission &&
+		c.extendedFeatures&l2cap.ExtendedFeatureEnhancedRetransmissionModeSupported == 0:
+		return errors.New("remote device does not support the enhanced retransmission mode")
+	case mode == l2cap.ModeStreaming && c.extendedFeatures&l2cap.ExtendedFeatureStreamingMode == 0:
+		return errors.New("remote device does not support the streaming mode")
+	}
+	return nil
+}
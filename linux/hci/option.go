@@ -2,6 +2,7 @@ package hci
 
 import (
 	"errors"
+	"fmt"
 	"github.com/thomascriley/ble"
 	"github.com/thomascriley/ble/linux/hci/cmd"
 	"github.com/thomascriley/ble/linux/hci/evt"
@@ -38,6 +39,27 @@ func (h *HCI) SetDisconnectedHandler(f func(ble.Conn)) error {
 	return nil
 }
 
+// SetConnEventHandler sets handler to be called on every change in the lifecycle of a connection. It is called from
+// the event loop, or from the goroutine changing the MTU, so it must neither block nor send commands.
+func (h *HCI) SetConnEventHandler(f func(ConnEvent)) error {
+	h.connEventHandler = f
+	return nil
+}
+
+// SetAdvertisingSetTerminatedHandler sets handler to be called when an advertising set stops because a connection was
+// created or its duration elapsed. It is called from the event loop and must not send commands.
+func (h *HCI) SetAdvertisingSetTerminatedHandler(f func(evt.LEAdvertisingSetTerminated)) error {
+	h.advSetTerminatedHandler = f
+	return nil
+}
+
+// SetBREDRAcceptHandler sets the policy accepting the BR/EDR connection requests of the remote devices, which are
+// rejected unless it returns true. It is called from its own goroutine for each request.
+func (h *HCI) SetBREDRAcceptHandler(f func(BREDRConnRequest) bool) error {
+	h.bredrAcceptHandler = f
+	return nil
+}
+
 // SetAdvParams overrides default advertising parameters.
 func (h *HCI) SetAdvParams(param cmd.LESetAdvertisingParameters) error {
 	h.params.advParams = param
@@ -54,6 +76,16 @@ func (h *HCI) SetCentralRole() error {
 	return errors.New("Not supported")
 }
 
+// SetL2CAPMode sets the mode, and its parameters, of the BR/EDR channels DialRFCOMM opens.
+func (h *HCI) SetL2CAPMode(p ModeParams) error {
+	p, err := p.withDefaults()
+	if err != nil {
+		return fmt.Errorf("invalid mode parameters: %w", err)
+	}
+	h.modeParams = p
+	return nil
+}
+
 // OptPairingIO allows input and output for the pairing process.
 func (h *HCI) SetPairingCapabilities(param smp.Capabilities) error {
 	h.smpCapabilites = param
@@ -14,6 +14,11 @@ type params struct {
 	scanEnable cmd.LESetScanEnable
 	connCancel cmd.LECreateConnectionCancel
 
+	// advWanted is set while the caller advertises, until StopAdvertising. Unlike advEnable, it is kept when the
+	// controller stops advertising because a central connected, so that advertising is enabled again once the
+	// central disconnected.
+	advWanted bool
+
 	advData    cmd.LESetAdvertisingData
 	scanResp   cmd.LESetScanResponseData
 	advParams  cmd.LESetAdvertisingParameters
@@ -0,0 +1,88 @@
+package hci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thomascriley/ble/linux/l2cap"
+)
+
+// pingTimeout bounds the echo and information requests, unless the context is done first.
+const pingTimeout = 30 * time.Second
+
+// localFixedChannels are the fixed channels of the local L2CAP implementation on ACL-U logical links, as reported to the
+// remote devices: the signaling channel [Vol 3, Part A, 4.12].
+const localFixedChannels uint64 = 1 << cidSignal
+
+// Ping sends an echo request with the data to the remote device, and returns the time its response took
+// [Vol 3, Part A, 4.8]. As LE devices reject echo requests as not understood [Vol 3, Part A, 4], the rejection is the
+// response on LE connections.
+func (c *Conn) Ping(ctx context.Context, data []byte) (time.Duration, error) {
+	if 4+len(data) > c.sigTxMTU {
+		return 0, fmt.Errorf("echo data of %d bytes exceeds the signaling mtu %d", len(data), c.sigTxMTU)
+	}
+	var rsp Signal
+	if !c.isLE() {
+		rsp = &l2cap.EchoResponse{}
+	}
+	start := time.Now()
+	if err := c.Signal(ctx, &l2cap.EchoRequest{Data: data}, rsp, pingTimeout); err != nil {
+		return 0, fmt.Errorf("echo request failed: %w", err)
+	}
+	return time.Since(start), nil
+}
+
+// L2CAPInfo is the information about the L2CAP implementation of a remote device [Vol 3, Part A, 4.10].
+type L2CAPInfo struct {
+	// ConnectionlessMTU is the size of the largest connectionless SDU the remote device accepts.
+	ConnectionlessMTU uint16
+
+	// ExtendedFeatures is the mask of the l2cap.ExtendedFeature features the remote device supports.
+	ExtendedFeatures uint32
+
+	// FixedChannels is the mask of the fixed channels the remote device supports, bit n standing for CID n. It is zero
+	// if the remote device does not report them.
+	FixedChannels uint64
+}
+
+// SupportsFeature reports whether the remote device supports the extended feature.
+func (i L2CAPInfo) SupportsFeature(feature uint32) bool { return i.ExtendedFeatures&feature == feature }
+
+// SupportsFixedChannel reports whether the remote device supports the fixed channel.
+func (i L2CAPInfo) SupportsFixedChannel(cid uint16) bool {
+	return cid < 64 && i.FixedChannels&(1<<cid) != 0
+}
+
+// L2CAPInfo requests the information about the L2CAP implementation of the remote device. Information requests are
+// only available on BR/EDR connections.
+func (c *Conn) L2CAPInfo(ctx context.Context) (L2CAPInfo, error) {
+	var info L2CAPInfo
+	if c.isLE() {
+		return info, errors.New("information requests are only available on BR/EDR connections")
+	}
+	rsp, err := c.information(ctx, l2cap.InfoTypeConnectionlessMTU, pingTimeout)
+	if err != nil {
+		return info, err
+	}
+	info.ConnectionlessMTU = rsp.ConnectionlessMTU
+
+	if rsp, err = c.information(ctx, l2cap.InfoTypeExtendedFeatures, pingTimeout); err != nil {
+		return info, err
+	}
+	info.ExtendedFeatures = rsp.ExtendedFeatureMask
+
+	// Devices prior to 3.0 do not support the request of their fixed channels.
+	if !info.SupportsFeature(l2cap.ExtendedFeatureFixedChannels) {
+		return info, nil
+	}
+	switch rsp, err = c.information(ctx, l2cap.InfoTypeFixedChannels, pingTimeout); {
+	case errors.Is(err, l2cap.ErrInfoNotSupported):
+	case err != nil:
+		return info, err
+	default:
+		info.FixedChannels = rsp.FixedChannels
+	}
+	return info, nil
+}
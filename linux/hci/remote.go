@@ -0,0 +1,247 @@
+package hci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thomascriley/ble/linux/hci/cmd"
+	"github.com/thomascriley/ble/linux/hci/evt"
+	"github.com/thomascriley/ble/log"
+)
+
+// remoteInfoTimeout bounds each of the remote information requests, which complete with events sent by the remote
+// device.
+const remoteInfoTimeout = 10 * time.Second
+
+// RemoteVersion is the version information of a remote device [Vol 2, Part E, 7.7.12].
+type RemoteVersion struct {
+	// Version is the LMP or link layer version of the remote controller [Assigned Numbers, 2.1].
+	Version uint8
+
+	// Manufacturer is the company identifier of the manufacturer of the remote controller [Assigned Numbers, 7.1].
+	Manufacturer uint16
+
+	// Subversion is the manufacturer specific revision of the remote controller.
+	Subversion uint16
+}
+
+// coreVersions are the core specification versions corresponding to the LMP and link layer versions.
+var coreVersions = []string{"1.0b", "1.1", "1.2", "2.0", "2.1", "3.0", "4.0", "4.1", "4.2", "5.0", "5.1", "5.2", "5.3",
+	"5.4", "6.0"}
+
+// String returns the core specification version implemented by the remote controller.
+func (v RemoteVersion) String() string {
+	if int(v.Version) < len(coreVersions) {
+		return coreVersions[v.Version]
+	}
+	return fmt.Sprintf("unknown (0x%02X)", v.Version)
+}
+
+// RemoteInfo holds the features and version information of a remote device, as fetched once connected.
+type RemoteInfo struct {
+	// LEFeatures are the link layer features used on LE connections.
+	LEFeatures LEFeatures
+
+	// LMPFeatures are the pages of link manager features of BR/EDR connections.
+	LMPFeatures LMPFeatures
+
+	Version RemoteVersion
+}
+
+// SupportsDataLengthExtension reports whether the remote device supports LE Data Packet Length Extension.
+func (i RemoteInfo) SupportsDataLengthExtension() bool {
+	return i.LEFeatures.Has(LEFeatureDataPacketLengthExtension)
+}
+
+// Supports2MPHY reports whether the remote device supports the LE 2M PHY.
+func (i RemoteInfo) Supports2MPHY() bool {
+	return i.LEFeatures.Has(LEFeature2MPHY)
+}
+
+// SupportsCodedPHY reports whether the remote device supports the LE Coded PHY.
+func (i RemoteInfo) SupportsCodedPHY() bool {
+	return i.LEFeatures.Has(LEFeatureCodedPHY)
+}
+
+// SupportsLEEncryption reports whether the remote device supports LE Encryption.
+func (i RemoteInfo) SupportsLEEncryption() bool {
+	return i.LEFeatures.Has(LEFeatureEncryption)
+}
+
+// SupportsSecureSimplePairing reports whether both the remote controller and host support Secure Simple Pairing.
+func (i RemoteInfo) SupportsSecureSimplePairing() bool {
+	return i.LMPFeatures.Has(LMPFeatureSecureSimplePairing) && i.LMPFeatures.Has(LMPFeatureSSPHost)
+}
+
+// RemoteInfo returns the features and version information of the remote device, waiting until they have been
+// fetched. Information that could not be fetched is left empty and reported by the error.
+func (c *Conn) RemoteInfo(ctx context.Context) (RemoteInfo, error) {
+	select {
+	case <-c.chRemoteInfo:
+		return c.remoteInfo, c.remoteInfoErr
+	case <-ctx.Done():
+		return RemoteInfo{}, ctx.Err()
+	case <-c.Disconnected():
+		return RemoteInfo{}, errors.New("disconnected before remote information was fetched")
+	}
+}
+
+// fetchRemoteInfo requests the features and version information of the remote device, once connected.
+func (c *Conn) fetchRemoteInfo() {
+	defer close(c.chRemoteInfo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.Disconnected():
+			cancel()
+		}
+	}()
+
+	var errs []error
+	if c.isLE() {
+		if err := c.fetchLEFeatures(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unable to read remote le features: %w", err))
+		}
+	} else if err := c.fetchLMPFeatures(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("unable to read remote lmp features: %w", err))
+	}
+	if err := c.fetchVersion(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("unable to read remote version information: %w", err))
+	}
+	c.remoteInfoErr = errors.Join(errs...)
+	if c.remoteInfoErr != nil {
+		c.log.Debug("unable to fetch remote information", log.Error(c.remoteInfoErr))
+	}
+}
+
+func (c *Conn) fetchLEFeatures(ctx context.Context) error {
+	b, err := c.requestRemote(ctx, &cmd.LEReadRemoteUsedFeatures{ConnectionHandle: c.param.ConnectionHandle()},
+		evt.LEReadRemoteUsedFeaturesCompleteSubCode)
+	if err != nil {
+		return err
+	}
+	e := evt.LEReadRemoteUsedFeaturesComplete(b)
+	if e.Status() != 0x00 {
+		return ErrCommand(e.Status())
+	}
+	c.remoteInfo.LEFeatures = LEFeatures(e.LEFeatures())
+	return nil
+}
+
+func (c *Conn) fetchLMPFeatures(ctx context.Context) error {
+	b, err := c.requestRemote(ctx, &cmd.ReadRemoteSupportedFeatures{ConnectionHandle: c.param.ConnectionHandle()},
+		evt.ReadRemoteSupportedFeaturesCompleteCode)
+	if err != nil {
+		return err
+	}
+	e := evt.ReadRemoteSupportedFeaturesComplete(b)
+	if e.Status() != 0x00 {
+		return ErrCommand(e.Status())
+	}
+	c.remoteInfo.LMPFeatures = LMPFeatures{e.LMPFeatures()}
+	if !c.remoteInfo.LMPFeatures.Has(LMPFeatureExtendedFeatures) {
+		return nil
+	}
+
+	// The pages beyond the first are only available through the extended features [Vol 2, Part E, 7.1.22].
+	for page, max := uint8(1), uint8(1); page <= max; page++ {
+		b, err = c.requestRemote(ctx, &cmd.ReadRemoteExtendedFeatures{ConnectionHandle: c.param.ConnectionHandle(),
+			PageNumber: page}, evt.ReadRemoteExtendedFeaturesCompleteCode)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", page, err)
+		}
+		e := evt.ReadRemoteExtendedFeaturesComplete(b)
+		if e.Status() != 0x00 {
+			return fmt.Errorf("page %d: %w", page, ErrCommand(e.Status()))
+		}
+		c.remoteInfo.LMPFeatures = append(c.remoteInfo.LMPFeatures, e.ExtendedLMPFeatures())
+		max = e.MaximumPageNumber()
+	}
+	return nil
+}
+
+func (c *Conn) fetchVersion(ctx context.Context) error {
+	b, err := c.requestRemote(ctx, &cmd.ReadRemoteVersionInformation{ConnectionHandle: c.param.ConnectionHandle()},
+		evt.ReadRemoteVersionInformationCompleteCode)
+	if err != nil {
+		return err
+	}
+	e := evt.ReadRemoteVersionInformationComplete(b)
+	if e.Status() != 0x00 {
+		return ErrCommand(e.Status())
+	}
+	c.remoteInfo.Version = RemoteVersion{
+		Version:      e.Version(),
+		Manufacturer: e.ManufacturerName(),
+		Subversion:   e.Subversion(),
+	}
+	return nil
+}
+
+// requestRemote sends the command and waits for the event, identified by its code, completing it.
+func (c *Conn) requestRemote(ctx context.Context, command Command, code int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteInfoTimeout)
+	defer cancel()
+
+	if err := c.hci.Send(ctx, command, nil); err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case e := <-c.chRemoteEvt:
+			// Drop events left over from requests that timed out.
+			if e.code == code {
+				return e.b, nil
+			}
+		}
+	}
+}
+
+// remoteEvent is an event completing one of the remote information requests.
+type remoteEvent struct {
+	code int
+	b    []byte
+}
+
+// dispatchRemoteEvent passes the event to the connection with the handle requesting remote information. It runs on
+// the event loop, so it never blocks.
+func (h *HCI) dispatchRemoteEvent(handle uint16, code int, b []byte) error {
+	h.muConns.Lock()
+	c, ok := h.conns[handle]
+	h.muConns.Unlock()
+	if !ok {
+		return fmt.Errorf("remote information event %02X has invalid connection handle %04X", code, handle)
+	}
+	select {
+	case c.chRemoteEvt <- remoteEvent{code: code, b: append([]byte(nil), b...)}:
+	default:
+	}
+	return nil
+}
+
+func (h *HCI) handleReadRemoteSupportedFeaturesComplete(b []byte) error {
+	e := evt.ReadRemoteSupportedFeaturesComplete(b)
+	return h.dispatchRemoteEvent(e.ConnectionHandle(), evt.ReadRemoteSupportedFeaturesCompleteCode, b)
+}
+
+func (h *HCI) handleReadRemoteExtendedFeaturesComplete(b []byte) error {
+	e := evt.ReadRemoteExtendedFeaturesComplete(b)
+	return h.dispatchRemoteEvent(e.ConnectionHandle(), evt.ReadRemoteExtendedFeaturesCompleteCode, b)
+}
+
+func (h *HCI) handleReadRemoteVersionInformationComplete(b []byte) error {
+	e := evt.ReadRemoteVersionInformationComplete(b)
+	return h.dispatchRemoteEvent(e.ConnectionHandle(), evt.ReadRemoteVersionInformationCompleteCode, b)
+}
+
+func (h *HCI) handleLEReadRemoteUsedFeaturesComplete(b []byte) error {
+	e := evt.LEReadRemoteUsedFeaturesComplete(b)
+	return h.dispatchRemoteEvent(e.ConnectionHandle(), evt.LEReadRemoteUsedFeaturesCompleteSubCode, b)
+}
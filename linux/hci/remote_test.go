@@ -0,0 +1,30 @@
+package hci
+
+import "testing"
+
+func TestLMPFeatures(t *testing.T) {
+	f := LMPFeatures{1<<51 | 1<<63, 1 << 0}
+	for feature, expected := range map[LMPFeature]bool{
+		LMPFeatureSecureSimplePairing: true,
+		LMPFeatureExtendedFeatures:    true,
+		LMPFeatureSSPHost:             true,
+		LMPFeatureLEHost:              false,
+		LMPFeatureEncryption:          false,
+		LMPFeatureSecureConn:          false,
+	} {
+		if received := f.Has(feature); received != expected {
+			t.Fatalf("feature %04X: Expected: %t, Received: %t", uint16(feature), expected, received)
+		}
+	}
+	if !(RemoteInfo{LMPFeatures: f}).SupportsSecureSimplePairing() {
+		t.Fatalf("Expected secure simple pairing support")
+	}
+}
+
+func TestRemoteVersion(t *testing.T) {
+	for version, expected := range map[uint8]string{0x06: "4.0", 0x09: "5.0", 0x0D: "5.4", 0xFF: "unknown (0xFF)"} {
+		if received := (RemoteVersion{Version: version}).String(); received != expected {
+			t.Fatalf("Expected: %s, Received: %s", expected, received)
+		}
+	}
+}
@@ -31,6 +31,9 @@ func (s sigCmd) data() []byte { return s[4 : 4+s.len()] }
 
 // Signal ...
 func (c *Conn) Signal(ctx context.Context, req Signal, rsp Signal, timeout time.Duration) error {
+	// Responses are matched to the single outstanding request.
+	c.sigMu.Lock()
+	defer c.sigMu.Unlock()
 
 	//logger.Info("Signaling (request: %X, response: %X)\n", req.Code(), rsp.Code())
 
@@ -73,8 +76,15 @@ func (c *Conn) Signal(ctx context.Context, req Signal, rsp Signal, timeout time.
 
 	// add a buffer of 1 in case the response occurs before we have a chance
 	// to wait on sigSent
-	c.sigSent = make(chan []byte, 1)
-	defer close(c.sigSent)
+	sent := make(chan []byte, 1)
+	c.muSigSent.Lock()
+	c.sigSent = sent
+	c.muSigSent.Unlock()
+	defer func() {
+		c.muSigSent.Lock()
+		c.sigSent = nil
+		c.muSigSent.Unlock()
+	}()
 
 	if _, err := c.writePDU(buf.Bytes()); err != nil {
 		return err
@@ -88,7 +98,7 @@ func (c *Conn) Signal(ctx context.Context, req Signal, rsp Signal, timeout time.
 		return errors.New("disconnected")
 	case <-c.hci.Closed():
 		return fmt.Errorf("hci device closed: %w", c.hci.err)
-	case s = <-c.sigSent:
+	case s = <-sent:
 	case <-time.After(timeout):
 		return errors.New("signaling request timed out")
 	}
@@ -100,6 +110,9 @@ func (c *Conn) Signal(ctx context.Context, req Signal, rsp Signal, timeout time.
 	if rsp == nil {
 		return nil
 	}
+	if s.code() == l2cap.SignalCommandReject && rsp.Code() != l2cap.SignalCommandReject {
+		return c.handleCommandReject(s)
+	}
 	if s.code() != rsp.Code() {
 		return errors.New("mismatched signaling response")
 	}
@@ -131,6 +144,18 @@ func (c *Conn) sendResponse(code uint8, id uint8, r Signal) (int, error) {
 	return c.writePDU(buf.Bytes())
 }
 
+// deliverResponse passes the response to the outstanding signaling request. It reports false if there is none.
+func (c *Conn) deliverResponse(s sigCmd) bool {
+	c.muSigSent.Lock()
+	defer c.muSigSent.Unlock()
+	select {
+	case c.sigSent <- s:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *Conn) handleSignal(p pdu) error {
 
 	//logger.Debug("sig", "recv", fmt.Sprintf("[%X]", p))
@@ -156,7 +181,10 @@ func (c *Conn) handleSignal(p pdu) error {
 		// Check if it's a supported request.
 		switch s.code() {
 		case l2cap.SignalCommandReject:
-			err = c.handleCommandReject(s)
+			// Requests the remote device does not support are rejected.
+			if !c.deliverResponse(s) {
+				err = c.handleCommandReject(s)
+			}
 		case l2cap.SignalConnectionRequest:
 			err = c.handleConnectionRequest(s)
 		case l2cap.SignalConfigurationRequest:
@@ -174,22 +202,20 @@ func (c *Conn) handleSignal(p pdu) error {
 		case l2cap.SignalConnectionParameterUpdateRequest:
 			err = c.handleConnectionParameterUpdateRequest(s)
 		case l2cap.SignalLECreditBasedConnectionRequest:
-			err = c.LECreditBasedConnectionRequest()
+			err = c.handleLECreditBasedConnectionRequest(s)
 		case l2cap.SignalLEFlowControlCredit:
-			err = c.LEFlowControlCredit()
+			err = c.handleLEFlowControlCredit(s)
+		case l2cap.SignalCreditBasedConnectionRequest:
+			err = c.handleCreditBasedConnectionRequest(s)
+		case l2cap.SignalCreditBasedReconfigureRequest:
+			err = c.handleCreditBasedReconfigureRequest(s)
 		case l2cap.SignalConnectionResponse:
 			err = c.handleConnectionResponse(s)
 		case l2cap.SignalConfigurationResponse:
 			err = c.handleConfigurationResponse(s)
 		default:
 			// Check if it's a response to a sent command.
-			select {
-			case <-c.hci.Closed():
-				return fmt.Errorf("hci device closed: %w", err)
-			case <-c.Disconnected():
-				return errors.New("disconnected")
-			case c.sigSent <- s:
-			default:
+			if !c.deliverResponse(s) {
 				_, err = c.sendResponse(
 					l2cap.SignalCommandReject,
 					s.id(),
@@ -225,29 +251,43 @@ func (c *Conn) handleCommandReject(s sigCmd) error {
 	}
 }
 
-// handleConnectionRequest ...
+// handleConnectionRequest accepts the channel if a listener is registered for its PSM.
 func (c *Conn) handleConnectionRequest(s sigCmd) error {
 	var req l2cap.ConnectionRequest
 	if err := req.Unmarshal(s.data()); err != nil {
 		return fmt.Errorf("unable to unmarshal connection request: %w", err)
 	}
 
-	// TODO: Add authentication, PSM check, etc
-	_, err := c.sendResponse(l2cap.SignalConnectionResponse, s.id(),
-		&l2cap.ConnectionResponse{
-			DestinationCID: c.SourceID,
-			SourceCID:      c.DestinationID,
-			Status:         l2cap.ConnectionStatusNoInfo,
-			Result:         l2cap.ConnectionResultSuccessful})
-	return fmt.Errorf("unable to send connection response: %w", err)
+	ch, l, result := c.acceptBREDRChannel(req)
+	rsp := &l2cap.ConnectionResponse{
+		SourceCID: req.SourceCID,
+		Status:    l2cap.ConnectionStatusNoInfo,
+		Result:    result}
+	if ch != nil {
+		rsp.DestinationCID = ch.localCID
+	}
+	if _, err := c.sendResponse(l2cap.SignalConnectionResponse, s.id(), rsp); err != nil {
+		if ch != nil {
+			ch.shutdown()
+		}
+		return fmt.Errorf("unable to send connection response: %w", err)
+	}
+	if ch == nil {
+		return nil
+	}
+	c.Add(1)
+	go func() {
+		defer c.Done()
+		ch.configureAccepted(l)
+	}()
+	return nil
 }
 
 // handleConfigurationRequest ...
 func (c *Conn) handleConfigurationRequest(s sigCmd) error {
 	rsp := &l2cap.ConfigurationResponse{
-		SourceCID: c.DestinationID,
-		Flags:     0x0000,
-		Result:    l2cap.ConfigurationResultSuccessful,
+		Flags:  0x0000,
+		Result: l2cap.ConfigurationResultSuccessful,
 	}
 
 	var req l2cap.ConfigurationRequest
@@ -259,34 +299,43 @@ func (c *Conn) handleConfigurationRequest(s sigCmd) error {
 		return fmt.Errorf("unable to unmarshal response `%T`: %w", rsp, err)
 	}
 
-	for _, option := range req.ConfigurationOptions {
-		switch option.Type() {
-		case l2cap.MTUOptionType:
-			c.txMTU = int(option.(*l2cap.MTUOption).MTU)
-		default:
-			if option.Hint() == 0x00 {
-				rsp.Result = l2cap.ConfigurationResultFailureUnknown
-			}
-		}
-		rsp.ConfigurationOptions = append(rsp.ConfigurationOptions, option)
+	// Send Command Reject when the DCID is unrecognized.
+	ch := c.bredrChannel(req.DestinationCID)
+	if ch == nil {
+		_, err := c.sendResponse(l2cap.SignalCommandReject, s.id(),
+			&l2cap.CommandReject{
+				Reason:         l2cap.ReasonInvalidCID,
+				DestinationCID: req.DestinationCID})
+		return err
 	}
+
+	rsp.SourceCID = ch.remoteCID
+	rsp.ConfigurationOptions, rsp.Result = ch.configure(req)
 	if _, err := c.sendResponse(l2cap.SignalConfigurationResponse, s.id(), rsp); err != nil {
 		return fmt.Errorf("unable to send SignalConfigurartionResponse: %w", err)
 	}
 
-	select {
-	case <-c.cfgRequest:
-	default:
-		close(c.cfgRequest)
-	}
+	// Refused requests are sent again with acceptable options, the channel opens once both devices accepted.
+	ch.open()
 	return nil
 }
 
-// handleEchoRequest ...
+// handleEchoRequest echoes the data of the request [Vol 3, Part A, 4.8]. Echo requests are not part of the LE
+// signaling, so they are rejected on LE connections.
 func (c *Conn) handleEchoRequest(s sigCmd) error {
-	// TODO: Allow user to supply own data response
-	_, err := c.sendResponse(l2cap.SignalEchoResponse, s.id(),
-		&l2cap.EchoResponse{Data: 0x00})
+	if c.isLE() {
+		_, err := c.sendResponse(l2cap.SignalCommandReject, s.id(),
+			&l2cap.CommandReject{Reason: l2cap.ReasonCommandNotUnderstood})
+		return err
+	}
+	var req l2cap.EchoRequest
+	if err := req.Unmarshal(s.data()); err != nil {
+		return err
+	}
+	if 4+len(req.Data) > c.sigTxMTU {
+		req.Data = req.Data[:c.sigTxMTU-4]
+	}
+	_, err := c.sendResponse(l2cap.SignalEchoResponse, s.id(), &l2cap.EchoResponse{Data: req.Data})
 	return err
 }
 
@@ -305,9 +354,9 @@ func (c *Conn) handleInformationRequest(s sigCmd) error {
 	case l2cap.InfoTypeConnectionlessMTU:
 		rsp.ConnectionlessMTU = uint16(c.txMTU)
 	case l2cap.InfoTypeExtendedFeatures:
-		rsp.ExtendedFeatureMask = c.extendedFeatures
+		rsp.ExtendedFeatureMask = localExtendedFeatures
 	case l2cap.InfoTypeFixedChannels:
-		rsp.FixedChannels = c.fixedChannels
+		rsp.FixedChannels = localFixedChannels
 	default:
 		rsp.Result = l2cap.InfoResponseResultNotSupported
 	}
@@ -355,6 +404,30 @@ func (c *Conn) handleDisconnectRequest(s sigCmd) error {
 		return err
 	}
 
+	if ch := c.channel(req.DestinationCID); ch != nil {
+		// Silently discard the request if SCID failed to find the same match.
+		if req.SourceCID != ch.remoteCID {
+			return nil
+		}
+		_, err := c.sendResponse(l2cap.SignalDisconnectResponse, s.id(),
+			&l2cap.DisconnectResponse{
+				DestinationCID: req.DestinationCID,
+				SourceCID:      req.SourceCID})
+		ch.shutdown()
+		return err
+	}
+	if ch := c.bredrChannel(req.DestinationCID); ch != nil {
+		if req.SourceCID != ch.remoteCID {
+			return nil
+		}
+		_, err := c.sendResponse(l2cap.SignalDisconnectResponse, s.id(),
+			&l2cap.DisconnectResponse{
+				DestinationCID: req.DestinationCID,
+				SourceCID:      req.SourceCID})
+		ch.shutdown()
+		return err
+	}
+
 	// Send Command Reject when the DCID is unrecognized.
 	if req.DestinationCID != cidLEAtt {
 		_, err := c.sendResponse(l2cap.SignalCommandReject, s.id(),
@@ -394,12 +467,12 @@ func (c *Conn) handleConnectionResponse(s sigCmd) error {
 		return nil
 	}
 
-	c.DestinationID = rsp.DestinationCID
-
-	select {
-	case c.sigSent <- s:
-	default:
+	// The remote device may configure the channel as soon as it responds, before DialChannel gets the response.
+	if ch := c.bredrChannel(rsp.SourceCID); ch != nil && rsp.Result == l2cap.ConnectionResultSuccessful {
+		ch.remoteCID = rsp.DestinationCID
 	}
+
+	c.deliverResponse(s)
 	return nil
 }
 
@@ -416,9 +489,14 @@ func (c *Conn) handleConfigurationResponse(s sigCmd) error {
 		return nil
 	}
 
-	select {
-	case c.sigSent <- s:
-	default:
+	// The mode starts as the last response completes the configuration, before the remote device sends I-frames.
+	if ch := c.bredrChannel(rsp.SourceCID); ch != nil &&
+		rsp.Result == l2cap.ConfigurationResultSuccessful && rsp.Flags&0x0001 == 0 {
+		ch.configured(rsp.ConfigurationOptions)
+		ch.open()
+	}
+
+	if !c.deliverResponse(s) {
 		c.hci.log.Debug("Configuration Response error: signal channel buffer full")
 	}
 	return nil
@@ -474,25 +552,11 @@ func (c *Conn) handleLEConnectionUpdateComplete(_ evt.LEConnectionUpdateComplete
 	return err
 }
 
-// LECreditBasedConnectionRequest ...
-func (c *Conn) LECreditBasedConnectionRequest() error {
-	// TODO:
-	return nil
-}
-
-// LEFlowControlCredit ...
-func (c *Conn) LEFlowControlCredit() error {
-	// TODO:
-	return nil
-}
-
 // InformationRequest [Vol 3, Part A, 4.10]
 func (c *Conn) InformationRequest(ctx context.Context, infoType uint16, timeout time.Duration) error {
-	req := &l2cap.InformationRequest{}
-	rsp := &l2cap.InformationResponse{}
-	req.InfoType = infoType
-	if err := c.Signal(ctx, req, rsp, timeout); err != nil {
-		return fmt.Errorf("signal errored: %w", err)
+	rsp, err := c.information(ctx, infoType, timeout)
+	if err != nil {
+		return err
 	}
 
 	switch infoType {
@@ -508,6 +572,26 @@ func (c *Conn) InformationRequest(ctx context.Context, infoType uint16, timeout
 	return nil
 }
 
+// information requests the information of the type, which also sets the extended features and fixed channels of the
+// connection.
+func (c *Conn) information(ctx context.Context, infoType uint16, timeout time.Duration) (*l2cap.InformationResponse,
+	error) {
+	rsp := &l2cap.InformationResponse{}
+	if err := c.Signal(ctx, &l2cap.InformationRequest{InfoType: infoType}, rsp, timeout); err != nil {
+		return nil, fmt.Errorf("signal errored: %w", err)
+	}
+	if rsp.InfoType != infoType {
+		return nil, fmt.Errorf("mismatched information type 0x%04X", rsp.InfoType)
+	}
+	switch infoType {
+	case l2cap.InfoTypeExtendedFeatures:
+		c.extendedFeatures = rsp.ExtendedFeatureMask
+	case l2cap.InfoTypeFixedChannels:
+		c.fixedChannels = rsp.FixedChannels
+	}
+	return rsp, nil
+}
+
 // ConnectionRequest [Vol 3, Part A, 4.2]
 func (c *Conn) ConnectionRequest(ctx context.Context, psm uint16, timeout time.Duration) error {
 	rsp := &l2cap.ConnectionResponse{}
@@ -535,19 +619,26 @@ func (c *Conn) ConnectionRequest(ctx context.Context, psm uint16, timeout time.D
 
 // ConfigurationRequest [Vol 3, Part A, 4.4]
 func (c *Conn) ConfigurationRequest(ctx context.Context, options []l2cap.Option, timeout time.Duration) error {
+	return c.configurationRequest(ctx, c.DestinationID, options, timeout)
+}
+
+// configurationRequest configures the channel with the remote CID dcid.
+func (c *Conn) configurationRequest(ctx context.Context, dcid uint16, options []l2cap.Option,
+	timeout time.Duration) error {
 	i := 0
 
 	rsp := &l2cap.ConfigurationResponse{
 		Flags: 0x0001,
 	}
 	req := &l2cap.ConfigurationRequest{
-		DestinationCID: c.DestinationID,
+		DestinationCID: dcid,
 	}
 
 	// the options need to be split into chunks and sent
 	for i < len(options) || rsp.Flags == 0x0001 {
 
 		// fill the request with options
+		req.ConfigurationOptions = nil
 		length := 0
 		for ; i < len(options); i++ {
 			b, err := options[i].MarshalBinary()
@@ -0,0 +1,325 @@
+package hfp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thomascriley/ble/log"
+)
+
+// AudioGatewayParams are the parameters of the Audio Gateway role.
+type AudioGatewayParams struct {
+	Features AGFeatures
+
+	// Indicators are the indicators of the Audio Gateway with their initial values, DefaultIndicators if nil.
+	Indicators []Indicator
+
+	// CallHold are the call hold and multiparty operations reported with the three-way calling, DefaultCallHold if
+	// nil.
+	CallHold []string
+
+	// Handler handles the commands the service level connection does not consist of, such as ATD, ATA, AT+CHUP,
+	// AT+CHLD=<operation>, AT+CLCC or the AT+CKPD of the headsets. It returns the information result codes to send
+	// before OK, such as the +CLCC of the calls, or the error to send instead: a CMEError is sent as +CME ERROR if
+	// the Hands-Free unit enabled the extended errors, ErrNoCarrier, ErrBusy and ErrNoAnswer as their result codes, and
+	// the other errors as ERROR. The commands are answered with ERROR if nil. It runs on the goroutine reading the
+	// stream, and may set the indicators.
+	Handler func(Command) ([]string, error)
+}
+
+// AudioGateway is the Audio Gateway role over the stream of an RFCOMM DLC to a Hands-Free unit. It answers the
+// commands of the service level connection, and reports the indicators, calls and gains set by the application.
+type AudioGateway struct {
+	log *slog.Logger
+	c   *atConn
+	p   AudioGatewayParams
+
+	mu         sync.Mutex
+	hfFeatures HFFeatures
+	indicators []Indicator
+	inactive   []bool
+	reporting  bool
+	callerID   bool
+	waiting    bool
+	cmee       bool
+
+	connectOnce sync.Once
+	chConnected chan struct{}
+
+	err      error
+	chClosed chan struct{}
+}
+
+// NewAudioGateway returns the Audio Gateway role over the stream, and starts answering the commands of the
+// Hands-Free unit until the stream fails: closing it stops the Audio Gateway role.
+func NewAudioGateway(logger *slog.Logger, rw io.ReadWriter, p AudioGatewayParams) *AudioGateway {
+	if p.Indicators == nil {
+		p.Indicators = DefaultIndicators()
+	}
+	if p.CallHold == nil {
+		p.CallHold = DefaultCallHold
+	}
+	ag := &AudioGateway{
+		log:         logger.With("profile", "hfp", "role", "ag"),
+		c:           newATConn(rw),
+		p:           p,
+		indicators:  append([]Indicator(nil), p.Indicators...),
+		inactive:    make([]bool, len(p.Indicators)),
+		chConnected: make(chan struct{}),
+		chClosed:    make(chan struct{}),
+	}
+	go ag.loop()
+	return ag
+}
+
+// Closed returns a channel closed once the stream failed or was closed.
+func (ag *AudioGateway) Closed() <-chan struct{} { return ag.chClosed }
+
+// Err returns the error the stream failed with, once closed.
+func (ag *AudioGateway) Err() error {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	return ag.err
+}
+
+// Connected returns a channel closed once the Hands-Free unit established the service level connection.
+func (ag *AudioGateway) Connected() <-chan struct{} { return ag.chConnected }
+
+// HFFeatures returns the supported features of the Hands-Free unit, known once connected.
+func (ag *AudioGateway) HFFeatures() HFFeatures {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	return ag.hfFeatures
+}
+
+// Indicator returns the value of the indicator, and whether the Audio Gateway has it.
+func (ag *AudioGateway) Indicator(name string) (int, bool) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	for _, ind := range ag.indicators {
+		if ind.Name == name {
+			return ind.Value, true
+		}
+	}
+	return 0, false
+}
+
+// SetIndicator sets the value of the indicator, and reports it with +CIEV if the Hands-Free unit enabled the
+// indicator events reporting and did not deactivate the indicator.
+func (ag *AudioGateway) SetIndicator(name string, value int) error {
+	ag.mu.Lock()
+	i := -1
+	for j, ind := range ag.indicators {
+		if ind.Name == name {
+			i = j
+		}
+	}
+	if i < 0 {
+		ag.mu.Unlock()
+		return fmt.Errorf("unknown indicator %q", name)
+	}
+	ind := &ag.indicators[i]
+	if value < ind.Min || value > ind.Max {
+		ag.mu.Unlock()
+		return fmt.Errorf("value %d of indicator %q out of range %d-%d", value, name, ind.Min, ind.Max)
+	}
+	changed := ind.Value != value
+	ind.Value = value
+	// The call status indicators can not be deactivated [HFP 4.35].
+	report := ag.reporting && changed && (!ag.inactive[i] || name == IndicatorCall || name == IndicatorCallSetup ||
+		name == IndicatorCallHeld)
+	ag.mu.Unlock()
+	if !report {
+		return nil
+	}
+	return ag.Unsolicited(fmt.Sprintf("+CIEV: %d,%d", i+1, value))
+}
+
+// Ring alerts the Hands-Free unit of the incoming call, followed by the number of the caller if known and the
+// Hands-Free unit enabled the caller ID notifications [HFP 4.13].
+func (ag *AudioGateway) Ring(number string, numberType int) error {
+	if err := ag.Unsolicited("RING"); err != nil {
+		return err
+	}
+	ag.mu.Lock()
+	clip := ag.callerID
+	ag.mu.Unlock()
+	if !clip || number == "" {
+		return nil
+	}
+	return ag.Unsolicited(fmt.Sprintf("+CLIP: %q,%d", number, numberType))
+}
+
+// CallWaiting notifies the Hands-Free unit of the waiting call, if it enabled the call waiting notifications
+// [HFP 4.21].
+func (ag *AudioGateway) CallWaiting(number string, numberType int) error {
+	ag.mu.Lock()
+	ccwa := ag.waiting
+	ag.mu.Unlock()
+	if !ccwa {
+		return nil
+	}
+	return ag.Unsolicited(fmt.Sprintf("+CCWA: %q,%d,1", number, numberType))
+}
+
+// SetSpeakerGain sets the speaker gain of the Hands-Free unit, from 0 to 15 [HFP 4.29].
+func (ag *AudioGateway) SetSpeakerGain(gain int) error {
+	return ag.Unsolicited("+VGS: " + strconv.Itoa(gain))
+}
+
+// SetMicGain sets the microphone gain of the Hands-Free unit, from 0 to 15 [HFP 4.29].
+func (ag *AudioGateway) SetMicGain(gain int) error {
+	return ag.Unsolicited("+VGM: " + strconv.Itoa(gain))
+}
+
+// SetVoiceRecognition reports the voice recognition state of the Audio Gateway [HFP 4.25].
+func (ag *AudioGateway) SetVoiceRecognition(active bool) error {
+	return ag.Unsolicited("+BVRA: " + strconv.Itoa(bitInt(active)))
+}
+
+// SetInBandRing reports whether the Audio Gateway rings in band [HFP 4.14].
+func (ag *AudioGateway) SetInBandRing(inBand bool) error {
+	return ag.Unsolicited("+BSIR: " + strconv.Itoa(bitInt(inBand)))
+}
+
+// Unsolicited sends the unsolicited result code.
+func (ag *AudioGateway) Unsolicited(line string) error {
+	return ag.c.write("\r\n" + line + "\r\n")
+}
+
+// loop answers the commands of the Hands-Free unit until the stream fails.
+func (ag *AudioGateway) loop() {
+	for {
+		line, err := ag.c.readLine()
+		if err != nil {
+			ag.mu.Lock()
+			ag.err = err
+			ag.mu.Unlock()
+			close(ag.chClosed)
+			return
+		}
+		cmd, err := parseCommand(line)
+		if err != nil {
+			ag.log.Debug("invalid command", "line", line, log.Error(err))
+			err = ErrError
+		} else {
+			var info []string
+			info, err = ag.handle(cmd)
+			for _, s := range info {
+				if err := ag.Unsolicited(s); err != nil {
+					ag.log.Debug("unable to send result code", log.Error(err))
+				}
+			}
+		}
+		if err := ag.Unsolicited(ag.finalResult(err)); err != nil {
+			ag.log.Debug("unable to send final result code", log.Error(err))
+		}
+	}
+}
+
+// finalResult returns the final result code of the error.
+func (ag *AudioGateway) finalResult(err error) string {
+	switch {
+	case err == nil:
+		return "OK"
+	case errors.Is(err, ErrNoCarrier):
+		return "NO CARRIER"
+	case errors.Is(err, ErrBusy):
+		return "BUSY"
+	case errors.Is(err, ErrNoAnswer):
+		return "NO ANSWER"
+	}
+	var cme CMEError
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	if ag.cmee && errors.As(err, &cme) {
+		return cme.Error()
+	}
+	return "ERROR"
+}
+
+// handle answers the command, returning its information result codes.
+func (ag *AudioGateway) handle(cmd Command) ([]string, error) {
+	ag.mu.Lock()
+	switch {
+	case cmd.Name == "+BRSF" && cmd.Type == CommandSet:
+		n, err := strconv.ParseUint(firstArg(cmd), 10, 32)
+		if err != nil {
+			ag.mu.Unlock()
+			return nil, ErrError
+		}
+		ag.hfFeatures = HFFeatures(n)
+		ag.mu.Unlock()
+		return []string{"+BRSF: " + strconv.Itoa(int(ag.p.Features))}, nil
+	case cmd.Name == "+BAC" && cmd.Type == CommandSet:
+		ag.mu.Unlock()
+		return nil, nil
+	case cmd.Name == "+CIND" && cmd.Type == CommandTest:
+		ag.mu.Unlock()
+		return []string{"+CIND: " + formatIndicators(ag.p.Indicators)}, nil
+	case cmd.Name == "+CIND" && cmd.Type == CommandRead:
+		values := make([]string, len(ag.indicators))
+		for i, ind := range ag.indicators {
+			values[i] = strconv.Itoa(ind.Value)
+		}
+		ag.mu.Unlock()
+		return []string{"+CIND: " + strings.Join(values, ",")}, nil
+	case cmd.Name == "+CMER" && cmd.Type == CommandSet:
+		// AT+CMER=3,0,0,<ind> enables or disables the indicator events reporting [HFP 4.34.2].
+		if len(cmd.Args) < 4 || cmd.Args[0] != "3" {
+			ag.mu.Unlock()
+			return nil, ErrError
+		}
+		reporting := cmd.Args[3] == "1"
+		ag.reporting = reporting
+		threeWay := ag.hfFeatures&HFThreeWayCalling != 0 && ag.p.Features&AGThreeWayCalling != 0
+		ag.mu.Unlock()
+		if reporting && !threeWay {
+			ag.connectOnce.Do(func() { close(ag.chConnected) })
+		}
+		return nil, nil
+	case cmd.Name == "+CHLD" && cmd.Type == CommandTest:
+		ag.mu.Unlock()
+		ag.connectOnce.Do(func() { close(ag.chConnected) })
+		return []string{"+CHLD: (" + strings.Join(ag.p.CallHold, ",") + ")"}, nil
+	case cmd.Name == "+BIA" && cmd.Type == CommandSet:
+		// Empty values leave the activation of the indicators unchanged [HFP 4.35].
+		for i, v := range cmd.Args {
+			if i < len(ag.inactive) && v != "" {
+				ag.inactive[i] = v == "0"
+			}
+		}
+		ag.mu.Unlock()
+		return nil, nil
+	case cmd.Name == "+CMEE" && cmd.Type == CommandSet:
+		ag.cmee = firstArg(cmd) == "1"
+		ag.mu.Unlock()
+		return nil, nil
+	case cmd.Name == "+CLIP" && cmd.Type == CommandSet:
+		ag.callerID = firstArg(cmd) == "1"
+		ag.mu.Unlock()
+		return nil, nil
+	case cmd.Name == "+CCWA" && cmd.Type == CommandSet:
+		ag.waiting = firstArg(cmd) == "1"
+		ag.mu.Unlock()
+		return nil, nil
+	}
+	ag.mu.Unlock()
+	if ag.p.Handler == nil {
+		return nil, ErrError
+	}
+	return ag.p.Handler(cmd)
+}
+
+// firstArg returns the first value of the command, if any.
+func firstArg(cmd Command) string {
+	if len(cmd.Args) == 0 {
+		return ""
+	}
+	return cmd.Args[0]
+}
@@ -0,0 +1,232 @@
+// Package hfp implements the AT command layer of the Hands-Free Profile, and of the Headset Profile, over an RFCOMM
+// DLC: the service level connection, the indicators, the result codes and the call control of the Audio Gateway and
+// Hands-Free roles [HFP 4]. The audio connections are not handled.
+package hfp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxLineLength bounds the length of the command lines and result codes.
+const maxLineLength = 1024
+
+// ErrError is the ERROR result code of a command [HFP 4.34.2].
+var ErrError = errors.New("error result code")
+
+// ErrClosed is returned once the stream of the AT commands failed or was closed.
+var ErrClosed = errors.New("closed")
+
+// CMEError is the extended audio gateway error result code, +CME ERROR, reported once the extended errors are
+// enabled [HFP 4.34.2].
+type CMEError int
+
+// Extended audio gateway error result codes.
+const (
+	CMEAGFailure             CMEError = 0
+	CMENoConnectionToPhone   CMEError = 1
+	CMEOperationNotAllowed   CMEError = 3
+	CMEOperationNotSupported CMEError = 4
+	CMEPHSIMPINRequired      CMEError = 5
+	CMESIMNotInserted        CMEError = 10
+	CMESIMPINRequired        CMEError = 11
+	CMESIMPUKRequired        CMEError = 12
+	CMESIMFailure            CMEError = 13
+	CMESIMBusy               CMEError = 14
+	CMEIncorrectPassword     CMEError = 16
+	CMESIMPIN2Required       CMEError = 17
+	CMESIMPUK2Required       CMEError = 18
+	CMEMemoryFull            CMEError = 20
+	CMEInvalidIndex          CMEError = 21
+	CMEMemoryFailure         CMEError = 23
+	CMETextStringTooLong     CMEError = 24
+	CMEInvalidCharacters     CMEError = 25
+	CMEDialStringTooLong     CMEError = 26
+	CMEInvalidDialString     CMEError = 27
+	CMENoNetworkService      CMEError = 30
+	CMENetworkTimeout        CMEError = 31
+	CMENetworkNotAllowed     CMEError = 32
+)
+
+func (e CMEError) Error() string { return fmt.Sprintf("+CME ERROR: %d", int(e)) }
+
+// CommandType is the form of an AT command.
+type CommandType uint8
+
+// Forms of the AT commands.
+const (
+	// CommandExec is a command without arguments, such as ATA or AT+CHUP, or a basic command with its arguments,
+	// such as ATD.
+	CommandExec CommandType = iota
+
+	// CommandRead reads the values of a command, AT+CMD?.
+	CommandRead
+
+	// CommandTest reads the values a command supports, AT+CMD=?.
+	CommandTest
+
+	// CommandSet sets the values of a command, AT+CMD=<values>.
+	CommandSet
+)
+
+// Command is an AT command sent by the Hands-Free unit.
+type Command struct {
+	// Name is the name of the command in upper case, such as +BRSF, or the letter of the basic commands, such as A
+	// or D.
+	Name string
+
+	Type CommandType
+
+	// Args are the values of the command, unquoted. The dial string of ATD is its only value, without the trailing
+	// semicolon.
+	Args []string
+}
+
+// parseCommand parses a command line.
+func parseCommand(line string) (Command, error) {
+	if len(line) < 3 || !strings.EqualFold(line[:2], "AT") {
+		return Command{}, fmt.Errorf("invalid command line %q", line)
+	}
+	s := line[2:]
+	if s[0] != '+' {
+		// Basic commands are a letter followed by their arguments [V.250 5.3.1].
+		c := Command{Name: strings.ToUpper(s[:1]), Type: CommandExec}
+		if arg := strings.TrimSuffix(strings.TrimSpace(s[1:]), ";"); arg != "" {
+			c.Args = []string{arg}
+		}
+		return c, nil
+	}
+	i := strings.IndexAny(s, "=?")
+	if i < 0 {
+		return Command{Name: strings.ToUpper(s), Type: CommandExec}, nil
+	}
+	c := Command{Name: strings.ToUpper(s[:i])}
+	switch rest := s[i:]; {
+	case rest == "?":
+		c.Type = CommandRead
+	case rest == "=?":
+		c.Type = CommandTest
+	case rest[0] == '=':
+		c.Type, c.Args = CommandSet, splitValues(rest[1:])
+	default:
+		return Command{}, fmt.Errorf("invalid command line %q", line)
+	}
+	return c, nil
+}
+
+// Int returns the i-th value of the command as an integer.
+func (c Command) Int(i int) (int, error) {
+	if i >= len(c.Args) {
+		return 0, fmt.Errorf("missing value %d of %s", i, c.Name)
+	}
+	return strconv.Atoi(c.Args[i])
+}
+
+// parseResult parses a result code with values, +NAME: <values>. It reports false for the other result codes.
+func parseResult(line string) (string, []string, bool) {
+	if !strings.HasPrefix(line, "+") {
+		return "", nil, false
+	}
+	// Some headsets still use the = of the early versions of HSP, +VGS=<gain>.
+	i := strings.IndexAny(line, ":=")
+	if i < 0 {
+		return "", nil, false
+	}
+	return strings.ToUpper(line[:i]), splitValues(line[i+1:]), true
+}
+
+// splitValues splits the comma separated values, keeping the commas of the quoted strings and of the parenthesized
+// lists. The quoted strings are unquoted.
+func splitValues(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	var values []string
+	var quoted bool
+	var depth, start int
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch c := s[i]; {
+			case c == '"':
+				quoted = !quoted
+				continue
+			case quoted:
+				continue
+			case c == '(':
+				depth++
+				continue
+			case c == ')':
+				depth--
+				continue
+			case c != ',' || depth > 0:
+				continue
+			}
+		}
+		v := strings.TrimSpace(s[start:i])
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = v[1 : len(v)-1]
+		}
+		values = append(values, v)
+		start = i + 1
+	}
+	return values
+}
+
+// unparenthesize returns the values of a parenthesized list, (<value>,<value>).
+func unparenthesize(s string) []string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '(' && s[len(s)-1] == ')' {
+		s = s[1 : len(s)-1]
+	}
+	return splitValues(s)
+}
+
+// atConn reads the lines of the remote device, and writes those of the local device.
+type atConn struct {
+	w io.Writer
+	r *bufio.Reader
+
+	// mu serializes the writes, so that the lines are not interleaved.
+	mu sync.Mutex
+}
+
+func newATConn(rw io.ReadWriter) *atConn {
+	return &atConn{w: rw, r: bufio.NewReader(rw)}
+}
+
+// readLine returns the next line that is not empty, without its terminating carriage return or line feed.
+func (c *atConn) readLine() (string, error) {
+	var b []byte
+	for {
+		ch, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case ch == '\r' || ch == '\n':
+			if len(b) > 0 {
+				return string(b), nil
+			}
+		case len(b) >= maxLineLength:
+			return "", fmt.Errorf("line exceeds %d bytes", maxLineLength)
+		default:
+			b = append(b, ch)
+		}
+	}
+}
+
+// write writes the lines as one write.
+func (c *atConn) write(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := io.WriteString(c.w, s); err != nil {
+		return fmt.Errorf("unable to write %q: %w", strings.TrimSpace(s), err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package hfp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		cmd  Command
+	}{
+		{"AT+BRSF=191", Command{Name: "+BRSF", Type: CommandSet, Args: []string{"191"}}},
+		{"AT+CIND=?", Command{Name: "+CIND", Type: CommandTest}},
+		{"at+cind?", Command{Name: "+CIND", Type: CommandRead}},
+		{"AT+CMER=3,0,0,1", Command{Name: "+CMER", Type: CommandSet, Args: []string{"3", "0", "0", "1"}}},
+		{"AT+CHUP", Command{Name: "+CHUP", Type: CommandExec}},
+		{"ATA", Command{Name: "A", Type: CommandExec}},
+		{"ATD+15551234567;", Command{Name: "D", Type: CommandExec, Args: []string{"+15551234567"}}},
+		{"ATD>3;", Command{Name: "D", Type: CommandExec, Args: []string{">3"}}},
+		{"AT+BIA=,1,0", Command{Name: "+BIA", Type: CommandSet, Args: []string{"", "1", "0"}}},
+	}
+	for _, tt := range tests {
+		cmd, err := parseCommand(tt.line)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %s", tt.line, err)
+		}
+		if !reflect.DeepEqual(cmd, tt.cmd) {
+			t.Fatalf("Expected: %+v, Received: %+v", tt.cmd, cmd)
+		}
+	}
+	for _, line := range []string{"A", "+BRSF=1", "AT+CIND?x"} {
+		if _, err := parseCommand(line); err == nil {
+			t.Fatalf("Expected an error for %q", line)
+		}
+	}
+}
+
+func TestParseIndicators(t *testing.T) {
+	name, values, ok := parseResult(`+CIND: ("service",(0,1)),("call",(0,1)),("callsetup",(0-3)),("battchg",(0-5))`)
+	if !ok || name != "+CIND" {
+		t.Fatalf("Expected: +CIND, Received: %s", name)
+	}
+	inds, err := parseIndicators(values)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	exp := []Indicator{{Name: "service", Max: 1}, {Name: "call", Max: 1}, {Name: "callsetup", Max: 3},
+		{Name: "battchg", Max: 5}}
+	if !reflect.DeepEqual(inds, exp) {
+		t.Fatalf("Expected: %+v, Received: %+v", exp, inds)
+	}
+	if _, values, _ = parseResult("+CIND: " + formatIndicators(exp)); !reflect.DeepEqual(splitValues(
+		formatIndicators(exp)), values) {
+		t.Fatalf("Expected: %q, Received: %q", splitValues(formatIndicators(exp)), values)
+	}
+
+	if _, values, _ = parseResult(`+CLIP: "+1 (555), 123",145`); !reflect.DeepEqual(values,
+		[]string{"+1 (555), 123", "145"}) {
+		t.Fatalf("Expected the quoted number, Received: %q", values)
+	}
+	if name, values, _ = parseResult("+VGS=7"); name != "+VGS" || !reflect.DeepEqual(values, []string{"7"}) {
+		t.Fatalf("Expected: +VGS 7, Received: %s %q", name, values)
+	}
+}
+
+func TestCallResultCode(t *testing.T) {
+	c := Call{Index: 2, Outgoing: true, Status: CallAlerting, Number: "5551234", NumberType: NumberTypeUnknown}
+	s := c.ResultCode()
+	if s != `+CLCC: 2,1,3,0,0,"5551234",129` {
+		t.Fatalf("Expected: %s, Received: %s", `+CLCC: 2,1,3,0,0,"5551234",129`, s)
+	}
+	_, values, _ := parseResult(s)
+	got, err := parseCall(values)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if got != c {
+		t.Fatalf("Expected: %+v, Received: %+v", c, got)
+	}
+}
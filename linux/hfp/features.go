@@ -0,0 +1,228 @@
+package hfp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HFFeatures are the supported features of the Hands-Free unit, exchanged with AT+BRSF [HFP 4.34.2].
+type HFFeatures uint32
+
+// Supported features of the Hands-Free unit.
+const (
+	HFEchoCancelling HFFeatures = 1 << iota
+	HFThreeWayCalling
+	HFCallerID
+	HFVoiceRecognition
+	HFRemoteVolume
+	HFEnhancedCallStatus
+	HFEnhancedCallControl
+	HFCodecNegotiation
+	HFIndicators
+	HFESCOS4
+)
+
+// AGFeatures are the supported features of the Audio Gateway, exchanged with +BRSF [HFP 4.34.2].
+type AGFeatures uint32
+
+// Supported features of the Audio Gateway.
+const (
+	AGThreeWayCalling AGFeatures = 1 << iota
+	AGEchoCancelling
+	AGVoiceRecognition
+	AGInBandRing
+	AGVoiceTag
+	AGRejectCall
+	AGEnhancedCallStatus
+	AGEnhancedCallControl
+	AGExtendedErrors
+	AGCodecNegotiation
+	AGHFIndicators
+	AGESCOS4
+)
+
+// Names of the indicators of the Audio Gateway [HFP 4.34.2].
+const (
+	IndicatorService   = "service"
+	IndicatorCall      = "call"
+	IndicatorCallSetup = "callsetup"
+	IndicatorCallHeld  = "callheld"
+	IndicatorSignal    = "signal"
+	IndicatorRoam      = "roam"
+	IndicatorBattery   = "battchg"
+)
+
+// Values of the callsetup indicator.
+const (
+	CallSetupNone = iota
+	CallSetupIncoming
+	CallSetupOutgoing
+	CallSetupAlerting
+)
+
+// Values of the callheld indicator.
+const (
+	CallHeldNone = iota
+	CallHeldActive
+	CallHeldOnly
+)
+
+// Indicator is an indicator of the Audio Gateway, reported with +CIEV once the Hands-Free unit enabled the indicator
+// events reporting.
+type Indicator struct {
+	Name  string
+	Min   int
+	Max   int
+	Value int
+}
+
+// DefaultIndicators returns the indicators of the Audio Gateways, in the order HFP lists them.
+func DefaultIndicators() []Indicator {
+	return []Indicator{
+		{Name: IndicatorService, Max: 1},
+		{Name: IndicatorCall, Max: 1},
+		{Name: IndicatorCallSetup, Max: 3},
+		{Name: IndicatorCallHeld, Max: 2},
+		{Name: IndicatorSignal, Max: 5},
+		{Name: IndicatorRoam, Max: 1},
+		{Name: IndicatorBattery, Max: 5},
+	}
+}
+
+// formatIndicators returns the values of the +CIND response to AT+CIND=?, ("service",(0,1)),("signal",(0-5))...
+func formatIndicators(inds []Indicator) string {
+	s := make([]string, len(inds))
+	for i, ind := range inds {
+		r := fmt.Sprintf("%d-%d", ind.Min, ind.Max)
+		if ind.Max == ind.Min+1 {
+			r = fmt.Sprintf("%d,%d", ind.Min, ind.Max)
+		}
+		s[i] = fmt.Sprintf("(%q,(%s))", ind.Name, r)
+	}
+	return strings.Join(s, ",")
+}
+
+// parseIndicators parses the values of the +CIND response to AT+CIND=?.
+func parseIndicators(values []string) ([]Indicator, error) {
+	inds := make([]Indicator, 0, len(values))
+	for _, v := range values {
+		fields := unparenthesize(v)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid indicator %q", v)
+		}
+		ind := Indicator{Name: fields[0]}
+		bounds := strings.FieldsFunc(strings.Trim(fields[1], "()"), func(r rune) bool { return r == ',' || r == '-' })
+		if len(bounds) == 0 {
+			return nil, fmt.Errorf("invalid range of indicator %q", ind.Name)
+		}
+		var err error
+		if ind.Min, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err != nil {
+			return nil, fmt.Errorf("invalid range of indicator %q: %w", ind.Name, err)
+		}
+		if ind.Max, err = strconv.Atoi(strings.TrimSpace(bounds[len(bounds)-1])); err != nil {
+			return nil, fmt.Errorf("invalid range of indicator %q: %w", ind.Name, err)
+		}
+		inds = append(inds, ind)
+	}
+	return inds, nil
+}
+
+// HoldOperation is an operation of the call hold and multiparty services, AT+CHLD [HFP 4.22].
+type HoldOperation uint8
+
+// Call hold and multiparty operations.
+const (
+	// HoldReleaseHeld releases the held calls, or rejects the waiting call.
+	HoldReleaseHeld HoldOperation = iota
+
+	// HoldReleaseActive releases the active calls, or the call of the index, and accepts the other call.
+	HoldReleaseActive
+
+	// HoldSwap places the active calls on hold, or all but the call of the index, and accepts the other call.
+	HoldSwap
+
+	// HoldConference adds the held call to the conversation.
+	HoldConference
+
+	// HoldTransfer connects the two calls and disconnects the subscriber from both, the explicit call transfer.
+	HoldTransfer
+)
+
+// DefaultCallHold are the call hold and multiparty operations of the Audio Gateways, as reported by +CHLD.
+var DefaultCallHold = []string{"0", "1", "1x", "2", "2x", "3", "4"}
+
+// CallStatus is the state of a call listed by AT+CLCC.
+type CallStatus uint8
+
+// States of the calls.
+const (
+	CallActive CallStatus = iota
+	CallHeld
+	CallDialing
+	CallAlerting
+	CallIncoming
+	CallWaiting
+)
+
+// Call is a call of the Audio Gateway, listed by AT+CLCC [HFP 4.31].
+type Call struct {
+	// Index is the index of the call, from 1, used by the call hold operations.
+	Index int
+
+	Outgoing   bool
+	Status     CallStatus
+	Multiparty bool
+
+	// Mode is the bearer of the call, 0 for voice.
+	Mode int
+
+	// Number is the phone number of the call, and NumberType its format, if known.
+	Number     string
+	NumberType int
+}
+
+// ResultCode returns the +CLCC result code of the call, which Audio Gateways answer AT+CLCC with.
+func (c Call) ResultCode() string {
+	s := fmt.Sprintf("+CLCC: %d,%d,%d,%d,%d", c.Index, bitInt(c.Outgoing), c.Status, c.Mode, bitInt(c.Multiparty))
+	if c.Number != "" {
+		s += fmt.Sprintf(",%q,%d", c.Number, c.NumberType)
+	}
+	return s
+}
+
+// parseCall parses the values of a +CLCC result code.
+func parseCall(values []string) (Call, error) {
+	if len(values) < 5 {
+		return Call{}, fmt.Errorf("invalid +CLCC values %q", values)
+	}
+	ints := make([]int, 5)
+	for i := range ints {
+		n, err := strconv.Atoi(values[i])
+		if err != nil {
+			return Call{}, fmt.Errorf("invalid +CLCC values %q: %w", values, err)
+		}
+		ints[i] = n
+	}
+	c := Call{Index: ints[0], Outgoing: ints[1] == 1, Status: CallStatus(ints[2]), Mode: ints[3],
+		Multiparty: ints[4] == 1}
+	if len(values) >= 7 {
+		c.Number = values[5]
+		c.NumberType, _ = strconv.Atoi(values[6])
+	}
+	return c, nil
+}
+
+// Types of the phone numbers [3GPP TS 24.008, 10.5.4.7].
+const (
+	NumberTypeUnknown       = 129
+	NumberTypeInternational = 145
+)
+
+// bitInt returns 1 if b is set.
+func bitInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,508 @@
+package hfp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thomascriley/ble/log"
+)
+
+// Final result codes of the dial commands, which fail as ERROR does.
+var (
+	ErrNoCarrier = errors.New("no carrier")
+	ErrBusy      = errors.New("busy")
+	ErrNoAnswer  = errors.New("no answer")
+)
+
+// EventKind is the kind of an unsolicited result code of the Audio Gateway.
+type EventKind uint8
+
+// Kinds of the unsolicited result codes.
+const (
+	// EventRing reports an incoming call, RING.
+	EventRing EventKind = iota
+
+	// EventIndicator reports the change of an indicator, +CIEV.
+	EventIndicator
+
+	// EventCallerID reports the number of the incoming call, +CLIP.
+	EventCallerID
+
+	// EventCallWaiting reports the number of the waiting call, +CCWA.
+	EventCallWaiting
+
+	// EventSpeakerGain and EventMicGain report the gains set by the Audio Gateway, +VGS and +VGM.
+	EventSpeakerGain
+	EventMicGain
+
+	// EventVoiceRecognition reports the voice recognition state, +BVRA.
+	EventVoiceRecognition
+
+	// EventInBandRing reports whether the Audio Gateway rings in band, +BSIR.
+	EventInBandRing
+
+	// EventUnsolicited reports any other unsolicited result code.
+	EventUnsolicited
+)
+
+// Event is an unsolicited result code of the Audio Gateway.
+type Event struct {
+	Kind EventKind
+
+	// Indicator is the name of the indicator of EventIndicator.
+	Indicator string
+
+	// Value is the value of the indicator, the gain, or the state of EventVoiceRecognition and EventInBandRing.
+	Value int
+
+	// Number is the phone number of EventCallerID and EventCallWaiting, and NumberType its format.
+	Number     string
+	NumberType int
+
+	// Line is the result code.
+	Line string
+}
+
+// HandsFree is the Hands-Free role, or the headset role of HSP, over the stream of an RFCOMM DLC to an Audio Gateway.
+// The commands are sent one at a time, waiting for their final result code.
+type HandsFree struct {
+	log      *slog.Logger
+	c        *atConn
+	features HFFeatures
+
+	// muCmd serializes the commands.
+	muCmd sync.Mutex
+
+	mu         sync.Mutex
+	pending    *pendingCommand
+	agFeatures AGFeatures
+	indicators []Indicator
+	callHold   []string
+	handler    func(Event)
+
+	connectOnce sync.Once
+	chConnected chan struct{}
+
+	err      error
+	chClosed chan struct{}
+}
+
+// pendingCommand is a command waiting for its final result code.
+type pendingCommand struct {
+	// prefix is the name of the information result codes of the command, if it has some.
+	prefix string
+	info   [][]string
+	done   chan error
+}
+
+// NewHandsFree returns the Hands-Free role over the stream, and starts reading the result codes of the Audio Gateway
+// until the stream fails: closing it stops the Hands-Free role. The service level connection is established with
+// Connect, the headsets of HSP do without it.
+func NewHandsFree(logger *slog.Logger, rw io.ReadWriter, features HFFeatures) *HandsFree {
+	hf := &HandsFree{
+		log:         logger.With("profile", "hfp", "role", "hf"),
+		c:           newATConn(rw),
+		features:    features,
+		chConnected: make(chan struct{}),
+		chClosed:    make(chan struct{}),
+	}
+	go hf.loop()
+	return hf
+}
+
+// Closed returns a channel closed once the stream failed or was closed.
+func (hf *HandsFree) Closed() <-chan struct{} { return hf.chClosed }
+
+// Err returns the error the stream failed with, once closed.
+func (hf *HandsFree) Err() error {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	return hf.err
+}
+
+// Connected returns a channel closed once the service level connection is established.
+func (hf *HandsFree) Connected() <-chan struct{} { return hf.chConnected }
+
+// SetEventHandler sets the handler of the unsolicited result codes of the Audio Gateway. It runs on the goroutine
+// reading the stream, and must not block nor send commands.
+func (hf *HandsFree) SetEventHandler(f func(Event)) {
+	hf.mu.Lock()
+	hf.handler = f
+	hf.mu.Unlock()
+}
+
+// AGFeatures returns the supported features of the Audio Gateway, known once connected.
+func (hf *HandsFree) AGFeatures() AGFeatures {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	return hf.agFeatures
+}
+
+// Indicators returns the indicators of the Audio Gateway, known once connected, with their current values.
+func (hf *HandsFree) Indicators() []Indicator {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	return append([]Indicator(nil), hf.indicators...)
+}
+
+// Indicator returns the value of the indicator of the Audio Gateway, and whether the Audio Gateway has it.
+func (hf *HandsFree) Indicator(name string) (int, bool) {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	for _, ind := range hf.indicators {
+		if ind.Name == name {
+			return ind.Value, true
+		}
+	}
+	return 0, false
+}
+
+// CallHoldOperations returns the call hold and multiparty operations the Audio Gateway supports, such as "1" or
+// "2x", known once connected if both devices support the three-way calling.
+func (hf *HandsFree) CallHoldOperations() []string {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	return append([]string(nil), hf.callHold...)
+}
+
+// Connect establishes the service level connection: it exchanges the supported features, reads the indicators of
+// the Audio Gateway, enables their events reporting and, if both devices support the three-way calling, reads the
+// call hold operations [HFP 4.2.1].
+func (hf *HandsFree) Connect(ctx context.Context) error {
+	info, err := hf.Command(ctx, "+BRSF="+strconv.Itoa(int(hf.features)), "+BRSF")
+	if err != nil {
+		return fmt.Errorf("unable to exchange supported features: %w", err)
+	}
+	if len(info) != 1 || len(info[0]) != 1 {
+		return fmt.Errorf("invalid +BRSF response %q", info)
+	}
+	ag, err := strconv.ParseUint(info[0][0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid +BRSF response: %w", err)
+	}
+	agFeatures := AGFeatures(ag)
+	hf.mu.Lock()
+	hf.agFeatures = agFeatures
+	hf.mu.Unlock()
+
+	if hf.features&HFCodecNegotiation != 0 && agFeatures&AGCodecNegotiation != 0 {
+		// CVSD is the codec every device supports.
+		if _, err = hf.Command(ctx, "+BAC=1", ""); err != nil {
+			return fmt.Errorf("unable to send available codecs: %w", err)
+		}
+	}
+
+	if info, err = hf.Command(ctx, "+CIND=?", "+CIND"); err != nil {
+		return fmt.Errorf("unable to read supported indicators: %w", err)
+	}
+	if len(info) != 1 {
+		return fmt.Errorf("invalid +CIND response %q", info)
+	}
+	inds, err := parseIndicators(info[0])
+	if err != nil {
+		return err
+	}
+	if info, err = hf.Command(ctx, "+CIND?", "+CIND"); err != nil {
+		return fmt.Errorf("unable to read indicators: %w", err)
+	}
+	if len(info) != 1 || len(info[0]) != len(inds) {
+		return fmt.Errorf("invalid +CIND response %q", info)
+	}
+	for i, v := range info[0] {
+		if inds[i].Value, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid +CIND response: %w", err)
+		}
+	}
+	hf.mu.Lock()
+	hf.indicators = inds
+	hf.mu.Unlock()
+
+	if _, err = hf.Command(ctx, "+CMER=3,0,0,1", ""); err != nil {
+		return fmt.Errorf("unable to enable indicator events reporting: %w", err)
+	}
+
+	if hf.features&HFThreeWayCalling != 0 && agFeatures&AGThreeWayCalling != 0 {
+		if info, err = hf.Command(ctx, "+CHLD=?", "+CHLD"); err != nil {
+			return fmt.Errorf("unable to read call hold operations: %w", err)
+		}
+		if len(info) != 1 || len(info[0]) != 1 {
+			return fmt.Errorf("invalid +CHLD response %q", info)
+		}
+		hf.mu.Lock()
+		hf.callHold = unparenthesize(info[0][0])
+		hf.mu.Unlock()
+	}
+	hf.connectOnce.Do(func() { close(hf.chConnected) })
+	return nil
+}
+
+// Command sends the AT command, such as "+CLCC" for AT+CLCC, and waits for its final result code. It returns the
+// values of the information result codes named prefix, such as "+CLCC", received meanwhile.
+func (hf *HandsFree) Command(ctx context.Context, cmd string, prefix string) ([][]string, error) {
+	hf.muCmd.Lock()
+	defer hf.muCmd.Unlock()
+
+	p := &pendingCommand{prefix: strings.ToUpper(prefix), done: make(chan error, 1)}
+	hf.mu.Lock()
+	hf.pending = p
+	hf.mu.Unlock()
+	defer func() {
+		hf.mu.Lock()
+		hf.pending = nil
+		hf.mu.Unlock()
+	}()
+
+	if err := hf.c.write("AT" + cmd + "\r"); err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-p.done:
+		hf.mu.Lock()
+		defer hf.mu.Unlock()
+		return p.info, err
+	case <-hf.chClosed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Dial places a call to the number [HFP 4.18].
+func (hf *HandsFree) Dial(ctx context.Context, number string) error {
+	_, err := hf.Command(ctx, "D"+number+";", "")
+	return err
+}
+
+// DialMemory places a call to the number stored at the memory location of the Audio Gateway [HFP 4.19].
+func (hf *HandsFree) DialMemory(ctx context.Context, location int) error {
+	_, err := hf.Command(ctx, "D>"+strconv.Itoa(location)+";", "")
+	return err
+}
+
+// Redial places a call to the last number dialed [HFP 4.20].
+func (hf *HandsFree) Redial(ctx context.Context) error {
+	_, err := hf.Command(ctx, "+BLDN", "")
+	return err
+}
+
+// Answer accepts the incoming call [HFP 4.13].
+func (hf *HandsFree) Answer(ctx context.Context) error {
+	_, err := hf.Command(ctx, "A", "")
+	return err
+}
+
+// HangUp rejects the incoming call, or terminates the ongoing one [HFP 4.14, 4.15].
+func (hf *HandsFree) HangUp(ctx context.Context) error {
+	_, err := hf.Command(ctx, "+CHUP", "")
+	return err
+}
+
+// CallHold performs the call hold or multiparty operation, on the call of the index if it is not 0 [HFP 4.22].
+func (hf *HandsFree) CallHold(ctx context.Context, op HoldOperation, index int) error {
+	cmd := "+CHLD=" + strconv.Itoa(int(op))
+	if index > 0 {
+		cmd += strconv.Itoa(index)
+	}
+	_, err := hf.Command(ctx, cmd, "")
+	return err
+}
+
+// SendDTMF sends the DTMF code, 0-9, *, # or A-D, during a call [HFP 4.28].
+func (hf *HandsFree) SendDTMF(ctx context.Context, code byte) error {
+	_, err := hf.Command(ctx, "+VTS="+string(code), "")
+	return err
+}
+
+// SetSpeakerGain reports the speaker gain of the Hands-Free unit, from 0 to 15 [HFP 4.29].
+func (hf *HandsFree) SetSpeakerGain(ctx context.Context, gain int) error {
+	_, err := hf.Command(ctx, "+VGS="+strconv.Itoa(gain), "")
+	return err
+}
+
+// SetMicGain reports the microphone gain of the Hands-Free unit, from 0 to 15 [HFP 4.29].
+func (hf *HandsFree) SetMicGain(ctx context.Context, gain int) error {
+	_, err := hf.Command(ctx, "+VGM="+strconv.Itoa(gain), "")
+	return err
+}
+
+// SetCallerID enables or disables the +CLIP result codes of the incoming calls [HFP 4.23].
+func (hf *HandsFree) SetCallerID(ctx context.Context, enable bool) error {
+	_, err := hf.Command(ctx, "+CLIP="+strconv.Itoa(bitInt(enable)), "")
+	return err
+}
+
+// SetCallWaiting enables or disables the +CCWA result codes of the waiting calls [HFP 4.21].
+func (hf *HandsFree) SetCallWaiting(ctx context.Context, enable bool) error {
+	_, err := hf.Command(ctx, "+CCWA="+strconv.Itoa(bitInt(enable)), "")
+	return err
+}
+
+// SetExtendedErrors enables or disables the +CME ERROR result codes [HFP 4.34.2].
+func (hf *HandsFree) SetExtendedErrors(ctx context.Context, enable bool) error {
+	_, err := hf.Command(ctx, "+CMEE="+strconv.Itoa(bitInt(enable)), "")
+	return err
+}
+
+// SetVoiceRecognition activates or deactivates the voice recognition of the Audio Gateway [HFP 4.25].
+func (hf *HandsFree) SetVoiceRecognition(ctx context.Context, enable bool) error {
+	_, err := hf.Command(ctx, "+BVRA="+strconv.Itoa(bitInt(enable)), "")
+	return err
+}
+
+// DisableEchoCancelling disables the echo cancelling and noise reduction of the Audio Gateway [HFP 4.24].
+func (hf *HandsFree) DisableEchoCancelling(ctx context.Context) error {
+	_, err := hf.Command(ctx, "+NREC=0", "")
+	return err
+}
+
+// CurrentCalls lists the calls of the Audio Gateway [HFP 4.31].
+func (hf *HandsFree) CurrentCalls(ctx context.Context) ([]Call, error) {
+	info, err := hf.Command(ctx, "+CLCC", "+CLCC")
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]Call, 0, len(info))
+	for _, values := range info {
+		c, err := parseCall(values)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, c)
+	}
+	return calls, nil
+}
+
+// PressButton sends the button press of the headsets of HSP, AT+CKPD=200 [HSP 4.2].
+func (hf *HandsFree) PressButton(ctx context.Context) error {
+	_, err := hf.Command(ctx, "+CKPD=200", "")
+	return err
+}
+
+// loop reads the result codes of the Audio Gateway until the stream fails.
+func (hf *HandsFree) loop() {
+	for {
+		line, err := hf.c.readLine()
+		if err != nil {
+			hf.mu.Lock()
+			hf.err = err
+			hf.mu.Unlock()
+			close(hf.chClosed)
+			return
+		}
+		hf.receive(line)
+	}
+}
+
+// receive handles a result code of the Audio Gateway.
+func (hf *HandsFree) receive(line string) {
+	hf.mu.Lock()
+	if p := hf.pending; p != nil {
+		if final, err := finalResult(line); final {
+			hf.pending = nil
+			hf.mu.Unlock()
+			p.done <- err
+			return
+		}
+		if name, values, ok := parseResult(line); ok && p.prefix != "" && name == p.prefix {
+			p.info = append(p.info, values)
+			hf.mu.Unlock()
+			return
+		}
+	}
+	e, ok := hf.event(line)
+	f := hf.handler
+	hf.mu.Unlock()
+	if ok && f != nil {
+		f(e)
+	}
+}
+
+// finalResult reports whether the line is a final result code, and returns its error.
+func finalResult(line string) (bool, error) {
+	switch line {
+	case "OK":
+		return true, nil
+	case "ERROR":
+		return true, ErrError
+	case "NO CARRIER":
+		return true, ErrNoCarrier
+	case "BUSY":
+		return true, ErrBusy
+	case "NO ANSWER":
+		return true, ErrNoAnswer
+	}
+	if s, ok := strings.CutPrefix(line, "+CME ERROR:"); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return true, ErrError
+		}
+		return true, CMEError(n)
+	}
+	return false, nil
+}
+
+// event returns the event of the unsolicited result code, updating the indicators. It is called with hf.mu held.
+func (hf *HandsFree) event(line string) (Event, bool) {
+	e := Event{Kind: EventUnsolicited, Line: line}
+	if line == "RING" {
+		e.Kind = EventRing
+		return e, true
+	}
+	name, values, ok := parseResult(line)
+	if !ok {
+		if final, _ := finalResult(line); final {
+			// The final result code of a command whose context is done.
+			hf.log.Debug("dropped result code", "line", line)
+			return e, false
+		}
+		return e, true
+	}
+	var value int
+	if len(values) > 0 {
+		value, _ = strconv.Atoi(values[0])
+	}
+	switch name {
+	case "+CIEV":
+		if len(values) < 2 {
+			return e, true
+		}
+		i, err := strconv.Atoi(values[0])
+		if err != nil || i < 1 || i > len(hf.indicators) {
+			hf.log.Debug("dropped unknown indicator", "line", line)
+			return e, false
+		}
+		v, err := strconv.Atoi(values[1])
+		if err != nil {
+			hf.log.Debug("dropped invalid indicator", "line", line, log.Error(err))
+			return e, false
+		}
+		hf.indicators[i-1].Value = v
+		e.Kind, e.Indicator, e.Value = EventIndicator, hf.indicators[i-1].Name, v
+	case "+CLIP", "+CCWA":
+		e.Kind = EventCallerID
+		if name == "+CCWA" {
+			e.Kind = EventCallWaiting
+		}
+		if len(values) > 0 {
+			e.Number = values[0]
+		}
+		if len(values) > 1 {
+			e.NumberType, _ = strconv.Atoi(values[1])
+		}
+	case "+VGS":
+		e.Kind, e.Value = EventSpeakerGain, value
+	case "+VGM":
+		e.Kind, e.Value = EventMicGain, value
+	case "+BVRA":
+		e.Kind, e.Value = EventVoiceRecognition, value
+	case "+BSIR":
+		e.Kind, e.Value = EventInBandRing, value
+	}
+	return e, true
+}
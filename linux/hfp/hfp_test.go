@@ -0,0 +1,262 @@
+package hfp
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedPeer is a scripted Audio Gateway, answering the commands of the Hands-Free unit with the result codes of
+// the script.
+type scriptedPeer struct {
+	t *testing.T
+	c net.Conn
+	r *bufio.Reader
+}
+
+// expect reads the command line, and answers it with the result codes.
+func (p *scriptedPeer) expect(cmd string, results ...string) {
+	p.t.Helper()
+	_ = p.c.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := p.r.ReadString('\r')
+	if err != nil {
+		p.t.Fatalf("Error reading %s: %s", cmd, err)
+	}
+	if line = strings.TrimSpace(line); line != cmd {
+		p.t.Fatalf("Expected: %s, Received: %s", cmd, line)
+	}
+	p.send(results...)
+}
+
+// send sends the result codes.
+func (p *scriptedPeer) send(results ...string) {
+	p.t.Helper()
+	for _, s := range results {
+		if _, err := p.c.Write([]byte("\r\n" + s + "\r\n")); err != nil {
+			p.t.Fatalf("Error writing %s: %s", s, err)
+		}
+	}
+}
+
+// run runs f, returning a channel receiving its error.
+func run(f func() error) <-chan error {
+	ch := make(chan error, 1)
+	go func() { ch <- f() }()
+	return ch
+}
+
+func wait(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the command")
+	}
+	return nil
+}
+
+func TestHandsFreeScripted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	ag := &scriptedPeer{t: t, c: remote, r: bufio.NewReader(remote)}
+
+	hf := NewHandsFree(slog.Default(), local, HFThreeWayCalling|HFCallerID|HFRemoteVolume)
+	events := make(chan Event, 8)
+	hf.SetEventHandler(func(e Event) { events <- e })
+
+	done := run(func() error { return hf.Connect(ctx) })
+	ag.expect("AT+BRSF=22", "+BRSF: 1", "OK")
+	ag.expect("AT+CIND=?", `+CIND: ("call",(0,1)),("callsetup",(0-3)),("service",(0,1)),("signal",(0-5))`, "OK")
+	// An unsolicited result code between the information result codes of a command is not one of them.
+	ag.expect("AT+CIND?", "RING", "+CIND: 0,0,1,4", "OK")
+	ag.expect("AT+CMER=3,0,0,1", "OK")
+	ag.expect("AT+CHLD=?", "+CHLD: (0,1,2,3)", "OK")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	if e := <-events; e.Kind != EventRing {
+		t.Fatalf("Expected: RING, Received: %+v", e)
+	}
+	if v, ok := hf.Indicator(IndicatorSignal); !ok || v != 4 {
+		t.Fatalf("Expected: signal 4, Received: %d", v)
+	}
+	if ops := hf.CallHoldOperations(); !reflect.DeepEqual(ops, []string{"0", "1", "2", "3"}) {
+		t.Fatalf("Expected: %q, Received: %q", []string{"0", "1", "2", "3"}, ops)
+	}
+
+	// The indicators track the events.
+	ag.send("+CIEV: 2,1", "RING", `+CLIP: "5551234",129`, "+VGS: 9")
+	for _, exp := range []Event{
+		{Kind: EventIndicator, Indicator: IndicatorCallSetup, Value: 1, Line: "+CIEV: 2,1"},
+		{Kind: EventRing, Line: "RING"},
+		{Kind: EventCallerID, Number: "5551234", NumberType: 129, Line: `+CLIP: "5551234",129`},
+		{Kind: EventSpeakerGain, Value: 9, Line: "+VGS: 9"},
+	} {
+		select {
+		case e := <-events:
+			if e != exp {
+				t.Fatalf("Expected: %+v, Received: %+v", exp, e)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for an event")
+		}
+	}
+	if v, _ := hf.Indicator(IndicatorCallSetup); v != CallSetupIncoming {
+		t.Fatalf("Expected: callsetup %d, Received: %d", CallSetupIncoming, v)
+	}
+
+	done = run(func() error { return hf.Answer(ctx) })
+	ag.expect("ATA", "OK")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Error answering: %s", err)
+	}
+	done = run(func() error { return hf.CallHold(ctx, HoldSwap, 2) })
+	ag.expect("AT+CHLD=22", "+CME ERROR: 3")
+	if err := wait(t, done); err != CMEOperationNotAllowed {
+		t.Fatalf("Expected: %s, Received: %v", CMEOperationNotAllowed, err)
+	}
+	done = run(func() error { return hf.Dial(ctx, "5551234") })
+	ag.expect("ATD5551234;", "BUSY")
+	if err := wait(t, done); err != ErrBusy {
+		t.Fatalf("Expected: %s, Received: %v", ErrBusy, err)
+	}
+
+	// The commands fail once the stream is closed.
+	_ = remote.Close()
+	select {
+	case <-hf.Closed():
+	case <-ctx.Done():
+		t.Fatalf("Timed out waiting for the stream to close")
+	}
+	if err := hf.HangUp(ctx); err == nil {
+		t.Fatalf("Expected an error once the stream is closed")
+	}
+}
+
+func TestAudioGateway(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	calls := []Call{{Index: 1, Status: CallActive, Number: "5551234", NumberType: NumberTypeUnknown},
+		{Index: 2, Status: CallWaiting, Number: "5559876", NumberType: NumberTypeUnknown}}
+	var ag *AudioGateway
+	ag = NewAudioGateway(slog.Default(), local, AudioGatewayParams{
+		Features: AGThreeWayCalling | AGInBandRing | AGExtendedErrors,
+		Handler: func(cmd Command) ([]string, error) {
+			switch cmd.Name {
+			case "D":
+				if cmd.Args[0] == "911" {
+					return nil, CMEOperationNotAllowed
+				}
+				return nil, ag.SetIndicator(IndicatorCallSetup, CallSetupOutgoing)
+			case "+CLCC":
+				return []string{calls[0].ResultCode(), calls[1].ResultCode()}, nil
+			}
+			return nil, ErrError
+		},
+	})
+	hf := NewHandsFree(slog.Default(), remote, HFThreeWayCalling|HFCallerID)
+	events := make(chan Event, 8)
+	hf.SetEventHandler(func(e Event) { events <- e })
+	next := func() Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for an event")
+		}
+		return Event{}
+	}
+
+	if err := hf.Connect(ctx); err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	select {
+	case <-ag.Connected():
+	case <-ctx.Done():
+		t.Fatalf("Timed out waiting for the service level connection")
+	}
+	if ag.HFFeatures() != HFThreeWayCalling|HFCallerID {
+		t.Fatalf("Expected: %X, Received: %X", HFThreeWayCalling|HFCallerID, ag.HFFeatures())
+	}
+	if !reflect.DeepEqual(hf.Indicators(), DefaultIndicators()) {
+		t.Fatalf("Expected: %+v, Received: %+v", DefaultIndicators(), hf.Indicators())
+	}
+	if !reflect.DeepEqual(hf.CallHoldOperations(), DefaultCallHold) {
+		t.Fatalf("Expected: %q, Received: %q", DefaultCallHold, hf.CallHoldOperations())
+	}
+
+	if err := ag.SetIndicator(IndicatorService, 1); err != nil {
+		t.Fatalf("Error setting indicator: %s", err)
+	}
+	if e := next(); e.Kind != EventIndicator || e.Indicator != IndicatorService || e.Value != 1 {
+		t.Fatalf("Expected: service 1, Received: %+v", e)
+	}
+	if err := ag.SetIndicator(IndicatorSignal, 6); err == nil {
+		t.Fatalf("Expected an error for a value out of range")
+	}
+
+	// The caller ID is only sent once enabled.
+	if err := ag.Ring("5551234", NumberTypeUnknown); err != nil {
+		t.Fatalf("Error ringing: %s", err)
+	}
+	if e := next(); e.Kind != EventRing {
+		t.Fatalf("Expected: RING, Received: %+v", e)
+	}
+	if err := hf.SetCallerID(ctx, true); err != nil {
+		t.Fatalf("Error enabling caller ID: %s", err)
+	}
+	if err := ag.Ring("5551234", NumberTypeUnknown); err != nil {
+		t.Fatalf("Error ringing: %s", err)
+	}
+	if e := next(); e.Kind != EventRing {
+		t.Fatalf("Expected: RING, Received: %+v", e)
+	}
+	if e := next(); e.Kind != EventCallerID || e.Number != "5551234" {
+		t.Fatalf("Expected: caller ID, Received: %+v", e)
+	}
+
+	if err := hf.Dial(ctx, "5551234"); err != nil {
+		t.Fatalf("Error dialing: %s", err)
+	}
+	if v, _ := hf.Indicator(IndicatorCallSetup); v != CallSetupOutgoing {
+		t.Fatalf("Expected: callsetup %d, Received: %d", CallSetupOutgoing, v)
+	}
+	if e := next(); e.Kind != EventIndicator || e.Indicator != IndicatorCallSetup {
+		t.Fatalf("Expected: callsetup, Received: %+v", e)
+	}
+	got, err := hf.CurrentCalls(ctx)
+	if err != nil {
+		t.Fatalf("Error listing calls: %s", err)
+	}
+	if !reflect.DeepEqual(got, calls) {
+		t.Fatalf("Expected: %+v, Received: %+v", calls, got)
+	}
+
+	// The extended errors are only sent once enabled.
+	if err := hf.Dial(ctx, "911"); err != ErrError {
+		t.Fatalf("Expected: %s, Received: %v", ErrError, err)
+	}
+	if err := hf.SetExtendedErrors(ctx, true); err != nil {
+		t.Fatalf("Error enabling extended errors: %s", err)
+	}
+	if err := hf.Dial(ctx, "911"); err != CMEOperationNotAllowed {
+		t.Fatalf("Expected: %s, Received: %v", CMEOperationNotAllowed, err)
+	}
+	if err := hf.PressButton(ctx); err != ErrError {
+		t.Fatalf("Expected: %s, Received: %v", ErrError, err)
+	}
+}
@@ -6,6 +6,21 @@ import (
 	"encoding/binary"
 )
 
+// [Vol 3, Part A, 5.4]
+const (
+	ModeBasic                  uint8 = 0x00
+	ModeRetransmission         uint8 = 0x01
+	ModeFlowControl            uint8 = 0x02
+	ModeEnhancedRetransmission uint8 = 0x03
+	ModeStreaming              uint8 = 0x04
+)
+
+// [Vol 3, Part A, 5.5]
+const (
+	FCSTypeNone  uint8 = 0x00
+	FCSType16Bit uint8 = 0x01
+)
+
 type Option interface {
 	encoding.BinaryMarshaler
 	encoding.BinaryUnmarshaler
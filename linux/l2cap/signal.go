@@ -13,14 +13,16 @@ const (
 	ReasonInvalidCID           uint16 = 0x0002
 
 	// [Vol 3, Part A, 4.3]
-	ConnectionResultSuccessful      uint16 = 0x0000
-	ConnectionResultPending         uint16 = 0x0001
-	ConnectionResultPSMNotSupported uint16 = 0x0002
-	ConnectionResultSecurityBlock   uint16 = 0x0003
-	ConnectionResultNoResources     uint16 = 0x0004
-	ConnectionStatusNoInfo          uint16 = 0x0000
-	ConnectionStatusAuthentication  uint16 = 0x0001
-	ConnectionStatusAuthorization   uint16 = 0x0002
+	ConnectionResultSuccessful                uint16 = 0x0000
+	ConnectionResultPending                   uint16 = 0x0001
+	ConnectionResultPSMNotSupported           uint16 = 0x0002
+	ConnectionResultSecurityBlock             uint16 = 0x0003
+	ConnectionResultNoResources               uint16 = 0x0004
+	ConnectionResultInvalidSourceCID          uint16 = 0x0006
+	ConnectionResultSourceCIDAlreadyAllocated uint16 = 0x0007
+	ConnectionStatusNoInfo                    uint16 = 0x0000
+	ConnectionStatusAuthentication            uint16 = 0x0001
+	ConnectionStatusAuthorization             uint16 = 0x0002
 
 	// [Vol 3, Part A, 4.5]
 	ConfigurationResultSuccessful              uint16 = 0x0000
@@ -71,6 +73,42 @@ const (
 	MoveChannelResultCollision              uint16 = 0x0005
 	MoveChannelResultNotAllowed             uint16 = 0x0006
 
+	// [Vol 3, Part A, 4.23]
+	LECreditResultSuccessful                    uint16 = 0x0000
+	LECreditResultPSMNotSupported               uint16 = 0x0002
+	LECreditResultNoResources                   uint16 = 0x0004
+	LECreditResultInsufficientAuthentication    uint16 = 0x0005
+	LECreditResultInsufficientAuthorization     uint16 = 0x0006
+	LECreditResultInsufficientEncryptionKeySize uint16 = 0x0007
+	LECreditResultInsufficientEncryption        uint16 = 0x0008
+	LECreditResultInvalidSourceCID              uint16 = 0x0009
+	LECreditResultSourceCIDAlreadyAllocated     uint16 = 0x000A
+	LECreditResultUnacceptableParameters        uint16 = 0x000B
+
+	// [Vol 3, Part A, 4.26]
+	CreditBasedResultSuccessful                    uint16 = 0x0000
+	CreditBasedResultSPSMNotSupported              uint16 = 0x0002
+	CreditBasedResultNoResources                   uint16 = 0x0004
+	CreditBasedResultInsufficientAuthentication    uint16 = 0x0005
+	CreditBasedResultInsufficientAuthorization     uint16 = 0x0006
+	CreditBasedResultInsufficientEncryptionKeySize uint16 = 0x0007
+	CreditBasedResultInsufficientEncryption        uint16 = 0x0008
+	CreditBasedResultInvalidSourceCID              uint16 = 0x0009
+	CreditBasedResultSourceCIDAlreadyAllocated     uint16 = 0x000A
+	CreditBasedResultUnacceptableParameters        uint16 = 0x000B
+	CreditBasedResultInvalidParameters             uint16 = 0x000C
+
+	// [Vol 3, Part A, 4.28]
+	ReconfigureResultSuccessful             uint16 = 0x0000
+	ReconfigureResultMTUReductionNotAllowed uint16 = 0x0001
+	ReconfigureResultMPSReductionNotAllowed uint16 = 0x0002
+	ReconfigureResultInvalidDestinationCID  uint16 = 0x0003
+	ReconfigureResultUnacceptableParameters uint16 = 0x0004
+
+	// MaxCreditBasedChannels is the number of channels a credit based connection or reconfigure request can hold
+	// [Vol 3, Part A, 4.25].
+	MaxCreditBasedChannels = 5
+
 	// [ Vol 3, Part A, 3.2]
 	DefaultConnectionlessMTU uint16 = 0x0030
 )
@@ -217,8 +255,7 @@ func (s *ConfigurationResponse) Unmarshal(b []byte) error {
 			continue
 		}
 
-		option.SetHint(uint8(b[i] >> 7 & 0x01))
-		if err := option.UnmarshalBinary(b[i+2:]); err != nil {
+		if err := option.UnmarshalBinary(b[i:]); err != nil {
 			return err
 		}
 		s.ConfigurationOptions = append(s.ConfigurationOptions, option)
@@ -227,6 +264,27 @@ func (s *ConfigurationResponse) Unmarshal(b []byte) error {
 	return nil
 }
 
+// Marshal serializes the data echoed.
+func (s *EchoRequest) Marshal() []byte { return append([]byte(nil), s.Data...) }
+
+// Unmarshal de-serializes the data echoed, which is optional [Vol 3, Part A, 4.8].
+func (s *EchoRequest) Unmarshal(b []byte) error {
+	s.Data = append([]byte(nil), b...)
+	return nil
+}
+
+// Marshal serializes the data echoed.
+func (s *EchoResponse) Marshal() []byte { return append([]byte(nil), s.Data...) }
+
+// Unmarshal de-serializes the data echoed, which is optional [Vol 3, Part A, 4.9].
+func (s *EchoResponse) Unmarshal(b []byte) error {
+	s.Data = append([]byte(nil), b...)
+	return nil
+}
+
+// ErrInfoNotSupported is returned when the remote device does not support the type of information requested.
+var ErrInfoNotSupported = errors.New("information type not supported")
+
 // Marshal Serializes the struct into binary data int LittleEndian order
 func (s *InformationResponse) Marshal() []byte {
 	var b []byte
@@ -253,7 +311,7 @@ func (s *InformationResponse) Unmarshal(b []byte) error {
 
 	switch s.Result {
 	case InfoResponseResultNotSupported:
-		return errors.New("Not supported")
+		return ErrInfoNotSupported
 	case InfoResponseResultSuccess:
 		switch s.InfoType {
 		case InfoTypeConnectionlessMTU:
@@ -277,3 +335,87 @@ func (s *InformationResponse) Unmarshal(b []byte) error {
 		return fmt.Errorf("Unknown result: %X", s.Result)
 	}
 }
+
+// Marshal Serializes the struct into binary data int LittleEndian order
+func (s *CreditBasedConnectionRequest) Marshal() []byte {
+	b := make([]byte, 8, 8+2*len(s.SourceCID))
+	binary.LittleEndian.PutUint16(b[0:], s.SPSM)
+	binary.LittleEndian.PutUint16(b[2:], s.MTU)
+	binary.LittleEndian.PutUint16(b[4:], s.MPS)
+	binary.LittleEndian.PutUint16(b[6:], s.InitialCredits)
+	return appendCIDs(b, s.SourceCID)
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedConnectionRequest) Unmarshal(b []byte) (err error) {
+	if len(b) < 8 {
+		return fmt.Errorf("credit based connection request too short: %d", len(b))
+	}
+	s.SPSM = binary.LittleEndian.Uint16(b[0:])
+	s.MTU = binary.LittleEndian.Uint16(b[2:])
+	s.MPS = binary.LittleEndian.Uint16(b[4:])
+	s.InitialCredits = binary.LittleEndian.Uint16(b[6:])
+	s.SourceCID, err = readCIDs(b[8:])
+	return err
+}
+
+// Marshal Serializes the struct into binary data int LittleEndian order
+func (s *CreditBasedConnectionResponse) Marshal() []byte {
+	b := make([]byte, 8, 8+2*len(s.DestinationCID))
+	binary.LittleEndian.PutUint16(b[0:], s.MTU)
+	binary.LittleEndian.PutUint16(b[2:], s.MPS)
+	binary.LittleEndian.PutUint16(b[4:], s.InitialCredits)
+	binary.LittleEndian.PutUint16(b[6:], s.Result)
+	return appendCIDs(b, s.DestinationCID)
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedConnectionResponse) Unmarshal(b []byte) (err error) {
+	if len(b) < 8 {
+		return fmt.Errorf("credit based connection response too short: %d", len(b))
+	}
+	s.MTU = binary.LittleEndian.Uint16(b[0:])
+	s.MPS = binary.LittleEndian.Uint16(b[2:])
+	s.InitialCredits = binary.LittleEndian.Uint16(b[4:])
+	s.Result = binary.LittleEndian.Uint16(b[6:])
+	s.DestinationCID, err = readCIDs(b[8:])
+	return err
+}
+
+// Marshal Serializes the struct into binary data int LittleEndian order
+func (s *CreditBasedReconfigureRequest) Marshal() []byte {
+	b := make([]byte, 4, 4+2*len(s.DestinationCID))
+	binary.LittleEndian.PutUint16(b[0:], s.MTU)
+	binary.LittleEndian.PutUint16(b[2:], s.MPS)
+	return appendCIDs(b, s.DestinationCID)
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedReconfigureRequest) Unmarshal(b []byte) (err error) {
+	if len(b) < 4 {
+		return fmt.Errorf("credit based reconfigure request too short: %d", len(b))
+	}
+	s.MTU = binary.LittleEndian.Uint16(b[0:])
+	s.MPS = binary.LittleEndian.Uint16(b[2:])
+	s.DestinationCID, err = readCIDs(b[4:])
+	return err
+}
+
+func appendCIDs(b []byte, cids []uint16) []byte {
+	for _, cid := range cids {
+		b = append(b, byte(cid), byte(cid>>8))
+	}
+	return b
+}
+
+// readCIDs reads the list of channel identifiers ending a credit based signaling packet.
+func readCIDs(b []byte) ([]uint16, error) {
+	if len(b)%2 != 0 || len(b)/2 > MaxCreditBasedChannels {
+		return nil, fmt.Errorf("invalid channel identifier list length: %d", len(b))
+	}
+	cids := make([]uint16, len(b)/2)
+	for i := range cids {
+		cids[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return cids, nil
+}
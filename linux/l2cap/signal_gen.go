@@ -149,47 +149,23 @@ const SignalEchoRequest = 0x08
 
 // EchoRequest implements Echo Request (0x08) [Vol 3, Part A, 4.8].
 type EchoRequest struct {
-	Data uint16
+	Data []byte
 }
 
 // Code returns the event code of the command.
 func (s EchoRequest) Code() int { return 0x08 }
 
-// Marshal serializes the command parameters into binary form.
-func (s *EchoRequest) Marshal() []byte {
-	buf := bytes.NewBuffer(make([]byte, 0))
-	binary.Write(buf, binary.LittleEndian, s)
-	return buf.Bytes()
-}
-
-// Unmarshal de-serializes the binary data and stores the result in the receiver.
-func (s *EchoRequest) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, s)
-}
-
 // SignalEchoResponse is the code of Echo Response signaling packet.
 const SignalEchoResponse = 0x09
 
 // EchoResponse implements Echo Response (0x09) [Vol 3, Part A, 4.9].
 type EchoResponse struct {
-	Data uint16
+	Data []byte
 }
 
 // Code returns the event code of the command.
 func (s EchoResponse) Code() int { return 0x09 }
 
-// Marshal serializes the command parameters into binary form.
-func (s *EchoResponse) Marshal() []byte {
-	buf := bytes.NewBuffer(make([]byte, 0))
-	binary.Write(buf, binary.LittleEndian, s)
-	return buf.Bytes()
-}
-
-// Unmarshal de-serializes the binary data and stores the result in the receiver.
-func (s *EchoResponse) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, s)
-}
-
 // SignalInformationRequest is the code of Information Request signaling packet.
 const SignalInformationRequest = 0x0A
 
@@ -455,11 +431,11 @@ const SignalLECreditBasedConnectionResponse = 0x15
 
 // LECreditBasedConnectionResponse implements LE Credit Based Connection Response (0x15) [Vol 3, Part A, 4.23].
 type LECreditBasedConnectionResponse struct {
-	DestinationCID    uint16
-	MTU               uint16
-	MPS               uint16
-	InitialCreditsCID uint16
-	Result            uint16
+	DestinationCID uint16
+	MTU            uint16
+	MPS            uint16
+	InitialCredits uint16
+	Result         uint16
 }
 
 // Code returns the event code of the command.
@@ -500,3 +476,69 @@ func (s *LEFlowControlCredit) Marshal() []byte {
 func (s *LEFlowControlCredit) Unmarshal(b []byte) error {
 	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, s)
 }
+
+// SignalCreditBasedConnectionRequest is the code of Credit Based Connection Request signaling packet.
+const SignalCreditBasedConnectionRequest = 0x17
+
+// CreditBasedConnectionRequest implements Credit Based Connection Request (0x17) [Vol 3, Part A, 4.25].
+type CreditBasedConnectionRequest struct {
+	SPSM           uint16
+	MTU            uint16
+	MPS            uint16
+	InitialCredits uint16
+	SourceCID      []uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedConnectionRequest) Code() int { return 0x17 }
+
+// SignalCreditBasedConnectionResponse is the code of Credit Based Connection Response signaling packet.
+const SignalCreditBasedConnectionResponse = 0x18
+
+// CreditBasedConnectionResponse implements Credit Based Connection Response (0x18) [Vol 3, Part A, 4.26].
+type CreditBasedConnectionResponse struct {
+	MTU            uint16
+	MPS            uint16
+	InitialCredits uint16
+	Result         uint16
+	DestinationCID []uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedConnectionResponse) Code() int { return 0x18 }
+
+// SignalCreditBasedReconfigureRequest is the code of Credit Based Reconfigure Request signaling packet.
+const SignalCreditBasedReconfigureRequest = 0x19
+
+// CreditBasedReconfigureRequest implements Credit Based Reconfigure Request (0x19) [Vol 3, Part A, 4.27].
+type CreditBasedReconfigureRequest struct {
+	MTU            uint16
+	MPS            uint16
+	DestinationCID []uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedReconfigureRequest) Code() int { return 0x19 }
+
+// SignalCreditBasedReconfigureResponse is the code of Credit Based Reconfigure Response signaling packet.
+const SignalCreditBasedReconfigureResponse = 0x1A
+
+// CreditBasedReconfigureResponse implements Credit Based Reconfigure Response (0x1A) [Vol 3, Part A, 4.28].
+type CreditBasedReconfigureResponse struct {
+	Result uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedReconfigureResponse) Code() int { return 0x1A }
+
+// Marshal serializes the command parameters into binary form.
+func (s *CreditBasedReconfigureResponse) Marshal() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	binary.Write(buf, binary.LittleEndian, s)
+	return buf.Bytes()
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedReconfigureResponse) Unmarshal(b []byte) error {
+	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, s)
+}
@@ -1,6 +1,8 @@
 package l2cap
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -12,3 +14,87 @@ func TestUnMarshalConfigurationResponse(t *testing.T) {
 		t.Fatalf("Error: %s", err)
 	}
 }
+
+var creditBasedConnectionRequestBytes []byte = []byte{0x81, 0x00, 0x40, 0x00, 0x40, 0x00, 0x0A, 0x00, 0x40, 0x00,
+	0x41, 0x00}
+
+func TestMarshalCreditBasedConnectionRequest(t *testing.T) {
+	req := &CreditBasedConnectionRequest{SPSM: 0x81, MTU: 64, MPS: 64, InitialCredits: 10,
+		SourceCID: []uint16{0x40, 0x41}}
+	if b := req.Marshal(); !bytes.Equal(creditBasedConnectionRequestBytes, b) {
+		t.Fatalf("Expected: %X, Received: %X", creditBasedConnectionRequestBytes, b)
+	}
+
+	var rx CreditBasedConnectionRequest
+	if err := rx.Unmarshal(creditBasedConnectionRequestBytes); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !reflect.DeepEqual(*req, rx) {
+		t.Fatalf("Expected: %+v, Received: %+v", *req, rx)
+	}
+}
+
+func TestUnMarshalCreditBasedConnectionRequestCIDs(t *testing.T) {
+	for _, n := range []int{1, 12} {
+		b := append(append([]byte(nil), creditBasedConnectionRequestBytes[:8]...), make([]byte, n)...)
+		var req CreditBasedConnectionRequest
+		if err := req.Unmarshal(b); err == nil {
+			t.Fatalf("Expected an error for %d bytes of source CIDs", n)
+		}
+	}
+}
+
+func TestMarshalCreditBasedReconfigureRequest(t *testing.T) {
+	req := &CreditBasedReconfigureRequest{MTU: 512, MPS: 128, DestinationCID: []uint16{0x40}}
+	var rx CreditBasedReconfigureRequest
+	if err := rx.Unmarshal(req.Marshal()); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !reflect.DeepEqual(*req, rx) {
+		t.Fatalf("Expected: %+v, Received: %+v", *req, rx)
+	}
+}
+
+var configurationResponseRFCBytes []byte = []byte{0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x09, 0x03, 0x20, 0x03,
+	0xD0, 0x07, 0xE0, 0x2E, 0xF5, 0x03}
+
+func TestUnMarshalConfigurationResponseOptions(t *testing.T) {
+	rsp := &ConfigurationResponse{}
+	if err := rsp.Unmarshal(configurationResponseRFCBytes); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(rsp.ConfigurationOptions) != 1 {
+		t.Fatalf("Expected: 1 option, Received: %d", len(rsp.ConfigurationOptions))
+	}
+	expected := &RetransmissionAndFlowControlOption{TypeHint: 0x04, Length: 0x09, Mode: ModeEnhancedRetransmission,
+		TxWindowSize: 32, MaxTransmit: 3, RetransmissionTimeout: 2000, MonitorTimeout: 12000, MaximumPDUSize: 1013}
+	if !reflect.DeepEqual(expected, rsp.ConfigurationOptions[0]) {
+		t.Fatalf("Expected: %+v, Received: %+v", expected, rsp.ConfigurationOptions[0])
+	}
+	if b := rsp.Marshal(); !bytes.Equal(configurationResponseRFCBytes, b) {
+		t.Fatalf("Expected: %X, Received: %X", configurationResponseRFCBytes, b)
+	}
+}
+
+func TestMarshalEchoRequest(t *testing.T) {
+	for _, data := range [][]byte{nil, {0x01, 0x02, 0x03}} {
+		req := &EchoRequest{Data: data}
+		if b := req.Marshal(); !bytes.Equal(data, b) {
+			t.Fatalf("Expected: %X, Received: %X", data, b)
+		}
+		var rsp EchoResponse
+		if err := rsp.Unmarshal(req.Marshal()); err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if !bytes.Equal(data, rsp.Data) {
+			t.Fatalf("Expected: %X, Received: %X", data, rsp.Data)
+		}
+	}
+}
+
+func TestUnMarshalInformationResponseNotSupported(t *testing.T) {
+	var rsp InformationResponse
+	if err := rsp.Unmarshal([]byte{0x03, 0x00, 0x01, 0x00}); err != ErrInfoNotSupported {
+		t.Fatalf("Expected: %v, Received: %v", ErrInfoNotSupported, err)
+	}
+}
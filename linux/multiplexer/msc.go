@@ -1,6 +1,9 @@
 package multiplexer
 
-const ModemStatusLength uint8 = 2
+const (
+	ModemStatusLength      uint8 = 2
+	ModemStatusBreakLength uint8 = 3
+)
 
 // ModemStatus It is desired to convey virtual V.24 control signals to a data stream, this is done by sending the MSC command. The
 // MSC command has one mandatory control signal byte and an optional break signal byte. This command is only relevant
@@ -10,6 +13,9 @@ type ModemStatus struct {
 
 	ServerChannel uint8
 
+	// Direction is the direction bit of the DLCI, set for the server channels of the initiator of the session
+	Direction uint8
+
 	FlowControl uint8
 
 	ReadyToCommunicate uint8
@@ -19,6 +25,11 @@ type ModemStatus struct {
 	IncomingCall uint8
 
 	DataValid uint8
+
+	// Break adds the break signal octet, reporting a break of BreakLength units of 200 ms, 0 if unspecified
+	Break bool
+
+	BreakLength uint8
 }
 
 func (m *ModemStatus) MarshalBinary() ([]byte, error) {
@@ -30,17 +41,22 @@ func (m *ModemStatus) MarshalBinary() ([]byte, error) {
 
 	var (
 		ea          uint8 = 0x01
-		direction   uint8 = 0x00
 		onesPadding uint8 = 0x01
 	)
 
-	b[i] = ea | (onesPadding << 1) | (direction << 2) | (m.ServerChannel&0x1F)<<3
-	b[i+1] = 0x01
+	b[i] = ea | (onesPadding << 1) | (m.Direction&0x01)<<2 | (m.ServerChannel&0x1F)<<3
+	// The EA bit of the control signals octet marks it as the last one, unless the break signal octet follows.
+	if !m.Break {
+		b[i+1] = 0x01
+	}
 	b[i+1] = b[i+1] | m.FlowControl&0x01<<1
 	b[i+1] = b[i+1] | m.ReadyToCommunicate&0x01<<2
 	b[i+1] = b[i+1] | m.ReadyToReceive&0x01<<3
 	b[i+1] = b[i+1] | m.IncomingCall&0x01<<6
 	b[i+1] = b[i+1] | m.DataValid&0x01<<7
+	if m.Break {
+		b[i+2] = 0x01 | 0x01<<1 | m.BreakLength&0x0F<<4
+	}
 	return b, nil
 }
 
@@ -51,16 +67,28 @@ func (m *ModemStatus) UnmarshalBinary(b []byte) error {
 	}
 	i := HeaderSize
 
+	m.Direction = b[i] >> 2 & 0x01
 	m.ServerChannel = b[i] >> 3 & 0x1F
 	m.FlowControl = b[i+1] >> 1 & 0x01
 	m.ReadyToCommunicate = b[i+1] >> 2 & 0x01
 	m.ReadyToReceive = b[i+1] >> 3 & 0x01
 	m.IncomingCall = b[i+1] >> 6 & 0x01
 	m.DataValid = b[i+1] >> 7 & 0x01
+	m.Break, m.BreakLength = false, 0
+	if b[1]>>1 >= ModemStatusBreakLength {
+		m.Break = b[i+2]>>1&0x01 == 0x01
+		m.BreakLength = b[i+2] >> 4 & 0x0F
+	}
 	return nil
 }
 
-func (m *ModemStatus) Len() uint8                 { return ModemStatusLength }
+func (m *ModemStatus) Len() uint8 {
+	if m.Break {
+		return ModemStatusBreakLength
+	}
+	return ModemStatusLength
+}
+
 func (m *ModemStatus) Type() uint8                { return TypeModemStatus }
 func (m *ModemStatus) GetCommandResponse() uint8  { return m.CommandResponse }
 func (m *ModemStatus) SetCommandResponse(l uint8) { m.CommandResponse = l }
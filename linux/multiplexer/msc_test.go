@@ -68,3 +68,22 @@ func TestMSCMarshal(t *testing.T) {
 		t.Fatalf("Exepected: %X, Received: %X", mscTestBytes, bs)
 	}
 }
+
+func TestMSCBreak(t *testing.T) {
+	frm := &ModemStatus{CommandResponse: testCRMSC, ServerChannel: testChannelMSC, Direction: 0x01,
+		ReadyToCommunicate: testRTCMSC, Break: true, BreakLength: 0x03}
+	bs, err := frm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := []byte{0xe3, 0x07, 0x0f, 0x04, 0x33}; !bytes.Equal(bs, expected) {
+		t.Fatalf("Exepected: %X, Received: %X", expected, bs)
+	}
+	rsp := &ModemStatus{}
+	if err := rsp.UnmarshalBinary(bs); err != nil {
+		t.Fatalf("Error unmarshalling: %s", err)
+	}
+	if !rsp.Break || rsp.BreakLength != 0x03 || rsp.Direction != 0x01 || rsp.ReadyToCommunicate != testRTCMSC {
+		t.Fatalf("Expected: %+v, Received: %+v", frm, rsp)
+	}
+}
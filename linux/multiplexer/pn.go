@@ -17,6 +17,9 @@ type ParameterNegotiation struct {
 	// DLCI Data link connection for which parameters are being negotiated
 	ServerChannel uint8
 
+	// Direction is the direction bit of the DLCI, set for the server channels of the initiator of the session
+	Direction uint8
+
 	// FrameTypes The type of frames used to carry information on the channel
 	// UIH frames indicated by the value 0x1000
 	FrameType uint8
@@ -59,7 +62,7 @@ func (p *ParameterNegotiation) MarshalBinary() ([]byte, error) {
 	}
 	i := HeaderSize
 
-	b[i] = 0x00 | p.ServerChannel&0x1F<<1
+	b[i] = p.Direction&0x01 | p.ServerChannel&0x1F<<1
 
 	if p.CreditBasedFlowControl {
 		b[i+1] = 0xF0
@@ -95,6 +98,7 @@ func (p *ParameterNegotiation) UnmarshalBinary(b []byte) error {
 	}
 	i := HeaderSize
 
+	p.Direction = b[i] & 0x01
 	p.ServerChannel = b[i] >> 1 & 0x1F
 
 	// first 4 bits are the FrameType, last 4 are the ConvergenceLayer
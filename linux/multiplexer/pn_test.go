@@ -91,3 +91,20 @@ func TestPNMarshal(t *testing.T) {
 		t.Fatalf("Exepected: %X, Received: %X", pnTestBytes, bs)
 	}
 }
+
+func TestPNDirection(t *testing.T) {
+	bs, err := (&ParameterNegotiation{CommandResponse: testCRPN, ServerChannel: testChannelPN, Direction: 0x01}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if bs[2] != 0x03 {
+		t.Fatalf("Expected: %X, Received: %X", 0x03, bs[2])
+	}
+	frm := &ParameterNegotiation{}
+	if err := frm.UnmarshalBinary(bs); err != nil {
+		t.Fatalf("Error unmarshalling: %s", err)
+	}
+	if frm.Direction != 0x01 || frm.ServerChannel != testChannelPN {
+		t.Fatalf("Expected: %X %X, Received: %X %X", 0x01, testChannelPN, frm.Direction, frm.ServerChannel)
+	}
+}
@@ -2,11 +2,25 @@ package multiplexer
 
 const RemoteLineStatusLength uint8 = 2
 
+// Line status bits of the RLS command. LineStatusError is set along with the bit of the error. [ETSI TS 101 369
+// V7.1.0, 5.4.6.3.10 ]
+const (
+	LineStatusError   uint8 = 0x01
+	LineStatusOverrun uint8 = 0x02
+	LineStatusParity  uint8 = 0x04
+	LineStatusFraming uint8 = 0x08
+)
+
+// RemoteLineStatus Sent when a device needs to tell the other end of the data link connection about a line status
+// error. [ETSI TS 101 369 V7.1.0, 5.4.6.3.10 ]
 type RemoteLineStatus struct {
 	CommandResponse uint8
 
 	ServerChannel uint8
 
+	// Direction is the direction bit of the DLCI, set for the server channels of the initiator of the session
+	Direction uint8
+
 	LineStatus uint8
 }
 
@@ -17,7 +31,7 @@ func (m *RemoteLineStatus) MarshalBinary() ([]byte, error) {
 	}
 	i := HeaderSize
 
-	b[i] = 0x01 | 0x01<<1 | m.ServerChannel&0x3F<<2
+	b[i] = 0x01 | 0x01<<1 | m.Direction&0x01<<2 | m.ServerChannel&0x1F<<3
 	b[i+1] = m.LineStatus & 0x0F
 	return b, nil
 }
@@ -29,7 +43,8 @@ func (m *RemoteLineStatus) UnmarshalBinary(b []byte) error {
 	}
 	i := HeaderSize
 
-	m.ServerChannel = b[i] >> 2 & 0x3F
+	m.Direction = b[i] >> 2 & 0x01
+	m.ServerChannel = b[i] >> 3 & 0x1F
 	m.LineStatus = b[i+1] & 0x0F
 	return nil
 }
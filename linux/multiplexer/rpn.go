@@ -9,6 +9,7 @@ const (
 	RemotePortNegotiationRequestLength uint8 = 1
 )
 
+// Bits of the parameter mask. The parameters are in the first octet of the mask, the flow control bits in the second.
 const (
 	MaskBaudRate uint8 = iota
 	MaskDataBits
@@ -17,7 +18,10 @@ const (
 	MaskParityType
 	MaskXONChar
 	MaskXOFFChar
-	MaskInputXONOFF
+)
+
+const (
+	MaskInputXONOFF uint8 = iota + 8
 	MaskOutputXONOFF
 	MaskInputRTR
 	MaskOutputRTR
@@ -25,6 +29,9 @@ const (
 	MaskOutputRTC
 )
 
+// MaskAll has the bits of all the parameters set.
+const MaskAll uint16 = 0x3F7F
+
 // RemotePortNegotiation Remote Port Negotiation used to set communication settings
 // at the remote end of the data link connection
 type RemotePortNegotiation struct {
@@ -35,6 +42,9 @@ type RemotePortNegotiation struct {
 	// DLCI is composed of a direction bit and a 5 bit server number 1 - 30
 	ServerChannel uint8
 
+	// Direction is the direction bit of the DLCI, set for the server channels of the initiator of the session
+	Direction uint8
+
 	baudRate uint8
 
 	dataBits uint8
@@ -65,21 +75,18 @@ func (p *RemotePortNegotiation) MarshalBinary() ([]byte, error) {
 	}
 	i := HeaderSize
 
-	b[i] = 0x01 | 0x01<<1 | p.ServerChannel&0x1F<<2
+	b[i] = 0x01 | 0x01<<1 | p.Direction&0x01<<2 | p.ServerChannel&0x1F<<3
 
 	if !p.Setup {
 		return b, nil
 	}
 
-	p.baudRate = b[i+1]
-	p.dataBits = b[i+2] & 0x03
-	p.stopBits = b[i+2] >> 2 & 0x01
-	p.parity = b[i+2] >> 3 & 0x01
-	p.parityType = b[i+2] >> 4 & 0x03
-	p.flowControl = b[i+3] & 0x3F
-	p.xON = b[i+4]
-	p.xOFF = b[i+5]
-	p.mask = binary.LittleEndian.Uint16(b[i+6:])
+	b[i+1] = p.baudRate
+	b[i+2] = p.dataBits&0x03 | p.stopBits&0x01<<2 | p.parity&0x01<<3 | p.parityType&0x03<<4
+	b[i+3] = p.flowControl & 0x3F
+	b[i+4] = p.xON
+	b[i+5] = p.xOFF
+	binary.LittleEndian.PutUint16(b[i+6:], p.mask)
 	return b, nil
 }
 
@@ -92,26 +99,29 @@ func (p *RemotePortNegotiation) UnmarshalBinary(b []byte) error {
 	}
 	i := HeaderSize
 
-	p.ServerChannel = b[i] >> 2 & 0x3F
+	p.Direction = b[i] >> 2 & 0x01
+	p.ServerChannel = b[i] >> 3 & 0x1F
 
-	if b[1]>>1 == 0x01 {
+	if b[1]>>1 != RemotePortNegotiationSetupLength {
 		p.Setup = false
 		return nil
 	}
 	p.Setup = true
 
-	b[i+1] = p.baudRate
-	b[i+2] = p.dataBits & 0x03
-	b[i+2] = p.stopBits & 0x01 << 2
-	b[i+2] = p.parity & 0x01 << 3
-	b[i+2] = p.parityType & 0x03 << 4
-	b[i+3] = p.flowControl & 0x3F
-	b[i+4] = p.xON
-	b[i+5] = p.xOFF
-	binary.LittleEndian.PutUint16(b[i+6:], p.mask)
+	p.baudRate = b[i+1]
+	p.dataBits = b[i+2] & 0x03
+	p.stopBits = b[i+2] >> 2 & 0x01
+	p.parity = b[i+2] >> 3 & 0x01
+	p.parityType = b[i+2] >> 4 & 0x03
+	p.flowControl = b[i+3] & 0x3F
+	p.xON = b[i+4]
+	p.xOFF = b[i+5]
+	p.mask = binary.LittleEndian.Uint16(b[i+6:])
 	return nil
 }
 
+// Change sets the parameter of the mask to the value, and marks it as changed. The flow control parameters are set
+// with a value of 1.
 func (p *RemotePortNegotiation) Change(mask uint8, value uint8) {
 	switch mask {
 	case MaskBaudRate:
@@ -128,6 +138,13 @@ func (p *RemotePortNegotiation) Change(mask uint8, value uint8) {
 		p.xON = value
 	case MaskXOFFChar:
 		p.xOFF = value
+	case MaskInputXONOFF, MaskOutputXONOFF, MaskInputRTR, MaskOutputRTR, MaskInputRTC, MaskOutputRTC:
+		bit := uint8(0x01) << (mask - MaskInputXONOFF)
+		if value != 0 {
+			p.flowControl |= bit
+		} else {
+			p.flowControl &^= bit
+		}
 	}
 	p.mask = p.mask | 0x01<<mask
 }
@@ -136,6 +153,12 @@ func (p *RemotePortNegotiation) IsChanged(mask uint8) bool {
 	return p.mask>>mask&0x01 == 0x01
 }
 
+// Mask returns the parameter mask, the bits of the parameters changed by a command or accepted by a response.
+func (p *RemotePortNegotiation) Mask() uint16 { return p.mask }
+
+// SetMask sets the parameter mask, such as the one of the command accepted by a response.
+func (p *RemotePortNegotiation) SetMask(mask uint16) { p.mask = mask }
+
 func (p *RemotePortNegotiation) Value(mask uint8) uint8 {
 	switch mask {
 	case MaskBaudRate:
@@ -152,8 +175,10 @@ func (p *RemotePortNegotiation) Value(mask uint8) uint8 {
 		return p.xON
 	case MaskXOFFChar:
 		return p.xOFF
+	case MaskInputXONOFF, MaskOutputXONOFF, MaskInputRTR, MaskOutputRTR, MaskInputRTC, MaskOutputRTC:
+		return p.flowControl >> (mask - MaskInputXONOFF) & 0x01
 	}
-	return uint8(p.mask >> mask & 0x01)
+	return 0
 }
 
 func (p *RemotePortNegotiation) Len() uint8 {
@@ -0,0 +1,78 @@
+package multiplexer
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	rpnTestBytes        []byte = []byte{0x93, 0x11, 0x0b, 0x03, 0x2b, 0x0c, 0x11, 0x13, 0x7f, 0x3f}
+	rpnRequestTestBytes []byte = []byte{0x93, 0x03, 0x0b}
+)
+
+const (
+	testChannelRPN    = 0x01
+	testBaudRateRPN   = 0x03
+	testDataBitsRPN   = 0x03
+	testParityRPN     = 0x01
+	testParityTypeRPN = 0x02
+	testXONRPN        = 0x11
+	testXOFFRPN       = 0x13
+)
+
+func TestRPNMarshal(t *testing.T) {
+	frm := &RemotePortNegotiation{CommandResponse: 0x01, ServerChannel: testChannelRPN, Setup: true}
+	frm.Change(MaskBaudRate, testBaudRateRPN)
+	frm.Change(MaskDataBits, testDataBitsRPN)
+	frm.Change(MaskStopBits, 0x00)
+	frm.Change(MaskParity, testParityRPN)
+	frm.Change(MaskParityType, testParityTypeRPN)
+	frm.Change(MaskXONChar, testXONRPN)
+	frm.Change(MaskXOFFChar, testXOFFRPN)
+	for _, mask := range []uint8{MaskInputXONOFF, MaskOutputXONOFF, MaskInputRTC, MaskOutputRTC} {
+		frm.Change(mask, 0x00)
+	}
+	frm.Change(MaskInputRTR, 0x01)
+	frm.Change(MaskOutputRTR, 0x01)
+
+	bs, err := frm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !bytes.Equal(bs, rpnTestBytes) {
+		t.Fatalf("Exepected: %X, Received: %X", rpnTestBytes, bs)
+	}
+}
+
+func TestRPNUnmarshal(t *testing.T) {
+	frm := &RemotePortNegotiation{}
+	if err := frm.UnmarshalBinary(rpnTestBytes); err != nil {
+		t.Fatalf("Error unmarshalling: %s", err)
+	}
+	if !frm.Setup || frm.ServerChannel != testChannelRPN || frm.Mask() != MaskAll {
+		t.Fatalf("Expected: %X %X, Received: %X %X", testChannelRPN, MaskAll, frm.ServerChannel, frm.Mask())
+	}
+	for mask, value := range map[uint8]uint8{
+		MaskBaudRate:   testBaudRateRPN,
+		MaskDataBits:   testDataBitsRPN,
+		MaskParity:     testParityRPN,
+		MaskParityType: testParityTypeRPN,
+		MaskXONChar:    testXONRPN,
+		MaskXOFFChar:   testXOFFRPN,
+		MaskInputRTR:   0x01,
+		MaskOutputRTR:  0x01,
+		MaskInputRTC:   0x00,
+	} {
+		if frm.Value(mask) != value {
+			t.Fatalf("Mask %d Expected: %X, Received: %X", mask, value, frm.Value(mask))
+		}
+	}
+
+	req := &RemotePortNegotiation{}
+	if err := req.UnmarshalBinary(rpnRequestTestBytes); err != nil {
+		t.Fatalf("Error unmarshalling: %s", err)
+	}
+	if req.Setup || req.ServerChannel != testChannelRPN {
+		t.Fatalf("Expected: request on %X, Received: %v on %X", testChannelRPN, req.Setup, req.ServerChannel)
+	}
+}
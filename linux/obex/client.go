@@ -0,0 +1,321 @@
+package obex
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/thomascriley/ble/log"
+)
+
+// ClientParams are the parameters of an OBEX client.
+type ClientParams struct {
+	// Target is the UUID of the service the client connects to, such as the folder browsing service of FTP, none for
+	// the inbox of OPP.
+	Target []byte
+
+	// MaxPacketLength is the largest packet the client accepts, DefaultMaxPacketLength if 0.
+	MaxPacketLength uint16
+
+	// SRM enables the single response mode, which GOEP 2.0 only allows over L2CAP: the packets of an operation are
+	// sent without waiting for the response to each of them, if the server supports it.
+	SRM bool
+}
+
+// Client is an OBEX client session over a stream, such as a ble.ClientRFCOMM or an L2CAP channel. The operations run
+// one at a time. The contexts bound them only if the stream supports deadlines, the operations not using the single
+// response mode are also aborted between two packets once their context is done.
+type Client struct {
+	log *slog.Logger
+	c   *conn
+	p   ClientParams
+
+	// mu serializes the operations.
+	mu        sync.Mutex
+	connID    uint32
+	hasConnID bool
+}
+
+// NewClient returns an OBEX client over the stream.
+func NewClient(logger *slog.Logger, rw io.ReadWriter, p ClientParams) *Client {
+	if p.MaxPacketLength == 0 {
+		p.MaxPacketLength = DefaultMaxPacketLength
+	}
+	return &Client{
+		log: logger.With("client", "obex"),
+		c:   newConn(rw, p.MaxPacketLength),
+		p:   p,
+	}
+}
+
+// Connect connects the session to the target service, sending the headers, and returns the headers of the response
+// [OBEX 3.4.1].
+func (cl *Client) Connect(ctx context.Context, headers ...Header) (Headers, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	defer cl.watch(ctx)()
+
+	hs := Headers(headers)
+	if cl.p.Target != nil {
+		hs = append(Headers{BytesHeader(HeaderTarget, cl.p.Target)}, hs...)
+	}
+	p := &packet{code: OpConnect, fields: connectFields(cl.p.MaxPacketLength), headers: hs}
+	if err := cl.c.write(p); err != nil {
+		return nil, err
+	}
+	rsp, err := cl.c.read(func(uint8) int { return 4 })
+	if err != nil {
+		return nil, fmt.Errorf("unable to read connect response: %w", err)
+	}
+	if code := ResponseCode(rsp.code); code != Success {
+		return rsp.headers, code
+	}
+	if n := int(binary.BigEndian.Uint16(rsp.fields[2:4])); n >= MinPacketLength {
+		cl.c.txMax = n
+	}
+	if h, ok := rsp.headers.Get(HeaderConnectionID); ok {
+		cl.connID, cl.hasConnID = h.Uint32(), true
+	}
+	return rsp.headers, nil
+}
+
+// Disconnect disconnects the session [OBEX 3.4.2].
+func (cl *Client) Disconnect(ctx context.Context) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	defer cl.watch(ctx)()
+
+	rsp, err := cl.request(&packet{code: OpDisconnect, headers: cl.requestHeaders(nil)})
+	if err != nil {
+		return err
+	}
+	cl.hasConnID = false
+	if code := ResponseCode(rsp.code); code != Success {
+		return code
+	}
+	return nil
+}
+
+// Put sends the object of the headers, such as its name, type and length, and of the body, and returns the headers
+// of the final response [OBEX 3.4.3]. A nil body deletes the object.
+func (cl *Client) Put(ctx context.Context, headers Headers, body io.Reader) (Headers, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	defer cl.watch(ctx)()
+
+	hs := cl.requestHeaders(headers)
+	if cl.p.SRM {
+		hs = append(hs, Uint8Header(HeaderSRM, srmEnable))
+	}
+	var srm, wait bool
+	buf := make([]byte, cl.c.txMax)
+	for first := true; ; first = false {
+		if !srm || wait {
+			if err := ctx.Err(); err != nil {
+				cl.abort()
+				return nil, err
+			}
+		}
+
+		p := &packet{code: OpPut, headers: hs}
+		hs = nil
+		final := body == nil
+		if body != nil {
+			var n int
+			if room := cl.c.bodyRoom(p.size()); room > 0 {
+				var err error
+				n, err = io.ReadFull(body, buf[:room])
+				switch {
+				case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+					final = true
+				case err != nil:
+					if !srm {
+						cl.abort()
+					}
+					return nil, fmt.Errorf("unable to read body: %w", err)
+				}
+			}
+			id := HeaderBody
+			if final {
+				id = HeaderEndOfBody
+			}
+			p.headers = append(p.headers, BytesHeader(id, buf[:n]))
+		}
+		if final {
+			p.code |= FinalBit
+		}
+		if err := cl.c.write(p); err != nil {
+			return nil, err
+		}
+		// In the single response mode, only the first packet and the final one are answered, unless the server asks
+		// the client to wait for the responses [GOEP 4.6].
+		if srm && !wait && !final {
+			continue
+		}
+
+		rsp, err := cl.c.read(noFields)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read put response: %w", err)
+		}
+		code := ResponseCode(rsp.code)
+		if first && cl.p.SRM && code == Continue {
+			srm = srmEnabled(rsp.headers)
+		}
+		wait = srmWait(rsp.headers)
+		switch {
+		case final && code.successful():
+			return rsp.headers.without(HeaderSRM, HeaderSRMParameters), nil
+		case code != Continue:
+			return rsp.headers, code
+		case final:
+			return rsp.headers, fmt.Errorf("unexpected continue response to final put packet")
+		}
+	}
+}
+
+// Get requests the object of the headers, such as its name or type, writes its body to w, and returns the headers
+// of the responses [OBEX 3.4.4]. If w fails in the single response mode, the rest of the body is read, and dropped,
+// before the error is returned.
+func (cl *Client) Get(ctx context.Context, headers Headers, w io.Writer) (Headers, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	defer cl.watch(ctx)()
+
+	hs := cl.requestHeaders(headers)
+	if cl.p.SRM {
+		hs = append(hs, Uint8Header(HeaderSRM, srmEnable))
+	}
+	if err := cl.c.write(&packet{code: OpGet | FinalBit, headers: hs}); err != nil {
+		return nil, err
+	}
+
+	var rspHeaders Headers
+	var srm bool
+	var werr error
+	for first := true; ; first = false {
+		rsp, err := cl.c.read(noFields)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read get response: %w", err)
+		}
+		code := ResponseCode(rsp.code)
+		if first && cl.p.SRM && code == Continue {
+			srm = srmEnabled(rsp.headers)
+		}
+		for _, h := range rsp.headers {
+			switch h.ID {
+			case HeaderBody, HeaderEndOfBody:
+				if werr == nil {
+					_, werr = w.Write(h.Value)
+				}
+			case HeaderSRM, HeaderSRMParameters:
+			default:
+				rspHeaders = append(rspHeaders, h)
+			}
+		}
+		switch {
+		case code.successful():
+			if werr != nil {
+				return rspHeaders, fmt.Errorf("unable to write body: %w", werr)
+			}
+			return rspHeaders, nil
+		case code != Continue:
+			return rspHeaders, code
+		}
+
+		if srm && !srmWait(rsp.headers) {
+			continue
+		}
+		if werr != nil && !srm {
+			cl.abort()
+			return rspHeaders, fmt.Errorf("unable to write body: %w", werr)
+		}
+		if err := ctx.Err(); err != nil && !srm {
+			cl.abort()
+			return rspHeaders, err
+		}
+		if err := cl.c.write(&packet{code: OpGet | FinalBit}); err != nil {
+			return rspHeaders, err
+		}
+	}
+}
+
+// SetPath changes the current folder of the session to the subfolder of the name, to the parent folder with
+// SetPathParent, or to the root folder if the name is empty [OBEX 3.4.6].
+func (cl *Client) SetPath(ctx context.Context, name string, flags SetPathFlags) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	defer cl.watch(ctx)()
+
+	var hs Headers
+	if name != "" || flags&SetPathParent == 0 {
+		hs = Headers{UnicodeHeader(HeaderName, name)}
+	}
+	rsp, err := cl.request(&packet{code: OpSetPath, fields: []byte{uint8(flags), 0x00}, headers: cl.requestHeaders(hs)})
+	if err != nil {
+		return err
+	}
+	if code := ResponseCode(rsp.code); code != Success {
+		return code
+	}
+	return nil
+}
+
+// request sends the single packet request, and reads its response.
+func (cl *Client) request(p *packet) (*packet, error) {
+	if err := cl.c.write(p); err != nil {
+		return nil, err
+	}
+	rsp, err := cl.c.read(noFields)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+	return rsp, nil
+}
+
+// abort aborts the operation in progress [OBEX 3.4.5].
+func (cl *Client) abort() {
+	if _, err := cl.request(&packet{code: OpAbort, headers: cl.requestHeaders(nil)}); err != nil {
+		cl.log.Debug("unable to abort operation", log.Error(err))
+	}
+}
+
+// requestHeaders returns the headers of the first packet of a request, preceded by the connection identifier the
+// server assigned, which comes first [OBEX 2.2.11].
+func (cl *Client) requestHeaders(hs Headers) Headers {
+	if !cl.hasConnID {
+		return hs
+	}
+	return append(Headers{Uint32Header(HeaderConnectionID, cl.connID)}, hs...)
+}
+
+// watch bounds the reads and writes of the stream with the deadline of the context, and returns the function
+// clearing it.
+func (cl *Client) watch(ctx context.Context) func() {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return func() {}
+	}
+	cl.c.setDeadline(d)
+	return func() { cl.c.setDeadline(time.Time{}) }
+}
+
+// noFields is the length of the fields of the packets without any.
+func noFields(uint8) int { return 0 }
+
+// srmEnabled reports whether the headers enable the single response mode.
+func srmEnabled(hs Headers) bool {
+	h, ok := hs.Get(HeaderSRM)
+	return ok && bytes.Equal(h.Value, []byte{srmEnable})
+}
+
+// srmWait reports whether the headers ask to wait for the next request, or response, in the single response mode.
+func srmWait(hs Headers) bool {
+	h, ok := hs.Get(HeaderSRMParameters)
+	return ok && h.Uint8() == srmpWait
+}
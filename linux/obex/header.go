@@ -0,0 +1,249 @@
+package obex
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// HeaderID identifies a header. Its two most significant bits are the encoding of the value [OBEX 2.1].
+type HeaderID uint8
+
+// Encodings of the header values.
+const (
+	encodingUnicode = 0x00
+	encodingBytes   = 0x40
+	encodingUint8   = 0x80
+	encodingUint32  = 0xC0
+	encodingMask    = 0xC0
+)
+
+// Header identifiers [OBEX 2.1, GOEP 4.6].
+const (
+	HeaderCount                 HeaderID = 0xC0
+	HeaderName                  HeaderID = 0x01
+	HeaderType                  HeaderID = 0x42
+	HeaderLength                HeaderID = 0xC3
+	HeaderTimeISO               HeaderID = 0x44
+	HeaderTime                  HeaderID = 0xC4
+	HeaderDescription           HeaderID = 0x05
+	HeaderTarget                HeaderID = 0x46
+	HeaderHTTP                  HeaderID = 0x47
+	HeaderBody                  HeaderID = 0x48
+	HeaderEndOfBody             HeaderID = 0x49
+	HeaderWho                   HeaderID = 0x4A
+	HeaderConnectionID          HeaderID = 0xCB
+	HeaderAppParameters         HeaderID = 0x4C
+	HeaderAuthChallenge         HeaderID = 0x4D
+	HeaderAuthResponse          HeaderID = 0x4E
+	HeaderCreatorID             HeaderID = 0xCF
+	HeaderWANUUID               HeaderID = 0x50
+	HeaderObjectClass           HeaderID = 0x51
+	HeaderSessionParameters     HeaderID = 0x52
+	HeaderSessionSequenceNumber HeaderID = 0x93
+	HeaderActionID              HeaderID = 0x94
+	HeaderDestName              HeaderID = 0x15
+	HeaderPermissions           HeaderID = 0xD6
+	HeaderSRM                   HeaderID = 0x97
+	HeaderSRMParameters         HeaderID = 0x98
+)
+
+// Header is a header of a packet. Value is the encoded value: UTF-16 with a null terminator for the unicode headers,
+// and big endian for the 4 bytes ones.
+type Header struct {
+	ID    HeaderID
+	Value []byte
+}
+
+// UnicodeHeader returns the unicode header, such as a name.
+func UnicodeHeader(id HeaderID, s string) Header {
+	if s == "" {
+		// The empty names, of the parent folders or of the default objects, have no value at all.
+		return Header{ID: id}
+	}
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u)+2)
+	for i, r := range u {
+		binary.BigEndian.PutUint16(b[2*i:], r)
+	}
+	return Header{ID: id, Value: b}
+}
+
+// BytesHeader returns the byte sequence header, such as a type, a body or a target.
+func BytesHeader(id HeaderID, b []byte) Header {
+	return Header{ID: id, Value: b}
+}
+
+// Uint8Header returns the 1 byte header.
+func Uint8Header(id HeaderID, v uint8) Header {
+	return Header{ID: id, Value: []byte{v}}
+}
+
+// Uint32Header returns the 4 bytes header, such as a length or a connection identifier.
+func Uint32Header(id HeaderID, v uint32) Header {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return Header{ID: id, Value: b}
+}
+
+// TypeHeader returns the type header of the MIME type, a null terminated ASCII string.
+func TypeHeader(mimeType string) Header {
+	return Header{ID: HeaderType, Value: append([]byte(mimeType), 0x00)}
+}
+
+// String returns the value of a unicode header, or of a null terminated byte sequence such as a type.
+func (h Header) String() string {
+	if h.ID&encodingMask == encodingBytes {
+		b := h.Value
+		if len(b) > 0 && b[len(b)-1] == 0x00 {
+			b = b[:len(b)-1]
+		}
+		return string(b)
+	}
+	u := make([]uint16, 0, len(h.Value)/2)
+	for i := 0; i+1 < len(h.Value); i += 2 {
+		if r := binary.BigEndian.Uint16(h.Value[i:]); r != 0x0000 {
+			u = append(u, r)
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+// Uint8 returns the value of a 1 byte header.
+func (h Header) Uint8() uint8 {
+	if len(h.Value) < 1 {
+		return 0
+	}
+	return h.Value[0]
+}
+
+// Uint32 returns the value of a 4 bytes header.
+func (h Header) Uint32() uint32 {
+	if len(h.Value) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(h.Value)
+}
+
+// size returns the length of the encoded header.
+func (h Header) size() int {
+	switch h.ID & encodingMask {
+	case encodingUint8:
+		return 2
+	case encodingUint32:
+		return 5
+	default:
+		return 3 + len(h.Value)
+	}
+}
+
+// marshal encodes the header into b, which is at least size bytes long.
+func (h Header) marshal(b []byte) error {
+	b[0] = byte(h.ID)
+	switch h.ID & encodingMask {
+	case encodingUint8:
+		if len(h.Value) != 1 {
+			return fmt.Errorf("invalid value of 1 byte header 0x%02X", uint8(h.ID))
+		}
+		b[1] = h.Value[0]
+	case encodingUint32:
+		if len(h.Value) != 4 {
+			return fmt.Errorf("invalid value of 4 bytes header 0x%02X", uint8(h.ID))
+		}
+		copy(b[1:5], h.Value)
+	default:
+		if 3+len(h.Value) > 0xFFFF {
+			return fmt.Errorf("header 0x%02X of %d bytes too long", uint8(h.ID), len(h.Value))
+		}
+		binary.BigEndian.PutUint16(b[1:3], uint16(3+len(h.Value)))
+		copy(b[3:], h.Value)
+	}
+	return nil
+}
+
+// Headers are the headers of a packet, in order.
+type Headers []Header
+
+// Get returns the first header of the identifier, and whether there is one.
+func (hs Headers) Get(id HeaderID) (Header, bool) {
+	for _, h := range hs {
+		if h.ID == id {
+			return h, true
+		}
+	}
+	return Header{}, false
+}
+
+// Name returns the value of the name header, empty if none.
+func (hs Headers) Name() string {
+	h, _ := hs.Get(HeaderName)
+	return h.String()
+}
+
+// Type returns the value of the type header, empty if none.
+func (hs Headers) Type() string {
+	h, _ := hs.Get(HeaderType)
+	return h.String()
+}
+
+// Length returns the value of the length header, and whether there is one.
+func (hs Headers) Length() (uint32, bool) {
+	h, ok := hs.Get(HeaderLength)
+	return h.Uint32(), ok
+}
+
+// without returns the headers but those of the identifiers.
+func (hs Headers) without(ids ...HeaderID) Headers {
+	var out Headers
+	for _, h := range hs {
+		keep := true
+		for _, id := range ids {
+			keep = keep && h.ID != id
+		}
+		if keep {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// size returns the length of the encoded headers.
+func (hs Headers) size() int {
+	var n int
+	for _, h := range hs {
+		n += h.size()
+	}
+	return n
+}
+
+// unmarshalHeaders decodes the headers.
+func unmarshalHeaders(b []byte) (Headers, error) {
+	var hs Headers
+	for len(b) > 0 {
+		h := Header{ID: HeaderID(b[0])}
+		// n is the length of the header, and off the offset of its value.
+		n, off := 0, 1
+		switch h.ID & encodingMask {
+		case encodingUint8:
+			n = 2
+		case encodingUint32:
+			n = 5
+		default:
+			off = 3
+			if len(b) < 3 {
+				return nil, fmt.Errorf("header 0x%02X truncated", b[0])
+			}
+			n = int(binary.BigEndian.Uint16(b[1:3]))
+			if n < 3 {
+				return nil, fmt.Errorf("invalid length %d of header 0x%02X", n, b[0])
+			}
+		}
+		if len(b) < n {
+			return nil, fmt.Errorf("header 0x%02X truncated", b[0])
+		}
+		h.Value = append([]byte(nil), b[off:n]...)
+		hs = append(hs, h)
+		b = b[n:]
+	}
+	return hs, nil
+}
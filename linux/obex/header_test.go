@@ -0,0 +1,83 @@
+package obex
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	hs := Headers{
+		Uint32Header(HeaderConnectionID, 0x01020304),
+		UnicodeHeader(HeaderName, "é.txt"),
+		TypeHeader(VCardType),
+		Uint8Header(HeaderSRM, srmEnable),
+		BytesHeader(HeaderEndOfBody, nil),
+		UnicodeHeader(HeaderName, ""),
+	}
+	b := make([]byte, hs.size())
+	off := 0
+	for _, h := range hs {
+		if err := h.marshal(b[off:]); err != nil {
+			t.Fatalf("Error marshalling header: %s", err)
+		}
+		off += h.size()
+	}
+	expected := []byte{
+		0xCB, 0x01, 0x02, 0x03, 0x04,
+		0x01, 0x00, 0x0F, 0x00, 0xE9, 0x00, '.', 0x00, 't', 0x00, 'x', 0x00, 't', 0x00, 0x00,
+		0x42, 0x00, 0x10, 't', 'e', 'x', 't', '/', 'x', '-', 'v', 'c', 'a', 'r', 'd', 0x00,
+		0x97, 0x01,
+		0x49, 0x00, 0x03,
+		0x01, 0x00, 0x03,
+	}
+	if !bytes.Equal(b, expected) {
+		t.Fatalf("Expected: %X, Received: %X", expected, b)
+	}
+
+	decoded, err := unmarshalHeaders(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling headers: %s", err)
+	}
+	if len(decoded) != len(hs) {
+		t.Fatalf("Expected: %d headers, Received: %d", len(hs), len(decoded))
+	}
+	for i := range hs {
+		if decoded[i].ID != hs[i].ID || !bytes.Equal(decoded[i].Value, hs[i].Value) {
+			t.Fatalf("Expected: %+v, Received: %+v", hs[i], decoded[i])
+		}
+	}
+	if id, _ := decoded.Get(HeaderConnectionID); id.Uint32() != 0x01020304 {
+		t.Fatalf("Expected: %X, Received: %X", 0x01020304, id.Uint32())
+	}
+	if name := decoded.Name(); name != "é.txt" {
+		t.Fatalf("Expected: %s, Received: %s", "é.txt", name)
+	}
+	if typ := decoded.Type(); typ != VCardType {
+		t.Fatalf("Expected: %s, Received: %s", VCardType, typ)
+	}
+	if _, ok := decoded.Length(); ok {
+		t.Fatalf("Expected no length header")
+	}
+	if !srmEnabled(decoded) {
+		t.Fatalf("Expected single response mode enabled")
+	}
+	if rest := decoded.without(HeaderName, HeaderSRM); !reflect.DeepEqual(rest, Headers{decoded[0], decoded[2],
+		decoded[4]}) {
+		t.Fatalf("Expected: %+v, Received: %+v", Headers{decoded[0], decoded[2], decoded[4]}, rest)
+	}
+}
+
+func TestUnmarshalHeadersTruncated(t *testing.T) {
+	for _, b := range [][]byte{
+		{0xCB, 0x01, 0x02},
+		{0x97},
+		{0x48, 0x00},
+		{0x48, 0x00, 0x02},
+		{0x48, 0x00, 0x05, 0x01},
+	} {
+		if _, err := unmarshalHeaders(b); err == nil {
+			t.Fatalf("Expected error unmarshalling %X", b)
+		}
+	}
+}
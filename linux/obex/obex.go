@@ -0,0 +1,124 @@
+// Package obex implements the Object Exchange protocol, OBEX, over an RFCOMM DLC or an L2CAP channel: the packets and
+// headers, the client and server sessions with the single response mode of GOEP 2.0, and the Object Push Profile.
+// The authentication of the sessions is not handled.
+package obex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Opcodes of the requests [OBEX 3.4]. The final bit is set on the last packet of a request.
+const (
+	OpConnect    = 0x80
+	OpDisconnect = 0x81
+	OpPut        = 0x02
+	OpGet        = 0x03
+	OpSetPath    = 0x85
+	OpAbort      = 0xFF
+
+	// FinalBit is set on the last packet of the requests, and on the response codes.
+	FinalBit = 0x80
+)
+
+// Version is the version of OBEX the connect packets report, 1.0.
+const Version = 0x10
+
+const (
+	// MinPacketLength is the smallest maximum packet length devices negotiate, and the length of the packets sent
+	// before the connection [OBEX 3.4.1.4].
+	MinPacketLength = 255
+
+	// DefaultMaxPacketLength is the maximum packet length proposed by default, the largest one. Over L2CAP, the
+	// packets are sent as SDUs and must not exceed the MTU of the channel.
+	DefaultMaxPacketLength = 0xFFFF
+)
+
+// ResponseCode is the code of a response [OBEX 3.2.1]. The codes other than Continue and Success are returned as
+// errors.
+type ResponseCode uint8
+
+// Response codes, with their final bit set.
+const (
+	Continue            ResponseCode = 0x90
+	Success             ResponseCode = 0xA0
+	Created             ResponseCode = 0xA1
+	Accepted            ResponseCode = 0xA2
+	BadRequest          ResponseCode = 0xC0
+	Unauthorized        ResponseCode = 0xC1
+	Forbidden           ResponseCode = 0xC3
+	NotFound            ResponseCode = 0xC4
+	MethodNotAllowed    ResponseCode = 0xC5
+	NotAcceptable       ResponseCode = 0xC6
+	RequestTimeOut      ResponseCode = 0xC8
+	Conflict            ResponseCode = 0xC9
+	LengthRequired      ResponseCode = 0xCB
+	PreconditionFailed  ResponseCode = 0xCC
+	EntityTooLarge      ResponseCode = 0xCD
+	UnsupportedMedia    ResponseCode = 0xCF
+	InternalServerError ResponseCode = 0xD0
+	NotImplemented      ResponseCode = 0xD1
+	ServiceUnavailable  ResponseCode = 0xD3
+	DatabaseFull        ResponseCode = 0xE0
+	DatabaseLocked      ResponseCode = 0xE1
+)
+
+var responseNames = map[ResponseCode]string{
+	Continue:            "continue",
+	Success:             "success",
+	Created:             "created",
+	Accepted:            "accepted",
+	BadRequest:          "bad request",
+	Unauthorized:        "unauthorized",
+	Forbidden:           "forbidden",
+	NotFound:            "not found",
+	MethodNotAllowed:    "method not allowed",
+	NotAcceptable:       "not acceptable",
+	RequestTimeOut:      "request time out",
+	Conflict:            "conflict",
+	LengthRequired:      "length required",
+	PreconditionFailed:  "precondition failed",
+	EntityTooLarge:      "request entity too large",
+	UnsupportedMedia:    "unsupported media type",
+	InternalServerError: "internal server error",
+	NotImplemented:      "not implemented",
+	ServiceUnavailable:  "service unavailable",
+	DatabaseFull:        "database full",
+	DatabaseLocked:      "database locked",
+}
+
+func (c ResponseCode) Error() string {
+	if s, ok := responseNames[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("response code 0x%02X", uint8(c))
+}
+
+// successful reports whether the response code completes the request.
+func (c ResponseCode) successful() bool {
+	return c == Success || c == Created || c == Accepted
+}
+
+// ErrAborted is returned once the remote device aborted the operation.
+var ErrAborted = errors.New("operation aborted")
+
+// SetPathFlags are the flags of the SETPATH requests [OBEX 3.4.6.1].
+type SetPathFlags uint8
+
+// SETPATH flags.
+const (
+	// SetPathParent backs up a level, to the parent folder, before applying the name if any.
+	SetPathParent SetPathFlags = 0x01
+
+	// SetPathNoCreate fails rather than create the folder if it does not exist.
+	SetPathNoCreate SetPathFlags = 0x02
+)
+
+// Values of the single response mode headers [GOEP 4.6].
+const (
+	srmDisable   = 0x00
+	srmEnable    = 0x01
+	srmSupported = 0x02
+
+	srmpWait = 0x01
+)
@@ -0,0 +1,206 @@
+package obex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// store is a Handler storing the objects of a single folder.
+type store struct {
+	objects map[string][]byte
+	path    []string
+}
+
+func (s *store) Put(req *Request) (Headers, error) {
+	name := req.Headers.Name()
+	if req.Body == nil {
+		if _, ok := s.objects[name]; !ok {
+			return nil, NotFound
+		}
+		delete(s.objects, name)
+		return nil, nil
+	}
+	if n, ok := req.Headers.Length(); ok && n > 1<<20 {
+		return nil, EntityTooLarge
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.objects[name] = b
+	return Headers{UnicodeHeader(HeaderDescription, "stored")}, nil
+}
+
+func (s *store) Get(req *Request) (Headers, io.Reader, error) {
+	b, ok := s.objects[req.Headers.Name()]
+	if !ok {
+		return nil, nil, NotFound
+	}
+	return Headers{Uint32Header(HeaderLength, uint32(len(b)))}, bytes.NewReader(b), nil
+}
+
+func (s *store) SetPath(req *Request) error {
+	switch {
+	case req.Flags&SetPathParent != 0 && len(s.path) == 0:
+		return NotFound
+	case req.Flags&SetPathParent != 0:
+		s.path = s.path[:len(s.path)-1]
+	case req.Headers.Name() == "":
+		s.path = nil
+	default:
+		s.path = append(s.path, req.Headers.Name())
+	}
+	return nil
+}
+
+// pair connects a client to a server over a pipe, and returns the client and the channel receiving the error of the
+// server.
+func pair(t *testing.T, cp ClientParams, sp ServerParams) (*Client, <-chan error) {
+	t.Helper()
+	c, s := net.Pipe()
+	t.Cleanup(func() { _ = c.Close() })
+	ch := make(chan error, 1)
+	go func() { ch <- NewServer(slog.Default(), sp).Serve(s) }()
+	return NewClient(slog.Default(), c, cp), ch
+}
+
+func TestClientServer(t *testing.T) {
+	target := []byte{0xF9, 0xEC, 0x7B, 0xC4, 0x95, 0x3C, 0x11, 0xD2, 0x98, 0x4E, 0x52, 0x54, 0x00, 0xDC, 0x9E, 0x09}
+	body := bytes.Repeat([]byte("0123456789"), 200)
+	for _, srm := range []bool{false, true} {
+		s := &store{objects: map[string][]byte{}}
+		cl, chServer := pair(t,
+			ClientParams{Target: target, MaxPacketLength: MinPacketLength, SRM: srm},
+			ServerParams{Target: target, MaxPacketLength: 300, SRM: srm, Handler: s})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+		hs, err := cl.Connect(ctx)
+		if err != nil {
+			t.Fatalf("Error connecting: %s", err)
+		}
+		if who, _ := hs.Get(HeaderWho); !bytes.Equal(who.Value, target) {
+			t.Fatalf("Expected: %X, Received: %X", target, who.Value)
+		}
+		if !cl.hasConnID || cl.c.txMax != 300 {
+			t.Fatalf("Expected: connection identifier and max packet length 300, Received: %t, %d", cl.hasConnID,
+				cl.c.txMax)
+		}
+
+		hs, err = cl.Put(ctx, Headers{UnicodeHeader(HeaderName, "a.txt")}, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error putting: %s", err)
+		}
+		if d, _ := hs.Get(HeaderDescription); d.String() != "stored" {
+			t.Fatalf("Expected: %s, Received: %s", "stored", d.String())
+		}
+		if !bytes.Equal(s.objects["a.txt"], body) {
+			t.Fatalf("Expected: %d bytes, Received: %d", len(body), len(s.objects["a.txt"]))
+		}
+
+		var buf bytes.Buffer
+		hs, err = cl.Get(ctx, Headers{UnicodeHeader(HeaderName, "a.txt")}, &buf)
+		if err != nil {
+			t.Fatalf("Error getting: %s", err)
+		}
+		if n, _ := hs.Length(); int(n) != len(body) || !bytes.Equal(buf.Bytes(), body) {
+			t.Fatalf("Expected: %d bytes, Received: %d, %d", len(body), n, buf.Len())
+		}
+
+		if _, err = cl.Get(ctx, Headers{UnicodeHeader(HeaderName, "b.txt")}, &buf); !errors.Is(err, NotFound) {
+			t.Fatalf("Expected: %s, Received: %v", NotFound, err)
+		}
+		_, err = cl.Put(ctx, Headers{UnicodeHeader(HeaderName, "b.txt"), Uint32Header(HeaderLength, 2<<20)},
+			strings.NewReader("too large"))
+		if !errors.Is(err, EntityTooLarge) {
+			t.Fatalf("Expected: %s, Received: %v", EntityTooLarge, err)
+		}
+		if _, err = cl.Put(ctx, Headers{UnicodeHeader(HeaderName, "a.txt")}, nil); err != nil {
+			t.Fatalf("Error deleting: %s", err)
+		}
+		if _, ok := s.objects["a.txt"]; ok {
+			t.Fatalf("Expected object deleted")
+		}
+
+		if err = cl.SetPath(ctx, "folder", 0); err != nil {
+			t.Fatalf("Error setting path: %s", err)
+		}
+		if err = cl.SetPath(ctx, "", SetPathParent); err != nil {
+			t.Fatalf("Error setting path: %s", err)
+		}
+		if err = cl.SetPath(ctx, "", SetPathParent); !errors.Is(err, NotFound) {
+			t.Fatalf("Expected: %s, Received: %v", NotFound, err)
+		}
+
+		if err = cl.Disconnect(ctx); err != nil {
+			t.Fatalf("Error disconnecting: %s", err)
+		}
+		_ = cl.c.w.(net.Conn).Close()
+		if err = <-chServer; err != nil {
+			t.Fatalf("Error serving: %s", err)
+		}
+		cancel()
+	}
+}
+
+func TestConnectTarget(t *testing.T) {
+	cl, _ := pair(t, ClientParams{}, ServerParams{Target: []byte{0x01}, Handler: &store{}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := cl.Connect(ctx); !errors.Is(err, ServiceUnavailable) {
+		t.Fatalf("Expected: %s, Received: %v", ServiceUnavailable, err)
+	}
+	if err := cl.SetPath(ctx, "", 0); !errors.Is(err, ServiceUnavailable) {
+		t.Fatalf("Expected: %s, Received: %v", ServiceUnavailable, err)
+	}
+}
+
+func TestObjectPush(t *testing.T) {
+	var received string
+	opp := &ObjectPush{
+		Receive: func(name string, mimeType string, body io.Reader) error {
+			if mimeType != "text/plain" {
+				return UnsupportedMedia
+			}
+			b, err := io.ReadAll(body)
+			received = name + ":" + string(b)
+			return err
+		},
+		BusinessCard: func() ([]byte, error) {
+			return []byte("BEGIN:VCARD\r\nVERSION:2.1\r\nN:Doe;John\r\nEND:VCARD\r\n"), nil
+		},
+	}
+	cl, _ := pair(t, ClientParams{}, ServerParams{Handler: opp})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := cl.Connect(ctx); err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	if err := cl.PushObject(ctx, "note.txt", "text/plain", strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("Error pushing: %s", err)
+	}
+	if received != "note.txt:hello" {
+		t.Fatalf("Expected: %s, Received: %s", "note.txt:hello", received)
+	}
+	err := cl.PushObject(ctx, "a.jpg", "image/jpeg", strings.NewReader("jpeg"), -1)
+	if !errors.Is(err, UnsupportedMedia) {
+		t.Fatalf("Expected: %s, Received: %v", UnsupportedMedia, err)
+	}
+	var card bytes.Buffer
+	if err = cl.PullBusinessCard(ctx, &card); err != nil {
+		t.Fatalf("Error pulling business card: %s", err)
+	}
+	if !strings.Contains(card.String(), "N:Doe;John") {
+		t.Fatalf("Expected: business card, Received: %q", card.String())
+	}
+	if err = cl.SetPath(ctx, "folder", 0); !errors.Is(err, Forbidden) {
+		t.Fatalf("Expected: %s, Received: %v", Forbidden, err)
+	}
+}
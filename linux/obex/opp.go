@@ -0,0 +1,73 @@
+package obex
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// VCardType is the type of the business cards of the Object Push Profile, vCard 2.1 or 3.0.
+const VCardType = "text/x-vcard"
+
+// PushObject pushes the object to the inbox of an Object Push server [OPP 5.2]. The length, if not negative, is sent
+// so that the server can refuse the objects too large before they are sent.
+func (cl *Client) PushObject(ctx context.Context, name string, mimeType string, body io.Reader, length int64) error {
+	hs := Headers{UnicodeHeader(HeaderName, name)}
+	if mimeType != "" {
+		hs = append(hs, TypeHeader(mimeType))
+	}
+	if length >= 0 && length <= 0xFFFFFFFF {
+		hs = append(hs, Uint32Header(HeaderLength, uint32(length)))
+	}
+	if body == nil {
+		// A nil body would delete the object, which pushes do not.
+		body = bytes.NewReader(nil)
+	}
+	_, err := cl.Put(ctx, hs, body)
+	return err
+}
+
+// PullBusinessCard pulls the default business card of an Object Push server, its owner's, and writes it to w
+// [OPP 5.3].
+func (cl *Client) PullBusinessCard(ctx context.Context, w io.Writer) error {
+	_, err := cl.Get(ctx, Headers{TypeHeader(VCardType)}, w)
+	return err
+}
+
+// ObjectPush is the Handler of an Object Push server, which serves the clients connecting without target.
+type ObjectPush struct {
+	// Receive receives the pushed object. Returning a ResponseCode, such as EntityTooLarge or UnsupportedMedia,
+	// refuses the object.
+	Receive func(name string, mimeType string, body io.Reader) error
+
+	// BusinessCard returns the default business card, if the server serves one.
+	BusinessCard func() ([]byte, error)
+}
+
+// Put receives the pushed object. Deleting objects is forbidden.
+func (o *ObjectPush) Put(req *Request) (Headers, error) {
+	if req.Body == nil || o.Receive == nil {
+		return nil, Forbidden
+	}
+	return nil, o.Receive(req.Headers.Name(), req.Headers.Type(), req.Body)
+}
+
+// Get serves the default business card, the only object clients can pull.
+func (o *ObjectPush) Get(req *Request) (Headers, io.Reader, error) {
+	if req.Headers.Type() != VCardType || req.Headers.Name() != "" {
+		return nil, nil, Forbidden
+	}
+	if o.BusinessCard == nil {
+		return nil, nil, NotFound
+	}
+	card, err := o.BusinessCard()
+	if err != nil {
+		return nil, nil, err
+	}
+	return Headers{TypeHeader(VCardType)}, bytes.NewReader(card), nil
+}
+
+// SetPath is forbidden, the inbox having no folders.
+func (o *ObjectPush) SetPath(*Request) error {
+	return Forbidden
+}
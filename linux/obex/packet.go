@@ -0,0 +1,129 @@
+package obex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// packet is a request or a response [OBEX 3.1].
+type packet struct {
+	// code is the opcode of the request, or the response code.
+	code uint8
+
+	// fields are those of the connect and SETPATH packets, which precede the headers.
+	fields []byte
+
+	headers Headers
+}
+
+func (p *packet) size() int { return 3 + len(p.fields) + p.headers.size() }
+
+// marshal encodes the packet.
+func (p *packet) marshal() ([]byte, error) {
+	n := p.size()
+	if n > 0xFFFF {
+		return nil, fmt.Errorf("packet of %d bytes too long", n)
+	}
+	b := make([]byte, n)
+	b[0] = p.code
+	binary.BigEndian.PutUint16(b[1:3], uint16(n))
+	off := 3 + copy(b[3:], p.fields)
+	for _, h := range p.headers {
+		if err := h.marshal(b[off:]); err != nil {
+			return nil, err
+		}
+		off += h.size()
+	}
+	return b, nil
+}
+
+// connectFields returns the fields of the connect packets.
+func connectFields(maxPacketLength uint16) []byte {
+	b := []byte{Version, 0x00, 0x00, 0x00}
+	binary.BigEndian.PutUint16(b[2:], maxPacketLength)
+	return b
+}
+
+// conn reads and writes the packets of a session.
+type conn struct {
+	w io.Writer
+	r *bufio.Reader
+
+	// deadliner is the stream if it supports deadlines, as the RFCOMM DLCs and L2CAP channels do.
+	deadliner interface{ SetDeadline(time.Time) error }
+
+	// rxMax is the largest packet the local device accepts, txMax the largest one the remote device does.
+	rxMax int
+	txMax int
+}
+
+func newConn(rw io.ReadWriter, rxMax uint16) *conn {
+	if rxMax < MinPacketLength {
+		rxMax = DefaultMaxPacketLength
+	}
+	// The buffer holds the largest packet, so that the channels keeping the boundaries of the SDUs, which send a
+	// packet per SDU, are read an SDU at a time.
+	c := &conn{w: rw, r: bufio.NewReaderSize(rw, DefaultMaxPacketLength), rxMax: int(rxMax), txMax: MinPacketLength}
+	c.deadliner, _ = rw.(interface{ SetDeadline(time.Time) error })
+	return c
+}
+
+// write sends the packet as one write.
+func (c *conn) write(p *packet) error {
+	b, err := p.marshal()
+	if err != nil {
+		return err
+	}
+	if len(b) > c.txMax {
+		return fmt.Errorf("packet of %d bytes exceeds maximum packet length %d", len(b), c.txMax)
+	}
+	if _, err = c.w.Write(b); err != nil {
+		return fmt.Errorf("unable to write packet: %w", err)
+	}
+	return nil
+}
+
+// read reads the next packet. fieldsLen returns the length of the fields preceding the headers of the packets of the
+// code.
+func (c *conn) read(fieldsLen func(code uint8) int) (*packet, error) {
+	hdr := make([]byte, 3)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[1:3]))
+	if n < 3 || n > c.rxMax {
+		return nil, fmt.Errorf("invalid packet length %d", n)
+	}
+	b := make([]byte, n-3)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, fmt.Errorf("packet truncated: %w", err)
+	}
+	p := &packet{code: hdr[0]}
+	if m := fieldsLen(p.code); m > 0 {
+		if len(b) < m {
+			return nil, fmt.Errorf("packet 0x%02X truncated", p.code)
+		}
+		p.fields, b = b[:m], b[m:]
+	}
+	hs, err := unmarshalHeaders(b)
+	if err != nil {
+		return nil, err
+	}
+	p.headers = hs
+	return p, nil
+}
+
+// setDeadline sets the deadline of the stream, if it supports deadlines.
+func (c *conn) setDeadline(t time.Time) {
+	if c.deadliner != nil {
+		_ = c.deadliner.SetDeadline(t)
+	}
+}
+
+// bodyRoom returns the room left for a body in a packet of the size.
+func (c *conn) bodyRoom(size int) int {
+	return c.txMax - size - 3
+}
@@ -0,0 +1,378 @@
+package obex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/thomascriley/ble/log"
+)
+
+// Request is a PUT, GET or SETPATH request of a client.
+type Request struct {
+	// Op is the opcode of the request without its final bit: OpPut, OpGet or OpSetPath.
+	Op uint8
+
+	// Headers are the headers of the request but the body, the connection identifier and the single response mode
+	// ones.
+	Headers Headers
+
+	// Body is the body of a PUT request, read as its packets are received. It is nil for the PUT requests deleting
+	// the object, which have no body at all.
+	Body io.Reader
+
+	// Flags are the flags of a SETPATH request.
+	Flags SetPathFlags
+}
+
+// Handler handles the requests of the clients of a server. A ResponseCode returned as error is sent as is, the other
+// errors as InternalServerError.
+type Handler interface {
+	// Put receives the object of the request, and returns the headers of the final response.
+	Put(req *Request) (Headers, error)
+
+	// Get returns the headers and the body of the object of the request. The headers are sent with the first
+	// response. The body is closed once sent, if it is an io.Closer.
+	Get(req *Request) (Headers, io.Reader, error)
+
+	// SetPath changes the current folder of the session.
+	SetPath(req *Request) error
+}
+
+// ServerParams are the parameters of an OBEX server.
+type ServerParams struct {
+	// Target is the UUID of the service of the server, such as the folder browsing service of FTP. The clients then
+	// connect to it with the same target, and are assigned a connection identifier. The clients of the servers
+	// without target, such as the inbox of OPP, connect without target.
+	Target []byte
+
+	// MaxPacketLength is the largest packet the server accepts, DefaultMaxPacketLength if 0.
+	MaxPacketLength uint16
+
+	// SRM enables the single response mode, which GOEP 2.0 only allows over L2CAP, for the clients requesting it.
+	SRM bool
+
+	Handler Handler
+}
+
+// Server serves the OBEX sessions of the clients with a Handler.
+type Server struct {
+	log *slog.Logger
+	p   ServerParams
+
+	// connID is the last connection identifier assigned.
+	connID atomic.Uint32
+}
+
+// NewServer returns an OBEX server.
+func NewServer(logger *slog.Logger, p ServerParams) *Server {
+	if p.MaxPacketLength == 0 {
+		p.MaxPacketLength = DefaultMaxPacketLength
+	}
+	return &Server{log: logger.With("server", "obex"), p: p}
+}
+
+// Serve serves the session of the client over the stream, such as an accepted RFCOMM DLC or L2CAP channel, until it
+// is closed. It returns nil once the stream reaches io.EOF.
+func (s *Server) Serve(rw io.ReadWriter) error {
+	ss := &session{s: s, c: newConn(rw, s.p.MaxPacketLength)}
+	for {
+		p, err := ss.c.read(requestFields)
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+		if err = ss.handle(p); err != nil {
+			return err
+		}
+	}
+}
+
+// requestFields returns the length of the fields of the requests of the opcode.
+func requestFields(code uint8) int {
+	switch code {
+	case OpConnect:
+		return 4
+	case OpSetPath:
+		return 2
+	}
+	return 0
+}
+
+// session is the session of a client.
+type session struct {
+	s *Server
+	c *conn
+
+	connected bool
+	connID    uint32
+}
+
+// handle answers the first packet of a request.
+func (ss *session) handle(p *packet) error {
+	op := p.code &^ FinalBit
+	if p.code == OpAbort {
+		// There is no operation in progress.
+		return ss.reply(Success, nil)
+	}
+	if p.code == OpConnect {
+		return ss.connect(p)
+	}
+	if !ss.connected {
+		return ss.reply(ServiceUnavailable, nil)
+	}
+	if h, ok := p.headers.Get(HeaderConnectionID); ss.s.p.Target != nil && (!ok || h.Uint32() != ss.connID) {
+		return ss.reply(ServiceUnavailable, nil)
+	}
+	switch {
+	case p.code == OpDisconnect:
+		ss.connected = false
+		return ss.reply(Success, nil)
+	case op == OpPut:
+		return ss.put(p)
+	case op == OpGet:
+		return ss.get(p)
+	case p.code == OpSetPath:
+		err := ss.s.p.Handler.SetPath(&Request{Op: OpSetPath, Headers: requestHeaders(p.headers),
+			Flags: SetPathFlags(p.fields[0])})
+		return ss.reply(ss.responseCode(err), nil)
+	}
+	return ss.reply(NotImplemented, nil)
+}
+
+// connect answers the connect request [OBEX 3.4.1].
+func (ss *session) connect(p *packet) error {
+	if n := int(binary.BigEndian.Uint16(p.fields[2:4])); n >= MinPacketLength {
+		ss.c.txMax = n
+	}
+	var hs Headers
+	if target := ss.s.p.Target; target != nil {
+		if h, ok := p.headers.Get(HeaderTarget); !ok || !bytes.Equal(h.Value, target) {
+			return ss.c.write(&packet{code: uint8(ServiceUnavailable), fields: connectFields(ss.s.p.MaxPacketLength)})
+		}
+		ss.connID = ss.s.connID.Add(1)
+		hs = Headers{Uint32Header(HeaderConnectionID, ss.connID), BytesHeader(HeaderWho, target)}
+	}
+	ss.connected = true
+	return ss.c.write(&packet{code: uint8(Success), fields: connectFields(ss.s.p.MaxPacketLength), headers: hs})
+}
+
+// put receives the object of the PUT request.
+func (ss *session) put(first *packet) error {
+	req := &Request{Op: OpPut, Headers: requestHeaders(first.headers)}
+	body := &putBody{ss: ss, srm: ss.s.p.SRM && srmEnabled(first.headers)}
+	body.receive(first)
+	if !body.final || hasBody(first.headers) {
+		req.Body = body
+	}
+	hs, err := ss.s.p.Handler.Put(req)
+	if body.err != nil {
+		// The client aborted the request, or the stream failed.
+		if errors.Is(body.err, ErrAborted) {
+			return nil
+		}
+		return body.err
+	}
+	// The packets left are read before the final response, unless they wait for the response to the last one read.
+	if err == nil || body.srm {
+		if _, derr := io.Copy(io.Discard, body); derr != nil {
+			if errors.Is(derr, ErrAborted) {
+				return nil
+			}
+			return derr
+		}
+	}
+	code := ss.responseCode(err)
+	if code == Success && !body.final {
+		code = InternalServerError
+	}
+	return ss.reply(code, hs)
+}
+
+// putBody reads the body of a PUT request from its packets, answering them as the next one is needed.
+type putBody struct {
+	ss *session
+
+	// srm reports whether the request uses the single response mode, announced once the first packet is answered.
+	srm       bool
+	announced bool
+
+	// rx is the body of the last packet read, and final reports whether it was the last one.
+	rx    []byte
+	final bool
+
+	err error
+}
+
+// receive reads the body of the packet.
+func (b *putBody) receive(p *packet) {
+	b.final = p.code&FinalBit != 0
+	for _, h := range p.headers {
+		if h.ID == HeaderBody || h.ID == HeaderEndOfBody {
+			b.rx = append(b.rx, h.Value...)
+		}
+	}
+}
+
+func (b *putBody) Read(p []byte) (int, error) {
+	for len(b.rx) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		if b.final {
+			return 0, io.EOF
+		}
+		b.err = b.next()
+	}
+	n := copy(p, b.rx)
+	b.rx = b.rx[n:]
+	return n, nil
+}
+
+// next answers the last packet read, and reads the next one.
+func (b *putBody) next() error {
+	switch {
+	case b.srm && !b.announced:
+		b.announced = true
+		if err := b.ss.c.write(&packet{code: uint8(Continue), headers: Headers{Uint8Header(HeaderSRM,
+			srmEnable)}}); err != nil {
+			return err
+		}
+	case !b.srm:
+		if err := b.ss.reply(Continue, nil); err != nil {
+			return err
+		}
+	}
+	p, err := b.ss.c.read(requestFields)
+	if err != nil {
+		return fmt.Errorf("unable to read put packet: %w", err)
+	}
+	switch p.code &^ FinalBit {
+	case OpPut:
+		b.receive(p)
+		return nil
+	case OpAbort &^ FinalBit:
+		if err := b.ss.reply(Success, nil); err != nil {
+			return err
+		}
+		return ErrAborted
+	}
+	if err := b.ss.reply(BadRequest, nil); err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected packet 0x%02X during put", p.code)
+}
+
+// get sends the object of the GET request.
+func (ss *session) get(first *packet) error {
+	srm := ss.s.p.SRM && srmEnabled(first.headers)
+	// The headers of the request span the packets until the final one [OBEX 3.4.4].
+	hs := first.headers
+	for p := first; p.code&FinalBit == 0; {
+		if err := ss.reply(Continue, nil); err != nil {
+			return err
+		}
+		var err error
+		if p, err = ss.c.read(requestFields); err != nil {
+			return fmt.Errorf("unable to read get packet: %w", err)
+		}
+		switch p.code &^ FinalBit {
+		case OpGet:
+			hs = append(hs, p.headers...)
+		case OpAbort &^ FinalBit:
+			return ss.reply(Success, nil)
+		default:
+			return ss.reply(BadRequest, nil)
+		}
+	}
+
+	rspHeaders, body, err := ss.s.p.Handler.Get(&Request{Op: OpGet, Headers: requestHeaders(hs)})
+	if err != nil {
+		return ss.reply(ss.responseCode(err), nil)
+	}
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close()
+	}
+	if srm {
+		rspHeaders = append(rspHeaders, Uint8Header(HeaderSRM, srmEnable))
+	}
+	buf := make([]byte, ss.c.txMax)
+	for {
+		p := &packet{code: uint8(Continue), headers: rspHeaders}
+		rspHeaders = nil
+		n, final := 0, body == nil
+		if room := ss.c.bodyRoom(p.size()); room > 0 && body != nil {
+			n, err = io.ReadFull(body, buf[:room])
+			switch {
+			case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+				final = true
+			case err != nil:
+				ss.s.log.Debug("unable to read body", log.Error(err))
+				return ss.reply(InternalServerError, nil)
+			}
+		}
+		if final {
+			p.code = uint8(Success)
+			p.headers = append(p.headers, BytesHeader(HeaderEndOfBody, buf[:n]))
+		} else {
+			p.headers = append(p.headers, BytesHeader(HeaderBody, buf[:n]))
+		}
+		if err = ss.c.write(p); err != nil || final {
+			return err
+		}
+		if srm {
+			continue
+		}
+
+		next, err := ss.c.read(requestFields)
+		if err != nil {
+			return fmt.Errorf("unable to read get packet: %w", err)
+		}
+		switch next.code &^ FinalBit {
+		case OpGet:
+		case OpAbort &^ FinalBit:
+			return ss.reply(Success, nil)
+		default:
+			return ss.reply(BadRequest, nil)
+		}
+	}
+}
+
+// reply sends the response.
+func (ss *session) reply(code ResponseCode, hs Headers) error {
+	return ss.c.write(&packet{code: uint8(code), headers: hs})
+}
+
+// responseCode returns the response code of the error of the handler.
+func (ss *session) responseCode(err error) ResponseCode {
+	var code ResponseCode
+	switch {
+	case err == nil:
+		return Success
+	case errors.As(err, &code):
+		return code
+	}
+	ss.s.log.Debug("request failed", log.Error(err))
+	return InternalServerError
+}
+
+// requestHeaders returns the headers of the request passed to the handler.
+func requestHeaders(hs Headers) Headers {
+	return hs.without(HeaderConnectionID, HeaderBody, HeaderEndOfBody, HeaderSRM, HeaderSRMParameters)
+}
+
+// hasBody reports whether the headers include a body.
+func hasBody(hs Headers) bool {
+	for _, h := range hs {
+		if h.ID == HeaderBody || h.ID == HeaderEndOfBody {
+			return true
+		}
+	}
+	return false
+}
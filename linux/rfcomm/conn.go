@@ -0,0 +1,503 @@
+package rfcomm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/internal/deadline"
+	"github.com/thomascriley/ble/linux/multiplexer"
+	"github.com/thomascriley/ble/log"
+)
+
+// Conn is an RFCOMM data link connection, DLC, to a server channel: an emulated serial port [RFCOMM 5.3]. Unlike the
+// L2CAP channels it runs over, Read and Write do not keep the boundaries of the frames. It is a net.Conn.
+type Conn struct {
+	s    *Session
+	dlci uint8
+
+	// frameSize is the largest payload of the frames.
+	frameSize int
+
+	// cfc reports whether the credit based flow control is used [RFCOMM 6.5].
+	cfc bool
+
+	// muTx serializes the writes, so that the bytes of each are sent in order.
+	muTx sync.Mutex
+
+	mu sync.Mutex
+
+	// txCredits are the frames the remote device can receive, rxCredits those the local device granted it and it did
+	// not send yet. The frames received are granted again once read: rxCredits, the frames buffered, and consumed
+	// add up to initialCredits.
+	txCredits int
+	rxCredits int
+	consumed  int
+
+	// rx are the payloads of the frames received and not read yet.
+	rx [][]byte
+
+	// txSignals are the signals of the local device, rxSignals those of the remote device. The remote device stops
+	// the frames sent with the flow control signal, unless the credit based flow control is used.
+	txSignals Signals
+	rxSignals Signals
+	stopped   bool
+
+	port        PortSettings
+	lineHandler func(LineEvent)
+
+	chRx      chan struct{}
+	chCredits chan struct{}
+
+	readDeadline  deadline.Deadline
+	writeDeadline deadline.Deadline
+
+	closeOnce sync.Once
+	chClosed  chan struct{}
+}
+
+func newConn(s *Session, dlci uint8, p params) *Conn {
+	c := &Conn{
+		s:         s,
+		dlci:      dlci,
+		frameSize: p.frameSize,
+		cfc:       p.cfc,
+		txCredits: p.txCredits,
+		txSignals: defaultSignals,
+		rxSignals: defaultSignals,
+		port:      DefaultPortSettings,
+		chRx:      make(chan struct{}, 1),
+		chCredits: make(chan struct{}, 1),
+		chClosed:  make(chan struct{}),
+	}
+	if c.cfc {
+		c.rxCredits = initialCredits
+	}
+	return c
+}
+
+// ServerChannel returns the server channel of the DLC.
+func (c *Conn) ServerChannel() uint8 { return c.dlci >> 1 }
+
+// Address returns the address of the remote device.
+func (c *Conn) Address() ble.Addr { return c.s.l2c.RemoteAddr() }
+
+// Disconnected returns a receiving channel, which is closed when the DLC disconnects.
+func (c *Conn) Disconnected() <-chan struct{} { return c.chClosed }
+
+// LocalAddr returns the address of the local device, and the server channel of the DLC.
+func (c *Conn) LocalAddr() net.Addr {
+	return ble.NetAddr{Addr: c.s.l2c.LocalAddr(), Net: "rfcomm", Port: int(c.ServerChannel())}
+}
+
+// RemoteAddr returns the address of the remote device, and the server channel of the DLC.
+func (c *Conn) RemoteAddr() net.Addr {
+	return ble.NetAddr{Addr: c.s.l2c.RemoteAddr(), Net: "rfcomm", Port: int(c.ServerChannel())}
+}
+
+// SetDeadline sets the read and write deadlines of the DLC.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	c.writeDeadline.Set(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline of the reads, past which they return os.ErrDeadlineExceeded. A zero value clears
+// it.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the writes, past which waiting for credits returns os.ErrDeadlineExceeded.
+// The frames already sent are not recalled. A zero value clears it.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+	return nil
+}
+
+// Read reads the bytes received, returning io.EOF once the DLC disconnected and all of them are read.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.ReadContext(context.Background(), b)
+}
+
+// ReadContext reads the bytes received, waiting for them until the context is done or the read deadline passes.
+func (c *Conn) ReadContext(ctx context.Context, b []byte) (int, error) {
+	expired := c.readDeadline.Done()
+	for {
+		c.mu.Lock()
+		if len(c.rx) > 0 {
+			n, grant := c.consume(b)
+			c.mu.Unlock()
+			if grant > 0 {
+				c.grant(grant)
+			}
+			return n, nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.chRx:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-expired:
+			return 0, os.ErrDeadlineExceeded
+		case <-c.chClosed:
+			c.mu.Lock()
+			empty := len(c.rx) == 0
+			c.mu.Unlock()
+			if empty {
+				return 0, io.EOF
+			}
+		}
+	}
+}
+
+// consume copies the bytes received to b, and returns the credits to grant for the frames read. It is called with
+// c.mu held.
+func (c *Conn) consume(b []byte) (int, uint8) {
+	var n int
+	for len(c.rx) > 0 && n < len(b) {
+		m := copy(b[n:], c.rx[0])
+		n += m
+		if c.rx[0] = c.rx[0][m:]; len(c.rx[0]) == 0 {
+			c.rx = c.rx[1:]
+			c.consumed++
+		}
+	}
+	if len(c.rx) > 0 {
+		notify(c.chRx)
+	}
+	// Credits are granted once the remote device used half of them, so that it keeps sending as the frames are read.
+	if !c.cfc || c.consumed == 0 || c.rxCredits > initialCredits/2 {
+		return n, 0
+	}
+	grant := c.consumed
+	c.rxCredits, c.consumed = c.rxCredits+grant, 0
+	return n, uint8(grant)
+}
+
+// grant sends the credits to the remote device, in a UIH frame without payload [RFCOMM 6.5.2].
+func (c *Conn) grant(credits uint8) {
+	if err := c.s.send(c.dlci, ControlNumberUIH, true, 0x01, credits, nil); err != nil {
+		c.s.log.Debug("unable to grant credits", log.Error(err))
+	}
+}
+
+// Write sends b in frames of at most the frame size of the DLC, waiting for the credits of the remote device.
+func (c *Conn) Write(b []byte) (int, error) {
+	return c.WriteContext(context.Background(), b)
+}
+
+// WriteContext sends b, waiting for the credits of the remote device until the context is done or the write deadline
+// passes. It returns the number of bytes sent.
+func (c *Conn) WriteContext(ctx context.Context, b []byte) (int, error) {
+	c.muTx.Lock()
+	defer c.muTx.Unlock()
+	expired := c.writeDeadline.Done()
+	var n int
+	for len(b) > 0 {
+		if err := c.takeCredit(ctx, expired); err != nil {
+			return n, err
+		}
+		m := len(b)
+		if m > c.frameSize {
+			m = c.frameSize
+		}
+		if err := c.s.send(c.dlci, ControlNumberUIH, true, 0x00, 0, b[:m]); err != nil {
+			return n, err
+		}
+		n, b = n+m, b[m:]
+	}
+	return n, nil
+}
+
+// takeCredit waits for a credit of the remote device to send a frame, or for it to clear its flow control signal if
+// the credit based flow control is not used.
+func (c *Conn) takeCredit(ctx context.Context, expired <-chan struct{}) error {
+	for {
+		select {
+		case <-c.chClosed:
+			return io.ErrClosedPipe
+		case <-expired:
+			return os.ErrDeadlineExceeded
+		default:
+		}
+		c.mu.Lock()
+		if !c.cfc && !c.stopped {
+			c.mu.Unlock()
+			return nil
+		}
+		if c.cfc && c.txCredits > 0 {
+			c.txCredits--
+			c.mu.Unlock()
+			return nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.chCredits:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-expired:
+			return os.ErrDeadlineExceeded
+		case <-c.chClosed:
+			return io.ErrClosedPipe
+		}
+	}
+}
+
+// receive handles the UIH frame received on the DLC. It runs on the loop of the session.
+func (c *Conn) receive(frm *frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cfc && frm.PollFinal == 0x01 && frm.Credits > 0 {
+		c.txCredits += int(frm.Credits)
+		notify(c.chCredits)
+	}
+	if len(frm.Payload) == 0 {
+		return
+	}
+	if c.cfc {
+		if c.rxCredits == 0 {
+			c.s.log.Debug("dropped frame sent without credits", log.Uint8("dlci", c.dlci))
+			return
+		}
+		c.rxCredits--
+	}
+	c.rx = append(c.rx, frm.Payload)
+	notify(c.chRx)
+}
+
+// sendModemStatus sends the V.24 signals of the DLC as it opens, and waits for their acknowledgement
+// [TS 07.10, 5.4.6.3.7].
+func (c *Conn) sendModemStatus(ctx context.Context) error {
+	c.mu.Lock()
+	m := c.modemStatus()
+	c.mu.Unlock()
+	_, err := c.command(ctx, m)
+	return err
+}
+
+// modemStatus returns the modem status command reporting the signals of the local device. It is called with c.mu
+// held.
+func (c *Conn) modemStatus() *multiplexer.ModemStatus {
+	return &multiplexer.ModemStatus{
+		CommandResponse:    0x01,
+		ServerChannel:      c.dlci >> 1,
+		Direction:          c.dlci & 0x01,
+		FlowControl:        FlowControl,
+		ReadyToCommunicate: bit(c.txSignals.DTR),
+		ReadyToReceive:     bit(c.txSignals.RTS),
+		IncomingCall:       bit(c.txSignals.RI),
+		DataValid:          bit(c.txSignals.DCD),
+	}
+}
+
+// command sends the multiplexer command applying to the DLC, and waits for its response.
+func (c *Conn) command(ctx context.Context, m multiplexer.Multiplexer) (multiplexer.Multiplexer, error) {
+	v, err := c.s.await(ctx, waitKey{dlci: c.dlci, msg: m.Type()}, func() error {
+		return c.s.sendMultiplexer(m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsp, ok := v.(multiplexer.Multiplexer)
+	if _, ns := v.(*multiplexer.NotSupported); !ok || ns {
+		return nil, ErrNotSupported
+	}
+	return rsp, nil
+}
+
+// RemoteSignals returns the signals the remote device asserts.
+func (c *Conn) RemoteSignals() Signals {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rxSignals
+}
+
+// SetSignals asserts the signals on the emulated serial port.
+func (c *Conn) SetSignals(ctx context.Context, signals Signals) error {
+	c.mu.Lock()
+	c.txSignals = signals
+	m := c.modemStatus()
+	c.mu.Unlock()
+	_, err := c.command(ctx, m)
+	return err
+}
+
+// SendBreak sends a break signal lasting d, rounded to 200 ms up to 3 s, or of an unspecified length if d is 0.
+func (c *Conn) SendBreak(ctx context.Context, d time.Duration) error {
+	n := (d + breakUnit/2) / breakUnit
+	if n > 0x0F {
+		n = 0x0F
+	}
+	c.mu.Lock()
+	m := c.modemStatus()
+	c.mu.Unlock()
+	m.Break, m.BreakLength = true, uint8(n)
+	_, err := c.command(ctx, m)
+	return err
+}
+
+// SendLineStatus reports the line status errors to the remote device [TS 07.10, 5.4.6.3.10].
+func (c *Conn) SendLineStatus(ctx context.Context, status LineStatus) error {
+	_, err := c.command(ctx, &multiplexer.RemoteLineStatus{
+		CommandResponse: 0x01,
+		ServerChannel:   c.dlci >> 1,
+		Direction:       c.dlci & 0x01,
+		LineStatus:      multiplexer.LineStatusError | uint8(status)&0x0E,
+	})
+	return err
+}
+
+// PortSettings requests the settings of the emulated serial port from the remote device.
+func (c *Conn) PortSettings(ctx context.Context) (PortSettings, error) {
+	m, err := c.command(ctx, &multiplexer.RemotePortNegotiation{
+		CommandResponse: 0x01,
+		ServerChannel:   c.dlci >> 1,
+		Direction:       c.dlci & 0x01,
+	})
+	if err != nil {
+		return PortSettings{}, err
+	}
+	rsp, ok := m.(*multiplexer.RemotePortNegotiation)
+	if !ok || !rsp.Setup {
+		return PortSettings{}, fmt.Errorf("invalid port negotiation response")
+	}
+	// The settings are reported whatever the parameter mask.
+	rsp.SetMask(multiplexer.MaskAll)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.port.apply(rsp)
+	return c.port, nil
+}
+
+// SetPortSettings sets the settings of the emulated serial port, and returns those in effect: the remote device may
+// reject some of them.
+func (c *Conn) SetPortSettings(ctx context.Context, p PortSettings) (PortSettings, error) {
+	cmd, err := p.rpn(c.dlci)
+	if err != nil {
+		return PortSettings{}, err
+	}
+	m, err := c.command(ctx, cmd)
+	if err != nil {
+		return PortSettings{}, err
+	}
+	rsp, ok := m.(*multiplexer.RemotePortNegotiation)
+	if !ok || !rsp.Setup {
+		return PortSettings{}, fmt.Errorf("invalid port negotiation response")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.port.apply(rsp)
+	return c.port, nil
+}
+
+// SetLineEventHandler sets the handler of the changes of the emulated serial port reported by the remote device. It
+// runs on the goroutine receiving the frames of the session, and must not block.
+func (c *Conn) SetLineEventHandler(f func(LineEvent)) {
+	c.mu.Lock()
+	c.lineHandler = f
+	c.mu.Unlock()
+}
+
+// receiveModemStatus handles the modem status command of the remote device.
+func (c *Conn) receiveModemStatus(m *multiplexer.ModemStatus) {
+	c.mu.Lock()
+	c.rxSignals = Signals{
+		DTR: m.ReadyToCommunicate == 0x01,
+		RTS: m.ReadyToReceive == 0x01,
+		RI:  m.IncomingCall == 0x01,
+		DCD: m.DataValid == 0x01,
+	}
+	// The flow control signal has no meaning with the credit based flow control [RFCOMM 6.5.3].
+	c.stopped = !c.cfc && m.FlowControl == 0x01
+	notify(c.chCredits)
+	e := LineEvent{Signals: c.rxSignals, Break: m.Break, BreakLength: time.Duration(m.BreakLength) * breakUnit}
+	f := c.lineHandler
+	c.mu.Unlock()
+	if f != nil {
+		f(e)
+	}
+}
+
+// receiveLineStatus handles the remote line status command of the remote device.
+func (c *Conn) receiveLineStatus(m *multiplexer.RemoteLineStatus) {
+	if m.LineStatus&multiplexer.LineStatusError == 0 {
+		return
+	}
+	c.mu.Lock()
+	e := LineEvent{Signals: c.rxSignals, LineStatus: LineStatus(m.LineStatus & 0x0E)}
+	f := c.lineHandler
+	c.mu.Unlock()
+	if f != nil {
+		f(e)
+	}
+}
+
+// receivePortSettings handles the port settings set by the remote device.
+func (c *Conn) receivePortSettings(p PortSettings) {
+	c.mu.Lock()
+	c.port = p
+	e := LineEvent{Signals: c.rxSignals, PortSettings: &p}
+	f := c.lineHandler
+	c.mu.Unlock()
+	if f != nil {
+		f(e)
+	}
+}
+
+// portSettings returns the settings of the emulated serial port.
+func (c *Conn) portSettings() PortSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.port
+}
+
+// CancelConnection disconnects the DLC.
+func (c *Conn) CancelConnection(ctx context.Context) error {
+	select {
+	case <-c.chClosed:
+		return nil
+	default:
+	}
+	defer c.s.remove(c)
+	_, err := c.s.await(ctx, waitKey{dlci: c.dlci}, func() error {
+		return c.s.send(c.dlci, ControlNumberDISC, true, 0x01, 0, nil)
+	})
+	return err
+}
+
+// Close disconnects the DLC, waiting for the remote device to acknowledge it for at most 20s.
+func (c *Conn) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+	defer cancel()
+	return c.CancelConnection(ctx)
+}
+
+// shutdown closes the DLC, once removed from its session.
+func (c *Conn) shutdown() {
+	c.closeOnce.Do(func() { close(c.chClosed) })
+}
+
+// bit returns 1 if b is set.
+func bit(b bool) uint8 {
+	if b {
+		return 0x01
+	}
+	return 0x00
+}
+
+// notify signals the channel, unless it is already.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 )
 
+// maxLength is the largest payload of a frame, whose length field is 15 bits long.
+const maxLength = 0x7FFF
+
 type frame struct {
 	CommmandResponse   uint8
 	Direction          uint8
@@ -16,8 +19,11 @@ type frame struct {
 }
 
 func (f *frame) Marshal(b []byte) (int, error) {
-	if len(b) < len(f.Payload)+4 {
-		return 0, fmt.Errorf("the byte array is longer than the frame size %d > %d", len(b), len(f.Payload)+4)
+	if len(f.Payload) > maxLength {
+		return 0, fmt.Errorf("the payload is longer than %d bytes", maxLength)
+	}
+	if size := f.size(); len(b) < size {
+		return 0, fmt.Errorf("the byte array is shorter than the frame size %d < %d", len(b), size)
 	}
 
 	// Address [5.4]
@@ -27,15 +33,19 @@ func (f *frame) Marshal(b []byte) (int, error) {
 	// control field
 	b[1] = f.ControlNumber | f.PollFinal&0x01<<4
 
-	// length
-	ea = 0x01
-	b[2] = ea | uint8(len(f.Payload))<<1
-
+	// length, on 2 bytes beyond 127 [TS 07.10, 5.2.1.5]
 	i := 3
+	if len(f.Payload) <= 0x7F {
+		b[2] = ea | uint8(len(f.Payload))<<1
+	} else {
+		b[2] = uint8(len(f.Payload)) << 1
+		b[3] = uint8(len(f.Payload) >> 7)
+		i++
+	}
 
 	// add credits for UIH frames when PF bit is set
 	if f.ControlNumber == ControlNumberUIH && f.PollFinal == 0x01 {
-		b[3] = f.Credits
+		b[i] = f.Credits
 		i++
 	}
 
@@ -52,12 +62,25 @@ func (f *frame) Marshal(b []byte) (int, error) {
 	default:
 		fcsBytes = b[0:3]
 	}
-	b[i] = generateFCS(fcsBytes)
+	f.FrameCheckSequence = generateFCS(fcsBytes)
+	b[i] = f.FrameCheckSequence
 	i++
 
 	return i, nil
 }
 
+// size returns the size of the marshalled frame.
+func (f *frame) size() int {
+	n := 4 + len(f.Payload)
+	if len(f.Payload) > 0x7F {
+		n++
+	}
+	if f.ControlNumber == ControlNumberUIH && f.PollFinal == 0x01 {
+		n++
+	}
+	return n
+}
+
 func (f *frame) Unmarshal(b []byte) error {
 	if len(b) < 3 {
 		return fmt.Errorf("the frame must be at least 3 bytes long (%X)", b)
@@ -85,6 +108,9 @@ func (f *frame) Unmarshal(b []byte) error {
 	var i = 3 + (int(ea)+1)%2
 
 	if f.ControlNumber == ControlNumberUIH && f.PollFinal == 0x01 {
+		if len(b) <= i {
+			return fmt.Errorf("the frame must be > %d bytes long to hold credits (%X)", i, b)
+		}
 		f.Credits = b[i]
 		i = i + 1
 	}
@@ -97,3 +97,37 @@ func TestFrameCreditMarshal(t *testing.T) {
 		t.Fatalf("Exepected: %X, Received: %X", frameBytes3, bs[:n])
 	}
 }
+
+func TestFrameLongPayloadMarshal(t *testing.T) {
+	frm := &frame{
+		ServerChannel:    0x01,
+		ControlNumber:    ControlNumberUIH,
+		CommmandResponse: 0x01,
+		Payload:          bytes.Repeat([]byte{0xAB}, 300),
+	}
+	bs := make([]byte, 4096)
+	n, err := frm.Marshal(bs)
+	if err != nil {
+		t.Fatalf("Error marshalling: %s", err)
+	}
+	if !bytes.Equal(bs[2:4], []byte{0x58, 0x02}) {
+		t.Fatalf("Expected: %X, Received: %X", []byte{0x58, 0x02}, bs[2:4])
+	}
+	rx := &frame{}
+	if err = rx.Unmarshal(bs[:n]); err != nil {
+		t.Fatalf("Error unmarshalling: %s", err)
+	}
+	if !bytes.Equal(rx.Payload, frm.Payload) {
+		t.Fatalf("Expected: %X, Received: %X", frm.Payload, rx.Payload)
+	}
+}
+
+func TestFrameFCSMismatch(t *testing.T) {
+	for _, b := range [][]byte{frameBytes1, frameBytes4} {
+		corrupted := append([]byte(nil), b...)
+		corrupted[len(corrupted)-1] ^= 0xFF
+		if err := (&frame{}).Unmarshal(corrupted); err == nil {
+			t.Fatalf("Expected: frame check sequence error, Received: nil for %X", corrupted)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package rfcomm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/thomascriley/ble/linux/multiplexer"
+)
+
+// Signals are the V.24 signals a device asserts on the emulated serial port of a DLC, which the other device receives
+// as their null modem counterparts: DTR as DSR, RTS as CTS [RFCOMM 6.3].
+type Signals struct {
+	// DTR, data terminal ready, is sent as ready to communicate.
+	DTR bool
+
+	// RTS, request to send, is sent as ready to receive.
+	RTS bool
+
+	// RI, ring indicator, is sent as incoming call.
+	RI bool
+
+	// DCD, data carrier detect, is sent as data valid.
+	DCD bool
+}
+
+// defaultSignals are the signals a DLC asserts as it opens.
+var defaultSignals = Signals{DTR: true, RTS: true, DCD: true}
+
+// breakUnit is the unit of the length of the break signals [TS 07.10, 5.4.6.3.7].
+const breakUnit = 200 * time.Millisecond
+
+// LineStatus are the line status errors of the emulated serial port [TS 07.10, 5.4.6.3.10].
+type LineStatus uint8
+
+// Line status errors.
+const (
+	LineStatusOverrun = LineStatus(multiplexer.LineStatusOverrun)
+	LineStatusParity  = LineStatus(multiplexer.LineStatusParity)
+	LineStatusFraming = LineStatus(multiplexer.LineStatusFraming)
+)
+
+// LineEvent is a change of the emulated serial port reported by the remote device.
+type LineEvent struct {
+	// Signals are those of the remote device, after the event.
+	Signals Signals
+
+	// Break reports a break signal, lasting BreakLength if it is not 0.
+	Break       bool
+	BreakLength time.Duration
+
+	// LineStatus are the line status errors reported, 0 if none.
+	LineStatus LineStatus
+
+	// PortSettings are the port settings the remote device set, nil if none.
+	PortSettings *PortSettings
+}
+
+// Parity is the parity of the emulated serial port.
+type Parity uint8
+
+// Parities.
+const (
+	ParityNone Parity = iota
+	ParityOdd
+	ParityEven
+	ParityMark
+	ParitySpace
+)
+
+// StopBits is the number of stop bits of the emulated serial port.
+type StopBits uint8
+
+// Stop bits.
+const (
+	StopBits1 StopBits = iota
+	StopBits1_5
+)
+
+// PortFlowControl are the flow control options of the emulated serial port. They are informative, the DLCs rely on
+// the flow control of RFCOMM.
+type PortFlowControl uint8
+
+// Flow control options.
+const (
+	FlowXONXOFFInput PortFlowControl = 1 << iota
+	FlowXONXOFFOutput
+	FlowRTRInput
+	FlowRTROutput
+	FlowRTCInput
+	FlowRTCOutput
+)
+
+// PortSettings are the settings of the emulated serial port of a DLC, set with remote port negotiation [TS 07.10,
+// 5.4.6.3.9]. They are informative, unless the remote device bridges the DLC to a physical port.
+type PortSettings struct {
+	// BaudRate in bits per second, from 2400 to 230400.
+	BaudRate int
+
+	// DataBits from 5 to 8.
+	DataBits int
+
+	StopBits    StopBits
+	Parity      Parity
+	FlowControl PortFlowControl
+
+	// XON and XOFF are the characters of the XON/XOFF flow control.
+	XON  byte
+	XOFF byte
+}
+
+// DefaultPortSettings are the settings of the ports not negotiated: 9600 bauds, 8 data bits, no parity, 1 stop bit
+// and no flow control.
+var DefaultPortSettings = PortSettings{BaudRate: 9600, DataBits: 8, XON: 0x11, XOFF: 0x13}
+
+// baudRates are the baud rates by their code.
+var baudRates = []int{2400, 4800, 7200, 9600, 19200, 38400, 57600, 115200, 230400}
+
+// rpn returns the remote port negotiation command setting all the settings.
+func (p PortSettings) rpn(dlci uint8) (*multiplexer.RemotePortNegotiation, error) {
+	baudRate := -1
+	for i, r := range baudRates {
+		if r == p.BaudRate {
+			baudRate = i
+		}
+	}
+	if baudRate < 0 {
+		return nil, fmt.Errorf("unsupported baud rate %d", p.BaudRate)
+	}
+	if p.DataBits < 5 || p.DataBits > 8 {
+		return nil, fmt.Errorf("unsupported number of data bits %d", p.DataBits)
+	}
+	if p.StopBits > StopBits1_5 || p.Parity > ParitySpace {
+		return nil, fmt.Errorf("unsupported stop bits %d or parity %d", p.StopBits, p.Parity)
+	}
+	m := &multiplexer.RemotePortNegotiation{
+		CommandResponse: 0x01,
+		ServerChannel:   dlci >> 1,
+		Direction:       dlci & 0x01,
+		Setup:           true,
+	}
+	m.Change(multiplexer.MaskBaudRate, uint8(baudRate))
+	m.Change(multiplexer.MaskDataBits, uint8(p.DataBits-5))
+	m.Change(multiplexer.MaskStopBits, uint8(p.StopBits))
+	if p.Parity == ParityNone {
+		m.Change(multiplexer.MaskParity, 0)
+		m.Change(multiplexer.MaskParityType, 0)
+	} else {
+		m.Change(multiplexer.MaskParity, 1)
+		m.Change(multiplexer.MaskParityType, uint8(p.Parity-ParityOdd))
+	}
+	m.Change(multiplexer.MaskXONChar, p.XON)
+	m.Change(multiplexer.MaskXOFFChar, p.XOFF)
+	for i := uint8(0); i < 6; i++ {
+		m.Change(multiplexer.MaskInputXONOFF+i, uint8(p.FlowControl>>i&0x01))
+	}
+	return m, nil
+}
+
+// apply sets the settings the remote port negotiation message marks as changed, and returns the mask of those valid.
+func (p *PortSettings) apply(m *multiplexer.RemotePortNegotiation) uint16 {
+	var mask uint16
+	accept := func(bit uint8) { mask |= 0x01 << bit }
+	if m.IsChanged(multiplexer.MaskBaudRate) && int(m.Value(multiplexer.MaskBaudRate)) < len(baudRates) {
+		p.BaudRate = baudRates[m.Value(multiplexer.MaskBaudRate)]
+		accept(multiplexer.MaskBaudRate)
+	}
+	if m.IsChanged(multiplexer.MaskDataBits) {
+		p.DataBits = 5 + int(m.Value(multiplexer.MaskDataBits))
+		accept(multiplexer.MaskDataBits)
+	}
+	if m.IsChanged(multiplexer.MaskStopBits) {
+		p.StopBits = StopBits(m.Value(multiplexer.MaskStopBits))
+		accept(multiplexer.MaskStopBits)
+	}
+	if m.IsChanged(multiplexer.MaskParity) {
+		p.Parity = ParityNone
+		if m.Value(multiplexer.MaskParity) == 0x01 {
+			p.Parity = ParityOdd + Parity(m.Value(multiplexer.MaskParityType))
+		}
+		accept(multiplexer.MaskParity)
+		accept(multiplexer.MaskParityType)
+	} else if m.IsChanged(multiplexer.MaskParityType) && p.Parity != ParityNone {
+		p.Parity = ParityOdd + Parity(m.Value(multiplexer.MaskParityType))
+		accept(multiplexer.MaskParityType)
+	}
+	if m.IsChanged(multiplexer.MaskXONChar) {
+		p.XON = m.Value(multiplexer.MaskXONChar)
+		accept(multiplexer.MaskXONChar)
+	}
+	if m.IsChanged(multiplexer.MaskXOFFChar) {
+		p.XOFF = m.Value(multiplexer.MaskXOFFChar)
+		accept(multiplexer.MaskXOFFChar)
+	}
+	for i := uint8(0); i < 6; i++ {
+		if !m.IsChanged(multiplexer.MaskInputXONOFF + i) {
+			continue
+		}
+		p.FlowControl &^= 1 << i
+		p.FlowControl |= PortFlowControl(m.Value(multiplexer.MaskInputXONOFF+i)) << i
+		accept(multiplexer.MaskInputXONOFF + i)
+	}
+	return mask
+}
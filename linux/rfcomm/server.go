@@ -0,0 +1,138 @@
+package rfcomm
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/thomascriley/ble"
+)
+
+// listenBacklog is the number of DLCs a listener queues until they are accepted.
+const listenBacklog = 8
+
+// Server accepts the RFCOMM sessions the remote devices open, and the DLCs they open to the server channels listened
+// on.
+type Server struct {
+	log *slog.Logger
+
+	mu        sync.Mutex
+	listeners map[uint8]*Listener
+}
+
+// NewServer returns an RFCOMM server.
+func NewServer(log *slog.Logger) *Server {
+	return &Server{
+		log:       log.With("server", "rfcomm"),
+		listeners: make(map[uint8]*Listener),
+	}
+}
+
+// Listen listens for the DLCs to the server channel, or to a server channel it allocates if channel is 0. The server
+// channel is released once the listener is closed.
+func (srv *Server) Listen(channel uint8) (*Listener, error) {
+	var err error
+	if channel == 0 {
+		channel, err = AllocServerChannel()
+	} else {
+		err = ReserveServerChannel(channel)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{
+		srv:      srv,
+		channel:  channel,
+		chAccept: make(chan *Conn, listenBacklog),
+		chClosed: make(chan struct{}),
+	}
+	srv.mu.Lock()
+	srv.listeners[channel] = l
+	srv.mu.Unlock()
+	return l, nil
+}
+
+func (srv *Server) listener(channel uint8) *Listener {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.listeners[channel]
+}
+
+// Serve runs the session the remote device opened on the L2CAP channel, as the responder, until either device closes
+// it. The L2CAP channel is closed with the session.
+func (srv *Server) Serve(l2c ble.Conn) *Session {
+	return newSession(l2c, false, srv, srv.log)
+}
+
+// Listener accepts the DLCs the remote devices open to a server channel.
+type Listener struct {
+	srv      *Server
+	channel  uint8
+	chAccept chan *Conn
+
+	mu       sync.Mutex
+	closed   bool
+	chClosed chan struct{}
+}
+
+// Channel returns the server channel listened on, to be advertised in the service record of the service.
+func (l *Listener) Channel() uint8 { return l.channel }
+
+// Accept waits for the next DLC opened by a remote device.
+func (l *Listener) Accept(ctx context.Context) (*Conn, error) {
+	select {
+	case c := <-l.chAccept:
+		return c, nil
+	case <-l.chClosed:
+		return nil, io.ErrClosedPipe
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops listening, and releases the server channel. The DLCs already accepted stay open, those waiting to be
+// accepted are disconnected.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.chClosed)
+	l.mu.Unlock()
+
+	l.srv.mu.Lock()
+	if l.srv.listeners[l.channel] == l {
+		delete(l.srv.listeners, l.channel)
+	}
+	l.srv.mu.Unlock()
+	ReleaseServerChannel(l.channel)
+
+	for {
+		select {
+		case c := <-l.chAccept:
+			ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+			_ = c.CancelConnection(ctx)
+			cancel()
+		default:
+			return nil
+		}
+	}
+}
+
+// deliver queues the DLC to be accepted. It reports false if the listener is closed or its backlog full.
+func (l *Listener) deliver(c *Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	select {
+	case l.chAccept <- c:
+		return true
+	default:
+		return false
+	}
+}
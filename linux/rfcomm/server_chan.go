@@ -2,38 +2,72 @@ package rfcomm
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 )
 
 // MaxServerChannels The server channel range is from 1 to 30
 const maxServerChannels uint8 = 30
 
+var (
+	serverChannelNumbers = newServerChannels()
+)
+
 type serverChannels struct {
 	sync.RWMutex
 
-	channels map[uint8]*Client
+	channels map[uint8]struct{}
 }
 
 func newServerChannels() *serverChannels {
 	return &serverChannels{
-		channels: make(map[uint8]*Client, maxServerChannels)}
+		channels: make(map[uint8]struct{}, maxServerChannels)}
 }
 
-func (s *serverChannels) Add(c *Client) (uint8, error) {
+func (s *serverChannels) Add() (uint8, error) {
 	s.Lock()
 	defer s.Unlock()
 	var i uint8
 	for i = 1; i <= maxServerChannels; i++ {
 		if _, ok := s.channels[i]; !ok {
-			s.channels[i] = c
+			s.channels[i] = struct{}{}
 			return i, nil
 		}
 	}
 	return 0, errors.New("there is no more room to add another server channel")
 }
 
+func (s *serverChannels) Reserve(serverChannel uint8) error {
+	s.Lock()
+	defer s.Unlock()
+	if serverChannel < 1 || serverChannel > maxServerChannels {
+		return fmt.Errorf("invalid server channel %d", serverChannel)
+	}
+	if _, ok := s.channels[serverChannel]; ok {
+		return fmt.Errorf("server channel %d already in use", serverChannel)
+	}
+	s.channels[serverChannel] = struct{}{}
+	return nil
+}
+
 func (s *serverChannels) Remove(serverChannel uint8) {
 	s.Lock()
 	delete(s.channels, serverChannel)
 	s.Unlock()
 }
+
+// AllocServerChannel allocates the lowest free server channel, to be advertised in the service record of a local
+// service and released with ReleaseServerChannel.
+func AllocServerChannel() (uint8, error) {
+	return serverChannelNumbers.Add()
+}
+
+// ReserveServerChannel allocates the server channel, for the services which are always advertised on the same one.
+func ReserveServerChannel(serverChannel uint8) error {
+	return serverChannelNumbers.Reserve(serverChannel)
+}
+
+// ReleaseServerChannel frees the server channel allocated.
+func ReleaseServerChannel(serverChannel uint8) {
+	serverChannelNumbers.Remove(serverChannel)
+}
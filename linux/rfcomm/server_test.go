@@ -0,0 +1,212 @@
+package rfcomm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/multiplexer"
+)
+
+// l2capPipe is one end of an in-memory L2CAP channel keeping the boundaries of the SDUs.
+type l2capPipe struct {
+	rx       <-chan []byte
+	tx       chan<- []byte
+	chClosed chan struct{}
+}
+
+func newL2CAPPipe() (*l2capPipe, *l2capPipe) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	return &l2capPipe{rx: a, tx: b, chClosed: make(chan struct{})},
+		&l2capPipe{rx: b, tx: a, chClosed: make(chan struct{})}
+}
+
+func (p *l2capPipe) Read(b []byte) (int, error) {
+	select {
+	case sdu := <-p.rx:
+		return copy(b, sdu), nil
+	case <-p.chClosed:
+		return 0, io.EOF
+	}
+}
+
+func (p *l2capPipe) Write(b []byte) (int, error) {
+	select {
+	case p.tx <- append([]byte(nil), b...):
+		return len(b), nil
+	case <-p.chClosed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (p *l2capPipe) Close(context.Context) error {
+	select {
+	case <-p.chClosed:
+	default:
+		close(p.chClosed)
+	}
+	return nil
+}
+
+func (p *l2capPipe) LocalAddr() ble.Addr           { return ble.NewAddr("00:00:00:00:00:01") }
+func (p *l2capPipe) RemoteAddr() ble.Addr          { return ble.NewAddr("00:00:00:00:00:02") }
+func (p *l2capPipe) RxMTU() int                    { return 672 }
+func (p *l2capPipe) SetRxMTU(int)                  {}
+func (p *l2capPipe) TxMTU() int                    { return 672 }
+func (p *l2capPipe) SetTxMTU(int)                  {}
+func (p *l2capPipe) Disconnected() <-chan struct{} { return p.chClosed }
+
+// sendFrame sends a frame of the initiator, the remote device, through the pipe.
+func sendFrame(t *testing.T, p *l2capPipe, frm *frame) {
+	t.Helper()
+	b := make([]byte, frm.size())
+	n, err := frm.Marshal(b)
+	if err != nil {
+		t.Fatalf("Error marshalling: %s", err)
+	}
+	if _, err = p.Write(b[:n]); err != nil {
+		t.Fatalf("Error writing: %s", err)
+	}
+}
+
+// readFrame reads the next frame of the responder, the local device, from the pipe.
+func readFrame(t *testing.T, p *l2capPipe) *frame {
+	t.Helper()
+	select {
+	case sdu := <-p.rx:
+		frm := &frame{}
+		if err := frm.Unmarshal(sdu); err != nil {
+			t.Fatalf("Error unmarshalling: %s", err)
+		}
+		return frm
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for a frame")
+	}
+	return nil
+}
+
+func TestServerAccept(t *testing.T) {
+	srv := NewServer(slog.Default())
+	l, err := srv.Listen(0)
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer l.Close()
+	channel := l.Channel()
+
+	local, remote := newL2CAPPipe()
+	srv.Serve(local)
+	defer remote.Close(context.Background())
+
+	sendFrame(t, remote, &frame{CommmandResponse: 0x01, ControlNumber: ControlNumberSABM, PollFinal: 0x01})
+	if frm := readFrame(t, remote); frm.ControlNumber != ControlNumberUA || frm.ServerChannel != 0 {
+		t.Fatalf("Expected: UA on DLCI 0, Received: %X on channel %d", frm.ControlNumber, frm.ServerChannel)
+	}
+
+	pn, err := (&multiplexer.ParameterNegotiation{
+		CommandResponse:  0x01,
+		ServerChannel:    channel,
+		ConvergenceLayer: convergenceCreditBasedCommand,
+		Priority:         7,
+		MaxSize:          100,
+		WindowSize:       7,
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("Error marshalling: %s", err)
+	}
+	sendFrame(t, remote, &frame{CommmandResponse: 0x01, ControlNumber: ControlNumberUIH, Payload: pn})
+	m, err := multiplexer.UnmarshalBinary(readFrame(t, remote).Payload)
+	if err != nil {
+		t.Fatalf("Error unmarshalling: %s", err)
+	}
+	rsp, ok := m.(*multiplexer.ParameterNegotiation)
+	if !ok || rsp.CommandResponse != 0x00 {
+		t.Fatalf("Expected: ParameterNegotiation response, Received: %T", m)
+	}
+	if rsp.ConvergenceLayer != convergenceCreditBasedResponse || rsp.WindowSize != initialCredits {
+		t.Fatalf("Expected: %X %X, Received: %X %X", convergenceCreditBasedResponse, initialCredits,
+			rsp.ConvergenceLayer, rsp.WindowSize)
+	}
+	if rsp.MaxSize != 100 {
+		t.Fatalf("MaxSize Expected: %d, Received: %d", 100, rsp.MaxSize)
+	}
+
+	sendFrame(t, remote, &frame{CommmandResponse: 0x01, ServerChannel: channel, ControlNumber: ControlNumberSABM,
+		PollFinal: 0x01})
+	if frm := readFrame(t, remote); frm.ControlNumber != ControlNumberUA || frm.ServerChannel != channel {
+		t.Fatalf("Expected: UA on channel %d, Received: %X on channel %d", channel, frm.ControlNumber,
+			frm.ServerChannel)
+	}
+	// The DLC is accepted once the modem status is acknowledged.
+	m, err = multiplexer.UnmarshalBinary(readFrame(t, remote).Payload)
+	if err != nil {
+		t.Fatalf("Error unmarshalling: %s", err)
+	}
+	msc, ok := m.(*multiplexer.ModemStatus)
+	if !ok || msc.ServerChannel != channel {
+		t.Fatalf("Expected: ModemStatus on channel %d, Received: %T", channel, m)
+	}
+	msc.CommandResponse = 0x00
+	b, err := msc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Error marshalling: %s", err)
+	}
+	sendFrame(t, remote, &frame{CommmandResponse: 0x01, ControlNumber: ControlNumberUIH, Payload: b})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := l.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Error accepting: %s", err)
+	}
+	if c.ServerChannel() != channel {
+		t.Fatalf("Expected: %d, Received: %d", channel, c.ServerChannel())
+	}
+
+	// The local device grants new credits once the remote device used half of them, and the frames are read.
+	for i := 0; i < 4; i++ {
+		sendFrame(t, remote, &frame{CommmandResponse: 0x01, ServerChannel: channel, ControlNumber: ControlNumberUIH,
+			Payload: []byte("ping")})
+	}
+	b = make([]byte, 16)
+	var rx []byte
+	for len(rx) < 16 {
+		n, err := c.Read(b)
+		if err != nil {
+			t.Fatalf("Error reading: %s", err)
+		}
+		rx = append(rx, b[:n]...)
+	}
+	if !bytes.Equal(rx, []byte("pingpingpingping")) {
+		t.Fatalf("Expected: %s, Received: %s", "pingpingpingping", rx)
+	}
+	frm := readFrame(t, remote)
+	if frm.PollFinal != 0x01 || frm.Credits != 4 || len(frm.Payload) != 0 {
+		t.Fatalf("Expected: 4 credits, Received: %d credits and %X", frm.Credits, frm.Payload)
+	}
+
+	if _, err := c.Write([]byte("pong")); err != nil {
+		t.Fatalf("Error writing: %s", err)
+	}
+	if frm := readFrame(t, remote); frm.ServerChannel != channel || !bytes.Equal(frm.Payload, []byte("pong")) {
+		t.Fatalf("Expected: %s, Received: %s", "pong", frm.Payload)
+	}
+
+	sendFrame(t, remote, &frame{CommmandResponse: 0x01, ServerChannel: channel, ControlNumber: ControlNumberDISC,
+		PollFinal: 0x01})
+	if frm := readFrame(t, remote); frm.ControlNumber != ControlNumberUA {
+		t.Fatalf("Expected: UA, Received: %X", frm.ControlNumber)
+	}
+	select {
+	case <-c.Disconnected():
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the DLC to disconnect")
+	}
+	if _, err := c.Read(b); err != io.EOF {
+		t.Fatalf("Expected: %s, Received: %v", io.EOF, err)
+	}
+}
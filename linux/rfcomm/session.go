@@ -0,0 +1,647 @@
+package rfcomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/multiplexer"
+	"github.com/thomascriley/ble/log"
+)
+
+const (
+	// responseTimeout bounds the wait for the responses to the commands, shorter than the 60s timers of RFCOMM
+	// [RFCOMM 5.3].
+	responseTimeout = 20 * time.Second
+
+	// closeTimeout bounds the closing of the L2CAP channel of a session.
+	closeTimeout = 200 * time.Millisecond
+
+	// defaultFrameSize is the maximum frame size of the DLCs opened without parameter negotiation [TS 07.10, 5.7.2].
+	defaultFrameSize = 127
+
+	// initialCredits is the number of credits granted to the remote device as a DLC opens, the most the parameter
+	// negotiation carries [RFCOMM 6.5].
+	initialCredits = 7
+
+	// frameOverhead is the size of the header and FCS of the UIH frames: address, control, 2 bytes of length, credits
+	// and FCS.
+	frameOverhead = 6
+
+	// convergenceCreditBased are the convergence layers of the parameter negotiation command and response enabling
+	// the credit based flow control [RFCOMM 5.5.3].
+	convergenceCreditBasedCommand  = 0x0F
+	convergenceCreditBasedResponse = 0x0E
+)
+
+// ErrSessionClosed is returned by the commands of a session closed, or closing.
+var ErrSessionClosed = errors.New("rfcomm session closed")
+
+// ErrNotSupported is returned by the multiplexer commands the remote device does not support.
+var ErrNotSupported = errors.New("rfcomm command not supported")
+
+// waitKey identifies the response awaited by a command: the UA or DM frame answering a SABM or DISC frame on the
+// DLCI when msg is 0, or the multiplexer response of the msg type.
+type waitKey struct {
+	dlci uint8
+	msg  uint8
+}
+
+// params are the parameters of a DLC, negotiated before it opens.
+type params struct {
+	frameSize int
+	cfc       bool
+	txCredits int
+}
+
+// Session is an RFCOMM multiplexer session, running over an L2CAP channel to a remote device [RFCOMM 5.2]. It routes
+// the frames of the DLCs it multiplexes, each with its own parameters and credits, answers the multiplexer commands of
+// the remote device, and closes once its last DLC closes.
+type Session struct {
+	l2c       ble.Conn
+	initiator bool
+	log       *slog.Logger
+
+	// srv accepts the DLCs the remote device opens, none are accepted if it is nil.
+	srv *Server
+
+	// maxFrameSize is the largest frame size the L2CAP channel carries.
+	maxFrameSize int
+
+	// muTx serializes the frames sent.
+	muTx sync.Mutex
+
+	mu      sync.Mutex
+	dlcs    map[uint8]*Conn
+	params  map[uint8]params
+	waiters map[waitKey]chan interface{}
+
+	// dialing is the number of DLCs being opened by the local device.
+	dialing int
+	closing bool
+	closed  bool
+
+	chClosed chan struct{}
+}
+
+// OpenSession opens a session, as the initiator, over the L2CAP channel to the RFCOMM PSM of the remote device. The
+// DLCs the remote device opens to the server channels listened on srv are accepted, unless srv is nil. The L2CAP
+// channel is closed with the session, or if it fails to open.
+func OpenSession(ctx context.Context, l2c ble.Conn, srv *Server, logger *slog.Logger) (*Session, error) {
+	s := newSession(l2c, true, srv, logger)
+	v, err := s.await(ctx, waitKey{}, func() error {
+		return s.send(0, ControlNumberSABM, true, 0x01, 0, nil)
+	})
+	if err == nil && v != ControlNumberUA {
+		err = errors.New("session refused")
+	}
+	if err != nil {
+		s.shutdown()
+		return nil, fmt.Errorf("unable to open rfcomm session: %w", err)
+	}
+	return s, nil
+}
+
+func newSession(l2c ble.Conn, initiator bool, srv *Server, logger *slog.Logger) *Session {
+	s := &Session{
+		l2c:          l2c,
+		initiator:    initiator,
+		log:          logger,
+		srv:          srv,
+		maxFrameSize: int(MaxFrameSize),
+		dlcs:         make(map[uint8]*Conn),
+		params:       make(map[uint8]params),
+		waiters:      make(map[waitKey]chan interface{}),
+		chClosed:     make(chan struct{}),
+	}
+	if n := l2c.TxMTU() - frameOverhead; n < s.maxFrameSize {
+		s.maxFrameSize = n
+	}
+	if n := l2c.RxMTU() - frameOverhead; n < s.maxFrameSize {
+		s.maxFrameSize = n
+	}
+	go s.loop()
+	return s
+}
+
+// RemoteAddr returns the address of the remote device.
+func (s *Session) RemoteAddr() ble.Addr { return s.l2c.RemoteAddr() }
+
+// Closed returns a receiving channel, which is closed when the session closes.
+func (s *Session) Closed() <-chan struct{} { return s.chClosed }
+
+// Dial opens a DLC to the server channel of the remote device, negotiating its parameters first [RFCOMM 5.5.3].
+func (s *Session) Dial(ctx context.Context, channel uint8) (*Conn, error) {
+	if channel < 1 || channel > maxServerChannels {
+		return nil, fmt.Errorf("invalid server channel %d", channel)
+	}
+	// The server channels of the responder are reached with a direction bit of 0, those of the initiator with 1.
+	dlci := channel << 1
+	if !s.initiator {
+		dlci |= 0x01
+	}
+	s.mu.Lock()
+	if s.closing || s.closed {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if _, ok := s.dlcs[dlci]; ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("server channel %d already connected", channel)
+	}
+	s.dialing++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.dialing--
+		s.mu.Unlock()
+		s.closeIfIdle()
+	}()
+
+	if err := s.negotiate(ctx, dlci); err != nil {
+		return nil, fmt.Errorf("unable to negotiate the parameters of server channel %d: %w", channel, err)
+	}
+	// The DLC is registered before it opens, so that no frame following the UA is lost.
+	c := s.open(dlci)
+	v, err := s.await(ctx, waitKey{dlci: dlci}, func() error {
+		return s.send(dlci, ControlNumberSABM, true, 0x01, 0, nil)
+	})
+	if err == nil && v != ControlNumberUA {
+		err = fmt.Errorf("connection to server channel %d refused", channel)
+	}
+	if err != nil {
+		s.remove(c)
+		return nil, err
+	}
+	if err := c.sendModemStatus(ctx); err != nil {
+		s.log.Debug("unable to send modem status", log.Error(err))
+	}
+	return c, nil
+}
+
+// negotiate proposes the parameters of the DLC, and the credit based flow control, and stores those the remote device
+// accepts. The remote device may reduce the frame size only [RFCOMM 5.5.3].
+func (s *Session) negotiate(ctx context.Context, dlci uint8) error {
+	pn := &multiplexer.ParameterNegotiation{
+		CommandResponse:    0x01,
+		ServerChannel:      dlci >> 1,
+		Direction:          dlci & 0x01,
+		ConvergenceLayer:   convergenceCreditBasedCommand,
+		Priority:           Priority,
+		Timer:              Timer,
+		MaxSize:            uint16(s.maxFrameSize),
+		MaxRetransmissions: MaxRetransmissions,
+		WindowSize:         initialCredits,
+	}
+	v, err := s.await(ctx, waitKey{dlci: dlci, msg: multiplexer.TypeParameterNegotiation}, func() error {
+		return s.sendMultiplexer(pn)
+	})
+	if err != nil {
+		return err
+	}
+	// Devices not supporting the negotiation use the default parameters.
+	p := params{frameSize: defaultFrameSize}
+	if rsp, ok := v.(*multiplexer.ParameterNegotiation); ok {
+		p.frameSize = int(rsp.MaxSize)
+		if rsp.ConvergenceLayer == convergenceCreditBasedResponse {
+			p.cfc, p.txCredits = true, int(rsp.WindowSize&0x07)
+		}
+	}
+	if p.frameSize == 0 || p.frameSize > s.maxFrameSize {
+		p.frameSize = s.maxFrameSize
+	}
+	s.mu.Lock()
+	s.params[dlci] = p
+	s.mu.Unlock()
+	return nil
+}
+
+// Close closes the session, and its DLCs, disconnecting the control channel, DLCI 0 [TS 07.10, 5.8.2].
+func (s *Session) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closing || s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closing = true
+	s.mu.Unlock()
+
+	_, err := s.await(ctx, waitKey{}, func() error {
+		return s.send(0, ControlNumberDISC, true, 0x01, 0, nil)
+	})
+	s.shutdown()
+	if errors.Is(err, ErrSessionClosed) {
+		return nil
+	}
+	return err
+}
+
+// closeIfIdle closes the session once its last DLC closed, unless the local device is opening one.
+func (s *Session) closeIfIdle() {
+	s.mu.Lock()
+	idle := len(s.dlcs) == 0 && s.dialing == 0 && !s.closing && !s.closed
+	s.mu.Unlock()
+	if !idle {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+		defer cancel()
+		if err := s.Close(ctx); err != nil {
+			s.log.Debug("unable to close rfcomm session", log.Error(err))
+		}
+	}()
+}
+
+// loop reads the frames of the L2CAP channel until it closes.
+func (s *Session) loop() {
+	defer s.shutdown()
+	b := make([]byte, s.l2c.RxMTU())
+	for {
+		n, err := s.l2c.Read(b)
+		if err != nil {
+			s.log.Debug("rfcomm session closed", log.Error(err))
+			return
+		}
+		frm := &frame{}
+		if err = frm.Unmarshal(b[:n]); err != nil {
+			s.log.Debug("dropped invalid frame", log.Error(err))
+			continue
+		}
+		if done := s.handle(frm); done {
+			return
+		}
+	}
+}
+
+// handle handles the frame received, and reports whether the session is closed.
+func (s *Session) handle(frm *frame) bool {
+	dlci := frm.ServerChannel<<1 | frm.Direction
+	switch frm.ControlNumber {
+	case ControlNumberSABM:
+		if dlci == 0 {
+			s.respond(0, ControlNumberUA)
+			return false
+		}
+		s.handleSABM(dlci)
+	case ControlNumberUA, ControlNumberDM:
+		if !s.deliver(waitKey{dlci: dlci}, frm.ControlNumber) && frm.ControlNumber == ControlNumberDM {
+			// The remote device disconnected the DLC on its own.
+			if c := s.dlc(dlci); c != nil {
+				s.remove(c)
+			}
+		}
+	case ControlNumberDISC:
+		if dlci == 0 {
+			s.respond(0, ControlNumberUA)
+			return true
+		}
+		c := s.dlc(dlci)
+		if c == nil {
+			s.respond(dlci, ControlNumberDM)
+			return false
+		}
+		s.respond(dlci, ControlNumberUA)
+		s.remove(c)
+	case ControlNumberUIH:
+		if dlci == 0 {
+			s.handleMultiplexer(frm.Payload)
+		} else if c := s.dlc(dlci); c != nil {
+			c.receive(frm)
+		}
+	}
+	return false
+}
+
+// handleSABM opens the DLC to the local server channel if it is listened on [RFCOMM 5.3].
+func (s *Session) handleSABM(dlci uint8) {
+	// The server channels of the responder are reached with a direction bit of 0, those of the initiator with 1.
+	var l *Listener
+	if (dlci&0x01 == 0x01) == s.initiator && s.srv != nil {
+		l = s.srv.listener(dlci >> 1)
+	}
+	if l == nil || s.dlc(dlci) != nil {
+		s.respond(dlci, ControlNumberDM)
+		return
+	}
+	c := s.open(dlci)
+	s.respond(dlci, ControlNumberUA)
+	// The DLC is accepted once the signals are exchanged, awaited outside of the loop.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+		defer cancel()
+		if err := c.sendModemStatus(ctx); err != nil {
+			s.log.Debug("unable to send modem status", log.Error(err))
+		}
+		if !l.deliver(c) {
+			_ = c.CancelConnection(ctx)
+		}
+	}()
+}
+
+// handleMultiplexer handles the multiplexer commands and responses of the frame [RFCOMM 4.3].
+func (s *Session) handleMultiplexer(b []byte) {
+	for len(b) >= multiplexer.HeaderSize {
+		n := multiplexer.HeaderSize + int(b[1]>>1)
+		if n > len(b) {
+			return
+		}
+		m, err := multiplexer.UnmarshalBinary(b[:n])
+		switch {
+		case err != nil:
+			if b[0]>>1&0x01 == 0x01 {
+				s.reply(&multiplexer.NotSupported{NSCommandResponse: 0x01, CommandType: b[0] >> 2})
+			}
+		case m.GetCommandResponse() == 0x01:
+			s.handleCommand(m)
+		default:
+			s.handleResponse(m)
+		}
+		b = b[n:]
+	}
+}
+
+// handleCommand answers the multiplexer command.
+func (s *Session) handleCommand(m multiplexer.Multiplexer) {
+	switch m := m.(type) {
+	case *multiplexer.ParameterNegotiation:
+		s.handleParameterNegotiation(m)
+		return
+	case *multiplexer.ModemStatus:
+		// The modem status response echoes the command [TS 07.10, 5.4.6.3.7].
+		m.CommandResponse = 0x00
+		s.reply(m)
+		if c := s.dlc(dlciOf(m)); c != nil {
+			c.receiveModemStatus(m)
+		}
+		return
+	case *multiplexer.RemoteLineStatus:
+		m.CommandResponse = 0x00
+		s.reply(m)
+		if c := s.dlc(dlciOf(m)); c != nil {
+			c.receiveLineStatus(m)
+		}
+		return
+	case *multiplexer.RemotePortNegotiation:
+		s.handlePortNegotiation(m)
+		return
+	}
+	m.SetCommandResponse(0x00)
+	s.reply(m)
+}
+
+// handleParameterNegotiation accepts the parameters of the DLC, reducing the frame size to the one the session
+// supports [RFCOMM 5.5.3].
+func (s *Session) handleParameterNegotiation(m *multiplexer.ParameterNegotiation) {
+	dlci := m.ServerChannel<<1 | m.Direction
+	p := params{frameSize: int(m.MaxSize)}
+	if p.frameSize == 0 || p.frameSize > s.maxFrameSize {
+		p.frameSize = s.maxFrameSize
+	}
+	if m.ConvergenceLayer == convergenceCreditBasedCommand {
+		p.cfc, p.txCredits = true, int(m.WindowSize&0x07)
+	}
+	s.mu.Lock()
+	if c, ok := s.dlcs[dlci]; ok {
+		// The parameters of an open DLC can not change.
+		p = params{frameSize: c.frameSize, cfc: c.cfc}
+	} else {
+		s.params[dlci] = p
+	}
+	s.mu.Unlock()
+
+	rsp := &multiplexer.ParameterNegotiation{
+		ServerChannel:      m.ServerChannel,
+		Direction:          m.Direction,
+		Priority:           m.Priority,
+		Timer:              Timer,
+		MaxSize:            uint16(p.frameSize),
+		MaxRetransmissions: MaxRetransmissions,
+	}
+	if p.cfc {
+		rsp.ConvergenceLayer, rsp.WindowSize = convergenceCreditBasedResponse, initialCredits
+	}
+	s.reply(rsp)
+}
+
+// handlePortNegotiation accepts the port settings the remote device sets, or reports the current ones if it only
+// requests them [TS 07.10, 5.4.6.3.9].
+func (s *Session) handlePortNegotiation(m *multiplexer.RemotePortNegotiation) {
+	dlci := dlciOf(m)
+	c := s.dlc(dlci)
+	p := DefaultPortSettings
+	if c != nil {
+		p = c.portSettings()
+	}
+	mask := multiplexer.MaskAll
+	if m.Setup {
+		mask = p.apply(m)
+	}
+	rsp, err := p.rpn(dlci)
+	if err != nil {
+		s.log.Debug("invalid port settings", log.Error(err))
+		return
+	}
+	rsp.CommandResponse = 0x00
+	rsp.SetMask(mask)
+	s.reply(rsp)
+	if c != nil && m.Setup {
+		c.receivePortSettings(p)
+	}
+}
+
+// handleResponse delivers the multiplexer response to the command awaiting it.
+func (s *Session) handleResponse(m multiplexer.Multiplexer) {
+	if ns, ok := m.(*multiplexer.NotSupported); ok {
+		s.mu.Lock()
+		for k, ch := range s.waiters {
+			if k.msg == ns.CommandType {
+				select {
+				case ch <- m:
+				default:
+				}
+			}
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.deliver(waitKey{dlci: dlciOf(m), msg: m.Type()}, m)
+}
+
+// dlciOf returns the DLCI the multiplexer message applies to, 0 for those applying to the session.
+func dlciOf(m multiplexer.Multiplexer) uint8 {
+	switch m := m.(type) {
+	case *multiplexer.ParameterNegotiation:
+		return m.ServerChannel<<1 | m.Direction
+	case *multiplexer.ModemStatus:
+		return m.ServerChannel<<1 | m.Direction
+	case *multiplexer.RemotePortNegotiation:
+		return m.ServerChannel<<1 | m.Direction
+	case *multiplexer.RemoteLineStatus:
+		return m.ServerChannel<<1 | m.Direction
+	}
+	return 0
+}
+
+// await sends the command with send, and waits for its response.
+func (s *Session) await(ctx context.Context, key waitKey, send func() error) (interface{}, error) {
+	ch := make(chan interface{}, 1)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if _, ok := s.waiters[key]; ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("command already pending on dlci %d", key.dlci)
+	}
+	s.waiters[key] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiters, key)
+		s.mu.Unlock()
+	}()
+
+	if err := send(); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(responseTimeout)
+	defer timer.Stop()
+	select {
+	case v := <-ch:
+		return v, nil
+	case <-s.chClosed:
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, errors.New("response timed out")
+	}
+}
+
+// deliver delivers the response to the command awaiting it, and reports whether one was.
+func (s *Session) deliver(key waitKey, v interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.waiters[key]
+	if !ok {
+		return false
+	}
+	select {
+	case ch <- v:
+	default:
+	}
+	return true
+}
+
+// send sends a command, or a response, frame on the DLCI. The C/R bit of the frames depends on the role of the
+// device in the session [TS 07.10, 5.2.1.2].
+func (s *Session) send(dlci uint8, control uint8, command bool, pf uint8, credits uint8, payload []byte) error {
+	var cr uint8
+	if command == s.initiator {
+		cr = 0x01
+	}
+	frm := &frame{
+		CommmandResponse: cr,
+		Direction:        dlci & 0x01,
+		ServerChannel:    dlci >> 1,
+		ControlNumber:    control,
+		PollFinal:        pf,
+		Credits:          credits,
+		Payload:          payload,
+	}
+	b := make([]byte, frm.size())
+	n, err := frm.Marshal(b)
+	if err != nil {
+		return err
+	}
+	s.muTx.Lock()
+	defer s.muTx.Unlock()
+	if _, err = s.l2c.Write(b[:n]); err != nil {
+		return fmt.Errorf("unable to send frame: %w", err)
+	}
+	return nil
+}
+
+// respond sends the UA or DM response to the SABM or DISC command received on the DLCI, with the final bit set.
+func (s *Session) respond(dlci uint8, control uint8) {
+	if err := s.send(dlci, control, false, 0x01, 0, nil); err != nil {
+		s.log.Debug("unable to send response", log.Error(err))
+	}
+}
+
+// sendMultiplexer sends the multiplexer message on the control channel, DLCI 0.
+func (s *Session) sendMultiplexer(m multiplexer.Multiplexer) error {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return s.send(0, ControlNumberUIH, true, 0x00, 0, b)
+}
+
+// reply sends the multiplexer response, or command, answering the remote device.
+func (s *Session) reply(m multiplexer.Multiplexer) {
+	if err := s.sendMultiplexer(m); err != nil {
+		s.log.Debug("unable to send multiplexer message", log.Error(err))
+	}
+}
+
+// open registers the DLC, with the parameters negotiated for it if any.
+func (s *Session) open(dlci uint8) *Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.params[dlci]
+	delete(s.params, dlci)
+	if !ok {
+		p.frameSize = defaultFrameSize
+		if p.frameSize > s.maxFrameSize {
+			p.frameSize = s.maxFrameSize
+		}
+	}
+	c := newConn(s, dlci, p)
+	s.dlcs[dlci] = c
+	return c
+}
+
+func (s *Session) dlc(dlci uint8) *Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dlcs[dlci]
+}
+
+// remove closes the DLC.
+func (s *Session) remove(c *Conn) {
+	s.mu.Lock()
+	if s.dlcs[c.dlci] == c {
+		delete(s.dlcs, c.dlci)
+	}
+	s.mu.Unlock()
+	c.shutdown()
+	s.closeIfIdle()
+}
+
+// shutdown closes the DLCs, and the L2CAP channel, of the session.
+func (s *Session) shutdown() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	dlcs := s.dlcs
+	s.dlcs = make(map[uint8]*Conn)
+	close(s.chClosed)
+	s.mu.Unlock()
+
+	for _, c := range dlcs {
+		c.shutdown()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	_ = s.l2c.Close(ctx)
+}
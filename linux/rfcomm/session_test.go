@@ -0,0 +1,297 @@
+package rfcomm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble"
+)
+
+// exchange writes the data on w, and reads it back from r.
+func exchange(t *testing.T, w io.Writer, r io.Reader, data []byte) {
+	t.Helper()
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Error writing: %s", err)
+	}
+	rx := make([]byte, len(data))
+	if _, err := io.ReadFull(r, rx); err != nil {
+		t.Fatalf("Error reading: %s", err)
+	}
+	if !bytes.Equal(rx, data) {
+		t.Fatalf("Expected: %s, Received: %s", data, rx)
+	}
+}
+
+func TestSessionMultipleDLCs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	remoteSrv, localSrv := NewServer(slog.Default()), NewServer(slog.Default())
+	var listeners []*Listener
+	for _, srv := range []*Server{remoteSrv, remoteSrv, localSrv} {
+		l, err := srv.Listen(0)
+		if err != nil {
+			t.Fatalf("Error listening: %s", err)
+		}
+		defer l.Close()
+		listeners = append(listeners, l)
+	}
+
+	local, remote := newL2CAPPipe()
+	responder := remoteSrv.Serve(remote)
+	s, err := OpenSession(ctx, local, localSrv, slog.Default())
+	if err != nil {
+		t.Fatalf("Error opening session: %s", err)
+	}
+
+	// The DLCs to the server channels of the responder, and the one it opens to the server channel of the initiator,
+	// share the session.
+	var dialed, accepted []*Conn
+	for i, l := range listeners {
+		dialer := s
+		if i == 2 {
+			dialer = responder
+		}
+		c, err := dialer.Dial(ctx, l.Channel())
+		if err != nil {
+			t.Fatalf("Error dialing server channel %d: %s", l.Channel(), err)
+		}
+		a, err := l.Accept(ctx)
+		if err != nil {
+			t.Fatalf("Error accepting: %s", err)
+		}
+		if c.dlci != a.dlci {
+			t.Fatalf("Expected: %X, Received: %X", c.dlci, a.dlci)
+		}
+		dialed, accepted = append(dialed, c), append(accepted, a)
+	}
+	if dialed[2].dlci&0x01 != 0x01 {
+		t.Fatalf("Expected: direction bit of the server channels of the initiator, Received: %X", dialed[2].dlci)
+	}
+
+	// Each DLC has its own credits, the frames sent exceed those initially granted.
+	for i := range dialed {
+		for j := 0; j < 2*initialCredits; j++ {
+			exchange(t, dialed[i], accepted[i], []byte{byte(i), byte(j)})
+			exchange(t, accepted[i], dialed[i], []byte{byte(j), byte(i)})
+		}
+	}
+
+	// The session closes with its last DLC.
+	for i, c := range dialed {
+		select {
+		case <-s.Closed():
+			t.Fatalf("Session closed with %d DLCs open", len(dialed)-i)
+		default:
+		}
+		if err := c.CancelConnection(ctx); err != nil {
+			t.Fatalf("Error disconnecting: %s", err)
+		}
+		select {
+		case <-accepted[i].Disconnected():
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the DLC to disconnect")
+		}
+	}
+	for _, ch := range []<-chan struct{}{s.Closed(), responder.Closed()} {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the session to close")
+		}
+	}
+	if _, err := s.Dial(ctx, listeners[0].Channel()); err != ErrSessionClosed {
+		t.Fatalf("Expected: %s, Received: %v", ErrSessionClosed, err)
+	}
+}
+
+// dialPair opens a DLC over a session between two servers, returning the ends of the initiator and the responder.
+func dialPair(ctx context.Context, t *testing.T) (*Conn, *Conn) {
+	t.Helper()
+	srv := NewServer(slog.Default())
+	l, err := srv.Listen(0)
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	local, remote := newL2CAPPipe()
+	srv.Serve(remote)
+	s, err := OpenSession(ctx, local, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("Error opening session: %s", err)
+	}
+	c, err := s.Dial(ctx, l.Channel())
+	if err != nil {
+		t.Fatalf("Error dialing: %s", err)
+	}
+	a, err := l.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Error accepting: %s", err)
+	}
+	return c, a
+}
+
+func TestConnLine(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, a := dialPair(ctx, t)
+
+	events := make(chan LineEvent, 4)
+	a.SetLineEventHandler(func(e LineEvent) { events <- e })
+	next := func() LineEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for a line event")
+		}
+		return LineEvent{}
+	}
+
+	signals := Signals{DTR: true, RI: true}
+	if err := c.SetSignals(ctx, signals); err != nil {
+		t.Fatalf("Error setting signals: %s", err)
+	}
+	// The signals reported as the DLC opened may be received after it is accepted.
+	for e := next(); e.Signals != signals; e = next() {
+		if e.Signals != defaultSignals {
+			t.Fatalf("Expected: %+v, Received: %+v", signals, e.Signals)
+		}
+	}
+	if a.RemoteSignals() != signals {
+		t.Fatalf("Expected: %+v, Received: %+v", signals, a.RemoteSignals())
+	}
+
+	if err := c.SendBreak(ctx, 600*time.Millisecond); err != nil {
+		t.Fatalf("Error sending break: %s", err)
+	}
+	if e := next(); !e.Break || e.BreakLength != 600*time.Millisecond {
+		t.Fatalf("Expected: break of %s, Received: %+v", 600*time.Millisecond, e)
+	}
+
+	if err := c.SendLineStatus(ctx, LineStatusParity); err != nil {
+		t.Fatalf("Error sending line status: %s", err)
+	}
+	if e := next(); e.LineStatus != LineStatusParity {
+		t.Fatalf("Expected: %X, Received: %X", LineStatusParity, e.LineStatus)
+	}
+
+	p := PortSettings{BaudRate: 115200, DataBits: 7, StopBits: StopBits1_5, Parity: ParityEven,
+		FlowControl: FlowRTRInput | FlowRTROutput, XON: 0x11, XOFF: 0x13}
+	if _, err := p.rpn(0); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	set, err := c.SetPortSettings(ctx, p)
+	if err != nil {
+		t.Fatalf("Error setting port settings: %s", err)
+	}
+	if set != p {
+		t.Fatalf("Expected: %+v, Received: %+v", p, set)
+	}
+	if e := next(); e.PortSettings == nil || *e.PortSettings != p {
+		t.Fatalf("Expected: %+v, Received: %+v", p, e.PortSettings)
+	}
+	got, err := a.PortSettings(ctx)
+	if err != nil {
+		t.Fatalf("Error requesting port settings: %s", err)
+	}
+	if got != p {
+		t.Fatalf("Expected: %+v, Received: %+v", p, got)
+	}
+	if _, err := c.SetPortSettings(ctx, PortSettings{BaudRate: 1200, DataBits: 8}); err == nil {
+		t.Fatalf("Expected: error for an unsupported baud rate")
+	}
+}
+
+func TestConnCredits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, a := dialPair(ctx, t)
+
+	// The frames not read are not granted again, the writer then waits for credits.
+	for i := 0; i < initialCredits; i++ {
+		if _, err := c.WriteContext(ctx, []byte{byte(i)}); err != nil {
+			t.Fatalf("Error writing: %s", err)
+		}
+	}
+	wctx, wcancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer wcancel()
+	if _, err := c.WriteContext(wctx, []byte{initialCredits}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected: %s, Received: %v", context.DeadlineExceeded, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.WriteContext(ctx, []byte{initialCredits})
+		done <- err
+	}()
+	rx := make([]byte, initialCredits+1)
+	if _, err := io.ReadFull(a, rx); err != nil {
+		t.Fatalf("Error reading: %s", err)
+	}
+	for i, b := range rx {
+		if b != byte(i) {
+			t.Fatalf("Expected: %X, Received: %X", i, rx)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Error writing: %s", err)
+	}
+
+	rctx, rcancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer rcancel()
+	if _, err := a.ReadContext(rctx, rx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected: %s, Received: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestConnDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, a := dialPair(ctx, t)
+
+	addr, ok := c.RemoteAddr().(ble.NetAddr)
+	if !ok || addr.Network() != "rfcomm" || addr.Port != int(c.ServerChannel()) {
+		t.Fatalf("Expected: rfcomm address of channel %d, Received: %v", c.ServerChannel(), c.RemoteAddr())
+	}
+
+	rx := make([]byte, 4)
+	if err := a.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if _, err := a.Read(rx); err != os.ErrDeadlineExceeded {
+		t.Fatalf("Expected: %s, Received: %v", os.ErrDeadlineExceeded, err)
+	}
+	if err := a.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	exchange(t, c, a, []byte("ping"))
+
+	// The writer runs out of credits, as the frames are not read.
+	if err := c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	var err error
+	for i := 0; i < 2*initialCredits && err == nil; i++ {
+		_, err = c.Write([]byte{byte(i)})
+	}
+	if err != os.ErrDeadlineExceeded {
+		t.Fatalf("Expected: %s, Received: %v", os.ErrDeadlineExceeded, err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Error closing: %s", err)
+	}
+	select {
+	case <-a.Disconnected():
+	case <-ctx.Done():
+		t.Fatalf("Timed out waiting for the DLC to disconnect")
+	}
+}
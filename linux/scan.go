@@ -0,0 +1,246 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+)
+
+// ScanOption configures a single call to Device.ScanWithOptions.
+type ScanOption func(*scanConfig)
+
+// DuplicateFilter selects where repeated advertisements from the same device are filtered out.
+type DuplicateFilter int
+
+// Duplicate filtering modes.
+const (
+	// DuplicatesController lets the controller report only the first advertisement of each device. Some controllers
+	// also drop the scan responses that follow. While another scan sharing the controller scan receives duplicates,
+	// the controller reports them all, and they are filtered on the host as with DuplicatesHost.
+	DuplicatesController DuplicateFilter = iota
+
+	// DuplicatesHost has the controller report every advertisement and passes one on to the handler only when it is
+	// the first from the device or its content changed.
+	DuplicatesHost
+
+	// DuplicatesAllow passes every advertisement received to the handler.
+	DuplicatesAllow
+)
+
+// scan interval and window limits [Vol 2, Part E, 7.8.10]
+const (
+	scanTimeUnit    = 625 * time.Microsecond
+	minScanInterval = 0x0004 * scanTimeUnit
+	maxScanInterval = 0x4000 * scanTimeUnit
+)
+
+// hostDedupSize is the number of devices remembered for host side duplicate filtering.
+const hostDedupSize = 1000
+
+type scanConfig struct {
+	params     cmd.LESetScanParameters
+	phys       hci.PHYs
+	dup        DuplicateFilter
+	duration   time.Duration
+	filter     ble.AdvFilter
+	acceptList []acceptListEntry
+	err        error
+}
+
+type acceptListEntry struct {
+	addr        ble.Addr
+	addressType ble.AddressType
+}
+
+// WithAllowDuplicates passes every advertisement received to the handler rather than only the first one from each
+// device.
+func WithAllowDuplicates(allow bool) ScanOption {
+	return func(c *scanConfig) {
+		c.dup = DuplicatesController
+		if allow {
+			c.dup = DuplicatesAllow
+		}
+	}
+}
+
+// WithDuplicateFilter selects how repeated advertisements are filtered. The default is DuplicatesController.
+func WithDuplicateFilter(f DuplicateFilter) ScanOption {
+	return func(c *scanConfig) {
+		c.dup = f
+	}
+}
+
+// WithActiveScan selects active scanning, which requests scan responses, or passive scanning, which only listens.
+func WithActiveScan(active bool) ScanOption {
+	return func(c *scanConfig) {
+		c.params.LEScanType = 0x00
+		if active {
+			c.params.LEScanType = 0x01
+		}
+	}
+}
+
+// WithScanInterval sets how often the controller starts scanning and for how long it scans each time. Both range from
+// 2.5 ms to 10.24 s and the window can not exceed the interval.
+func WithScanInterval(interval, window time.Duration) ScanOption {
+	return func(c *scanConfig) {
+		switch {
+		case interval < minScanInterval || interval > maxScanInterval:
+			c.err = fmt.Errorf("scan interval %s out of range [%s, %s]", interval, minScanInterval, maxScanInterval)
+		case window < minScanInterval || window > interval:
+			c.err = fmt.Errorf("scan window %s out of range [%s, %s]", window, minScanInterval, interval)
+		default:
+			c.params.LEScanInterval = uint16(interval / scanTimeUnit)
+			c.params.LEScanWindow = uint16(window / scanTimeUnit)
+		}
+	}
+}
+
+// WithOwnAddressType sets the address type used in scan requests.
+func WithOwnAddressType(t ble.AddressType) ScanOption {
+	return func(c *scanConfig) {
+		c.params.OwnAddressType = uint8(t)
+	}
+}
+
+// WithFilterPolicy sets the scanning filter policy [Vol 2, Part E, 7.8.10]: 0x00 accepts all advertisements, 0x01
+// only those from the accept list, 0x02 and 0x03 also accept directed advertisements to a resolvable private address.
+func WithFilterPolicy(policy uint8) ScanOption {
+	return func(c *scanConfig) {
+		if policy > 0x03 {
+			c.err = fmt.Errorf("invalid scanning filter policy 0x%02X", policy)
+			return
+		}
+		c.params.ScanningFilterPolicy = policy
+	}
+}
+
+// WithScanPHYs scans on the given primary PHYs, LE 1M and or LE Coded, using the extended scanning commands.
+func WithScanPHYs(phys hci.PHYs) ScanOption {
+	return func(c *scanConfig) {
+		if phys == 0 || phys&^(hci.PHY1M|hci.PHYCoded) != 0 {
+			c.err = fmt.Errorf("invalid scanning PHYs 0x%02X", uint8(phys))
+			return
+		}
+		c.phys = phys
+	}
+}
+
+// WithScanDuration stops the scan and returns once d has elapsed.
+func WithScanDuration(d time.Duration) ScanOption {
+	return func(c *scanConfig) {
+		c.duration = d
+	}
+}
+
+// WithFilter only passes advertisements matching f to the handler. Filters given in several options must all match.
+func WithFilter(f ble.AdvFilter) ScanOption {
+	return func(c *scanConfig) {
+		if c.filter == nil {
+			c.filter = f
+			return
+		}
+		c.filter = c.filter.And(f)
+	}
+}
+
+// WithAcceptList only passes advertisements from the addresses to the handler. If the addresses fit in the controller
+// accept list, they replace its content and the controller drops other advertisements before they reach the host.
+// Otherwise the addresses are filtered on the host.
+func WithAcceptList(addressType ble.AddressType, addrs ...ble.Addr) ScanOption {
+	return func(c *scanConfig) {
+		for _, a := range addrs {
+			c.acceptList = append(c.acceptList, acceptListEntry{addr: a, addressType: addressType})
+		}
+	}
+}
+
+// match returns the filter combining all the host side conditions of the configuration, or nil if every
+// advertisement matches.
+func (c *scanConfig) match() ble.AdvFilter {
+	if len(c.acceptList) == 0 {
+		return c.filter
+	}
+	addrs := make([]ble.Addr, len(c.acceptList))
+	for i, e := range c.acceptList {
+		addrs[i] = e.addr
+	}
+	return ble.FilterAddress(addrs...).And(c.filter)
+}
+
+// dedup wraps the handler so that it is only called for advertisements that are new or changed. If active is not
+// nil, the advertisements are only filtered while it reports true.
+func dedup(h ble.AdvHandler, active func() bool) ble.AdvHandler {
+	seen := expirable.NewLRU[string, string](hostDedupSize, nil, 0)
+	return func(a ble.Advertisement) {
+		if a.Address() == nil || active != nil && !active() {
+			h(a)
+			return
+		}
+		var content string
+		if la, ok := a.(*hci.Advertisement); ok {
+			content = string(la.Data()) + string(la.ScanResponse())
+		}
+		addr := a.Address().String()
+		if prev, ok := seen.Get(addr); ok && prev == content {
+			return
+		}
+		seen.Add(addr, content)
+		h(a)
+	}
+}
+
+// ScanWithOptions starts scanning, passing the advertisements matching the options to the handler, until the context
+// is done or the scan duration elapsed. Options not given keep the defaults set with HCI.SetScanParams.
+func (d *Device) ScanWithOptions(ctx context.Context, h ble.AdvHandler, opts ...ScanOption) error {
+	cfg := &scanConfig{params: d.HCI.ScanParams()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.err != nil {
+		return cfg.err
+	}
+	if cfg.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.duration)
+		defer cancel()
+	}
+	switch cfg.dup {
+	case DuplicatesHost:
+		h = dedup(h, nil)
+	case DuplicatesController:
+		// The controller only filters duplicates if every subscriber asked it to, the host filters them otherwise.
+		h = dedup(h, d.scanner.reportsDuplicates)
+	}
+	if f := cfg.match(); f != nil {
+		next := h
+		h = func(a ble.Advertisement) {
+			if f(a) {
+				next(a)
+			}
+		}
+	}
+
+	sub, err := d.scanner.subscribe(ctx, cfg, h)
+	if err != nil {
+		return err
+	}
+
+	// scan until the context or socket close
+	select {
+	case err = <-sub.err:
+		_ = d.scanner.unsubscribe(sub)
+		return err
+	case <-ctx.Done():
+		return d.scanner.unsubscribe(sub)
+	case <-d.HCI.Closed():
+		_ = d.scanner.unsubscribe(sub)
+		return errors.New("hci device closed")
+	}
+}
@@ -0,0 +1,298 @@
+package linux
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+	"github.com/thomascriley/ble/log"
+)
+
+// scanner shares a single controller scan between the concurrent callers of Device.ScanWithOptions. The controller
+// scans with the parameters of all subscribers merged, and stops once the last subscriber left.
+type scanner struct {
+	hci *hci.HCI
+	log *slog.Logger
+
+	// mu serializes changes to the controller scan. It is held while commands are sent, so it must never be taken
+	// from the advertisement handler, which runs on the goroutine receiving the command responses.
+	mu      sync.Mutex
+	running bool
+	paused  int
+	current scanState
+
+	// duplicates is set while the controller scan reports the duplicate advertisements. It is read from the
+	// advertisement handler.
+	duplicates atomic.Bool
+
+	subsMu sync.RWMutex
+	subs   []*scanSub
+}
+
+// scanSub is a single subscriber of the scanner.
+type scanSub struct {
+	cfg *scanConfig
+	h   ble.AdvHandler
+	err chan error
+}
+
+// scanState is the merged configuration the controller scan runs with.
+type scanState struct {
+	params     cmd.LESetScanParameters
+	phys       hci.PHYs
+	allowDup   bool
+	acceptList []acceptListEntry
+}
+
+func newScanner(h *hci.HCI, log *slog.Logger) *scanner {
+	return &scanner{hci: h, log: log}
+}
+
+// dispatch passes the advertisement to every subscriber.
+func (s *scanner) dispatch(a ble.Advertisement) {
+	s.subsMu.RLock()
+	subs := s.subs
+	s.subsMu.RUnlock()
+	for _, sub := range subs {
+		sub.h(a)
+	}
+}
+
+// subscribe adds a subscriber and starts or reconfigures the controller scan for it.
+func (s *scanner) subscribe(ctx context.Context, cfg *scanConfig, h ble.AdvHandler) (*scanSub, error) {
+	sub := &scanSub{cfg: cfg, h: h, err: make(chan error, 1)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subsMu.Lock()
+	s.subs = append(s.subs[:len(s.subs):len(s.subs)], sub)
+	s.subsMu.Unlock()
+
+	if err := s.hci.SetAdvHandler(s.dispatch); err != nil {
+		s.remove(sub)
+		return nil, fmt.Errorf("unable to set advertisement handler: %w", err)
+	}
+	if err := s.update(ctx); err != nil {
+		s.remove(sub)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// unsubscribe removes the subscriber, stopping the controller scan if it was the last one and reconfiguring it for
+// the remaining subscribers otherwise.
+func (s *scanner) unsubscribe(sub *scanSub) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(sub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.update(ctx)
+}
+
+func (s *scanner) remove(sub *scanSub) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	subs := make([]*scanSub, 0, len(s.subs))
+	for _, other := range s.subs {
+		if other != sub {
+			subs = append(subs, other)
+		}
+	}
+	s.subs = subs
+}
+
+// pause stops the controller scan until resume is called, for instance while connecting. Pauses nest, the scan
+// restarts once every pause has been resumed.
+func (s *scanner) pause() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := s.stop(ctx); err != nil {
+			return err
+		}
+	}
+	s.paused++
+	return nil
+}
+
+// resume restarts the controller scan stopped by pause. Errors are reported to the subscribers.
+func (s *scanner) resume(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused > 0 {
+		s.paused--
+	}
+	if err := s.update(ctx); err != nil {
+		s.log.Debug("BLE: failed to resume scan", log.Error(err))
+		s.subsMu.RLock()
+		for _, sub := range s.subs {
+			select {
+			case sub.err <- err:
+			default:
+			}
+		}
+		s.subsMu.RUnlock()
+	}
+}
+
+// update brings the controller scan in line with the subscribers. It must be called with mu held.
+func (s *scanner) update(ctx context.Context) error {
+	s.subsMu.RLock()
+	subs := s.subs
+	s.subsMu.RUnlock()
+
+	if len(subs) == 0 || s.paused > 0 {
+		if s.running {
+			return s.stop(ctx)
+		}
+		return nil
+	}
+
+	state := merge(subs)
+	if s.running && state.equal(s.current) {
+		return nil
+	}
+	if s.running {
+		if err := s.stop(ctx); err != nil {
+			return err
+		}
+	}
+	return s.start(ctx, state)
+}
+
+func (s *scanner) start(ctx context.Context, state scanState) error {
+	s.log.Debug("BLE: starting device scan")
+	p := state.params
+	if len(state.acceptList) > 0 && s.pushAcceptList(ctx, state.acceptList) {
+		p.ScanningFilterPolicy |= 0x01 // ignore advertisements not in the accept list
+	}
+	s.duplicates.Store(state.allowDup)
+	var err error
+	if state.phys != 0 {
+		err = s.hci.ScanExtended(ctx, hci.ExtendedScanParameters(p, state.phys), state.allowDup)
+	} else {
+		err = s.hci.ScanWithParams(ctx, p, state.allowDup)
+	}
+	if err != nil {
+		return fmt.Errorf("ble failed to start scan: %w", err)
+	}
+	s.log.Debug("BLE: started device scan")
+	s.current = state
+	s.running = true
+	return nil
+}
+
+func (s *scanner) stop(ctx context.Context) error {
+	s.log.Debug("BLE: stopping device scan")
+	if err := s.hci.StopScanning(ctx); err != nil {
+		return fmt.Errorf("ble failed to stop scanning: %w", err)
+	}
+	s.log.Debug("BLE: stopped device scan")
+	s.running = false
+	return nil
+}
+
+// reportsDuplicates reports whether the controller scan reports the duplicate advertisements.
+func (s *scanner) reportsDuplicates() bool {
+	return s.duplicates.Load()
+}
+
+// pushAcceptList loads the accept list into the controller. It reports false if the controller can not hold the list,
+// in which case the addresses are only filtered on the host.
+func (s *scanner) pushAcceptList(ctx context.Context, entries []acceptListEntry) bool {
+	size, err := s.hci.AcceptListSize(ctx)
+	if err != nil {
+		s.log.Debug("BLE: unable to read accept list size", log.Error(err))
+		return false
+	}
+	if len(entries) > size {
+		s.log.Debug("BLE: accept list does not fit the controller, filtering on host")
+		return false
+	}
+	if err = s.hci.ClearAcceptList(ctx); err != nil {
+		s.log.Debug("BLE: unable to clear accept list", log.Error(err))
+		return false
+	}
+	for _, e := range entries {
+		if err = s.hci.AddToAcceptList(ctx, e.addr, e.addressType); err != nil {
+			s.log.Debug("BLE: unable to add to accept list", log.Error(err))
+			return false
+		}
+	}
+	return true
+}
+
+// merge combines the configurations of the subscribers into the one the controller scans with. Active scanning wins
+// over passive, the shortest interval and the longest window win, and the controller only filters duplicates or
+// uses the accept list if every subscriber asked for it. The own address type is the one of the first subscriber.
+func merge(subs []*scanSub) scanState {
+	state := scanState{params: subs[0].cfg.params, allowDup: false}
+	acceptAll := false
+	for _, sub := range subs {
+		p := sub.cfg.params
+		if p.LEScanType == 0x01 {
+			state.params.LEScanType = 0x01
+		}
+		if p.LEScanInterval < state.params.LEScanInterval {
+			state.params.LEScanInterval = p.LEScanInterval
+		}
+		if p.LEScanWindow > state.params.LEScanWindow {
+			state.params.LEScanWindow = p.LEScanWindow
+		}
+		// Accepting directed advertisements to resolvable private addresses is more permissive, restricting to the
+		// accept list is less so.
+		state.params.ScanningFilterPolicy |= p.ScanningFilterPolicy & 0x02
+		state.params.ScanningFilterPolicy &= p.ScanningFilterPolicy | 0x02
+		if sub.cfg.dup != DuplicatesController {
+			state.allowDup = true
+		}
+		if len(sub.cfg.acceptList) == 0 {
+			acceptAll = true
+		}
+		state.acceptList = append(state.acceptList, sub.cfg.acceptList...)
+		if sub.cfg.phys != 0 {
+			state.phys |= sub.cfg.phys
+		}
+	}
+	if state.params.LEScanWindow > state.params.LEScanInterval {
+		state.params.LEScanWindow = state.params.LEScanInterval
+	}
+	if state.phys != 0 {
+		// Subscribers scanning with the legacy commands still need the LE 1M PHY.
+		for _, sub := range subs {
+			if sub.cfg.phys == 0 {
+				state.phys |= hci.PHY1M
+			}
+		}
+	}
+	if acceptAll {
+		state.acceptList = nil
+	}
+	return state
+}
+
+func (s scanState) equal(o scanState) bool {
+	if s.params != o.params || s.phys != o.phys || s.allowDup != o.allowDup || len(s.acceptList) != len(o.acceptList) {
+		return false
+	}
+	for i, e := range s.acceptList {
+		if e.addressType != o.acceptList[i].addressType || e.addr.String() != o.acceptList[i].addr.String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package linux
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/hci"
+	"github.com/thomascriley/ble/linux/hci/cmd"
+)
+
+func testSub(opts ...ScanOption) *scanSub {
+	cfg := &scanConfig{params: cmd.LESetScanParameters{LEScanInterval: 0x0010, LEScanWindow: 0x0010}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &scanSub{cfg: cfg}
+}
+
+func TestMergeScanConfigs(t *testing.T) {
+	passive := testSub(WithActiveScan(false), WithScanInterval(100*time.Millisecond, 50*time.Millisecond))
+	active := testSub(WithActiveScan(true), WithAllowDuplicates(true), WithScanInterval(40*time.Millisecond, 20*time.Millisecond))
+
+	state := merge([]*scanSub{passive, active})
+	if state.params.LEScanType != 0x01 {
+		t.Fatalf("Expected: active scan, Received: %d", state.params.LEScanType)
+	}
+	if state.params.LEScanInterval != 64 || state.params.LEScanWindow != 64 {
+		t.Fatalf("Expected: interval 64, window 64, Received: interval %d, window %d", state.params.LEScanInterval, state.params.LEScanWindow)
+	}
+	if !state.allowDup {
+		t.Fatalf("Expected controller duplicate filtering to be disabled")
+	}
+
+	state = merge([]*scanSub{passive})
+	if state.params.LEScanType != 0x00 || state.allowDup {
+		t.Fatalf("Expected: passive scan with duplicate filtering, Received: %+v", state)
+	}
+}
+
+func TestMergeAcceptLists(t *testing.T) {
+	a := testSub(WithAcceptList(ble.AddressTypePublic, ble.NewAddr("aa:bb:cc:dd:ee:ff")))
+	b := testSub(WithAcceptList(ble.AddressTypeRandom, ble.NewAddr("11:22:33:44:55:66")))
+	if state := merge([]*scanSub{a, b}); len(state.acceptList) != 2 {
+		t.Fatalf("Expected: 2 accept list entries, Received: %d", len(state.acceptList))
+	}
+	if state := merge([]*scanSub{a, testSub()}); state.acceptList != nil {
+		t.Fatalf("Expected: no accept list, Received: %v", state.acceptList)
+	}
+}
+
+func TestMergeScanPHYs(t *testing.T) {
+	coded := testSub(WithScanPHYs(hci.PHYCoded))
+	if state := merge([]*scanSub{coded, testSub()}); state.phys != hci.PHY1M|hci.PHYCoded {
+		t.Fatalf("Expected: %d, Received: %d", hci.PHY1M|hci.PHYCoded, state.phys)
+	}
+}
+
+// addrAdv is an advertisement of the address, without content.
+type addrAdv struct {
+	ble.Advertisement
+	addr ble.Addr
+}
+
+func (a addrAdv) Address() ble.Addr { return a.addr }
+
+func TestDedup(t *testing.T) {
+	a := addrAdv{addr: ble.NewAddr("AA:BB:CC:DD:EE:FF")}
+	for _, tc := range []struct {
+		name     string
+		active   func() bool
+		expected int
+	}{
+		{name: "host", expected: 1},
+		{name: "controller filtering", active: func() bool { return false }, expected: 3},
+		{name: "controller reporting duplicates", active: func() bool { return true }, expected: 1},
+	} {
+		n := 0
+		h := dedup(func(ble.Advertisement) { n++ }, tc.active)
+		for i := 0; i < 3; i++ {
+			h(a)
+		}
+		if n != tc.expected {
+			t.Fatalf("%s: Expected: %d, Received: %d", tc.name, tc.expected, n)
+		}
+	}
+}
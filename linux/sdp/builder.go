@@ -0,0 +1,111 @@
+package sdp
+
+import (
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/sdp/element"
+)
+
+// Attribute IDs of the records built.
+const (
+	// AttrSupportedFormatsList is the object formats an OBEX Object Push server accepts.
+	AttrSupportedFormatsList uint16 = 0x0303
+
+	// AttrSDPVersionNumberList is the versions of SDP the SDP server supports.
+	AttrSDPVersionNumberList uint16 = 0x0200
+)
+
+// Object formats of the OBEX Object Push profile [OPP, 6.1].
+const (
+	FormatVCard21   uint8 = 0x01
+	FormatVCard30   uint8 = 0x02
+	FormatVCal10    uint8 = 0x03
+	FormatICal20    uint8 = 0x04
+	FormatVNote     uint8 = 0x05
+	FormatVMessage  uint8 = 0x06
+	FormatAnyObject uint8 = 0xFF
+)
+
+var (
+	// sdpServer is the service class of the record of the SDP server itself.
+	sdpServer = ble.UUID16(0x1000)
+
+	// languageBaseAttributeIDList declares the English texts, encoded in UTF-8, at the primary language base.
+	languageBaseAttributeIDList = element.Sequence{uint16(0x656E), uint16(0x006A), AttrPrimaryLanguageBase}
+)
+
+// NewRecord returns the record of a service of the classes, the most specific first, reached through the protocol
+// stack and conforming to the profiles. The record is browsable in the public browse group, and named name unless
+// empty.
+func NewRecord(name string, classes []ble.UUID, protocols []ProtocolDescriptor,
+	profiles []ProfileDescriptor) (Record, error) {
+	r := Record{}
+	seq := element.Sequence{}
+	for _, u := range classes {
+		v, err := element.FromUUID(u)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	r[AttrServiceClassIDList] = seq
+
+	if len(protocols) > 0 {
+		seq = element.Sequence{}
+		for _, p := range protocols {
+			v, err := element.FromUUID(p.Protocol)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, append(element.Sequence{v}, p.Params...))
+		}
+		r[AttrProtocolDescriptorList] = seq
+	}
+
+	if len(profiles) > 0 {
+		seq = element.Sequence{}
+		for _, p := range profiles {
+			v, err := element.FromUUID(p.Profile)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, element.Sequence{v, p.Version})
+		}
+		r[AttrBluetoothProfileDescriptorList] = seq
+	}
+
+	r[AttrBrowseGroupList] = element.Sequence{element.UUID16(0x1002)}
+	if name != "" {
+		r[AttrLanguageBaseAttributeIDList] = languageBaseAttributeIDList
+		r[AttrPrimaryLanguageBase+AttrServiceNameOffset] = name
+	}
+	return r, nil
+}
+
+// RFCOMMProtocols returns the protocol stack of the services running over the RFCOMM server channel.
+func RFCOMMProtocols(channel uint8) []ProtocolDescriptor {
+	return []ProtocolDescriptor{
+		{Protocol: ProtocolL2CAP},
+		{Protocol: ProtocolRFCOMM, Params: []interface{}{channel}},
+	}
+}
+
+// SerialPortRecord returns the record of a Serial Port Profile service on the RFCOMM server channel [SPP, 6].
+func SerialPortRecord(name string, channel uint8) Record {
+	r, _ := NewRecord(name, []ble.UUID{SerialPort}, RFCOMMProtocols(channel),
+		[]ProfileDescriptor{{Profile: SerialPort, Version: 0x0102}})
+	return r
+}
+
+// OBEXObjectPushRecord returns the record of an OBEX Object Push service on the RFCOMM server channel, accepting the
+// object formats [OPP, 6.1].
+func OBEXObjectPushRecord(name string, channel uint8, formats []uint8) Record {
+	protocols := append(RFCOMMProtocols(channel), ProtocolDescriptor{Protocol: ProtocolOBEX})
+	r, _ := NewRecord(name, []ble.UUID{OBEXObjectPush}, protocols,
+		[]ProfileDescriptor{{Profile: OBEXObjectPush, Version: 0x0102}})
+	seq := make(element.Sequence, 0, len(formats))
+	for _, f := range formats {
+		seq = append(seq, f)
+	}
+	r[AttrSupportedFormatsList] = seq
+	return r
+}
@@ -0,0 +1,249 @@
+package sdp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/sdp/element"
+)
+
+// maxAttributeBytes bounds the attribute lists a client reassembles from the partial responses.
+const maxAttributeBytes = 1 << 20
+
+// Client is a Service Discovery Protocol client [Vol 3, Part B, 2.1]. It runs over a channel keeping the boundaries
+// of the PDUs, such as a BR/EDR channel to PSM, and sends one request at a time.
+type Client struct {
+	rw    io.ReadWriter
+	rxMTU int
+	txMTU int
+
+	mu  sync.Mutex
+	tid uint16
+
+	chRsp  chan []byte
+	chDone chan struct{}
+	err    error
+}
+
+// NewClient returns a client running over rw, whose largest PDUs received and sent are rxMTU and txMTU bytes. It
+// reads rw until it returns an error, such as once the channel is closed.
+func NewClient(rw io.ReadWriter, rxMTU, txMTU int) *Client {
+	c := &Client{
+		rw:     rw,
+		rxMTU:  rxMTU,
+		txMTU:  txMTU,
+		chRsp:  make(chan []byte, 1),
+		chDone: make(chan struct{}),
+	}
+	go c.loop()
+	return c
+}
+
+func (c *Client) loop() {
+	defer close(c.chDone)
+	for {
+		b := make([]byte, c.rxMTU)
+		n, err := c.rw.Read(b)
+		if err != nil {
+			c.err = err
+			return
+		}
+		// A response nobody waits for anymore is replaced.
+		select {
+		case <-c.chRsp:
+		default:
+		}
+		c.chRsp <- b[:n]
+	}
+}
+
+// ServiceSearch returns the handles of the service records matching all the UUIDs of the pattern
+// [Vol 3, Part B, 4.5].
+func (c *Client) ServiceSearch(ctx context.Context, pattern []ble.UUID) ([]uint32, error) {
+	params, err := searchPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	params = binary.BigEndian.AppendUint16(params, 0xFFFF)
+
+	var handles []uint32
+	var cont []byte
+	for {
+		rsp, err := c.transact(ctx, pduServiceSearchRequest, appendContinuation(params, cont))
+		if err != nil {
+			return nil, err
+		}
+		if len(rsp) < 4 {
+			return nil, fmt.Errorf("invalid service search response")
+		}
+		n := int(binary.BigEndian.Uint16(rsp[2:4]))
+		if len(rsp) < 4+4*n {
+			return nil, fmt.Errorf("invalid service search response")
+		}
+		for i := 0; i < n; i++ {
+			handles = append(handles, binary.BigEndian.Uint32(rsp[4+4*i:]))
+		}
+		if cont, err = continuation(rsp[4+4*n:]); err != nil {
+			return nil, err
+		}
+		if len(cont) == 0 {
+			return handles, nil
+		}
+	}
+}
+
+// ServiceAttribute returns the attributes of the ranges of the service record, all of them if none are given
+// [Vol 3, Part B, 4.6].
+func (c *Client) ServiceAttribute(ctx context.Context, handle uint32, ranges ...AttributeRange) (Record, error) {
+	params := binary.BigEndian.AppendUint32(nil, handle)
+	v, err := c.attributes(ctx, pduServiceAttributeRequest, params, ranges)
+	if err != nil {
+		return nil, err
+	}
+	return parseAttributeList(v)
+}
+
+// ServiceSearchAttribute returns the attributes of the ranges of the service records matching all the UUIDs of the
+// pattern, all of them if none are given [Vol 3, Part B, 4.7].
+func (c *Client) ServiceSearchAttribute(ctx context.Context, pattern []ble.UUID,
+	ranges ...AttributeRange) ([]Record, error) {
+	params, err := searchPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.attributes(ctx, pduServiceSearchAttributeRequest, params, ranges)
+	if err != nil {
+		return nil, err
+	}
+	lists, ok := v.(element.Sequence)
+	if !ok {
+		return nil, fmt.Errorf("invalid attribute lists")
+	}
+	recs := make([]Record, 0, len(lists))
+	for _, l := range lists {
+		r, err := parseAttributeList(l)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, r)
+	}
+	return recs, nil
+}
+
+// attributes sends the attribute request until the whole attribute list, or lists, is received, and decodes it.
+func (c *Client) attributes(ctx context.Context, id uint8, params []byte, ranges []AttributeRange) (interface{},
+	error) {
+	if len(ranges) == 0 {
+		ranges = []AttributeRange{AllAttributes}
+	}
+	max := c.rxMTU - headerLen - 2 - 1 - maxContinuationLen
+	if max < minAttributeByteCount {
+		max = minAttributeByteCount
+	}
+	if max > 0xFFFF {
+		max = 0xFFFF
+	}
+	params = binary.BigEndian.AppendUint16(params, uint16(max))
+	params, err := element.Append(params, attributeIDList(ranges))
+	if err != nil {
+		return nil, err
+	}
+
+	var b, cont []byte
+	for {
+		rsp, err := c.transact(ctx, id, appendContinuation(params, cont))
+		if err != nil {
+			return nil, err
+		}
+		if len(rsp) < 2 {
+			return nil, fmt.Errorf("invalid attribute response")
+		}
+		n := int(binary.BigEndian.Uint16(rsp[0:2]))
+		if len(rsp) < 2+n {
+			return nil, fmt.Errorf("invalid attribute response")
+		}
+		if b = append(b, rsp[2:2+n]...); len(b) > maxAttributeBytes {
+			return nil, fmt.Errorf("attribute lists exceed %d bytes", maxAttributeBytes)
+		}
+		if cont, err = continuation(rsp[2+n:]); err != nil {
+			return nil, err
+		}
+		if len(cont) == 0 {
+			break
+		}
+	}
+	v, n, err := element.Unmarshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode attribute lists: %w", err)
+	}
+	if n != len(b) {
+		return nil, fmt.Errorf("unexpected %d bytes after attribute lists", len(b)-n)
+	}
+	return v, nil
+}
+
+// transact sends the request and returns the parameters of its response.
+func (c *Client) transact(ctx context.Context, id uint8, params []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if headerLen+len(params) > c.txMTU {
+		return nil, fmt.Errorf("request of %d bytes exceeds mtu %d", headerLen+len(params), c.txMTU)
+	}
+	c.tid++
+	if _, err := c.rw.Write(pdu(id, c.tid, params)); err != nil {
+		return nil, fmt.Errorf("unable to send request: %w", err)
+	}
+	for {
+		select {
+		case b := <-c.chRsp:
+			if len(b) < headerLen || binary.BigEndian.Uint16(b[1:3]) != c.tid {
+				// Drop the responses to the requests given up on.
+				continue
+			}
+			params := b[headerLen:]
+			if int(binary.BigEndian.Uint16(b[3:5])) != len(params) {
+				return nil, fmt.Errorf("invalid parameter length")
+			}
+			switch b[0] {
+			case id + 1:
+				return params, nil
+			case pduErrorResponse:
+				if len(params) < 2 {
+					return nil, fmt.Errorf("invalid error response")
+				}
+				return nil, Error(binary.BigEndian.Uint16(params))
+			default:
+				return nil, fmt.Errorf("unexpected response 0x%02X", b[0])
+			}
+		case <-c.chDone:
+			if c.err == nil || errors.Is(c.err, io.EOF) {
+				return nil, io.ErrClosedPipe
+			}
+			return nil, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// searchPattern returns the service search pattern of the UUIDs [Vol 3, Part B, 4.5.1].
+func searchPattern(pattern []ble.UUID) ([]byte, error) {
+	if len(pattern) == 0 || len(pattern) > maxSearchPattern {
+		return nil, fmt.Errorf("search pattern of %d uuids, not 1 to %d", len(pattern), maxSearchPattern)
+	}
+	seq := make(element.Sequence, 0, len(pattern))
+	for _, u := range pattern {
+		v, err := element.FromUUID(u)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return element.Marshal(seq)
+}
@@ -0,0 +1,143 @@
+package sdp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/sdp/element"
+)
+
+// sduPipe is one end of an in-memory channel keeping the boundaries of the SDUs.
+type sduPipe struct {
+	rx <-chan []byte
+	tx chan<- []byte
+}
+
+func newSDUPipe() (*sduPipe, *sduPipe) {
+	a, b := make(chan []byte, 4), make(chan []byte, 4)
+	return &sduPipe{rx: a, tx: b}, &sduPipe{rx: b, tx: a}
+}
+
+func (p *sduPipe) Read(b []byte) (int, error) {
+	sdu, ok := <-p.rx
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(b, sdu), nil
+}
+
+func (p *sduPipe) Write(b []byte) (int, error) {
+	p.tx <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (p *sduPipe) Close() error {
+	close(p.tx)
+	return nil
+}
+
+func TestServiceSearchAttributeContinuation(t *testing.T) {
+	rec := element.Sequence{
+		AttrServiceRecordHandle, uint32(0x00010001),
+		AttrServiceClassIDList, element.Sequence{element.UUID16(0x1101)},
+		AttrProtocolDescriptorList, element.Sequence{
+			element.Sequence{element.UUID16(0x0100)},
+			element.Sequence{element.UUID16(0x0003), uint8(5)},
+		},
+		AttrPrimaryLanguageBase, "Serial Port",
+	}
+	lists, err := element.Marshal(element.Sequence{rec})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	local, remote := newSDUPipe()
+	defer local.Close()
+	go func() {
+		defer remote.Close()
+		// Send the attribute lists in two parts, the first one followed by a continuation state.
+		parts := [][]byte{lists[:10], lists[10:]}
+		for i, part := range parts {
+			req := make([]byte, 64)
+			n, err := remote.Read(req)
+			if err != nil || n < headerLen || req[0] != pduServiceSearchAttributeRequest {
+				return
+			}
+			params := binary.BigEndian.AppendUint16(nil, uint16(len(part)))
+			params = append(params, part...)
+			if i == 0 {
+				params = appendContinuation(params, []byte{0x01})
+			} else {
+				params = appendContinuation(params, nil)
+			}
+			_, _ = remote.Write(pdu(pduServiceSearchAttributeResponse, binary.BigEndian.Uint16(req[1:3]), params))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	recs, err := NewClient(local, 64, 48).ServiceSearchAttribute(ctx, []ble.UUID{SerialPort})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("Expected: 1 record, Received: %d", len(recs))
+	}
+	if ch, ok := recs[0].RFCOMMChannel(); !ok || ch != 5 {
+		t.Fatalf("Expected: %d, Received: %d", 5, ch)
+	}
+	if h, _ := recs[0].Handle(); h != 0x00010001 {
+		t.Fatalf("Expected: %X, Received: %X", 0x00010001, h)
+	}
+	if name, _ := recs[0].ServiceName(); name != "Serial Port" {
+		t.Fatalf("Expected: %s, Received: %s", "Serial Port", name)
+	}
+	if ids := recs[0].ServiceClassIDs(); len(ids) != 1 || !ids[0].Equal(SerialPort) {
+		t.Fatalf("Expected: %v, Received: %v", []ble.UUID{SerialPort}, ids)
+	}
+}
+
+func TestServiceSearchErrorResponse(t *testing.T) {
+	local, remote := newSDUPipe()
+	defer local.Close()
+	go func() {
+		defer remote.Close()
+		req := make([]byte, 64)
+		if _, err := remote.Read(req); err != nil {
+			return
+		}
+		params := binary.BigEndian.AppendUint16(nil, uint16(ErrInvalidSyntax))
+		_, _ = remote.Write(pdu(pduErrorResponse, binary.BigEndian.Uint16(req[1:3]), params))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := NewClient(local, 48, 48).ServiceSearch(ctx, []ble.UUID{SerialPort}); err != ErrInvalidSyntax {
+		t.Fatalf("Expected: %v, Received: %v", ErrInvalidSyntax, err)
+	}
+}
+
+func TestRecordString(t *testing.T) {
+	r := Record{
+		AttrServiceRecordHandle: uint32(0x00010000),
+		AttrServiceClassIDList:  element.Sequence{element.UUID16(0x1101)},
+		AttrProtocolDescriptorList: element.Sequence{
+			element.Sequence{element.UUID16(0x0100)},
+			element.Sequence{element.UUID16(0x0003), uint8(3)},
+		},
+		AttrPrimaryLanguageBase + AttrServiceNameOffset: "Serial Port",
+		0x0200: true,
+	}
+	expected := "0x0000 ServiceRecordHandle: Uint(0x10000)\n" +
+		"0x0001 ServiceClassIDList: Sequence{UUID(0x1101)}\n" +
+		"0x0004 ProtocolDescriptorList: Sequence{Sequence{UUID(0x0100)}, Sequence{UUID(0x0003), Uint(0x3)}}\n" +
+		"0x0100 ServiceName: Text(\"Serial Port\")\n" +
+		"0x0200: Bool(true)"
+	if s := r.String(); s != expected {
+		t.Fatalf("Expected: %s, Received: %s", expected, s)
+	}
+}
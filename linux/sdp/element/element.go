@@ -0,0 +1,320 @@
+// Package element implements the data elements of the Service Discovery Protocol [Vol 3, Part B, 3].
+//
+// The data elements are represented by Go values:
+//
+//	Nil          nil
+//	Unsigned     uint8, uint16, uint32, uint64, Uint128
+//	Signed       int8, int16, int32, int64, Int128
+//	UUID         UUID16, UUID32, UUID128
+//	Text         string
+//	Boolean      bool
+//	Sequence     Sequence
+//	Alternative  Alternative
+//	URL          URL
+package element
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Type is the type of a data element, the 5 most significant bits of its header [Vol 3, Part B, 3.2].
+type Type uint8
+
+// Types of the data elements.
+const (
+	TypeNil         Type = 0
+	TypeUint        Type = 1
+	TypeInt         Type = 2
+	TypeUUID        Type = 3
+	TypeText        Type = 4
+	TypeBool        Type = 5
+	TypeSequence    Type = 6
+	TypeAlternative Type = 7
+	TypeURL         Type = 8
+)
+
+// Size indexes of the header, the 3 least significant bits [Vol 3, Part B, 3.3].
+const (
+	size1  = 0
+	size2  = 1
+	size4  = 2
+	size8  = 3
+	size16 = 4
+	size8L = 5 // The size is in the next byte.
+	sizeL  = 6 // The size is in the next 2 bytes.
+	size4L = 7 // The size is in the next 4 bytes.
+)
+
+// maxDepth bounds the nesting of the sequences and alternatives decoded.
+const maxDepth = 32
+
+// ErrMalformed is returned when the data element is truncated or its header invalid.
+var ErrMalformed = errors.New("malformed data element")
+
+type (
+	// Uint128 is a 128-bit unsigned integer, in big-endian order.
+	Uint128 [16]byte
+
+	// Int128 is a 128-bit signed integer, in big-endian order.
+	Int128 [16]byte
+
+	// UUID16 is a 16-bit UUID, an alias of the UUID based on the Bluetooth Base UUID.
+	UUID16 uint16
+
+	// UUID32 is a 32-bit UUID, an alias of the UUID based on the Bluetooth Base UUID.
+	UUID32 uint32
+
+	// UUID128 is a 128-bit UUID, in big-endian order.
+	UUID128 [16]byte
+
+	// Sequence is a sequence of data elements, all of which are used.
+	Sequence []interface{}
+
+	// Alternative is a sequence of data elements, one of which is used.
+	Alternative []interface{}
+
+	// URL is a uniform resource locator.
+	URL string
+)
+
+// TypeOf returns the type of the data element represented by v, and false if v does not represent one.
+func TypeOf(v interface{}) (Type, bool) {
+	switch v.(type) {
+	case nil:
+		return TypeNil, true
+	case uint8, uint16, uint32, uint64, Uint128:
+		return TypeUint, true
+	case int8, int16, int32, int64, Int128:
+		return TypeInt, true
+	case UUID16, UUID32, UUID128:
+		return TypeUUID, true
+	case string:
+		return TypeText, true
+	case bool:
+		return TypeBool, true
+	case Sequence:
+		return TypeSequence, true
+	case Alternative:
+		return TypeAlternative, true
+	case URL:
+		return TypeURL, true
+	}
+	return 0, false
+}
+
+// Marshal encodes the data element represented by v. The sizes of texts, sequences, alternatives and URLs are encoded
+// in the smallest header that fits them.
+func Marshal(v interface{}) ([]byte, error) {
+	return Append(nil, v)
+}
+
+// Append appends the encoding of the data element represented by v to b.
+func Append(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, header(TypeNil, size1)), nil
+	case uint8:
+		return append(b, header(TypeUint, size1), v), nil
+	case uint16:
+		return binary.BigEndian.AppendUint16(append(b, header(TypeUint, size2)), v), nil
+	case uint32:
+		return binary.BigEndian.AppendUint32(append(b, header(TypeUint, size4)), v), nil
+	case uint64:
+		return binary.BigEndian.AppendUint64(append(b, header(TypeUint, size8)), v), nil
+	case Uint128:
+		return append(append(b, header(TypeUint, size16)), v[:]...), nil
+	case int8:
+		return append(b, header(TypeInt, size1), uint8(v)), nil
+	case int16:
+		return binary.BigEndian.AppendUint16(append(b, header(TypeInt, size2)), uint16(v)), nil
+	case int32:
+		return binary.BigEndian.AppendUint32(append(b, header(TypeInt, size4)), uint32(v)), nil
+	case int64:
+		return binary.BigEndian.AppendUint64(append(b, header(TypeInt, size8)), uint64(v)), nil
+	case Int128:
+		return append(append(b, header(TypeInt, size16)), v[:]...), nil
+	case UUID16:
+		return binary.BigEndian.AppendUint16(append(b, header(TypeUUID, size2)), uint16(v)), nil
+	case UUID32:
+		return binary.BigEndian.AppendUint32(append(b, header(TypeUUID, size4)), uint32(v)), nil
+	case UUID128:
+		return append(append(b, header(TypeUUID, size16)), v[:]...), nil
+	case string:
+		return appendVariable(b, TypeText, []byte(v))
+	case bool:
+		if v {
+			return append(b, header(TypeBool, size1), 0x01), nil
+		}
+		return append(b, header(TypeBool, size1), 0x00), nil
+	case Sequence:
+		return appendList(b, TypeSequence, v)
+	case Alternative:
+		return appendList(b, TypeAlternative, v)
+	case URL:
+		return appendVariable(b, TypeURL, []byte(v))
+	}
+	return nil, fmt.Errorf("unsupported data element value %T", v)
+}
+
+func header(t Type, size uint8) byte { return byte(t)<<3 | size }
+
+func appendList(b []byte, t Type, l []interface{}) ([]byte, error) {
+	var data []byte
+	for _, v := range l {
+		var err error
+		if data, err = Append(data, v); err != nil {
+			return nil, err
+		}
+	}
+	return appendVariable(b, t, data)
+}
+
+func appendVariable(b []byte, t Type, data []byte) ([]byte, error) {
+	switch n := uint64(len(data)); {
+	case n <= 0xFF:
+		b = append(b, header(t, size8L), uint8(n))
+	case n <= 0xFFFF:
+		b = binary.BigEndian.AppendUint16(append(b, header(t, sizeL)), uint16(n))
+	case n <= 0xFFFFFFFF:
+		b = binary.BigEndian.AppendUint32(append(b, header(t, size4L)), uint32(n))
+	default:
+		return nil, fmt.Errorf("data element of %d bytes is too large", n)
+	}
+	return append(b, data...), nil
+}
+
+// Unmarshal decodes the data element at the start of b. It returns the value representing it and its size in bytes.
+func Unmarshal(b []byte) (interface{}, int, error) {
+	return unmarshal(b, 0)
+}
+
+func unmarshal(b []byte, depth int) (interface{}, int, error) {
+	if len(b) == 0 {
+		return nil, 0, ErrMalformed
+	}
+	t, size := Type(b[0]>>3), b[0]&0x07
+
+	// The size of the data, and of the header before it.
+	n, hdr := 0, 1
+	switch size {
+	case size1, size2, size4, size8, size16:
+		n = 1 << size
+	case size8L:
+		if len(b) < 2 {
+			return nil, 0, ErrMalformed
+		}
+		n, hdr = int(b[1]), 2
+	case sizeL:
+		if len(b) < 3 {
+			return nil, 0, ErrMalformed
+		}
+		n, hdr = int(binary.BigEndian.Uint16(b[1:])), 3
+	case size4L:
+		if len(b) < 5 {
+			return nil, 0, ErrMalformed
+		}
+		l := binary.BigEndian.Uint32(b[1:])
+		if uint64(l) > uint64(len(b)-5) {
+			return nil, 0, ErrMalformed
+		}
+		n, hdr = int(l), 5
+	}
+	if t == TypeNil {
+		n = 0
+	}
+	if n > len(b)-hdr {
+		return nil, 0, ErrMalformed
+	}
+	data := b[hdr : hdr+n]
+
+	switch t {
+	case TypeNil:
+		if size != size1 {
+			return nil, 0, fmt.Errorf("%w: nil of size index %d", ErrMalformed, size)
+		}
+		return nil, hdr, nil
+	case TypeUint, TypeInt:
+		if size > size16 {
+			return nil, 0, fmt.Errorf("%w: integer of size index %d", ErrMalformed, size)
+		}
+		return integer(t, data), hdr + n, nil
+	case TypeUUID:
+		switch size {
+		case size2:
+			return UUID16(binary.BigEndian.Uint16(data)), hdr + n, nil
+		case size4:
+			return UUID32(binary.BigEndian.Uint32(data)), hdr + n, nil
+		case size16:
+			var u UUID128
+			copy(u[:], data)
+			return u, hdr + n, nil
+		}
+		return nil, 0, fmt.Errorf("%w: uuid of size index %d", ErrMalformed, size)
+	case TypeBool:
+		if size != size1 {
+			return nil, 0, fmt.Errorf("%w: boolean of size index %d", ErrMalformed, size)
+		}
+		return data[0] != 0x00, hdr + n, nil
+	case TypeText, TypeURL, TypeSequence, TypeAlternative:
+		if size < size8L {
+			return nil, 0, fmt.Errorf("%w: type %d of size index %d", ErrMalformed, t, size)
+		}
+	default:
+		return nil, 0, fmt.Errorf("%w: reserved type %d", ErrMalformed, t)
+	}
+
+	switch t {
+	case TypeText:
+		return string(data), hdr + n, nil
+	case TypeURL:
+		return URL(data), hdr + n, nil
+	}
+	if depth == maxDepth {
+		return nil, 0, fmt.Errorf("%w: nested more than %d times", ErrMalformed, maxDepth)
+	}
+	l := make([]interface{}, 0)
+	for len(data) > 0 {
+		v, m, err := unmarshal(data, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		l, data = append(l, v), data[m:]
+	}
+	if t == TypeSequence {
+		return Sequence(l), hdr + n, nil
+	}
+	return Alternative(l), hdr + n, nil
+}
+
+func integer(t Type, data []byte) interface{} {
+	switch len(data) {
+	case 1:
+		if t == TypeInt {
+			return int8(data[0])
+		}
+		return data[0]
+	case 2:
+		if t == TypeInt {
+			return int16(binary.BigEndian.Uint16(data))
+		}
+		return binary.BigEndian.Uint16(data)
+	case 4:
+		if t == TypeInt {
+			return int32(binary.BigEndian.Uint32(data))
+		}
+		return binary.BigEndian.Uint32(data)
+	case 8:
+		if t == TypeInt {
+			return int64(binary.BigEndian.Uint64(data))
+		}
+		return binary.BigEndian.Uint64(data)
+	}
+	var v [16]byte
+	copy(v[:], data)
+	if t == TypeInt {
+		return Int128(v)
+	}
+	return Uint128(v)
+}
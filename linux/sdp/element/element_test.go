@@ -0,0 +1,125 @@
+package element
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/thomascriley/ble"
+)
+
+// sppProtocolDescriptorListBytes is the protocol descriptor list of a serial port on RFCOMM channel 3.
+var sppProtocolDescriptorListBytes = []byte{0x35, 0x0C, 0x35, 0x03, 0x19, 0x01, 0x00, 0x35, 0x05, 0x19, 0x00, 0x03,
+	0x08, 0x03}
+
+func TestMarshalSequence(t *testing.T) {
+	v := Sequence{Sequence{UUID16(0x0100)}, Sequence{UUID16(0x0003), uint8(3)}}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !bytes.Equal(sppProtocolDescriptorListBytes, b) {
+		t.Fatalf("Expected: %X, Received: %X", sppProtocolDescriptorListBytes, b)
+	}
+
+	rx, n, err := Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if n != len(b) || !reflect.DeepEqual(v, rx) {
+		t.Fatalf("Expected: %v, Received: %v", v, rx)
+	}
+}
+
+func TestMarshalValues(t *testing.T) {
+	long := string(make([]byte, 0x100))
+	for _, v := range []interface{}{nil, uint8(1), uint16(2), uint32(3), uint64(4), Uint128{15: 5}, int8(-1),
+		int16(-2), int32(-3), int64(-4), Int128{0: 0xFF}, UUID16(0x1101), UUID32(0x00011101), UUID128{0: 0x12}, "text",
+		long, true, false, Alternative{Sequence{}, Sequence{nil}}, URL("http://example.com")} {
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		rx, n, err := Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if n != len(b) || !reflect.DeepEqual(v, rx) {
+			t.Fatalf("Expected: %v, Received: %v", v, rx)
+		}
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, b := range [][]byte{{}, {0x09, 0x01}, {0x35, 0x03, 0x19}, {0x01}, {0x1D}, {0x48}, {0x4F, 0xFF, 0xFF, 0xFF,
+		0xFF}} {
+		if _, _, err := Unmarshal(b); err == nil {
+			t.Fatalf("Expected an error for %X", b)
+		}
+	}
+}
+
+func TestToUUID(t *testing.T) {
+	spp := UUID128{0x00, 0x00, 0x11, 0x01, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0x80, 0x5F, 0x9B, 0x34, 0xFB}
+	for _, v := range []interface{}{UUID16(0x1101), UUID32(0x1101), spp} {
+		u, err := ToUUID(v)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if !u.Equal(ble.UUID16(0x1101)) {
+			t.Fatalf("Expected: %s, Received: %s", ble.UUID16(0x1101), u)
+		}
+	}
+
+	u := ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7")
+	v, err := FromUUID(u)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if rx, err := ToUUID(v); err != nil || !rx.Equal(u) {
+		t.Fatalf("Expected: %s, Received: %s", u, rx)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	v, _, err := Unmarshal(sppProtocolDescriptorListBytes)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	expected := "Sequence {\n  Sequence {\n    UUID(0x0100)\n  }\n  Sequence {\n    UUID(0x0003)\n    Uint(0x3)\n  }\n}"
+	if s := Format(v); s != expected {
+		t.Fatalf("Expected: %s, Received: %s", expected, s)
+	}
+	expected = "Sequence{Sequence{UUID(0x0100)}, Sequence{UUID(0x0003), Uint(0x3)}}"
+	if s := FormatValue(v); s != expected {
+		t.Fatalf("Expected: %s, Received: %s", expected, s)
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	f.Add(sppProtocolDescriptorListBytes)
+	f.Add([]byte{0x3D, 0x00, 0x05, 0x25, 0x03, 0x61, 0x62, 0x63})
+	f.Add([]byte{0x47, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		v, n, err := Unmarshal(b)
+		if err != nil {
+			return
+		}
+		if n > len(b) {
+			t.Fatalf("Expected: at most %d bytes, Received: %d", len(b), n)
+		}
+		// The value decoded encodes to an element decoding to the same value, though its headers may be smaller.
+		rb, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		rv, rn, err := Unmarshal(rb)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		if rn != len(rb) || !reflect.DeepEqual(v, rv) {
+			t.Fatalf("Expected: %v, Received: %v", v, rv)
+		}
+		_ = Format(v)
+	})
+}
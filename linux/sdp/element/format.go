@@ -0,0 +1,98 @@
+package element
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeNil:
+		return "Nil"
+	case TypeUint:
+		return "Uint"
+	case TypeInt:
+		return "Int"
+	case TypeUUID:
+		return "UUID"
+	case TypeText:
+		return "Text"
+	case TypeBool:
+		return "Bool"
+	case TypeSequence:
+		return "Sequence"
+	case TypeAlternative:
+		return "Alternative"
+	case TypeURL:
+		return "URL"
+	default:
+		return fmt.Sprintf("Type(%d)", uint8(t))
+	}
+}
+
+func (u UUID16) String() string { return fmt.Sprintf("0x%04X", uint16(u)) }
+func (u UUID32) String() string { return fmt.Sprintf("0x%08X", uint32(u)) }
+func (u UUID128) String() string {
+	return fmt.Sprintf("%X-%X-%X-%X-%X", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+func (v Uint128) String() string { return fmt.Sprintf("0x%X", v[:]) }
+func (v Int128) String() string  { return fmt.Sprintf("0x%X", v[:]) }
+
+// Format returns the data element represented by v as indented text, one element per line.
+func Format(v interface{}) string {
+	var sb strings.Builder
+	format(&sb, v, 0)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func format(sb *strings.Builder, v interface{}, depth int) {
+	switch v := v.(type) {
+	case Sequence:
+		formatList(sb, "Sequence", v, depth)
+	case Alternative:
+		formatList(sb, "Alternative", v, depth)
+	default:
+		fmt.Fprintf(sb, "%s%s\n", strings.Repeat("  ", depth), FormatValue(v))
+	}
+}
+
+func formatList(sb *strings.Builder, name string, l []interface{}, depth int) {
+	fmt.Fprintf(sb, "%s%s {\n", strings.Repeat("  ", depth), name)
+	for _, e := range l {
+		format(sb, e, depth+1)
+	}
+	fmt.Fprintf(sb, "%s}\n", strings.Repeat("  ", depth))
+}
+
+// FormatValue returns the data element represented by v on a single line, prefixed by its type.
+func FormatValue(v interface{}) string {
+	t, ok := TypeOf(v)
+	if !ok {
+		return fmt.Sprintf("Invalid(%T)", v)
+	}
+	switch v := v.(type) {
+	case nil:
+		return "Nil"
+	case uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%s(0x%X)", t, v)
+	case int8, int16, int32, int64:
+		return fmt.Sprintf("%s(%d)", t, v)
+	case string:
+		return fmt.Sprintf("%s(%q)", t, v)
+	case URL:
+		return fmt.Sprintf("%s(%q)", t, string(v))
+	case Sequence:
+		return formatValues(t, v)
+	case Alternative:
+		return formatValues(t, v)
+	}
+	return fmt.Sprintf("%s(%v)", t, v)
+}
+
+func formatValues(t Type, l []interface{}) string {
+	parts := make([]string, 0, len(l))
+	for _, e := range l {
+		parts = append(parts, FormatValue(e))
+	}
+	return fmt.Sprintf("%s{%s}", t, strings.Join(parts, ", "))
+}
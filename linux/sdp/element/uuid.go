@@ -0,0 +1,48 @@
+package element
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thomascriley/ble"
+)
+
+// baseUUID is the Bluetooth Base UUID, 00000000-0000-1000-8000-00805F9B34FB, the 16-bit and 32-bit UUIDs are aliases
+// of [Vol 3, Part B, 2.5.1].
+var baseUUID = UUID128{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0x80, 0x5F, 0x9B, 0x34, 0xFB}
+
+// FromUUID returns the UUID element of u, a UUID16 for the 16-bit UUIDs and a UUID128 for the others.
+func FromUUID(u ble.UUID) (interface{}, error) {
+	switch u.Len() {
+	case 2:
+		return UUID16(binary.LittleEndian.Uint16(u)), nil
+	case 16:
+		var v UUID128
+		copy(v[:], ble.Reverse(u))
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid uuid length %d", u.Len())
+}
+
+// ToUUID returns the ble.UUID of the UUID element v. The UUIDs based on the Bluetooth Base UUID are returned as 16-bit
+// UUIDs whenever their value fits, so that they compare equal to the ble.UUID16 of the services.
+func ToUUID(v interface{}) (ble.UUID, error) {
+	switch v := v.(type) {
+	case UUID16:
+		return ble.UUID16(uint16(v)), nil
+	case UUID32:
+		if v <= 0xFFFF {
+			return ble.UUID16(uint16(v)), nil
+		}
+		u := baseUUID
+		binary.BigEndian.PutUint32(u[:4], uint32(v))
+		return ble.UUID(ble.Reverse(u[:])), nil
+	case UUID128:
+		if bytes.Equal(v[:2], []byte{0x00, 0x00}) && bytes.Equal(v[4:], baseUUID[4:]) {
+			return ble.UUID16(binary.BigEndian.Uint16(v[2:4])), nil
+		}
+		return ble.UUID(ble.Reverse(v[:])), nil
+	}
+	return nil, fmt.Errorf("%T is not a uuid data element", v)
+}
@@ -0,0 +1,235 @@
+package sdp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/sdp/element"
+)
+
+// Universal attribute IDs [Assigned Numbers, 5.1].
+const (
+	AttrServiceRecordHandle               uint16 = 0x0000
+	AttrServiceClassIDList                uint16 = 0x0001
+	AttrServiceRecordState                uint16 = 0x0002
+	AttrServiceID                         uint16 = 0x0003
+	AttrProtocolDescriptorList            uint16 = 0x0004
+	AttrBrowseGroupList                   uint16 = 0x0005
+	AttrLanguageBaseAttributeIDList       uint16 = 0x0006
+	AttrServiceInfoTimeToLive             uint16 = 0x0007
+	AttrServiceAvailability               uint16 = 0x0008
+	AttrBluetoothProfileDescriptorList    uint16 = 0x0009
+	AttrDocumentationURL                  uint16 = 0x000A
+	AttrClientExecutableURL               uint16 = 0x000B
+	AttrIconURL                           uint16 = 0x000C
+	AttrAdditionalProtocolDescriptorLists uint16 = 0x000D
+
+	// The offsets of the attributes of a language from its base attribute ID.
+	AttrServiceNameOffset        uint16 = 0x0000
+	AttrServiceDescriptionOffset uint16 = 0x0001
+	AttrProviderNameOffset       uint16 = 0x0002
+
+	// AttrPrimaryLanguageBase is the base attribute ID of the primary language of the records.
+	AttrPrimaryLanguageBase uint16 = 0x0100
+)
+
+// Protocol and service class UUIDs [Assigned Numbers, 3.1 and 3.3].
+var (
+	ProtocolSDP    = ble.UUID16(0x0001)
+	ProtocolRFCOMM = ble.UUID16(0x0003)
+	ProtocolOBEX   = ble.UUID16(0x0008)
+	ProtocolL2CAP  = ble.UUID16(0x0100)
+
+	PublicBrowseRoot = ble.UUID16(0x1002)
+	SerialPort       = ble.UUID16(0x1101)
+	OBEXObjectPush   = ble.UUID16(0x1105)
+	OBEXFileTransfer = ble.UUID16(0x1106)
+	Headset          = ble.UUID16(0x1108)
+	HeadsetAG        = ble.UUID16(0x1112)
+	Handsfree        = ble.UUID16(0x111E)
+	HandsfreeAG      = ble.UUID16(0x111F)
+)
+
+// Record is a service record, the values of its attributes by attribute ID [Vol 3, Part B, 2.2]. The values are
+// the Go values of their data elements, as described by the element package.
+type Record map[uint16]interface{}
+
+// ProtocolDescriptor is a protocol of a protocol descriptor list, and its parameters [Vol 3, Part B, 5.1.5].
+type ProtocolDescriptor struct {
+	Protocol ble.UUID
+	Params   []interface{}
+}
+
+// ProfileDescriptor is a profile a service conforms to, and its version [Vol 3, Part B, 5.1.11].
+type ProfileDescriptor struct {
+	Profile ble.UUID
+	Version uint16
+}
+
+// Handle returns the service record handle of the record.
+func (r Record) Handle() (uint32, bool) {
+	h, ok := r[AttrServiceRecordHandle].(uint32)
+	return h, ok
+}
+
+// ServiceClassIDs returns the service classes the record is an instance of, the most specific first.
+func (r Record) ServiceClassIDs() []ble.UUID {
+	return uuids(r[AttrServiceClassIDList])
+}
+
+// BrowseGroups returns the browse groups the record belongs to.
+func (r Record) BrowseGroups() []ble.UUID {
+	return uuids(r[AttrBrowseGroupList])
+}
+
+// ProtocolDescriptors returns the protocol stack of the service, the lowest layer first. It only returns the first
+// stack of the records listing alternative ones.
+func (r Record) ProtocolDescriptors() []ProtocolDescriptor {
+	v := r[AttrProtocolDescriptorList]
+	if alt, ok := v.(element.Alternative); ok && len(alt) > 0 {
+		v = alt[0]
+	}
+	seq, _ := v.(element.Sequence)
+	var pds []ProtocolDescriptor
+	for _, p := range seq {
+		p, ok := p.(element.Sequence)
+		if !ok || len(p) == 0 {
+			continue
+		}
+		u, err := element.ToUUID(p[0])
+		if err != nil {
+			continue
+		}
+		pds = append(pds, ProtocolDescriptor{Protocol: u, Params: p[1:]})
+	}
+	return pds
+}
+
+// ProfileDescriptors returns the profiles the service conforms to.
+func (r Record) ProfileDescriptors() []ProfileDescriptor {
+	seq, _ := r[AttrBluetoothProfileDescriptorList].(element.Sequence)
+	var pds []ProfileDescriptor
+	for _, p := range seq {
+		p, ok := p.(element.Sequence)
+		if !ok || len(p) != 2 {
+			continue
+		}
+		u, err := element.ToUUID(p[0])
+		if err != nil {
+			continue
+		}
+		v, _ := p[1].(uint16)
+		pds = append(pds, ProfileDescriptor{Profile: u, Version: v})
+	}
+	return pds
+}
+
+// RFCOMMChannel returns the RFCOMM server channel of the service.
+func (r Record) RFCOMMChannel() (uint8, bool) {
+	for _, pd := range r.ProtocolDescriptors() {
+		if pd.Protocol.Equal(ProtocolRFCOMM) && len(pd.Params) > 0 {
+			ch, ok := pd.Params[0].(uint8)
+			return ch, ok
+		}
+	}
+	return 0, false
+}
+
+// L2CAPPSM returns the PSM of the service, when the service is reached directly over an L2CAP channel.
+func (r Record) L2CAPPSM() (uint16, bool) {
+	for _, pd := range r.ProtocolDescriptors() {
+		if pd.Protocol.Equal(ProtocolL2CAP) && len(pd.Params) > 0 {
+			psm, ok := pd.Params[0].(uint16)
+			return psm, ok
+		}
+	}
+	return 0, false
+}
+
+// ServiceName returns the name of the service in the primary language.
+func (r Record) ServiceName() (string, bool) {
+	s, ok := r[AttrPrimaryLanguageBase+AttrServiceNameOffset].(string)
+	return s, ok
+}
+
+// ServiceDescription returns the description of the service in the primary language.
+func (r Record) ServiceDescription() (string, bool) {
+	s, ok := r[AttrPrimaryLanguageBase+AttrServiceDescriptionOffset].(string)
+	return s, ok
+}
+
+// ProviderName returns the name of the provider of the service in the primary language.
+func (r Record) ProviderName() (string, bool) {
+	s, ok := r[AttrPrimaryLanguageBase+AttrProviderNameOffset].(string)
+	return s, ok
+}
+
+func uuids(v interface{}) []ble.UUID {
+	seq, _ := v.(element.Sequence)
+	var us []ble.UUID
+	for _, e := range seq {
+		if u, err := element.ToUUID(e); err == nil {
+			us = append(us, u)
+		}
+	}
+	return us
+}
+
+// parseAttributeList returns the record of the attribute list, a sequence of attribute IDs followed by their values
+// [Vol 3, Part B, 4.6.2].
+func parseAttributeList(v interface{}) (Record, error) {
+	seq, ok := v.(element.Sequence)
+	if !ok || len(seq)%2 != 0 {
+		return nil, fmt.Errorf("invalid attribute list")
+	}
+	r := make(Record, len(seq)/2)
+	for i := 0; i < len(seq); i += 2 {
+		id, ok := seq[i].(uint16)
+		if !ok {
+			return nil, fmt.Errorf("invalid attribute id %v", seq[i])
+		}
+		r[id] = seq[i+1]
+	}
+	return r, nil
+}
+
+// attributeNames are the names of the universal attributes, and of the attributes of the primary language.
+var attributeNames = map[uint16]string{
+	AttrServiceRecordHandle:                                "ServiceRecordHandle",
+	AttrServiceClassIDList:                                 "ServiceClassIDList",
+	AttrServiceRecordState:                                 "ServiceRecordState",
+	AttrServiceID:                                          "ServiceID",
+	AttrProtocolDescriptorList:                             "ProtocolDescriptorList",
+	AttrBrowseGroupList:                                    "BrowseGroupList",
+	AttrLanguageBaseAttributeIDList:                        "LanguageBaseAttributeIDList",
+	AttrServiceInfoTimeToLive:                              "ServiceInfoTimeToLive",
+	AttrServiceAvailability:                                "ServiceAvailability",
+	AttrBluetoothProfileDescriptorList:                     "BluetoothProfileDescriptorList",
+	AttrDocumentationURL:                                   "DocumentationURL",
+	AttrClientExecutableURL:                                "ClientExecutableURL",
+	AttrIconURL:                                            "IconURL",
+	AttrAdditionalProtocolDescriptorLists:                  "AdditionalProtocolDescriptorLists",
+	AttrPrimaryLanguageBase + AttrServiceNameOffset:        "ServiceName",
+	AttrPrimaryLanguageBase + AttrServiceDescriptionOffset: "ServiceDescription",
+	AttrPrimaryLanguageBase + AttrProviderNameOffset:       "ProviderName",
+}
+
+// String returns the attributes of the record by ascending attribute ID, one per line.
+func (r Record) String() string {
+	ids := make([]uint16, 0, len(r))
+	for id := range r {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var sb strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&sb, "0x%04X", id)
+		if name, ok := attributeNames[id]; ok {
+			fmt.Fprintf(&sb, " %s", name)
+		}
+		fmt.Fprintf(&sb, ": %s\n", element.FormatValue(r[id]))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,117 @@
+// Package sdp implements the Service Discovery Protocol [Vol 3, Part B].
+package sdp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thomascriley/ble/linux/sdp/element"
+)
+
+// PSM is the protocol/service multiplexer of SDP [Assigned Numbers, 2.2].
+const PSM = 0x0001
+
+// PDU IDs [Vol 3, Part B, 4.2].
+const (
+	pduErrorResponse                  = 0x01
+	pduServiceSearchRequest           = 0x02
+	pduServiceSearchResponse          = 0x03
+	pduServiceAttributeRequest        = 0x04
+	pduServiceAttributeResponse       = 0x05
+	pduServiceSearchAttributeRequest  = 0x06
+	pduServiceSearchAttributeResponse = 0x07
+)
+
+const (
+	// headerLen is the size of the PDU header: the PDU ID, the transaction ID and the parameter length.
+	headerLen = 5
+
+	// maxContinuationLen is the size of the largest continuation state [Vol 3, Part B, 4.3].
+	maxContinuationLen = 16
+
+	// maxSearchPattern is the largest number of UUIDs a service search pattern holds [Vol 3, Part B, 4.5].
+	maxSearchPattern = 12
+
+	// minAttributeByteCount is the smallest maximum attribute byte count of the requests [Vol 3, Part B, 4.6.1].
+	minAttributeByteCount = 0x0007
+)
+
+// Error is the error code of an error response [Vol 3, Part B, 4.4.1].
+type Error uint16
+
+// Error codes.
+const (
+	ErrInvalidVersion           Error = 0x0001
+	ErrInvalidRecordHandle      Error = 0x0002
+	ErrInvalidSyntax            Error = 0x0003
+	ErrInvalidPDUSize           Error = 0x0004
+	ErrInvalidContinuationState Error = 0x0005
+	ErrInsufficientResources    Error = 0x0006
+)
+
+func (e Error) Error() string {
+	switch e {
+	case ErrInvalidVersion:
+		return "invalid/unsupported SDP version"
+	case ErrInvalidRecordHandle:
+		return "invalid service record handle"
+	case ErrInvalidSyntax:
+		return "invalid request syntax"
+	case ErrInvalidPDUSize:
+		return "invalid PDU size"
+	case ErrInvalidContinuationState:
+		return "invalid continuation state"
+	case ErrInsufficientResources:
+		return "insufficient resources to satisfy request"
+	default:
+		return fmt.Sprintf("sdp error (0x%04X)", uint16(e))
+	}
+}
+
+// AttributeRange is a range of attribute IDs, from Start to End inclusive.
+type AttributeRange struct {
+	Start uint16
+	End   uint16
+}
+
+// AllAttributes is the range of all the attribute IDs.
+var AllAttributes = AttributeRange{Start: 0x0000, End: 0xFFFF}
+
+// Attribute returns the range of the single attribute ID.
+func Attribute(id uint16) AttributeRange { return AttributeRange{Start: id, End: id} }
+
+// attributeIDList returns the attribute ID list of the ranges, the single attribute IDs as 16-bit unsigned integers
+// and the others as 32-bit ones [Vol 3, Part B, 4.6.1].
+func attributeIDList(ranges []AttributeRange) element.Sequence {
+	l := make(element.Sequence, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Start == r.End {
+			l = append(l, r.Start)
+		} else {
+			l = append(l, uint32(r.Start)<<16|uint32(r.End))
+		}
+	}
+	return l
+}
+
+// appendContinuation appends the continuation state to b.
+func appendContinuation(b []byte, cont []byte) []byte {
+	return append(append(b, uint8(len(cont))), cont...)
+}
+
+// continuation returns the continuation state ending the parameters b.
+func continuation(b []byte) ([]byte, error) {
+	if len(b) < 1 || int(b[0]) > maxContinuationLen || int(b[0]) != len(b)-1 {
+		return nil, fmt.Errorf("invalid continuation state")
+	}
+	return append([]byte(nil), b[1:]...), nil
+}
+
+// pdu returns the PDU of the parameters.
+func pdu(id uint8, tid uint16, params []byte) []byte {
+	b := make([]byte, headerLen, headerLen+len(params))
+	b[0] = id
+	binary.BigEndian.PutUint16(b[1:3], tid)
+	binary.BigEndian.PutUint16(b[3:5], uint16(len(params)))
+	return append(b, params...)
+}
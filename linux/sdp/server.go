@@ -0,0 +1,401 @@
+package sdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/thomascriley/ble"
+	"github.com/thomascriley/ble/linux/rfcomm"
+	"github.com/thomascriley/ble/linux/sdp/element"
+)
+
+const (
+	// sdpServerHandle is the handle of the record of the SDP server itself [Vol 3, Part B, 2.2].
+	sdpServerHandle uint32 = 0x00000000
+
+	// firstHandle is the first handle allocated to the records registered, the lower ones being reserved.
+	firstHandle uint32 = 0x00010000
+
+	// continuationLen is the size of the continuation states of the server, the offset of the next part.
+	continuationLen = 4
+)
+
+// Server answers the requests of the SDP clients from a registry of service records [Vol 3, Part B, 2.1].
+type Server struct {
+	mu       sync.RWMutex
+	records  map[uint32]Record
+	channels map[uint32]uint8
+	next     uint32
+}
+
+// NewServer returns a server holding the record of the SDP server itself.
+func NewServer() *Server {
+	r, _ := NewRecord("", []ble.UUID{sdpServer}, nil, nil)
+	r[AttrServiceRecordHandle] = sdpServerHandle
+	r[AttrSDPVersionNumberList] = element.Sequence{uint16(0x0100)}
+	return &Server{
+		records:  map[uint32]Record{sdpServerHandle: r},
+		channels: map[uint32]uint8{},
+		next:     firstHandle,
+	}
+}
+
+// Register adds the record, and returns the handle allocated to it. The attributes of r are copied, so the attributes
+// added or removed later are not published.
+func (s *Server) Register(r Record) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.register(r)
+}
+
+func (s *Server) register(r Record) (uint32, error) {
+	c := make(Record, len(r)+1)
+	for id, v := range r {
+		if _, ok := element.TypeOf(v); !ok {
+			return 0, fmt.Errorf("attribute 0x%04X: unsupported value %T", id, v)
+		}
+		c[id] = v
+	}
+	h := s.next
+	for _, ok := s.records[h]; ok; _, ok = s.records[h] {
+		if h++; h < firstHandle {
+			h = firstHandle
+		}
+	}
+	c[AttrServiceRecordHandle] = h
+	s.records[h], s.next = c, h+1
+	return h, nil
+}
+
+// RegisterRFCOMM allocates an RFCOMM server channel, and registers the record f returns for it, such as a
+// SerialPortRecord. The server channel is released once the record is unregistered.
+func (s *Server) RegisterRFCOMM(f func(channel uint8) Record) (handle uint32, channel uint8, err error) {
+	if channel, err = rfcomm.AllocServerChannel(); err != nil {
+		return 0, 0, err
+	}
+	r := f(channel)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if handle, err = s.register(r); err != nil {
+		rfcomm.ReleaseServerChannel(channel)
+		return 0, 0, err
+	}
+	s.channels[handle] = channel
+	return handle, channel, nil
+}
+
+// Unregister removes the record.
+func (s *Server) Unregister(handle uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[handle]; !ok || handle == sdpServerHandle {
+		return ErrInvalidRecordHandle
+	}
+	delete(s.records, handle)
+	if channel, ok := s.channels[handle]; ok {
+		rfcomm.ReleaseServerChannel(channel)
+		delete(s.channels, handle)
+	}
+	return nil
+}
+
+// Serve answers the requests received on rw, whose largest PDUs received and sent are rxMTU and txMTU bytes, until
+// reading it fails. It returns nil once rw returns io.EOF.
+func (s *Server) Serve(rw io.ReadWriter, rxMTU, txMTU int) error {
+	b := make([]byte, rxMTU)
+	for {
+		n, err := rw.Read(b)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n < headerLen {
+			continue
+		}
+		if _, err = rw.Write(s.handle(b[:n], txMTU)); err != nil {
+			return fmt.Errorf("unable to send response: %w", err)
+		}
+	}
+}
+
+// handle returns the response to the request.
+func (s *Server) handle(b []byte, txMTU int) []byte {
+	id, tid, params := b[0], binary.BigEndian.Uint16(b[1:3]), b[headerLen:]
+	if int(binary.BigEndian.Uint16(b[3:5])) != len(params) {
+		return errorResponse(tid, ErrInvalidPDUSize)
+	}
+
+	var rsp []byte
+	var err error
+	switch id {
+	case pduServiceSearchRequest:
+		rsp, err = s.serviceSearch(params, txMTU)
+	case pduServiceAttributeRequest, pduServiceSearchAttributeRequest:
+		rsp, err = s.attributes(id, params, txMTU)
+	default:
+		err = ErrInvalidSyntax
+	}
+	var e Error
+	switch {
+	case errors.As(err, &e):
+		return errorResponse(tid, e)
+	case err != nil:
+		return errorResponse(tid, ErrInvalidSyntax)
+	}
+	return pdu(id+1, tid, rsp)
+}
+
+func errorResponse(tid uint16, e Error) []byte {
+	return pdu(pduErrorResponse, tid, binary.BigEndian.AppendUint16(nil, uint16(e)))
+}
+
+// serviceSearch answers a service search request [Vol 3, Part B, 4.5].
+func (s *Server) serviceSearch(params []byte, txMTU int) ([]byte, error) {
+	pattern, params, err := parseSearchPattern(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) < 2 {
+		return nil, ErrInvalidSyntax
+	}
+	max := int(binary.BigEndian.Uint16(params))
+	offset, err := parseContinuation(params[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	handles := s.search(pattern)
+	if len(handles) > max {
+		handles = handles[:max]
+	}
+	if offset > len(handles) {
+		return nil, ErrInvalidContinuationState
+	}
+	count := (txMTU - headerLen - 4 - 1 - continuationLen) / 4
+	if count > len(handles)-offset {
+		count = len(handles) - offset
+	}
+	rsp := binary.BigEndian.AppendUint16(nil, uint16(len(handles)))
+	rsp = binary.BigEndian.AppendUint16(rsp, uint16(count))
+	for _, h := range handles[offset : offset+count] {
+		rsp = binary.BigEndian.AppendUint32(rsp, h)
+	}
+	return appendServerContinuation(rsp, offset+count, len(handles)), nil
+}
+
+// attributes answers a service attribute or service search attribute request [Vol 3, Part B, 4.6 and 4.7].
+func (s *Server) attributes(id uint8, params []byte, txMTU int) ([]byte, error) {
+	// The record of a service attribute request, or the pattern of a service search attribute request.
+	var r Record
+	var pattern []ble.UUID
+	var err error
+	if id == pduServiceAttributeRequest {
+		if len(params) < 4 {
+			return nil, ErrInvalidSyntax
+		}
+		var ok bool
+		s.mu.RLock()
+		r, ok = s.records[binary.BigEndian.Uint32(params)]
+		s.mu.RUnlock()
+		if !ok {
+			return nil, ErrInvalidRecordHandle
+		}
+		params = params[4:]
+	} else if pattern, params, err = parseSearchPattern(params); err != nil {
+		return nil, err
+	}
+	if len(params) < 2 {
+		return nil, ErrInvalidSyntax
+	}
+	max := int(binary.BigEndian.Uint16(params))
+	if max < minAttributeByteCount {
+		return nil, ErrInvalidSyntax
+	}
+	ranges, params, err := parseAttributeIDList(params[2:])
+	if err != nil {
+		return nil, err
+	}
+	offset, err := parseContinuation(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if r != nil {
+		v = attributeList(r, ranges)
+	} else {
+		seq := element.Sequence{}
+		s.mu.RLock()
+		for _, h := range s.searchLocked(pattern) {
+			seq = append(seq, attributeList(s.records[h], ranges))
+		}
+		s.mu.RUnlock()
+		v = seq
+	}
+	b, err := element.Marshal(v)
+	if err != nil {
+		return nil, ErrInsufficientResources
+	}
+	if offset > len(b) {
+		return nil, ErrInvalidContinuationState
+	}
+	if n := txMTU - headerLen - 2 - 1 - continuationLen; n < max {
+		max = n
+	}
+	if max > len(b)-offset {
+		max = len(b) - offset
+	}
+	rsp := binary.BigEndian.AppendUint16(nil, uint16(max))
+	rsp = append(rsp, b[offset:offset+max]...)
+	return appendServerContinuation(rsp, offset+max, len(b)), nil
+}
+
+// search returns the handles of the records holding all the UUIDs of the pattern, in ascending order.
+func (s *Server) search(pattern []ble.UUID) []uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.searchLocked(pattern)
+}
+
+func (s *Server) searchLocked(pattern []ble.UUID) []uint32 {
+	var handles []uint32
+	for h, r := range s.records {
+		if r.contains(pattern) {
+			handles = append(handles, h)
+		}
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+	return handles
+}
+
+// contains reports whether the record holds all the UUIDs, in the values of any of its attributes
+// [Vol 3, Part B, 2.5.2].
+func (r Record) contains(pattern []ble.UUID) bool {
+	var us []ble.UUID
+	for _, v := range r {
+		us = appendUUIDs(us, v)
+	}
+	for _, u := range pattern {
+		found := false
+		for _, v := range us {
+			if v.Equal(u) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func appendUUIDs(us []ble.UUID, v interface{}) []ble.UUID {
+	switch v := v.(type) {
+	case element.UUID16, element.UUID32, element.UUID128:
+		if u, err := element.ToUUID(v); err == nil {
+			us = append(us, u)
+		}
+	case element.Sequence:
+		for _, e := range v {
+			us = appendUUIDs(us, e)
+		}
+	case element.Alternative:
+		for _, e := range v {
+			us = appendUUIDs(us, e)
+		}
+	}
+	return us
+}
+
+// attributeList returns the attribute list of the attributes of the record in the ranges, by ascending attribute ID.
+func attributeList(r Record, ranges []AttributeRange) element.Sequence {
+	ids := make([]uint16, 0, len(r))
+	for id := range r {
+		for _, rg := range ranges {
+			if id >= rg.Start && id <= rg.End {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	l := make(element.Sequence, 0, 2*len(ids))
+	for _, id := range ids {
+		l = append(l, id, r[id])
+	}
+	return l
+}
+
+// parseSearchPattern returns the UUIDs of the service search pattern at the start of b, and the bytes after it.
+func parseSearchPattern(b []byte) ([]ble.UUID, []byte, error) {
+	v, n, err := element.Unmarshal(b)
+	if err != nil {
+		return nil, nil, ErrInvalidSyntax
+	}
+	seq, ok := v.(element.Sequence)
+	if !ok || len(seq) == 0 || len(seq) > maxSearchPattern {
+		return nil, nil, ErrInvalidSyntax
+	}
+	pattern := make([]ble.UUID, 0, len(seq))
+	for _, e := range seq {
+		u, err := element.ToUUID(e)
+		if err != nil {
+			return nil, nil, ErrInvalidSyntax
+		}
+		pattern = append(pattern, u)
+	}
+	return pattern, b[n:], nil
+}
+
+// parseAttributeIDList returns the ranges of the attribute ID list at the start of b, and the bytes after it.
+func parseAttributeIDList(b []byte) ([]AttributeRange, []byte, error) {
+	v, n, err := element.Unmarshal(b)
+	if err != nil {
+		return nil, nil, ErrInvalidSyntax
+	}
+	seq, ok := v.(element.Sequence)
+	if !ok || len(seq) == 0 {
+		return nil, nil, ErrInvalidSyntax
+	}
+	ranges := make([]AttributeRange, 0, len(seq))
+	for _, e := range seq {
+		switch e := e.(type) {
+		case uint16:
+			ranges = append(ranges, Attribute(e))
+		case uint32:
+			ranges = append(ranges, AttributeRange{Start: uint16(e >> 16), End: uint16(e)})
+		default:
+			return nil, nil, ErrInvalidSyntax
+		}
+	}
+	return ranges, b[n:], nil
+}
+
+// parseContinuation returns the offset of the continuation state of the server, 0 for the first request.
+func parseContinuation(b []byte) (int, error) {
+	cont, err := continuation(b)
+	switch {
+	case err != nil:
+		return 0, ErrInvalidSyntax
+	case len(cont) == 0:
+		return 0, nil
+	case len(cont) != continuationLen:
+		return 0, ErrInvalidContinuationState
+	}
+	return int(binary.BigEndian.Uint32(cont)), nil
+}
+
+// appendServerContinuation appends the continuation state of the next part, empty once the last part is sent.
+func appendServerContinuation(b []byte, next, total int) []byte {
+	if next >= total {
+		return appendContinuation(b, nil)
+	}
+	return appendContinuation(b, binary.BigEndian.AppendUint32(nil, uint32(next)))
+}
@@ -0,0 +1,62 @@
+package sdp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thomascriley/ble"
+)
+
+func TestServerRFCOMMRecord(t *testing.T) {
+	s := NewServer()
+	handle, channel, err := s.RegisterRFCOMM(func(channel uint8) Record {
+		return SerialPortRecord("Serial Port", channel)
+	})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	local, remote := newSDUPipe()
+	defer local.Close()
+	go func() {
+		defer remote.Close()
+		_ = s.Serve(remote, 48, 48)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The small MTU splits the attribute lists in several responses.
+	c := NewClient(local, 48, 48)
+	handles, err := c.ServiceSearch(ctx, []ble.UUID{SerialPort, ProtocolRFCOMM})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(handles) != 1 || handles[0] != handle {
+		t.Fatalf("Expected: %X, Received: %X", []uint32{handle}, handles)
+	}
+	recs, err := c.ServiceSearchAttribute(ctx, []ble.UUID{SerialPort})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("Expected: 1 record, Received: %d", len(recs))
+	}
+	if ch, _ := recs[0].RFCOMMChannel(); ch != channel {
+		t.Fatalf("Expected: %d, Received: %d", channel, ch)
+	}
+	if name, _ := recs[0].ServiceName(); name != "Serial Port" {
+		t.Fatalf("Expected: %s, Received: %s", "Serial Port", name)
+	}
+
+	if err = s.Unregister(handle); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if _, err = c.ServiceAttribute(ctx, handle); err != ErrInvalidRecordHandle {
+		t.Fatalf("Expected: %v, Received: %v", ErrInvalidRecordHandle, err)
+	}
+	if handles, err = c.ServiceSearch(ctx, []ble.UUID{SerialPort}); err != nil || len(handles) != 0 {
+		t.Fatalf("Expected: no handles, Received: %X, %v", handles, err)
+	}
+}
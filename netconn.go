@@ -0,0 +1,84 @@
+package ble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// NetAddr is the address of an end point of a Bluetooth channel, as a net.Addr.
+type NetAddr struct {
+	// Addr is the address of the device.
+	Addr Addr
+
+	// Net is the protocol of the channel, "l2cap" or "rfcomm".
+	Net string
+
+	// Port is the PSM of an L2CAP channel, or the server channel of an RFCOMM one. It is 0 for the fixed channels.
+	Port int
+}
+
+// Network returns the protocol of the channel.
+func (a NetAddr) Network() string { return a.Net }
+
+// String returns the address of the device, and the port if any, as net.JoinHostPort joins them.
+func (a NetAddr) String() string {
+	if a.Addr == nil {
+		return ""
+	}
+	if a.Port == 0 {
+		return a.Addr.String()
+	}
+	return net.JoinHostPort(a.Addr.String(), strconv.Itoa(a.Port))
+}
+
+// netConnCloseTimeout bounds the disconnection of the connections closed through NetConn.
+const netConnCloseTimeout = 15 * time.Second
+
+// deadliner is implemented by the connections supporting deadlines.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// NetConn returns the connection as a net.Conn. The deadlines are only supported if the connection implements them,
+// the channels of the library do; otherwise setting them returns ErrNotImplemented.
+func NetConn(c Conn) net.Conn {
+	return &netConn{Conn: c}
+}
+
+type netConn struct {
+	Conn
+}
+
+func (c *netConn) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), netConnCloseTimeout)
+	defer cancel()
+	return c.Conn.Close(ctx)
+}
+
+func (c *netConn) LocalAddr() net.Addr  { return NetAddr{Addr: c.Conn.LocalAddr(), Net: "l2cap"} }
+func (c *netConn) RemoteAddr() net.Addr { return NetAddr{Addr: c.Conn.RemoteAddr(), Net: "l2cap"} }
+
+func (c *netConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.SetReadDeadline(t), c.SetWriteDeadline(t))
+}
+
+func (c *netConn) SetReadDeadline(t time.Time) error {
+	d, ok := c.Conn.(deadliner)
+	if !ok {
+		return fmt.Errorf("read deadline: %w", ErrNotImplemented)
+	}
+	return d.SetReadDeadline(t)
+}
+
+func (c *netConn) SetWriteDeadline(t time.Time) error {
+	d, ok := c.Conn.(deadliner)
+	if !ok {
+		return fmt.Errorf("write deadline: %w", ErrNotImplemented)
+	}
+	return d.SetWriteDeadline(t)
+}
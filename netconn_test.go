@@ -0,0 +1,30 @@
+package ble
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNetAddr(t *testing.T) {
+	tests := []struct {
+		addr NetAddr
+		s    string
+	}{
+		{NetAddr{Addr: NewAddr("00:11:22:33:44:55"), Net: "rfcomm", Port: 3}, "[00:11:22:33:44:55]:3"},
+		{NetAddr{Addr: NewAddr("00:11:22:33:44:55"), Net: "l2cap"}, "00:11:22:33:44:55"},
+		{NetAddr{Net: "l2cap"}, ""},
+	}
+	for _, tt := range tests {
+		if tt.addr.String() != tt.s {
+			t.Fatalf("Expected: %s, Received: %s", tt.s, tt.addr.String())
+		}
+	}
+}
+
+func TestNetConnDeadline(t *testing.T) {
+	c := NetConn(struct{ Conn }{})
+	if err := c.SetDeadline(time.Now()); !errors.Is(err, ErrNotImplemented) {
+		t.Fatalf("Expected: %s, Received: %v", ErrNotImplemented, err)
+	}
+}